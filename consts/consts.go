@@ -6,9 +6,15 @@ const (
 	TimeFormatSecond = "2006-01-02 15:04:05"
 	TimeFormatLog    = "2006-01-02T15"
 
-	MethodPrecreate = "precreate"
-	MethodUpload    = "upload"
-	MethodCreate    = "create"
+	MethodPrecreate   = "precreate"
+	MethodUpload      = "upload"
+	MethodCreate      = "create"
+	MethodUinfo       = "uinfo"
+	MethodQuota       = "quota"
+	MethodFileManager = "filemanager"
+	MethodList        = "list"
+	MethodFileMetas   = "filemetas"
+	MethodDownload    = "download"
 
 	AutoInitConstant = 1
 
@@ -16,6 +22,19 @@ const (
 	Size16MB = 16 * 1024 * 1024
 	Size32MB = 32 * 1024 * 1024
 
+	// 单个文件的大小上限，超过时拆分成多个部分上传
+	MaxFileSizeNormal = 4 * 1024 * 1024 * 1024  // 普通用户4GB
+	MaxFileSizeVip    = 10 * 1024 * 1024 * 1024 // 普通会员10GB
+	MaxFileSizeSVip   = 20 * 1024 * 1024 * 1024 // 超级会员20GB
+
+	PartNameFormat  = "%s.part%03d" // 拆分后每个部分的文件名，序号从1开始
+	ManifestSuffix  = ".manifest"   // 拆分上传的清单文件后缀
+	ManifestVersion = 1
+
+	VipTypeNormal = 0 // 普通用户，分片大小4MB
+	VipTypeVip    = 1 // 普通会员，分片大小16MB
+	VipTypeSVip   = 2 // 超级会员，分片大小32MB
+
 	ZipQuality50  = 50
 	ZipQuality70  = 70
 	ZipQuality100 = 100
@@ -42,10 +61,15 @@ const (
 	RTypeBlockListRename = 2 // 如果存在同名文件且blockList不同是进行重命名
 	RTypeOverride        = 3 // 如果存在同名文件进行覆盖
 
-	ErrnoSuccess            = 0  // 返回成功的错误码
-	ErrnoAccessTokenInvalid = -6 // access_token失效的错误吗
+	ReturnTypeNotExist = 1 // 文件在云端不存在
+	ReturnTypeExist    = 2 // 文件在云端已存在，即秒传成功
 
-	MaxRetryCount = 3 // 最大上传次数
+	ErrnoSuccess            = 0   // 返回成功的错误码
+	ErrnoAccessTokenInvalid = -6  // access_token失效的错误吗
+	ErrnoSpaceFull          = -10 // 网盘容量已满的错误码
+
+	MaxRetryCount      = 3 // 最大上传次数
+	MaxQueueRetryCount = 3 // 上传队列中失败文件的最大自动重试次数
 )
 
 const (
@@ -60,6 +84,100 @@ const (
 	EmptyUploadCount   = 0
 	DefaultUploadCount = 3
 	MaxUploadCount     = 10
+
+	UploadOrderKey        = "upload_order"
+	UploadOrderFIFO       = "fifo"     // 按入队顺序上传
+	UploadOrderSmallest   = "smallest" // 小文件优先
+	UploadOrderNewest     = "newest"   // 最近修改的文件优先
+	UploadInterleaveKey   = "upload_interleave"
+	LargeFileThresholdKey = "large_file_threshold" // 大文件阈值，单位MB
+	DefaultLargeFileMB    = 100
+
+	ChunkSizeKey  = "chunk_size" // 分片大小，单位MB，auto表示根据会员等级自动选择
+	ChunkSizeAuto = "auto"
+
+	HashBufferCountKey     = "hash_buffer_count" // 计算md5时最多同时使用的缓冲区数量，每个4MB，上传分片直接从文件读取不占用缓冲区
+	DefaultHashBufferCount = 16
+	MaxHashBufferCount     = 100
+
+	QuietPeriodKey     = "quiet_period" // 文件最后一次修改后需要等待的时间，单位秒，0表示不等待
+	DefaultQuietPeriod = 60
+
+	QuotaLowWaterKey     = "quota_low_water" // 网盘剩余空间低于这个值时提醒，单位GB，0表示不提醒
+	DefaultQuotaLowWater = 10
+
+	PackThresholdKey     = "pack_threshold" // 小于这个大小的文件打包上传，单位KB
+	DefaultPackThreshold = 1024
+	BundleName           = ".backup_bundle.tar" // 打包文件在网盘中的文件名，每个目录一个
+	BundleDir            = "bundles"            // 打包文件在本地的缓存目录
+
+	CompressGzip       = "gzip" // 上传前使用gzip压缩
+	CompressSuffixGzip = ".gz"  // gzip压缩后在网盘中的文件后缀
+	CompressZstd       = "zstd" // 上传前使用zstd压缩，压缩和解压比gzip快，压缩率更高
+	CompressSuffixZstd = ".zst" // zstd压缩后在网盘中的文件后缀
+
+	AlbumRoot       = "/相册"     // 媒体备份模式下照片和视频在网盘中的根目录
+	AlbumDateLayout = "2006/01" // 按拍摄时间的年月组织目录
+
+	AppDirName     = "backup"   // 用户配置目录下本程序的目录名
+	DBFileName     = "files.db" // 数据库文件名
+	DBBusyTimeout  = 5000       // 数据库被其他连接锁住时的等待时间，单位毫秒
+	DBMaxOpenConns = 4          // 数据库最大连接数，WAL模式下同时只有一个连接可以写入
+	EnvPrefix      = "backup"   // 环境变量前缀，例如BACKUP_DATABASE_PATH
+
+	CatalogDir             = "/.backup_catalog" // 目录备份在网盘中的保留目录
+	CatalogName            = "catalog.tar.gz"   // 目录备份的文件名，网盘中保留历史版本
+	CatalogIntervalKey     = "catalog_interval" // 目录备份的间隔，单位小时，0表示不备份
+	DefaultCatalogInterval = 24
+	CatalogEncryptKey      = "catalog_encrypt"  // 目录备份是否加密，密码不保存在配置文件中
+	CatalogPasswordKey     = "catalog_password" // 以前版本明文保存的目录备份密码，启动时移到内存中并从配置文件中删除
+
+	RestoreDir         = "restore" // 批量恢复时下载的临时文件目录，在数据库所在目录下
+	RestoreWorkerCount = 8         // 批量恢复同时下载的文件数
+	RestoreBatchSize   = 1000      // 批量恢复时每次从数据库读取的文件数
+
+	VersionDir = "/.backup_versions" // 文件被覆盖前，快照中引用的旧内容复制到这个目录
+
+	GuardChangeRatioKey     = "guard_change_ratio" // 一次扫描中修改的文件超过已有文件的这个百分比时暂停上传，0表示不检查
+	DefaultGuardChangeRatio = 30
+	GuardMinChanged         = 20   // 修改的文件少于这个数量时不按比例判断，防止文件很少的目录误报
+	GuardEntropyJumps       = 10   // 信息熵突然升高的文件达到这个数量时暂停上传
+	GuardExtensionHits      = 5    // 勒索软件扩展名的文件达到这个数量时暂停上传，个别同名扩展名的正常文件不会误报
+	GuardLowEntropy         = 6.0  // 修改前的信息熵低于这个值，说明原来不是压缩或者加密的内容
+	GuardHighEntropy        = 7.8  // 修改后的信息熵高于这个值，内容接近随机数据
+	GuardEntropyMinSize     = 4096 // 小于这个大小的文件信息熵不准确，不参与判断
+
+	NotificationKey  = "notification" // 通知渠道的配置
+	DefaultStaleDays = 3              // 超过这么多天没有成功的备份时提醒
+	BotTypeDingTalk  = "dingtalk"     // 钉钉群机器人
+	BotTypeWeCom     = "wecom"        // 企业微信群机器人
+)
+
+// RansomwareExtensions 常见勒索软件加密后的文件扩展名，只包含勒索软件特有的扩展名
+// .enc、.crypt、.wallet这类正常软件也会使用的扩展名容易误报，不包含在内
+var RansomwareExtensions = []string{
+	".locked", ".encrypted", ".crypted", ".crinf", ".locky", ".zepto", ".cerber", ".cerber3", ".wncry", ".wcry",
+	".wnry", ".ryk", ".ryuk", ".conti", ".lockbit", ".djvu", ".phobos", ".makop", ".dharma", ".petya", ".zzzzz",
+}
+
+// 通知的事件类型
+const (
+	EventRunFinish   = "run_finish"   // 备份路径的一次运行完成
+	EventRunFail     = "run_fail"     // 扫描出错或者有文件上传失败
+	EventTokenExpire = "token_expire" // access_token失效并且刷新失败
+	EventQuotaFull   = "quota_full"   // 网盘空间已满，全部暂停
+	EventQuotaLow    = "quota_low"    // 网盘剩余空间低于提醒阈值
+	EventSuspend     = "suspend"      // 疑似勒索软件加密，暂停备份路径的上传
+	EventUploadFail  = "upload_fail"  // 文件多次上传失败，不再自动重试
+	EventNoBackup    = "no_backup"    // 连续多天没有成功的备份
+)
+
+// 备份路径优先级，优先级高的备份路径中的文件优先上传
+const (
+	BackupPriorityLow      = -1 // 低
+	BackupPriorityNormal   = 0  // 普通
+	BackupPriorityHigh     = 1  // 高
+	BackupPriorityVeryHigh = 2  // 最高
 )
 
 // 日志相关信息
@@ -68,9 +186,16 @@ const (
 	LogSpanId     = TraceKey("span_id")
 	LogTimeLayout = "2006-01-02 15:04:05.000-07:00"
 
+	LevelDebug = "debug"
 	LevelInfo  = "info"
 	LevelWarn  = "warn"
 	LevelError = "error"
+
+	LogFormatText = "text"      // 默认的[级别][时间][调用位置] k=v||k=v格式
+	LogFormatJson = "json"      // 每行一个JSON对象，便于日志采集
+	LogLevelKey   = "log_level" // 在界面中修改的日志级别，保存在上传配置中
+	LogTailLimit  = 500         // 查看日志时默认返回的行数
+	MaxLogTail    = 5000        // 查看日志时最多返回的行数
 )
 
 // 文件上传状态
@@ -81,6 +206,7 @@ const (
 	UploadStatusUploading           // 上传中
 	UploadStatusUploaded            // 上传完成
 	UploadStatusFail                // 上传失败
+	UploadStatusPaused              // 暂停上传
 )
 
 const (
@@ -88,6 +214,9 @@ const (
 	UploadSuccessText = "上传成功"
 	WaitUploadText    = "等待上传"
 	StartUploadText   = "开始上传"
+	PausedUploadText  = "已暂停"
+	WaitQuietText     = "等待文件停止修改"
+	SpaceFullText     = "网盘空间不足"
 )
 
 var UploadTextMap = map[int]string{
@@ -95,4 +224,20 @@ var UploadTextMap = map[int]string{
 	UploadStatusUploading:    StartUploadText,
 	UploadStatusUploaded:     UploadSuccessText,
 	UploadStatusFail:         UploadFailText,
+	UploadStatusPaused:       PausedUploadText,
 }
+
+// 备份运行状态
+const (
+	BackupRunStatusRunning = iota // 运行中
+	BackupRunStatusSuccess        // 运行成功
+	BackupRunStatusPartial        // 部分文件上传失败
+	BackupRunStatusFail           // 运行失败
+)
+
+// 批量恢复任务状态
+const (
+	RestoreStatusRunning  = iota // 恢复中
+	RestoreStatusPaused          // 已暂停，可以继续
+	RestoreStatusFinished        // 已完成
+)
@@ -4,21 +4,21 @@ go 1.16
 
 require (
 	fyne.io/fyne v1.4.3
-	fyne.io/fyne/v2 v2.1.3
-	github.com/fsnotify/fsnotify v1.5.1
+	fyne.io/fyne/v2 v2.2.4
+	github.com/fsnotify/fsnotify v1.5.4
 	github.com/google/uuid v1.1.2
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/json-iterator/go v1.1.12
+	github.com/klauspost/compress v1.15.15
 	github.com/magiconair/properties v1.8.6 // indirect
 	github.com/mattn/go-sqlite3 v1.14.12 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/afero v1.8.2 // indirect
 	github.com/spf13/viper v1.10.1
-	golang.org/x/sys v0.0.0-20220319134239-a9b59b0215f8 // indirect
 	gopkg.in/ini.v1 v1.66.4 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
-	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/sqlite v1.3.1
 	gorm.io/gorm v1.23.3
 )
@@ -0,0 +1,286 @@
+package catalog
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/internal/config"
+	"backup/pkg/crypt"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+	"backup/pkg/pcs_client"
+)
+
+// 备份文件中的文件名
+const (
+	entryDB           = "files.db"
+	entryToken        = "token.json"
+	entryPcsConfig    = "pcs_config.yaml"
+	entryUploadConfig = "upload_config.yaml"
+)
+
+const startDelay = 5 * time.Minute // 启动后等扫描开始再备份
+
+// ErrPasswordRequired 目录备份是加密的，需要密码
+var ErrPasswordRequired = errors.New("catalog is encrypted, password required")
+
+// PromptPassword 开启了加密但是内存中没有密码时向用户询问密码，由界面设置，取消时返回false
+var PromptPassword func() (string, bool)
+
+var status = struct {
+	lock       sync.Mutex
+	lastTime   time.Time // 最近一次备份成功的时间
+	lastErr    error     // 最近一次备份的错误
+	inProgress bool
+}{}
+
+// Status 最近一次备份成功的时间和最近一次备份的错误
+func Status() (time.Time, error) {
+	status.lock.Lock()
+	defer status.lock.Unlock()
+	return status.lastTime, status.lastErr
+}
+
+// serverPath 目录备份在网盘中的路径
+func serverPath() string {
+	return path.Join(consts.CatalogDir, consts.CatalogName)
+}
+
+// localFiles 需要备份的本地文件，数据库使用快照
+func localFiles() map[string]string {
+	return map[string]string{
+		entryToken:        config.Config.PcsConfig.TokenPath,
+		entryPcsConfig:    config.PcsConfigPath,
+		entryUploadConfig: config.UploadConfigPath,
+	}
+}
+
+// Start 定时备份目录，间隔在上传配置中修改
+func Start(ctx context.Context) {
+	go func() {
+		wait := startDelay
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			interval := config.GetCatalogInterval()
+			if interval <= 0 { // 没有开启，过一段时间再检查配置
+				wait = time.Hour
+				continue
+			}
+			if lastTime, _ := Status(); time.Since(lastTime) >= interval {
+				Backup(ctx)
+			}
+			wait = time.Hour
+		}
+	}()
+}
+
+// Backup 把数据库快照和配置文件打包上传到网盘的保留目录
+func Backup(ctx context.Context) error {
+	baseLogger := logger.Logger.WithContext(ctx)
+	status.lock.Lock()
+	if status.inProgress {
+		status.lock.Unlock()
+		return errors.New("catalog backup is in progress")
+	}
+	status.inProgress = true
+	status.lock.Unlock()
+
+	err := backup(ctx)
+
+	status.lock.Lock()
+	status.inProgress = false
+	status.lastErr = err
+	if err == nil {
+		status.lastTime = time.Now()
+	}
+	status.lock.Unlock()
+	if err != nil {
+		baseLogger.WithError(err).Error("backup catalog fail")
+		return err
+	}
+	baseLogger.Info("backup catalog success")
+	return nil
+}
+
+func backup(ctx context.Context) error {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir fail")
+	}
+	defer os.RemoveAll(dir)
+
+	files := localFiles()
+	files[entryDB] = filepath.Join(dir, entryDB)
+	if err := database.Snapshot(files[entryDB]); err != nil {
+		return errors.Wrap(err, "snapshot database fail")
+	}
+	password, err := catalogPassword()
+	if err != nil {
+		return err
+	}
+	data, err := writeArchive(files, password)
+	if err != nil {
+		return errors.Wrap(err, "write archive fail")
+	}
+	archive := filepath.Join(dir, consts.CatalogName)
+	if err := ioutil.WriteFile(archive, data, 0600); err != nil {
+		return errors.Wrap(err, "write archive file fail")
+	}
+	params := pcs_client.NewUploadParams(archive, serverPath(), func() {}, nil)
+	return pcs_client.Upload(ctx, params)
+}
+
+// catalogPassword 备份使用的密码，开启加密时没有密码不会上传，防止token明文上传到网盘
+func catalogPassword() (string, error) {
+	if !config.GetCatalogEncrypt() {
+		return "", nil
+	}
+	if password := config.GetCatalogPassword(); password != "" {
+		return password, nil
+	}
+	if PromptPassword != nil {
+		if password, ok := PromptPassword(); ok && password != "" {
+			config.SetCatalogPassword(password)
+			return password, nil
+		}
+	}
+	return "", ErrPasswordRequired
+}
+
+// Restore 从网盘下载目录备份，替换本地的数据库和配置文件，完成后需要重启程序
+func Restore(ctx context.Context, password string) error {
+	baseLogger := logger.Logger.WithContext(ctx)
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir fail")
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, consts.CatalogName)
+	if err := pcs_client.Download(ctx, serverPath(), archive); err != nil {
+		return errors.Wrap(err, "download catalog fail")
+	}
+	data, err := ioutil.ReadFile(archive)
+	if err != nil {
+		return errors.Wrap(err, "read catalog fail")
+	}
+	entries, err := readArchive(data, password)
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[entryDB]; !ok {
+		return errors.New("database not found in catalog")
+	}
+
+	// 所有文件先写到目标位置旁边，全部成功后再替换
+	targets := localFiles()
+	targets[entryDB] = database.Path
+	for name, content := range entries {
+		target, ok := targets[name]
+		if !ok {
+			continue
+		}
+		if err := ioutil.WriteFile(target+".restore", content, 0600); err != nil {
+			return errors.Wrapf(err, "write %s fail", name)
+		}
+	}
+	if err := database.Close(); err != nil {
+		return errors.Wrap(err, "close database fail")
+	}
+	// 旧数据库的WAL文件不能应用到恢复的数据库上
+	os.Remove(database.Path + "-wal")
+	os.Remove(database.Path + "-shm")
+	for name := range entries {
+		target, ok := targets[name]
+		if !ok {
+			continue
+		}
+		if err := os.Rename(target+".restore", target); err != nil {
+			return errors.Wrapf(err, "replace %s fail", name)
+		}
+		baseLogger.WithField("name", name).WithField("target", target).Info("restore catalog file")
+	}
+	return nil
+}
+
+// writeArchive 把文件打包成tar.gz，密码不为空时加密，不存在的配置文件跳过
+func writeArchive(files map[string]string, password string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, filename := range files {
+		content, err := ioutil.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s fail", filename)
+		}
+		err = tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), ModTime: time.Now()})
+		if err != nil {
+			return nil, errors.Wrap(err, "write tar header fail")
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			return nil, errors.Wrap(err, "write tar content fail")
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, errors.Wrap(err, "close tar fail")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, errors.Wrap(err, "close gzip fail")
+	}
+	if password == "" {
+		return buffer.Bytes(), nil
+	}
+	return crypt.Encrypt(buffer.Bytes(), password)
+}
+
+// readArchive 解密并解压备份文件，返回文件名和内容
+func readArchive(data []byte, password string) (map[string][]byte, error) {
+	if crypt.IsEncrypted(data) {
+		if password == "" {
+			return nil, ErrPasswordRequired
+		}
+		var err error
+		if data, err = crypt.Decrypt(data, password); err != nil {
+			return nil, err
+		}
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "open gzip fail")
+	}
+	tarReader := tar.NewReader(gzipReader)
+	entries := map[string][]byte{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read tar fail")
+		}
+		content, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s fail", header.Name)
+		}
+		entries[header.Name] = content
+	}
+}
@@ -0,0 +1,94 @@
+package catalog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/internal/config"
+	"backup/pkg/crypt"
+)
+
+func Test_writeArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatalf("create temp dir error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, entryDB), []byte("sqlite"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, entryToken), []byte("token"), 0600)
+	files := map[string]string{
+		entryDB:        filepath.Join(dir, entryDB),
+		entryToken:     filepath.Join(dir, entryToken),
+		entryPcsConfig: filepath.Join(dir, "not_exist.yaml"), // 不存在的配置文件跳过
+	}
+	want := map[string][]byte{entryDB: []byte("sqlite"), entryToken: []byte("token")}
+
+	tests := []struct {
+		name         string
+		password     string
+		readPassword string
+		wantErr      error
+	}{
+		{name: "plain"},
+		{name: "encrypted", password: "secret", readPassword: "secret"},
+		{name: "password required", password: "secret", wantErr: ErrPasswordRequired},
+		{name: "wrong password", password: "secret", readPassword: "wrong", wantErr: crypt.ErrWrongPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := writeArchive(files, tt.password)
+			if err != nil {
+				t.Fatalf("writeArchive() error = %v", err)
+			}
+			got, err := readArchive(data, tt.readPassword)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("readArchive() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, want) {
+				t.Errorf("readArchive() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_catalogPassword(t *testing.T) {
+	defer func() {
+		config.UploadConfigViper.Set(consts.CatalogEncryptKey, false)
+		config.SetCatalogPassword("")
+		PromptPassword = nil
+	}()
+	tests := []struct {
+		name    string
+		encrypt bool
+		memory  string
+		prompt  func() (string, bool)
+		want    string
+		wantErr error
+	}{
+		{name: "not encrypt", encrypt: false, want: ""},
+		{name: "password in memory", encrypt: true, memory: "secret", want: "secret"},
+		{name: "prompt", encrypt: true, prompt: func() (string, bool) { return "typed", true }, want: "typed"},
+		{name: "prompt skipped", encrypt: true, prompt: func() (string, bool) { return "typed", false }, wantErr: ErrPasswordRequired},
+		{name: "no prompt", encrypt: true, wantErr: ErrPasswordRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.UploadConfigViper.Set(consts.CatalogEncryptKey, tt.encrypt)
+			config.SetCatalogPassword(tt.memory)
+			PromptPassword = tt.prompt
+			got, err := catalogPassword()
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("catalogPassword() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+			if tt.want != "" && config.GetCatalogPassword() != tt.want {
+				t.Errorf("GetCatalogPassword() = %q, want %q", config.GetCatalogPassword(), tt.want)
+			}
+		})
+	}
+}
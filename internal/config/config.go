@@ -1,11 +1,17 @@
 package config
 
 import (
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 
 	"backup/consts"
 )
@@ -17,15 +23,19 @@ upload_config: upload_config.yaml
 log:
   path: log
   level: INFO
+  format: text
   max_size: 10
   backup: 10
 server:
   host: 127.0.0.1
-  port: 8080`
+  port: 8080
+database:
+  path: ""`
 
 var (
 	pcsConfigPathKey    = "pcs_config"
 	uploadConfigPathKey = "upload_config"
+	databasePathKey     = "database.path"
 
 	PcsConfigPath    string
 	UploadConfigPath string
@@ -53,10 +63,44 @@ type PcsConfig struct {
 type LogConfig struct {
 	Path    string `json:"path" mapstructure:"path"`
 	Level   string `json:"level" mapstructure:"level"`
+	Format  string `json:"format" mapstructure:"format"` // text或者json，json格式便于日志采集
 	MaxSize int    `json:"max_size" mapstructure:"max_size"`
 	Backup  int    `json:"backup" mapstructure:"backup"`
 }
 
+// NotificationConfig 通知渠道的配置，保存在上传配置文件中，Events为空时发送所有事件
+type NotificationConfig struct {
+	StaleDays int           `json:"stale_days" mapstructure:"stale_days"`
+	Webhook   WebhookConfig `json:"webhook" mapstructure:"webhook"`
+	Bot       BotConfig     `json:"bot" mapstructure:"bot"`
+	Email     EmailConfig   `json:"email" mapstructure:"email"`
+}
+
+// WebhookConfig 通用webhook，以JSON格式POST事件
+type WebhookConfig struct {
+	Url    string   `json:"url" mapstructure:"url"`
+	Events []string `json:"events" mapstructure:"events"`
+}
+
+// BotConfig 钉钉或者企业微信的群机器人
+type BotConfig struct {
+	Type   string   `json:"type" mapstructure:"type"`
+	Url    string   `json:"url" mapstructure:"url"`
+	Secret string   `json:"secret" mapstructure:"secret"` // 钉钉机器人的加签密钥
+	Events []string `json:"events" mapstructure:"events"`
+}
+
+// EmailConfig SMTP邮件
+type EmailConfig struct {
+	Host     string   `json:"host" mapstructure:"host"`
+	Port     int      `json:"port" mapstructure:"port"`
+	Username string   `json:"username" mapstructure:"username"`
+	Password string   `json:"password" mapstructure:"password"`
+	From     string   `json:"from" mapstructure:"from"`
+	To       []string `json:"to" mapstructure:"to"`
+	Events   []string `json:"events" mapstructure:"events"`
+}
+
 type serverConfig struct {
 	Host string `json:"host" mapstructure:"host"`
 	Port int    `json:"port" mapstructure:"port"`
@@ -66,20 +110,27 @@ func init() {
 	once.Do(func() {
 		ConfigViper.SetConfigType("yaml")
 		ConfigViper.ReadConfig(strings.NewReader(configString))
+		// 环境变量可以覆盖内置配置，例如BACKUP_DATABASE_PATH
+		ConfigViper.SetEnvPrefix(consts.EnvPrefix)
+		ConfigViper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+		ConfigViper.AutomaticEnv()
 
 		PcsConfigPath = ConfigViper.GetString(pcsConfigPathKey)
 		UploadConfigPath = ConfigViper.GetString(uploadConfigPathKey)
 
-		// 获取日志配置
-		err := ConfigViper.UnmarshalKey("log", &Config.LogConfig)
-		if err != nil {
-			log.Fatalf("unmarshal key `log` fail, err: %+v", err)
+		// 获取日志配置，逐项读取，环境变量才能覆盖其中的配置，例如BACKUP_LOG_FORMAT=json
+		Config.LogConfig = LogConfig{
+			Path:    ConfigViper.GetString("log.path"),
+			Level:   ConfigViper.GetString("log.level"),
+			Format:  ConfigViper.GetString("log.format"),
+			MaxSize: ConfigViper.GetInt("log.max_size"),
+			Backup:  ConfigViper.GetInt("log.backup"),
 		}
 
 		// 获取PCS配置
 		PcsConfigViper.SetConfigFile(PcsConfigPath)
 		PcsConfigViper.ReadInConfig()
-		err = PcsConfigViper.UnmarshalKey("pcs", &Config.PcsConfig)
+		err := PcsConfigViper.UnmarshalKey("pcs", &Config.PcsConfig)
 		if err != nil {
 			log.Fatalf("unmarshal key `pcs` fail, err: %+v", err)
 		}
@@ -91,10 +142,198 @@ func init() {
 	})
 }
 
+// GetDatabasePath 数据库文件的路径，没有配置时放在用户配置目录下，不受启动目录影响
+func GetDatabasePath() string {
+	if path := ConfigViper.GetString(databasePathKey); path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return consts.DBFileName
+	}
+	return filepath.Join(dir, consts.AppDirName, consts.DBFileName)
+}
+
+// SetDatabasePath 指定数据库文件的路径，在database.Init之前调用，测试中使用临时目录
+func SetDatabasePath(path string) {
+	ConfigViper.Set(databasePathKey, path)
+}
+
 func (p *PcsConfig) IsValid() bool {
 	return !(p.AppKey == "" || p.AppSecret == "")
 }
 
+// GetUploadOrder 等待队列的排序策略
+func GetUploadOrder() string {
+	switch order := UploadConfigViper.GetString(consts.UploadOrderKey); order {
+	case consts.UploadOrderSmallest, consts.UploadOrderNewest:
+		return order
+	}
+	return consts.UploadOrderFIFO
+}
+
+// GetUploadInterleave 是否交替上传大文件和小文件
+func GetUploadInterleave() bool {
+	return UploadConfigViper.GetBool(consts.UploadInterleaveKey)
+}
+
+// GetLargeFileThreshold 大文件阈值，单位B
+func GetLargeFileThreshold() int64 {
+	threshold := UploadConfigViper.GetInt64(consts.LargeFileThresholdKey)
+	if threshold <= 0 {
+		threshold = consts.DefaultLargeFileMB
+	}
+	return threshold * 1024 * 1024
+}
+
+// GetChunkSize 配置的分片大小，单位B，返回0表示根据会员等级自动选择
+func GetChunkSize() int64 {
+	switch UploadConfigViper.GetString(consts.ChunkSizeKey) {
+	case "4":
+		return consts.Size4MB
+	case "16":
+		return consts.Size16MB
+	case "32":
+		return consts.Size32MB
+	}
+	return 0
+}
+
+// GetHashBufferCount 计算md5的缓冲区数量，决定计算md5时的内存上限，重启后生效
+func GetHashBufferCount() int {
+	count := UploadConfigViper.GetInt(consts.HashBufferCountKey)
+	if count <= 0 || count > consts.MaxHashBufferCount {
+		count = consts.DefaultHashBufferCount
+	}
+	return count
+}
+
+// GetQuietPeriod 文件最后一次修改后需要等待的时间，还在修改的文件等一段时间没有修改后再上传
+func GetQuietPeriod() time.Duration {
+	if !UploadConfigViper.IsSet(consts.QuietPeriodKey) {
+		return consts.DefaultQuietPeriod * time.Second
+	}
+	period := UploadConfigViper.GetInt(consts.QuietPeriodKey)
+	if period < 0 {
+		period = consts.DefaultQuietPeriod
+	}
+	return time.Duration(period) * time.Second
+}
+
+// GetQuotaLowWater 网盘剩余空间的提醒阈值，单位B，0表示不提醒
+func GetQuotaLowWater() int64 {
+	if !UploadConfigViper.IsSet(consts.QuotaLowWaterKey) {
+		return consts.DefaultQuotaLowWater * 1024 * 1024 * 1024
+	}
+	lowWater := UploadConfigViper.GetInt64(consts.QuotaLowWaterKey)
+	if lowWater < 0 {
+		lowWater = consts.DefaultQuotaLowWater
+	}
+	return lowWater * 1024 * 1024 * 1024
+}
+
+// GetPackThreshold 打包上传的文件大小阈值，单位B
+func GetPackThreshold() int64 {
+	threshold := UploadConfigViper.GetInt64(consts.PackThresholdKey)
+	if threshold <= 0 {
+		threshold = consts.DefaultPackThreshold
+	}
+	return threshold * 1024
+}
+
+// GetCatalogInterval 目录备份的间隔，0表示不备份
+func GetCatalogInterval() time.Duration {
+	if !UploadConfigViper.IsSet(consts.CatalogIntervalKey) {
+		return consts.DefaultCatalogInterval * time.Hour
+	}
+	interval := UploadConfigViper.GetInt(consts.CatalogIntervalKey)
+	if interval < 0 {
+		interval = consts.DefaultCatalogInterval
+	}
+	return time.Duration(interval) * time.Hour
+}
+
+// catalogPassword 目录备份的加密密码只保存在内存中，重启后第一次备份时重新输入
+var catalogPassword struct {
+	lock  sync.RWMutex
+	value string
+}
+
+// GetCatalogEncrypt 目录备份是否加密，以前版本保存过密码时也认为开启了加密
+func GetCatalogEncrypt() bool {
+	return UploadConfigViper.GetBool(consts.CatalogEncryptKey) || UploadConfigViper.GetString(consts.CatalogPasswordKey) != ""
+}
+
+// GetCatalogPassword 目录备份的加密密码，没有输入过时返回空字符串
+func GetCatalogPassword() string {
+	catalogPassword.lock.RLock()
+	defer catalogPassword.lock.RUnlock()
+	return catalogPassword.value
+}
+
+// SetCatalogPassword 在内存中记录目录备份的加密密码，不写入配置文件
+func SetCatalogPassword(password string) {
+	catalogPassword.lock.Lock()
+	defer catalogPassword.lock.Unlock()
+	catalogPassword.value = password
+}
+
+// MigrateCatalogPassword 以前版本把目录备份的密码明文保存在上传配置中，启动时移到内存中，并从配置文件中删除
+func MigrateCatalogPassword() error {
+	password := UploadConfigViper.GetString(consts.CatalogPasswordKey)
+	if password == "" {
+		return nil
+	}
+	SetCatalogPassword(password)
+
+	settings := UploadConfigViper.AllSettings()
+	delete(settings, consts.CatalogPasswordKey)
+	settings[consts.CatalogEncryptKey] = true
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return errors.Wrap(err, "marshal upload config fail")
+	}
+	if err := ioutil.WriteFile(UploadConfigPath, data, 0644); err != nil {
+		return errors.Wrap(err, "write upload config fail")
+	}
+	return errors.Wrap(UploadConfigViper.ReadInConfig(), "reload upload config fail")
+}
+
+// GetGuardChangeRatio 一次扫描中修改文件的百分比阈值，超过时暂停备份路径的上传，0表示不检查
+func GetGuardChangeRatio() int {
+	if !UploadConfigViper.IsSet(consts.GuardChangeRatioKey) {
+		return consts.DefaultGuardChangeRatio
+	}
+	ratio := UploadConfigViper.GetInt(consts.GuardChangeRatioKey)
+	if ratio < 0 || ratio > 100 {
+		ratio = consts.DefaultGuardChangeRatio
+	}
+	return ratio
+}
+
+// GetLogLevel 日志级别，在界面中修改过时使用上传配置中的级别，否则使用内置配置
+func GetLogLevel() string {
+	if level := UploadConfigViper.GetString(consts.LogLevelKey); level != "" {
+		return level
+	}
+	return Config.LogConfig.Level
+}
+
+// GetNotificationConfig 通知渠道的配置
+func GetNotificationConfig() NotificationConfig {
+	var res NotificationConfig
+	if err := UploadConfigViper.UnmarshalKey(consts.NotificationKey, &res); err != nil {
+		log.Printf("unmarshal notification config fail, err: %+v", err)
+	}
+	if !UploadConfigViper.IsSet(consts.NotificationKey+".stale_days") || res.StaleDays < 0 {
+		res.StaleDays = consts.DefaultStaleDays
+	}
+	return res
+}
+
 func GetUploadCount() int {
 	uploadCount := UploadConfigViper.GetInt(consts.UploadCountKey)
 	if uploadCount <= consts.EmptyUploadCount || uploadCount > consts.MaxUploadCount {
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backup/consts"
+)
+
+func TestMigrateCatalogPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("create temp dir fail: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	oldPath := UploadConfigPath
+	defer func() {
+		UploadConfigPath = oldPath
+		UploadConfigViper.SetConfigFile(oldPath)
+		UploadConfigViper.ReadInConfig()
+		SetCatalogPassword("")
+	}()
+
+	UploadConfigPath = filepath.Join(dir, "upload_config.yaml")
+	if err := ioutil.WriteFile(UploadConfigPath, []byte("upload_count: 3\ncatalog_password: secret\n"), 0644); err != nil {
+		t.Fatalf("write config fail: %v", err)
+	}
+	UploadConfigViper.SetConfigFile(UploadConfigPath)
+	if err := UploadConfigViper.ReadInConfig(); err != nil {
+		t.Fatalf("read config fail: %v", err)
+	}
+
+	if err := MigrateCatalogPassword(); err != nil {
+		t.Fatalf("MigrateCatalogPassword() error = %v", err)
+	}
+	if got := GetCatalogPassword(); got != "secret" {
+		t.Errorf("GetCatalogPassword() = %s, want secret", got)
+	}
+	if !GetCatalogEncrypt() {
+		t.Errorf("GetCatalogEncrypt() = false, want true")
+	}
+	data, err := ioutil.ReadFile(UploadConfigPath)
+	if err != nil {
+		t.Fatalf("read config fail: %v", err)
+	}
+	if strings.Contains(string(data), consts.CatalogPasswordKey) || strings.Contains(string(data), "secret") {
+		t.Errorf("config still contains password: %s", data)
+	}
+	if UploadConfigViper.GetInt(consts.UploadCountKey) != 3 {
+		t.Errorf("other settings lost: %s", data)
+	}
+}
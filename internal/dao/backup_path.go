@@ -32,6 +32,15 @@ func (d *BackupPathDao) Add(info *model.BackupPath) (int64, error) {
 	return db.RowsAffected, nil
 }
 
+func (d *BackupPathDao) Update(updates map[string]interface{}, absPath string) error {
+	err := d.DB.Table(model.BackupPathTableName).Where("abs_path = ?", absPath).Updates(updates).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("updates", updates).WithField("abs_path", absPath).Error("update backup path fail")
+		return err
+	}
+	return nil
+}
+
 func (d *BackupPathDao) QueryByAbsPath(absPath string) (*model.BackupPath, error) {
 	var result = model.BackupPath{}
 	db := d.DB.Table(model.BackupPathTableName).Where("abs_path = ?", absPath).First(&result)
@@ -50,7 +59,7 @@ func (d *BackupPathDao) Total() int64 {
 		logger.Logger.WithContext(d.ctx).WithError(err).Error("count backup path fail")
 		return 0
 	}
-	return 0
+	return count
 }
 
 func (d *BackupPathDao) GetAll() []*model.BackupPath {
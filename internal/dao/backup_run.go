@@ -0,0 +1,98 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"backup/consts"
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+type BackupRunDao struct {
+	ctx context.Context
+	DB  *gorm.DB
+}
+
+func NewBackupRunDao(ctx context.Context, db *gorm.DB) *BackupRunDao {
+	return &BackupRunDao{
+		ctx: ctx,
+		DB:  db,
+	}
+}
+
+func (d *BackupRunDao) Add(run *model.BackupRun) error {
+	err := d.DB.Table(model.BackupRunTableName).Create(run).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("run", run).Error("create backup run fail")
+		return err
+	}
+	return nil
+}
+
+func (d *BackupRunDao) Update(updates map[string]interface{}, id uint64) error {
+	err := d.DB.Table(model.BackupRunTableName).Where("id = ?", id).Updates(updates).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("updates", updates).WithField("id", id).Error("update backup run fail")
+		return err
+	}
+	return nil
+}
+
+// QueryLastSuccess 查询最近一次成功结束的运行记录
+func (d *BackupRunDao) QueryLastSuccess() (*model.BackupRun, error) {
+	var res *model.BackupRun
+	err := d.DB.Table(model.BackupRunTableName).Where("status = ?", consts.BackupRunStatusSuccess).Order("end_time desc").First(&res).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).Error("query last success backup run fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryRecent 按开始时间倒序查询最近的运行记录
+func (d *BackupRunDao) QueryRecent(limit int) []*model.BackupRun {
+	var res []*model.BackupRun
+	err := d.DB.Table(model.BackupRunTableName).Order("start_time desc").Limit(limit).Find(&res).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("limit", limit).Error("query recent backup run fail")
+		return nil
+	}
+	return res
+}
+
+// SummaryByBackupPath 按备份路径汇总运行记录
+func (d *BackupRunDao) SummaryByBackupPath() []*model.BackupRunSummary {
+	var res []*model.BackupRunSummary
+	err := d.DB.Table(model.BackupRunTableName).Select(
+		"backup_path",
+		"count(*) as run_count",
+		"sum(uploaded_count) as uploaded_count",
+		"sum(failed_count) as failed_count",
+		"sum(upload_bytes) as upload_bytes",
+		"sum(rapid_upload_count) as rapid_upload_count",
+		"sum(dedup_count) as dedup_count",
+		"sum(saved_bytes) as saved_bytes",
+	).Group("backup_path").Scan(&res).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).Error("summary backup run fail")
+		return nil
+	}
+
+	for _, summary := range res {
+		var runs []*model.BackupRun
+		err := d.DB.Table(model.BackupRunTableName).Where("backup_path = ? and status = ?", summary.BackupPath, consts.BackupRunStatusSuccess).
+			Order("end_time desc").Limit(1).Find(&runs).Error
+		if err != nil {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("backup_path", summary.BackupPath).Error("query last success backup run fail")
+			continue
+		}
+		if len(runs) > 0 {
+			summary.LastSuccessTime = runs[0].EndTime
+		}
+	}
+	return res
+}
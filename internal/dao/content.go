@@ -0,0 +1,74 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+type ContentDao struct {
+	ctx context.Context
+	DB  *gorm.DB
+}
+
+func NewContentDao(ctx context.Context, db *gorm.DB) *ContentDao {
+	return &ContentDao{
+		ctx: ctx,
+		DB:  db,
+	}
+}
+
+// Link 文件上传成功后记录内容，serverPath不为空时更新为最近一次上传的路径
+// 网盘中的文件被新内容覆盖后，其他内容不能再指向这个路径，否则复制时会得到错误的内容
+func (d *ContentDao) Link(md5 string, size int64, serverPath string) (*model.Content, error) {
+	var content = &model.Content{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(model.ContentTableName).Where(&model.Content{Md5: md5}).Attrs(&model.Content{Size: size}).FirstOrCreate(content).Error; err != nil {
+			return err
+		}
+		if serverPath == "" {
+			return nil
+		}
+		if err := tx.Table(model.ContentTableName).Where("server_path = ? and id != ?", serverPath, content.ID).Update("server_path", "").Error; err != nil {
+			return err
+		}
+		if serverPath == content.ServerPath {
+			return nil
+		}
+		content.ServerPath = serverPath
+		return tx.Table(model.ContentTableName).Where("id = ?", content.ID).Update("server_path", serverPath).Error
+	})
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("md5", md5).WithField("server_path", serverPath).Error("link content fail")
+		return nil, err
+	}
+	return content, nil
+}
+
+func (d *ContentDao) QueryByMd5(md5 string) (*model.Content, error) {
+	var res *model.Content
+	if err := d.DB.Table(model.ContentTableName).Where("md5 = ?", md5).First(&res).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("md5", md5).Error("query content fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// Savings 统计关联到同一内容的重复文件，每个内容只需要上传一次
+func (d *ContentDao) Savings() *model.ContentSavings {
+	var res = &model.ContentSavings{}
+	refs := d.DB.Table(model.FileInfoTableName).Select("content_id", "count(*) as ref_count").
+		Where("content_id > 0").Group("content_id")
+	err := d.DB.Table(model.ContentTableName+" as c").
+		Select("coalesce(sum(r.ref_count - 1), 0) as duplicate_count", "coalesce(sum(c.size * (r.ref_count - 1)), 0) as saved_bytes").
+		Joins("join (?) as r on r.content_id = c.id", refs).Scan(res).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).Error("query content savings fail")
+	}
+	return res
+}
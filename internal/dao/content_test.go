@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"context"
+	"testing"
+
+	"backup/internal/model"
+	"backup/pkg/database"
+)
+
+func TestContentDao_Link(t *testing.T) {
+	d := NewContentDao(context.Background(), database.DB)
+	fileInfoDao := NewFileInfoDao(context.Background(), database.DB)
+	md5 := "content_test_md5"
+	paths := []string{"/content_test/a/1.txt", "/content_test/b/1.txt", "/content_test/c/1.txt"}
+	defer d.DB.Table(model.ContentTableName).Where("md5 = ?", md5).Delete(&model.Content{})
+	defer d.DB.Table(model.FileInfoTableName).Where("abs_path in ?", paths).Delete(&model.FileInfo{})
+	before := d.Savings()
+
+	tests := []struct {
+		name       string
+		serverPath string
+		want       string
+	}{
+		{name: "first upload", serverPath: "/a/1.txt", want: "/a/1.txt"},
+		{name: "split upload keeps path", serverPath: "", want: "/a/1.txt"},
+		{name: "latest upload", serverPath: "/c/1.txt", want: "/c/1.txt"},
+	}
+	var contentId uint64
+	for i, tt := range tests {
+		content, err := d.Link(md5, 100, tt.serverPath)
+		if err != nil {
+			t.Fatalf("%s: Link() error = %v", tt.name, err)
+		}
+		if contentId != 0 && content.ID != contentId {
+			t.Errorf("%s: Link() id = %d, want %d", tt.name, content.ID, contentId)
+		}
+		contentId = content.ID
+		if got, _ := d.QueryByMd5(md5); got == nil || got.ServerPath != tt.want {
+			t.Errorf("%s: QueryByMd5() = %+v, want server path %s", tt.name, got, tt.want)
+		}
+		fileInfoDao.Add(&model.FileInfo{AbsPath: paths[i], Md5: md5, ContentId: content.ID})
+	}
+
+	// 三个文件关联到同一个内容，其中两个是重复的
+	after := d.Savings()
+	if after.DuplicateCount-before.DuplicateCount != 2 || after.SavedBytes-before.SavedBytes != 200 {
+		t.Errorf("Savings() = %+v, before %+v, want 2 more files and 200 more bytes", after, before)
+	}
+
+	// 网盘中的文件被其他内容覆盖后，原来的内容不再指向这个路径
+	other := "content_test_md5_other"
+	defer d.DB.Table(model.ContentTableName).Where("md5 = ?", other).Delete(&model.Content{})
+	if _, err := d.Link(other, 100, "/c/1.txt"); err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	if got, _ := d.QueryByMd5(md5); got == nil || got.ServerPath != "" {
+		t.Errorf("QueryByMd5() = %+v, want empty server path after overwritten", got)
+	}
+	if got, _ := d.QueryByMd5(other); got == nil || got.ServerPath != "/c/1.txt" {
+		t.Errorf("QueryByMd5() = %+v, want server path /c/1.txt", got)
+	}
+}
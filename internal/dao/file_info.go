@@ -3,6 +3,7 @@ package dao
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -70,3 +71,80 @@ func (d *FileInfoDao) DeleteAllByPrefix(prefix string) error {
 	}
 	return nil
 }
+
+// ResetStatus 将处于指定状态的文件重置为未上传，用于程序重启后恢复中断的状态
+func (d *FileInfoDao) ResetStatus(status ...int) (int64, error) {
+	db := d.DB.Table(model.FileInfoTableName).Where("upload_status in ?", status).Update("upload_status", consts.UploadStatusNoUploaded)
+	if err := db.Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("status", status).Error("reset file info status fail")
+		return 0, err
+	}
+	return db.RowsAffected, nil
+}
+
+// CountRestore 统计批量恢复需要下载的文件数和字节数
+func (d *FileInfoDao) CountRestore(backupPaths []string, pointInTime *time.Time) (count, size int64, err error) {
+	var res struct {
+		Count int64
+		Size  int64
+	}
+	err = d.DB.Table(model.FileInfoTableName).Scopes(restoreScope(backupPaths, pointInTime)).
+		Where("upload_status = ?", consts.UploadStatusUploaded).
+		Select("count(*) as count", "coalesce(sum(size), 0) as size").Scan(&res).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("backup_paths", backupPaths).Error("count restore file fail")
+		return 0, 0, err
+	}
+	return res.Count, res.Size, nil
+}
+
+// CountUnder 目录下已经记录的文件数，不区分上传状态
+func (d *FileInfoDao) CountUnder(dir string) (int64, error) {
+	var count int64
+	err := d.DB.Table(model.FileInfoTableName).Scopes(restoreScope([]string{dir}, nil)).Count(&count).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("dir", dir).Error("count file under dir fail")
+		return 0, err
+	}
+	return count, nil
+}
+
+// EachRestore 分批读取批量恢复需要下载的文件，fn返回错误时停止
+func (d *FileInfoDao) EachRestore(backupPaths []string, pointInTime *time.Time, fn func(infos []*model.FileInfo) error) error {
+	var batch []*model.FileInfo
+	err := d.DB.Table(model.FileInfoTableName).Scopes(restoreScope(backupPaths, pointInTime)).
+		Where("upload_status = ?", consts.UploadStatusUploaded).
+		FindInBatches(&batch, consts.RestoreBatchSize, func(tx *gorm.DB, _ int) error {
+			return fn(batch)
+		}).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("backup_paths", backupPaths).Error("query restore file fail")
+		return err
+	}
+	return nil
+}
+
+// QueryChangedAfter 备份路径下修改时间晚于pointInTime的文件路径
+func (d *FileInfoDao) QueryChangedAfter(backupPaths []string, pointInTime time.Time) ([]string, error) {
+	var res []string
+	err := d.DB.Table(model.FileInfoTableName).Scopes(changedAfterScope(backupPaths, pointInTime)).Pluck("abs_path", &res).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("backup_paths", backupPaths).Error("query changed file fail")
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryUploadedByMd5 查询一个内容相同并且已经上传的文件，excludeAbsPath不参与查询
+func (d *FileInfoDao) QueryUploadedByMd5(md5, excludeAbsPath string) (*model.FileInfo, error) {
+	var res *model.FileInfo
+	err := d.DB.Table(model.FileInfoTableName).Where("md5 = ? and upload_status = ? and abs_path != ?", md5, consts.UploadStatusUploaded, excludeAbsPath).
+		First(&res).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("md5", md5).Error("query uploaded file info fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
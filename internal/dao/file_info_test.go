@@ -3,10 +3,13 @@ package dao
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"gorm.io/gorm"
 
+	"backup/consts"
 	"backup/internal/model"
 	"backup/pkg/database"
 	"backup/pkg/util"
@@ -176,3 +179,59 @@ func TestFileInfoDao_DeleteAllByPrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestFileInfoDao_EachRestore(t *testing.T) {
+	d := NewFileInfoDao(context.Background(), database.DB)
+	root := filepath.Join(string(filepath.Separator)+"restore_test", "a")
+	old := time.Now().Add(-time.Hour)
+	now := time.Now()
+	infos := []*model.FileInfo{
+		{AbsPath: filepath.Join(root, "1.txt"), Size: 1, UploadStatus: consts.UploadStatusUploaded, ModTime: &old},
+		{AbsPath: filepath.Join(root, "b", "2.txt"), Size: 2, UploadStatus: consts.UploadStatusUploaded, ModTime: &now},
+		{AbsPath: filepath.Join(root, "3.txt"), Size: 4, UploadStatus: consts.UploadStatusFail, ModTime: &old},
+		{AbsPath: root + "b" + string(filepath.Separator) + "4.txt", Size: 8, UploadStatus: consts.UploadStatusUploaded, ModTime: &old},
+		{AbsPath: filepath.Join(filepath.Dir(root), "a_b", "5.txt"), Size: 16, UploadStatus: consts.UploadStatusUploaded, ModTime: &now},
+		{AbsPath: filepath.Join(filepath.Dir(root), "axb", "6.txt"), Size: 32, UploadStatus: consts.UploadStatusUploaded, ModTime: &now},
+	}
+	for _, info := range infos {
+		d.Add(info)
+	}
+	defer d.DeleteAllByPrefix(filepath.Dir(root))
+
+	pointInTime := now.Add(-time.Minute)
+	tests := []struct {
+		name        string
+		pointInTime *time.Time
+		wantCount   int64
+		wantSize    int64
+	}{
+		{name: "latest", wantCount: 2, wantSize: 3},
+		{name: "point in time", pointInTime: &pointInTime, wantCount: 1, wantSize: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, size, err := d.CountRestore([]string{root}, tt.pointInTime)
+			if err != nil || count != tt.wantCount || size != tt.wantSize {
+				t.Errorf("CountRestore() = %d, %d, %v, want %d, %d", count, size, err, tt.wantCount, tt.wantSize)
+			}
+			var got int64
+			d.EachRestore([]string{root}, tt.pointInTime, func(infos []*model.FileInfo) error {
+				got += int64(len(infos))
+				return nil
+			})
+			if got != tt.wantCount {
+				t.Errorf("EachRestore() = %d files, want %d", got, tt.wantCount)
+			}
+		})
+	}
+
+	// a_b中的_不能当作通配符匹配axb目录
+	changed, err := d.QueryChangedAfter([]string{filepath.Join(filepath.Dir(root), "a_b")}, pointInTime)
+	if err != nil || len(changed) != 1 || changed[0] != infos[4].AbsPath {
+		t.Errorf("QueryChangedAfter() = %v, %v, want [%s]", changed, err, infos[4].AbsPath)
+	}
+	changed, err = d.QueryChangedAfter([]string{root}, pointInTime)
+	if err != nil || len(changed) != 1 || changed[0] != infos[1].AbsPath {
+		t.Errorf("QueryChangedAfter() = %v, %v, want [%s]", changed, err, infos[1].AbsPath)
+	}
+}
@@ -0,0 +1,56 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+type FilePartDao struct {
+	ctx context.Context
+	DB  *gorm.DB
+}
+
+func NewFilePartDao(ctx context.Context, db *gorm.DB) *FilePartDao {
+	return &FilePartDao{
+		ctx: ctx,
+		DB:  db,
+	}
+}
+
+// Save 保存上传完成的部分，同一个文件同一个序号的部分只保留最新的记录
+func (d *FilePartDao) Save(part *model.FilePart) error {
+	err := d.DB.Table(model.FilePartTableName).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "abs_path"}, {Name: "seq"}},
+		DoUpdates: clause.AssignmentColumns([]string{"server_path", "manifest_path", "offset", "size", "md5", "update_time"}),
+	}).Create(part).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("part", part).Error("save file part fail")
+		return err
+	}
+	return nil
+}
+
+// QueryByAbsPath 按序号查询文件的所有部分
+func (d *FilePartDao) QueryByAbsPath(absPath string) ([]*model.FilePart, error) {
+	var res []*model.FilePart
+	if err := d.DB.Table(model.FilePartTableName).Where("abs_path = ?", absPath).Order("seq asc").Find(&res).Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("abs_path", absPath).Error("query file part fail")
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteAfter 删除序号大于seq的部分，文件变小后拆分的部分变少时使用
+func (d *FilePartDao) DeleteAfter(absPath string, seq int) error {
+	err := d.DB.Table(model.FilePartTableName).Where("abs_path = ? and seq > ?", absPath, seq).Delete(&model.FilePart{}).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("abs_path", absPath).WithField("seq", seq).Error("delete file part fail")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package dao
+
+import (
+	"context"
+	"testing"
+
+	"backup/internal/model"
+	"backup/pkg/database"
+)
+
+func TestFilePartDao(t *testing.T) {
+	d := NewFilePartDao(context.Background(), database.DB)
+	absPath := "/file_part_test/disk.vmdk"
+	defer d.DeleteAfter(absPath, 0)
+
+	for seq := 1; seq <= 3; seq++ {
+		if err := d.Save(&model.FilePart{AbsPath: absPath, Seq: seq, Md5: "old"}); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	// 重新上传后覆盖原来的记录
+	if err := d.Save(&model.FilePart{AbsPath: absPath, Seq: 2, Md5: "new"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := d.DeleteAfter(absPath, 2); err != nil {
+		t.Fatalf("DeleteAfter() error = %v", err)
+	}
+
+	parts, err := d.QueryByAbsPath(absPath)
+	if err != nil {
+		t.Fatalf("QueryByAbsPath() error = %v", err)
+	}
+	tests := []struct {
+		seq int
+		md5 string
+	}{
+		{seq: 1, md5: "old"},
+		{seq: 2, md5: "new"},
+	}
+	if len(parts) != len(tests) {
+		t.Fatalf("QueryByAbsPath() length = %d, want %d", len(parts), len(tests))
+	}
+	for i, tt := range tests {
+		if parts[i].Seq != tt.seq || parts[i].Md5 != tt.md5 {
+			t.Errorf("parts[%d] = %+v, want seq %d md5 %s", i, parts[i], tt.seq, tt.md5)
+		}
+	}
+}
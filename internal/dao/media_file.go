@@ -0,0 +1,70 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+type MediaFileDao struct {
+	ctx context.Context
+	DB  *gorm.DB
+}
+
+func NewMediaFileDao(ctx context.Context, db *gorm.DB) *MediaFileDao {
+	return &MediaFileDao{
+		ctx: ctx,
+		DB:  db,
+	}
+}
+
+// Save 保存媒体文件，同一个md5只保留一条记录
+func (d *MediaFileDao) Save(file *model.MediaFile) error {
+	err := d.DB.Table(model.MediaFileTableName).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "md5"}},
+		DoUpdates: clause.AssignmentColumns([]string{"abs_path", "server_path", "update_time"}),
+	}).Create(file).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("file", file).Error("save media file fail")
+		return err
+	}
+	return nil
+}
+
+// QueryByMd5 查询相同内容的媒体文件，用于识别不同文件夹中的重复照片
+func (d *MediaFileDao) QueryByMd5(md5 string) (*model.MediaFile, error) {
+	var res *model.MediaFile
+	if err := d.DB.Table(model.MediaFileTableName).Where("md5 = ?", md5).First(&res).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("md5", md5).Error("query media file fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryByAbsPath 查询文件上一次备份的记录
+func (d *MediaFileDao) QueryByAbsPath(absPath string) (*model.MediaFile, error) {
+	var res *model.MediaFile
+	if err := d.DB.Table(model.MediaFileTableName).Where("abs_path = ?", absPath).Order("id desc").First(&res).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("abs_path", absPath).Error("query media file fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// ExistServerPath 相册中的路径是否已经被其他文件使用
+func (d *MediaFileDao) ExistServerPath(serverPath string) (bool, error) {
+	var count int64
+	if err := d.DB.Table(model.MediaFileTableName).Where("server_path = ?", serverPath).Count(&count).Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("server_path", serverPath).Error("query media file fail")
+		return false, err
+	}
+	return count > 0, nil
+}
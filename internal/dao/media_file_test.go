@@ -0,0 +1,43 @@
+package dao
+
+import (
+	"context"
+	"testing"
+
+	"backup/internal/model"
+	"backup/pkg/database"
+)
+
+func TestMediaFileDao_Save(t *testing.T) {
+	d := NewMediaFileDao(context.Background(), database.DB)
+	md5 := "media_test_md5"
+	defer d.DB.Table(model.MediaFileTableName).Where("md5 = ?", md5).Delete(&model.MediaFile{})
+
+	d.Save(&model.MediaFile{Md5: md5, AbsPath: "/media_test/a/1.jpg", ServerPath: "/相册/2026/10/1.jpg"})
+	// 同样的照片在另一个文件夹中，md5相同时覆盖原来的记录
+	if err := d.Save(&model.MediaFile{Md5: md5, AbsPath: "/media_test/b/1.jpg", ServerPath: "/相册/2026/10/1.jpg"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := d.QueryByMd5(md5)
+	if err != nil {
+		t.Fatalf("QueryByMd5() error = %v", err)
+	}
+	if got.AbsPath != "/media_test/b/1.jpg" {
+		t.Errorf("QueryByMd5() abs path = %s, want /media_test/b/1.jpg", got.AbsPath)
+	}
+
+	tests := []struct {
+		serverPath string
+		want       bool
+	}{
+		{serverPath: "/相册/2026/10/1.jpg", want: true},
+		{serverPath: "/相册/2026/10/2.jpg", want: false},
+	}
+	for _, tt := range tests {
+		exist, err := d.ExistServerPath(tt.serverPath)
+		if err != nil || exist != tt.want {
+			t.Errorf("ExistServerPath(%s) = %v, %v, want %v", tt.serverPath, exist, err, tt.want)
+		}
+	}
+}
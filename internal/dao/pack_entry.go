@@ -0,0 +1,102 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+type PackEntryDao struct {
+	ctx context.Context
+	DB  *gorm.DB
+}
+
+func NewPackEntryDao(ctx context.Context, db *gorm.DB) *PackEntryDao {
+	return &PackEntryDao{
+		ctx: ctx,
+		DB:  db,
+	}
+}
+
+// Replace 重新打包后替换包中的所有文件，文件从其他包移过来时删除原来的记录
+func (d *PackEntryDao) Replace(bundlePath string, entries []*model.PackEntry) error {
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(model.PackEntryTableName).Where("bundle_path = ?", bundlePath).Delete(&model.PackEntry{}).Error; err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := tx.Table(model.PackEntryTableName).Where("abs_path = ?", entry.AbsPath).Delete(&model.PackEntry{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Table(model.PackEntryTableName).Create(entries).Error
+	})
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("bundle_path", bundlePath).Error("replace pack entry fail")
+		return err
+	}
+	return nil
+}
+
+// QueryByBundlePath 查询包中的所有文件
+func (d *PackEntryDao) QueryByBundlePath(bundlePath string) ([]*model.PackEntry, error) {
+	var res []*model.PackEntry
+	if err := d.DB.Table(model.PackEntryTableName).Where("bundle_path = ?", bundlePath).Order("offset asc").Find(&res).Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("bundle_path", bundlePath).Error("query pack entry fail")
+		return nil, err
+	}
+	return res, nil
+}
+
+func (d *PackEntryDao) QueryByAbsPath(absPath string) (*model.PackEntry, error) {
+	var res *model.PackEntry
+	if err := d.DB.Table(model.PackEntryTableName).Where("abs_path = ?", absPath).First(&res).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("abs_path", absPath).Error("query pack entry fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryRestore 查询批量恢复需要从包中取出的文件，按包和偏移量排序
+func (d *PackEntryDao) QueryRestore(backupPaths []string, pointInTime *time.Time) ([]*model.PackEntry, error) {
+	var res []*model.PackEntry
+	err := d.DB.Table(model.PackEntryTableName).Scopes(restoreScope(backupPaths, pointInTime)).
+		Order("bundle_path asc").Order("offset asc").Find(&res).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("backup_paths", backupPaths).Error("query restore pack entry fail")
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryChangedAfter 备份路径下修改时间晚于pointInTime的打包文件路径
+func (d *PackEntryDao) QueryChangedAfter(backupPaths []string, pointInTime time.Time) ([]string, error) {
+	var res []string
+	err := d.DB.Table(model.PackEntryTableName).Scopes(changedAfterScope(backupPaths, pointInTime)).Pluck("abs_path", &res).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("backup_paths", backupPaths).Error("query changed pack entry fail")
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryByMd5 查询一个内容相同的打包文件
+func (d *PackEntryDao) QueryByMd5(md5 string) (*model.PackEntry, error) {
+	var res *model.PackEntry
+	if err := d.DB.Table(model.PackEntryTableName).Where("md5 = ?", md5).First(&res).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("md5", md5).Error("query pack entry fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,51 @@
+package dao
+
+import (
+	"context"
+	"testing"
+
+	"backup/internal/model"
+	"backup/pkg/database"
+)
+
+func TestPackEntryDao_Replace(t *testing.T) {
+	d := NewPackEntryDao(context.Background(), database.DB)
+	bundleA, bundleB := "/pack_test/a/.backup_bundle.tar", "/pack_test/b/.backup_bundle.tar"
+	defer d.Replace(bundleA, nil)
+	defer d.Replace(bundleB, nil)
+
+	d.Replace(bundleA, []*model.PackEntry{
+		{AbsPath: "/pack_test/a/1.txt", BundlePath: bundleA, Offset: 512},
+		{AbsPath: "/pack_test/a/2.txt", BundlePath: bundleA, Offset: 1536},
+	})
+	// 重新打包，2.txt被删除，3.txt从其他包移过来
+	d.Replace(bundleB, []*model.PackEntry{{AbsPath: "/pack_test/b/3.txt", BundlePath: bundleB, Offset: 512}})
+	if err := d.Replace(bundleA, []*model.PackEntry{
+		{AbsPath: "/pack_test/a/1.txt", BundlePath: bundleA, Offset: 512},
+		{AbsPath: "/pack_test/b/3.txt", BundlePath: bundleA, Offset: 1536},
+	}); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+
+	tests := []struct {
+		bundlePath string
+		want       []string
+	}{
+		{bundlePath: bundleA, want: []string{"/pack_test/a/1.txt", "/pack_test/b/3.txt"}},
+		{bundlePath: bundleB, want: nil},
+	}
+	for _, tt := range tests {
+		entries, err := d.QueryByBundlePath(tt.bundlePath)
+		if err != nil {
+			t.Fatalf("QueryByBundlePath() error = %v", err)
+		}
+		if len(entries) != len(tt.want) {
+			t.Fatalf("QueryByBundlePath(%s) length = %d, want %d", tt.bundlePath, len(entries), len(tt.want))
+		}
+		for i, entry := range entries {
+			if entry.AbsPath != tt.want[i] {
+				t.Errorf("QueryByBundlePath(%s)[%d] = %s, want %s", tt.bundlePath, i, entry.AbsPath, tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package dao
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"backup/consts"
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+type RestoreJobDao struct {
+	ctx context.Context
+	DB  *gorm.DB
+}
+
+func NewRestoreJobDao(ctx context.Context, db *gorm.DB) *RestoreJobDao {
+	return &RestoreJobDao{
+		ctx: ctx,
+		DB:  db,
+	}
+}
+
+func (d *RestoreJobDao) Add(job *model.RestoreJob) error {
+	if err := d.DB.Table(model.RestoreJobTableName).Create(job).Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("job", job).Error("create restore job fail")
+		return err
+	}
+	return nil
+}
+
+func (d *RestoreJobDao) Update(updates map[string]interface{}, id uint64) error {
+	if err := d.DB.Table(model.RestoreJobTableName).Where("id = ?", id).Updates(updates).Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("updates", updates).WithField("id", id).Error("update restore job fail")
+		return err
+	}
+	return nil
+}
+
+// QueryUnfinished 查询最近一个没有完成的恢复任务，程序退出时正在运行的任务也算作未完成
+func (d *RestoreJobDao) QueryUnfinished() (*model.RestoreJob, error) {
+	var res *model.RestoreJob
+	err := d.DB.Table(model.RestoreJobTableName).Where("status != ?", consts.RestoreStatusFinished).Order("id desc").First(&res).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).Error("query unfinished restore job fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// restoreScope 批量恢复的筛选条件，只包含备份路径下修改时间不晚于pointInTime的文件
+func restoreScope(backupPaths []string, pointInTime *time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(underScope(backupPaths))
+		if pointInTime != nil {
+			db = db.Where("mod_time <= ?", pointInTime)
+		}
+		return db
+	}
+}
+
+// changedAfterScope 备份路径下修改时间晚于pointInTime的文件，没有快照时这些文件在pointInTime的内容已经无法恢复
+func changedAfterScope(backupPaths []string, pointInTime time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(underScope(backupPaths)).Where("mod_time > ?", pointInTime)
+	}
+}
+
+// underScope 备份路径本身和路径下的所有文件
+func underScope(backupPaths []string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(backupPaths) == 0 {
+			return db
+		}
+		cond := db.Session(&gorm.Session{NewDB: true})
+		for _, backupPath := range backupPaths {
+			cond = cond.Or(`abs_path = ? or abs_path like ? escape '\'`, backupPath, dirPattern(backupPath))
+		}
+		return db.Where(cond)
+	}
+}
+
+// likeEscaper 转义like中的通配符，路径中的_和%按普通字符匹配
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// dirPattern 匹配目录下所有文件的like条件，按目录匹配，/a/b不包含/a/bc
+func dirPattern(dir string) string {
+	return likeEscaper.Replace(strings.TrimRight(dir, string(os.PathSeparator))+string(os.PathSeparator)) + "%"
+}
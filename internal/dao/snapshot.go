@@ -0,0 +1,103 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+const snapshotBatchSize = 500 // 每次插入的快照文件数
+
+type SnapshotDao struct {
+	ctx context.Context
+	DB  *gorm.DB
+}
+
+func NewSnapshotDao(ctx context.Context, db *gorm.DB) *SnapshotDao {
+	return &SnapshotDao{
+		ctx: ctx,
+		DB:  db,
+	}
+}
+
+// Create 在一个事务中创建快照和变化的文件
+func (d *SnapshotDao) Create(snapshot *model.Snapshot, entries []*model.SnapshotEntry) error {
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(model.SnapshotTableName).Create(snapshot).Error; err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entry.SnapshotId = snapshot.ID
+			entry.BackupPath = snapshot.BackupPath
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Table(model.SnapshotEntryTableName).CreateInBatches(entries, snapshotBatchSize).Error
+	})
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("snapshot", snapshot).Error("create snapshot fail")
+		return err
+	}
+	return nil
+}
+
+// QueryAsOf 查询备份路径在指定时间之前最近的快照，t为空时查询最新的快照
+func (d *SnapshotDao) QueryAsOf(backupPath string, t *time.Time) (*model.Snapshot, error) {
+	var res *model.Snapshot
+	db := d.DB.Table(model.SnapshotTableName).Where("backup_path = ?", backupPath)
+	if t != nil {
+		db = db.Where("create_time <= ?", t)
+	}
+	if err := db.Order("id desc").First(&res).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("backup_path", backupPath).Error("query snapshot fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryByBackupPath 按时间倒序查询备份路径的快照
+func (d *SnapshotDao) QueryByBackupPath(backupPath string, limit int) []*model.Snapshot {
+	var res []*model.Snapshot
+	err := d.DB.Table(model.SnapshotTableName).Where("backup_path = ?", backupPath).Order("id desc").Limit(limit).Find(&res).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("backup_path", backupPath).Error("query snapshot fail")
+		return nil
+	}
+	return res
+}
+
+// QueryState 还原快照中的完整文件列表，dir不为空时只查询这个目录下的文件
+func (d *SnapshotDao) QueryState(backupPath string, snapshotId uint64, dir string) ([]*model.SnapshotEntry, error) {
+	latest := d.DB.Table(model.SnapshotEntryTableName).Select("abs_path", "max(snapshot_id) as snapshot_id").
+		Where("backup_path = ? and snapshot_id <= ?", backupPath, snapshotId).Group("abs_path")
+	db := d.DB.Table(model.SnapshotEntryTableName+" as e").Select("e.*").
+		Joins("join (?) as l on e.abs_path = l.abs_path and e.snapshot_id = l.snapshot_id", latest).
+		Where("e.deleted = ?", false)
+	if dir != "" {
+		db = db.Where("e.abs_path = ? or e.abs_path like ?", dir, dirPattern(dir))
+	}
+
+	var res []*model.SnapshotEntry
+	if err := db.Order("e.abs_path asc").Find(&res).Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("snapshot_id", snapshotId).WithField("dir", dir).Error("query snapshot state fail")
+		return nil, err
+	}
+	return res, nil
+}
+
+// ExistMd5 是否有快照引用这个内容
+func (d *SnapshotDao) ExistMd5(md5 string) bool {
+	var count int64
+	if err := d.DB.Table(model.SnapshotEntryTableName).Where("md5 = ? and deleted = ?", md5, false).Limit(1).Count(&count).Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("md5", md5).Error("query snapshot entry fail")
+		return false
+	}
+	return count > 0
+}
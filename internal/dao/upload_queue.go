@@ -0,0 +1,123 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"backup/consts"
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+type UploadQueueDao struct {
+	ctx context.Context
+	DB  *gorm.DB
+}
+
+func NewUploadQueueDao(ctx context.Context, db *gorm.DB) *UploadQueueDao {
+	return &UploadQueueDao{
+		ctx: ctx,
+		DB:  db,
+	}
+}
+
+// Add 入队，如果已经在队列中则重置为等待上传，保留原来的入队顺序
+func (d *UploadQueueDao) Add(item *model.UploadQueue) error {
+	err := d.DB.Table(model.UploadQueueTableName).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "abs_path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"server_path", "state", "attempts", "next_retry_time", "compress", "mode", "priority", "update_time"}),
+	}).Create(item).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("item", item).Error("add upload queue fail")
+		return err
+	}
+	return nil
+}
+
+func (d *UploadQueueDao) Update(updates map[string]interface{}, absPath string) error {
+	err := d.DB.Table(model.UploadQueueTableName).Where("abs_path = ?", absPath).Updates(updates).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("updates", updates).WithField("abs_path", absPath).Error("update upload queue fail")
+		return err
+	}
+	return nil
+}
+
+// SaveUploadState 保存分片上传的进度
+func (d *UploadQueueDao) SaveUploadState(absPath, uploadId, blockList, completedParts string) error {
+	return d.Update(map[string]interface{}{
+		"upload_id":       uploadId,
+		"block_list":      blockList,
+		"completed_parts": completedParts,
+	}, absPath)
+}
+
+// Fail 记录一次失败，失败次数+1
+func (d *UploadQueueDao) Fail(absPath, lastError string, nextRetryTime *time.Time) error {
+	err := d.DB.Table(model.UploadQueueTableName).Where("abs_path = ?", absPath).Updates(map[string]interface{}{
+		"state":           consts.UploadStatusFail,
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      lastError,
+		"next_retry_time": nextRetryTime,
+	}).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("abs_path", absPath).Error("update upload queue fail")
+		return err
+	}
+	return nil
+}
+
+func (d *UploadQueueDao) QueryByAbsPath(absPath string) (*model.UploadQueue, error) {
+	var res *model.UploadQueue
+	if err := d.DB.Table(model.UploadQueueTableName).Where("abs_path = ?", absPath).First(&res).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("abs_path", absPath).Error("query upload queue fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryAll 按入队顺序查询队列中的所有记录
+func (d *UploadQueueDao) QueryAll() ([]*model.UploadQueue, error) {
+	var res []*model.UploadQueue
+	if err := d.DB.Table(model.UploadQueueTableName).Order("id asc").Find(&res).Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).Error("query all upload queue fail")
+		return nil, err
+	}
+	return res, nil
+}
+
+// QueryDueRetry 按入队顺序查询到了重试时间的失败记录
+func (d *UploadQueueDao) QueryDueRetry(now time.Time, maxAttempts int) ([]*model.UploadQueue, error) {
+	var res []*model.UploadQueue
+	err := d.DB.Table(model.UploadQueueTableName).
+		Where("state = ? and attempts < ? and next_retry_time <= ?", consts.UploadStatusFail, maxAttempts, now).
+		Order("id asc").Find(&res).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).Error("query due retry upload queue fail")
+		return nil, err
+	}
+	return res, nil
+}
+
+func (d *UploadQueueDao) Delete(absPath string) error {
+	err := d.DB.Table(model.UploadQueueTableName).Where("abs_path = ?", absPath).Delete(&model.UploadQueue{}).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("abs_path", absPath).Error("delete upload queue fail")
+		return err
+	}
+	return nil
+}
+
+func (d *UploadQueueDao) DeleteAllByPrefix(prefix string) error {
+	if err := d.DB.Where("abs_path like ?", fmt.Sprintf("%s%%", prefix)).Delete(&model.UploadQueue{}).Error; err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("backup_path", prefix).Error("delete all upload queue prefix fail")
+		return err
+	}
+	return nil
+}
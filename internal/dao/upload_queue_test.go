@@ -0,0 +1,86 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"backup/consts"
+	"backup/internal/model"
+	"backup/pkg/database"
+)
+
+func TestUploadQueueDao_Retry(t *testing.T) {
+	d := NewUploadQueueDao(context.Background(), database.DB)
+	paths := []string{"/queue_test/a.txt", "/queue_test/b.txt", "/queue_test/c.txt"}
+	defer d.DeleteAllByPrefix("/queue_test/")
+
+	for _, path := range paths {
+		if err := d.Add(&model.UploadQueue{AbsPath: path, ServerPath: path, State: consts.UploadStatusWaitUploaded}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		path      string
+		retryTime *time.Time
+		failTimes int
+		wantDue   bool
+	}{
+		{name: "due", path: paths[0], retryTime: &past, failTimes: 1, wantDue: true},
+		{name: "notDue", path: paths[1], retryTime: &future, failTimes: 1, wantDue: false},
+		{name: "exceedMaxAttempts", path: paths[2], retryTime: &past, failTimes: consts.MaxQueueRetryCount, wantDue: false},
+	}
+	for _, tt := range tests {
+		for i := 0; i < tt.failTimes; i++ {
+			if err := d.Fail(tt.path, "upload fail", tt.retryTime); err != nil {
+				t.Fatalf("Fail() error = %v", err)
+			}
+		}
+	}
+
+	due, err := d.QueryDueRetry(time.Now(), consts.MaxQueueRetryCount)
+	if err != nil {
+		t.Fatalf("QueryDueRetry() error = %v", err)
+	}
+	dueSet := map[string]bool{}
+	for _, record := range due {
+		dueSet[record.AbsPath] = true
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if dueSet[tt.path] != tt.wantDue {
+				t.Errorf("QueryDueRetry() contains %s = %v, want %v", tt.path, dueSet[tt.path], tt.wantDue)
+			}
+		})
+	}
+
+	// 重新入队后失败次数清零，入队顺序不变
+	if err := d.Add(&model.UploadQueue{AbsPath: paths[2], ServerPath: paths[2], State: consts.UploadStatusWaitUploaded}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	all, err := d.QueryAll()
+	if err != nil {
+		t.Fatalf("QueryAll() error = %v", err)
+	}
+	var order []string
+	for _, record := range all {
+		if record.AbsPath == paths[2] && (record.Attempts != 0 || record.State != consts.UploadStatusWaitUploaded) {
+			t.Errorf("re-add record = %+v, want reset", record)
+		}
+		for _, path := range paths {
+			if record.AbsPath == path {
+				order = append(order, path)
+			}
+		}
+	}
+	for i := range paths {
+		if i >= len(order) || order[i] != paths[i] {
+			t.Errorf("QueryAll() order = %v, want %v", order, paths)
+			break
+		}
+	}
+}
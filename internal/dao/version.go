@@ -0,0 +1,44 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+type VersionDao struct {
+	ctx context.Context
+	DB  *gorm.DB
+}
+
+func NewVersionDao(ctx context.Context, db *gorm.DB) *VersionDao {
+	return &VersionDao{
+		ctx: ctx,
+		DB:  db,
+	}
+}
+
+// Add 记录保留的旧内容，相同内容已经保留过时不再记录
+func (d *VersionDao) Add(version *model.Version) error {
+	err := d.DB.Table(model.VersionTableName).Clauses(clause.OnConflict{DoNothing: true}).Create(version).Error
+	if err != nil {
+		logger.Logger.WithContext(d.ctx).WithError(err).WithField("version", version).Error("add version fail")
+		return err
+	}
+	return nil
+}
+
+func (d *VersionDao) QueryByMd5(md5 string) (*model.Version, error) {
+	var res *model.Version
+	if err := d.DB.Table(model.VersionTableName).Where("md5 = ?", md5).First(&res).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(d.ctx).WithError(err).WithField("md5", md5).Error("query version fail")
+		}
+		return nil, err
+	}
+	return res, nil
+}
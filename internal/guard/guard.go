@@ -0,0 +1,189 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"backup/consts"
+	"backup/internal/config"
+	"backup/internal/dao"
+	"backup/internal/statistics"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+	"backup/pkg/util"
+)
+
+// Action 需要上传的文件，暂停期间保留，用户确认后执行，这时本次运行的统计已经结束，recorder为nil
+type Action func(recorder *statistics.RunRecorder)
+
+// Guard 检查一次扫描中备份路径的文件变化，发现疑似勒索软件加密时暂停这个备份路径的上传
+// 覆盖网盘中已有内容的上传先保留到扫描结束，没有异常时再执行
+type Guard struct {
+	ctx        context.Context
+	backupPath string
+	recorder   *statistics.RunRecorder
+	known      int64 // 扫描开始时已经记录的文件数
+	ratio      int64 // 修改文件的百分比阈值，0表示不检查
+
+	mux       sync.Mutex
+	changed   int64    // 修改的文件数
+	jumps     int64    // 信息熵突然升高的文件数
+	hits      int64    // 勒索软件扩展名的文件数
+	reason    string   // 暂停的原因，为空时没有暂停
+	suspended bool     // 扫描开始前已经暂停，还没有确认
+	deferred  []Action // 扫描结束后执行的上传
+}
+
+func New(ctx context.Context, backupPath string, recorder *statistics.RunRecorder) *Guard {
+	g := &Guard{
+		ctx:        ctx,
+		backupPath: backupPath,
+		recorder:   recorder,
+		ratio:      int64(config.GetGuardChangeRatio()),
+	}
+	g.known, _ = dao.NewFileInfoDao(ctx, database.DB).CountUnder(backupPath)
+	if record, err := dao.NewBackupPathDao(ctx, database.DB).QueryByAbsPath(backupPath); err == nil && record.Suspended {
+		g.reason, g.suspended = record.SuspendMsg, true // 用户还没有确认，这次扫描的上传继续保留
+	}
+	return g
+}
+
+// Observe 记录一个需要上传的文件，modified表示内容和已经记录的不同，oldEntropy是修改前的信息熵
+func (g *Guard) Observe(path string, modified bool, oldEntropy float64, hash *util.FileHash) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	if ext := strings.ToLower(filepath.Ext(path)); isRansomwareExt(ext) {
+		g.hits++
+		if g.hits >= consts.GuardExtensionHits {
+			g.trip(fmt.Sprintf("发现%d个勒索软件加密后的文件，例如：%s", g.hits, path))
+		}
+		return
+	}
+	if !modified {
+		return
+	}
+	g.changed++
+	if entropyJump(oldEntropy, hash) {
+		g.jumps++
+		if g.jumps >= consts.GuardEntropyJumps {
+			g.trip(fmt.Sprintf("%d个文件的内容突然变成了类似加密的数据", g.jumps))
+			return
+		}
+	}
+	if g.ratio > 0 && g.changed >= consts.GuardMinChanged && g.changed*100 > g.known*g.ratio {
+		g.trip(fmt.Sprintf("一次扫描中修改了%d个文件，超过已有%d个文件的%d%%", g.changed, g.known, g.ratio))
+	}
+}
+
+// trip 第一次发现异常时记录原因，之后的异常不再覆盖
+func (g *Guard) trip(reason string) {
+	if g.reason != "" {
+		return
+	}
+	g.reason = reason
+	logger.Logger.WithContext(g.ctx).WithField("backup_path", g.backupPath).WithField("reason", reason).Warn("suspicious change found, suspend upload")
+}
+
+// Run 上传不会覆盖网盘中已有的内容，没有暂停时立即执行
+func (g *Guard) Run(action Action) {
+	g.mux.Lock()
+	if g.reason == "" {
+		g.mux.Unlock()
+		action(g.recorder)
+		return
+	}
+	g.deferred = append(g.deferred, action)
+	g.mux.Unlock()
+}
+
+// Defer 上传会覆盖网盘中已有的内容，扫描结束确认没有异常后再执行
+func (g *Guard) Defer(action Action) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.deferred = append(g.deferred, action)
+}
+
+// Finish 扫描结束，没有异常时执行保留的上传，否则暂停备份路径直到用户确认
+// 返回这次扫描新发现的暂停原因，扫描前已经暂停时返回空
+func (g *Guard) Finish() string {
+	g.mux.Lock()
+	reason, deferred := g.reason, g.deferred
+	g.deferred = nil
+	g.mux.Unlock()
+
+	if reason == "" {
+		for _, action := range deferred {
+			action(g.recorder)
+		}
+		return ""
+	}
+	hold(g.backupPath, deferred)
+	if g.suspended {
+		return ""
+	}
+	dao.NewBackupPathDao(g.ctx, database.DB).Update(map[string]interface{}{
+		"suspended":   true,
+		"suspend_msg": reason,
+	}, g.backupPath)
+	return reason
+}
+
+func isRansomwareExt(ext string) bool {
+	for _, e := range consts.RansomwareExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// entropyJump 原来是普通内容，修改后变成接近随机的数据
+func entropyJump(oldEntropy float64, hash *util.FileHash) bool {
+	return hash.Size >= consts.GuardEntropyMinSize && oldEntropy > 0 &&
+		oldEntropy < consts.GuardLowEntropy && hash.Entropy >= consts.GuardHighEntropy
+}
+
+var (
+	heldLock sync.Mutex
+	held     = map[string][]Action{} // 暂停的备份路径中等待用户确认的上传
+)
+
+// hold 保留暂停期间的上传，每次扫描都会重新发现需要上传的文件，只保留最近一次扫描的结果
+func hold(backupPath string, actions []Action) {
+	heldLock.Lock()
+	defer heldLock.Unlock()
+	held[backupPath] = actions
+}
+
+// HeldCount 暂停的备份路径中等待确认的上传数
+func HeldCount(backupPath string) int {
+	heldLock.Lock()
+	defer heldLock.Unlock()
+	return len(held[backupPath])
+}
+
+// Confirm 用户确认修改是正常的，取消暂停并执行保留的上传
+// 程序重启后保留的上传已经丢失，修改的文件没有更新记录，下一次扫描时会重新上传
+func Confirm(ctx context.Context, backupPath string) error {
+	err := dao.NewBackupPathDao(ctx, database.DB).Update(map[string]interface{}{
+		"suspended":   false,
+		"suspend_msg": "",
+	}, backupPath)
+	if err != nil {
+		return err
+	}
+	heldLock.Lock()
+	actions := held[backupPath]
+	delete(held, backupPath)
+	heldLock.Unlock()
+
+	logger.Logger.WithContext(ctx).WithField("backup_path", backupPath).WithField("held_count", len(actions)).Info("confirm suspicious change, resume upload")
+	for _, action := range actions {
+		action(nil)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"backup/consts"
+	"backup/internal/statistics"
+	"backup/pkg/util"
+)
+
+func TestGuard_Observe(t *testing.T) {
+	plain := &util.FileHash{Size: 10240, Entropy: 4.5}
+	random := &util.FileHash{Size: 10240, Entropy: 7.99}
+	type observe struct {
+		path       string
+		modified   bool
+		oldEntropy float64
+		hash       *util.FileHash
+	}
+	// repeat 生成n个不同文件名的observe，path是扩展名，为空时使用.txt
+	repeat := func(n int, o observe) []observe {
+		ext := o.path
+		if ext == "" {
+			ext = ".txt"
+		}
+		res := make([]observe, 0, n)
+		for i := 0; i < n; i++ {
+			o.path = fmt.Sprintf("/data/%d%s", i, ext)
+			res = append(res, o)
+		}
+		return res
+	}
+	tests := []struct {
+		name     string
+		known    int64
+		ratio    int64
+		observes []observe
+		want     bool
+	}{
+		{name: "new files", known: 10, ratio: 30, observes: repeat(100, observe{hash: plain}), want: false},
+		{name: "ransomware extension", known: 1000, ratio: 30, observes: repeat(consts.GuardExtensionHits, observe{path: ".docx.LOCKED", hash: random}), want: true},
+		{name: "single ransomware extension", known: 1000, ratio: 30, observes: []observe{{path: "/data/a.docx.locked", hash: random}}, want: false},
+		{name: "generic extension", known: 1000, ratio: 30, observes: repeat(consts.GuardExtensionHits, observe{path: ".enc", hash: random}), want: false},
+		{name: "few changes", known: 1000, ratio: 30, observes: repeat(consts.GuardMinChanged, observe{modified: true, oldEntropy: 4.5, hash: plain}), want: false},
+		{name: "too many changes", known: 100, ratio: 30, observes: repeat(31, observe{modified: true, oldEntropy: 4.5, hash: plain}), want: true},
+		{name: "ratio disabled", known: 100, ratio: 0, observes: repeat(100, observe{modified: true, oldEntropy: 4.5, hash: plain}), want: false},
+		{name: "entropy jump", known: 10000, ratio: 30, observes: repeat(consts.GuardEntropyJumps, observe{modified: true, oldEntropy: 4.5, hash: random}), want: true},
+		{name: "already compressed", known: 10000, ratio: 30, observes: repeat(consts.GuardEntropyJumps, observe{modified: true, oldEntropy: 7.9, hash: random}), want: false},
+		{name: "unknown old entropy", known: 10000, ratio: 30, observes: repeat(consts.GuardEntropyJumps, observe{modified: true, hash: random}), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Guard{ctx: context.Background(), known: tt.known, ratio: tt.ratio}
+			for _, o := range tt.observes {
+				g.Observe(o.path, o.modified, o.oldEntropy, o.hash)
+			}
+			if got := g.reason != ""; got != tt.want {
+				t.Errorf("Observe() suspend = %v, want %v, reason = %s", got, tt.want, g.reason)
+			}
+		})
+	}
+}
+
+func TestGuard_Run(t *testing.T) {
+	g := &Guard{ctx: context.Background()}
+	var ran []string
+	action := func(name string) Action {
+		return func(*statistics.RunRecorder) {
+			ran = append(ran, name)
+		}
+	}
+	g.Run(action("new"))
+	g.Defer(action("overwrite"))
+	if len(ran) != 1 || ran[0] != "new" {
+		t.Fatalf("before finish ran = %v, want [new]", ran)
+	}
+	if reason := g.Finish(); reason != "" || len(ran) != 2 {
+		t.Errorf("Finish() = %q, ran = %v, want all actions run", reason, ran)
+	}
+}
@@ -5,11 +5,17 @@ import "time"
 const BackupPathTableName = "backup_path"
 
 type BackupPath struct {
-	ID         uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"` // 自增ID
-	AbsPath    string     `json:"abs_path" gorm:"column:abs_path;unique"`       // 文件绝对路径
-	IsDir      bool       `json:"is_dir" gorm:"column:is_dir"`                  // 是否是文件夹
-	CreateTime *time.Time `json:"create_time" gorm:"column:create_time"`        // 创建时间
-	UpdateTime *time.Time `json:"update_time" gorm:"column:update_time"`        // 更新时间
+	ID         uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"`    // 自增ID
+	AbsPath    string     `json:"abs_path" gorm:"column:abs_path;unique"`          // 文件绝对路径
+	IsDir      bool       `json:"is_dir" gorm:"column:is_dir"`                     // 是否是文件夹
+	Priority   int        `json:"priority" gorm:"column:priority;default:0"`       // 上传优先级，越大越优先
+	Pack       bool       `json:"pack" gorm:"column:pack;default:false"`           // 是否把小文件打包上传
+	Compress   string     `json:"compress" gorm:"column:compress"`                 // 上传前使用的压缩算法，为空时不压缩
+	Media      bool       `json:"media" gorm:"column:media;default:false"`         // 是否按照片和视频备份，按拍摄时间放到相册目录
+	Suspended  bool       `json:"suspended" gorm:"column:suspended;default:false"` // 是否因为疑似勒索软件加密暂停上传，用户确认后继续
+	SuspendMsg string     `json:"suspend_msg" gorm:"column:suspend_msg"`           // 暂停上传的原因
+	CreateTime *time.Time `json:"create_time" gorm:"column:create_time"`           // 创建时间
+	UpdateTime *time.Time `json:"update_time" gorm:"column:update_time"`           // 更新时间
 }
 
 func (b *BackupPath) TableName() string {
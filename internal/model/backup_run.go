@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+const BackupRunTableName = "backup_run"
+
+// BackupRun 每次扫描上传的运行记录
+type BackupRun struct {
+	ID               uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"`        // 自增ID
+	BackupPath       string     `json:"backup_path" gorm:"column:backup_path;index"`         // 备份路径
+	Status           uint8      `json:"status" gorm:"column:status"`                         // 运行状态
+	StartTime        *time.Time `json:"start_time" gorm:"column:start_time"`                 // 开始时间
+	EndTime          *time.Time `json:"end_time" gorm:"column:end_time"`                     // 结束时间
+	ScannedCount     int64      `json:"scanned_count" gorm:"column:scanned_count"`           // 扫描文件数
+	ChangedCount     int64      `json:"changed_count" gorm:"column:changed_count"`           // 变更文件数
+	UploadedCount    int64      `json:"uploaded_count" gorm:"column:uploaded_count"`         // 上传成功文件数
+	FailedCount      int64      `json:"failed_count" gorm:"column:failed_count"`             // 上传失败文件数
+	SkippedCount     int64      `json:"skipped_count" gorm:"column:skipped_count"`           // 未变更跳过的文件数
+	UploadBytes      int64      `json:"upload_bytes" gorm:"column:upload_bytes"`             // 上传字节数
+	RapidUploadCount int64      `json:"rapid_upload_count" gorm:"column:rapid_upload_count"` // 秒传命中次数
+	DedupCount       int64      `json:"dedup_count" gorm:"column:dedup_count"`               // 复制本地重复内容完成的文件数
+	SavedBytes       int64      `json:"saved_bytes" gorm:"column:saved_bytes"`               // 秒传和复制节省的上传字节数
+	CreateTime       *time.Time `json:"create_time" gorm:"column:create_time"`               // 创建时间
+	UpdateTime       *time.Time `json:"update_time" gorm:"column:update_time"`               // 更新时间
+}
+
+func (b *BackupRun) TableName() string {
+	return BackupRunTableName
+}
+
+// BackupRunSummary 按备份路径汇总的运行统计
+type BackupRunSummary struct {
+	BackupPath       string     `json:"backup_path" gorm:"column:backup_path"`               // 备份路径
+	RunCount         int64      `json:"run_count" gorm:"column:run_count"`                   // 运行次数
+	UploadedCount    int64      `json:"uploaded_count" gorm:"column:uploaded_count"`         // 上传成功文件数
+	FailedCount      int64      `json:"failed_count" gorm:"column:failed_count"`             // 上传失败文件数
+	UploadBytes      int64      `json:"upload_bytes" gorm:"column:upload_bytes"`             // 上传字节数
+	RapidUploadCount int64      `json:"rapid_upload_count" gorm:"column:rapid_upload_count"` // 秒传命中次数
+	DedupCount       int64      `json:"dedup_count" gorm:"column:dedup_count"`               // 复制本地重复内容完成的文件数
+	SavedBytes       int64      `json:"saved_bytes" gorm:"column:saved_bytes"`               // 秒传和复制节省的上传字节数
+	LastSuccessTime  *time.Time `json:"last_success_time" gorm:"column:last_success_time"`   // 最近一次成功结束时间
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+const ContentTableName = "content"
+
+// Content 按md5去重的文件内容，内容相同的本地文件关联到同一条记录
+type Content struct {
+	ID         uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"` // 自增ID
+	Md5        string     `json:"md5" gorm:"column:md5;unique"`                 // 文件md5
+	Size       int64      `json:"size" gorm:"column:size"`                      // 文件大小
+	ServerPath string     `json:"server_path" gorm:"column:server_path"`        // 完整内容在网盘中的路径，为空时不能复制
+	CreateTime *time.Time `json:"create_time" gorm:"column:create_time"`        // 创建时间
+	UpdateTime *time.Time `json:"update_time" gorm:"column:update_time"`        // 更新时间
+}
+
+func (c *Content) TableName() string {
+	return ContentTableName
+}
+
+// ContentSavings 去重节省的文件数和空间
+type ContentSavings struct {
+	DuplicateCount int64 `json:"duplicate_count" gorm:"column:duplicate_count"` // 重复的文件数
+	SavedBytes     int64 `json:"saved_bytes" gorm:"column:saved_bytes"`         // 重复文件的总大小
+}
@@ -2,9 +2,10 @@ package model
 
 import (
 	"context"
-	"os"
 	"time"
 
+	jsoniter "github.com/json-iterator/go"
+
 	"backup/consts"
 	"backup/pkg/logger"
 	"backup/pkg/util"
@@ -13,14 +14,20 @@ import (
 const FileInfoTableName = "file_info"
 
 type FileInfo struct {
-	ID           uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"` // 自增ID
-	AbsPath      string     `json:"abs_path" gorm:"column:abs_path;unique"`       // 文件绝对路径
-	ServerPath   string     `json:"server_path" gorm:"column:server_path"`        // 上传到服务端的地址
-	Size         int64      `json:"size" gorm:"column:size"`                      // 文件大小
-	Md5          string     `json:"md5" gorm:"column:md5"`                        // 文件md5值
-	UploadStatus uint8      `json:"upload_status" gorm:"column:upload_status"`    // 文件上传状态
-	CreateTime   *time.Time `json:"create_time" gorm:"column:create_time"`        // 创建时间
-	UpdateTime   *time.Time `json:"update_time" gorm:"column:update_time"`        // 更新时间
+	ID           uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"`    // 自增ID
+	AbsPath      string     `json:"abs_path" gorm:"column:abs_path;unique"`          // 文件绝对路径
+	ServerPath   string     `json:"server_path" gorm:"column:server_path"`           // 上传到服务端的地址
+	Size         int64      `json:"size" gorm:"column:size"`                         // 文件大小
+	Md5          string     `json:"md5" gorm:"column:md5;index"`                     // 文件md5值
+	ContentId    uint64     `json:"content_id" gorm:"column:content_id;index"`       // 关联的内容记录，内容相同的文件关联到同一条记录
+	UploadStatus uint8      `json:"upload_status" gorm:"column:upload_status;index"` // 文件上传状态
+	SliceMd5     string     `json:"slice_md5" gorm:"column:slice_md5"`               // 文件前256KB的md5值
+	BlockList    string     `json:"block_list" gorm:"column:block_list"`             // 分片md5列表，json数组
+	ChunkSize    int64      `json:"chunk_size" gorm:"column:chunk_size"`             // 计算分片md5时的分片大小
+	ModTime      *time.Time `json:"mod_time" gorm:"column:mod_time"`                 // 计算md5时的文件修改时间
+	Entropy      float64    `json:"entropy" gorm:"column:entropy"`                   // 文件前256KB的信息熵，用于发现被加密的文件
+	CreateTime   *time.Time `json:"create_time" gorm:"column:create_time"`           // 创建时间
+	UpdateTime   *time.Time `json:"update_time" gorm:"column:update_time"`           // 更新时间
 }
 
 func (f *FileInfo) TableName() string {
@@ -28,23 +35,63 @@ func (f *FileInfo) TableName() string {
 }
 
 func NewFileInfo(path, excludePrefix string) *FileInfo {
-	stat, err := os.Stat(path)
-	if err != nil {
-		logger.Logger.WithField("path", path).WithError(err).Error("get file stat fail")
-		return nil
-	}
-
-	md5, err := util.GetFileMd5(context.Background(), path)
+	hash, err := util.HashFile(context.Background(), path, consts.Size4MB)
 	if err != nil {
 		logger.Logger.WithField("path", path).WithError(err).Error("generate file md5 fail")
 		return nil
 	}
+	return NewFileInfoWithHash(path, excludePrefix, hash)
+}
 
+// NewFileInfoWithHash 使用已经计算好的md5生成FileInfo，不需要再读取文件
+func NewFileInfoWithHash(path, excludePrefix string, hash *util.FileHash) *FileInfo {
+	blockList, _ := jsoniter.MarshalToString(hash.BlockList)
+	modTime := hash.ModTime
 	return &FileInfo{
 		AbsPath:      path,                                         // 文件绝对路径
 		ServerPath:   util.GenerateServerFile(path, excludePrefix), // 服务器上存储的文件名
-		Size:         stat.Size(),                                  // 文件大小
+		Size:         hash.Size,                                    // 文件大小
 		UploadStatus: consts.UploadStatusNoUploaded,                // 未上传状态
-		Md5:          md5,                                          // 文件内容MD5值
+		Md5:          hash.Md5,                                     // 文件内容MD5值
+		SliceMd5:     hash.SliceMd5,                                // 校验段MD5值
+		BlockList:    blockList,                                    // 分片MD5列表
+		ChunkSize:    hash.ChunkSize,                               // 分片大小
+		ModTime:      &modTime,                                     // 文件修改时间
+		Entropy:      hash.Entropy,                                 // 信息熵
+	}
+}
+
+// HashUpdates 缓存md5计算结果需要更新的字段
+func HashUpdates(hash *util.FileHash) map[string]interface{} {
+	blockList, _ := jsoniter.MarshalToString(hash.BlockList)
+	modTime := hash.ModTime
+	return map[string]interface{}{
+		"md5":        hash.Md5,       // 文件内容MD5值
+		"size":       hash.Size,      // 文件大小
+		"slice_md5":  hash.SliceMd5,  // 校验段MD5值
+		"block_list": blockList,      // 分片MD5列表
+		"chunk_size": hash.ChunkSize, // 分片大小
+		"mod_time":   &modTime,       // 文件修改时间
+		"entropy":    hash.Entropy,   // 信息熵
+	}
+}
+
+// Hash 缓存的md5计算结果，没有缓存时返回nil
+func (f *FileInfo) Hash() *util.FileHash {
+	if f.Md5 == "" || f.BlockList == "" || f.ModTime == nil {
+		return nil
+	}
+	var blockList []string
+	if err := jsoniter.UnmarshalFromString(f.BlockList, &blockList); err != nil {
+		return nil
+	}
+	return &util.FileHash{
+		Md5:       f.Md5,
+		SliceMd5:  f.SliceMd5,
+		BlockList: blockList,
+		ChunkSize: f.ChunkSize,
+		Size:      f.Size,
+		ModTime:   *f.ModTime,
+		Entropy:   f.Entropy,
 	}
 }
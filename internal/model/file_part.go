@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+const FilePartTableName = "file_part"
+
+// FilePart 超过大小上限拆分上传的文件，每个部分一条记录
+type FilePart struct {
+	ID           uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"`                 // 自增ID
+	AbsPath      string     `json:"abs_path" gorm:"column:abs_path;uniqueIndex:idx_abs_path_seq"` // 原文件绝对路径
+	Seq          int        `json:"seq" gorm:"column:seq;uniqueIndex:idx_abs_path_seq"`           // 部分的序号，从1开始
+	ServerPath   string     `json:"server_path" gorm:"column:server_path"`                        // 部分在网盘中的路径
+	ManifestPath string     `json:"manifest_path" gorm:"column:manifest_path"`                    // 清单文件在网盘中的路径
+	Offset       int64      `json:"offset" gorm:"column:offset"`                                  // 在原文件中的偏移量
+	Size         int64      `json:"size" gorm:"column:size"`                                      // 部分的大小
+	Md5          string     `json:"md5" gorm:"column:md5"`                                        // 部分的md5
+	CreateTime   *time.Time `json:"create_time" gorm:"column:create_time"`                        // 创建时间
+	UpdateTime   *time.Time `json:"update_time" gorm:"column:update_time"`                        // 更新时间
+}
+
+func (f *FilePart) TableName() string {
+	return FilePartTableName
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+const MediaFileTableName = "media_file"
+
+// MediaFile 媒体模式备份的照片和视频，按md5识别不同文件夹中的重复文件
+type MediaFile struct {
+	ID         uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"` // 自增ID
+	Md5        string     `json:"md5" gorm:"column:md5;unique"`                 // 文件md5
+	AbsPath    string     `json:"abs_path" gorm:"column:abs_path;index"`        // 第一次备份时的文件绝对路径
+	ServerPath string     `json:"server_path" gorm:"column:server_path;index"`  // 相册中的路径
+	CreateTime *time.Time `json:"create_time" gorm:"column:create_time"`        // 创建时间
+	UpdateTime *time.Time `json:"update_time" gorm:"column:update_time"`        // 更新时间
+}
+
+func (m *MediaFile) TableName() string {
+	return MediaFileTableName
+}
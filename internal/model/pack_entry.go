@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+const PackEntryTableName = "pack_entry"
+
+// PackEntry 打包上传的小文件，记录文件在哪个包中以及数据在包中的位置
+type PackEntry struct {
+	ID         uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"` // 自增ID
+	AbsPath    string     `json:"abs_path" gorm:"column:abs_path;unique"`       // 文件绝对路径
+	BundlePath string     `json:"bundle_path" gorm:"column:bundle_path;index"`  // 包在网盘中的路径
+	Name       string     `json:"name" gorm:"column:name"`                      // 包中的文件名
+	Offset     int64      `json:"offset" gorm:"column:offset"`                  // 数据在包中的偏移量
+	Size       int64      `json:"size" gorm:"column:size"`                      // 文件大小
+	Md5        string     `json:"md5" gorm:"column:md5;index"`                  // 文件md5
+	ModTime    *time.Time `json:"mod_time" gorm:"column:mod_time"`              // 文件修改时间
+	CreateTime *time.Time `json:"create_time" gorm:"column:create_time"`        // 创建时间
+	UpdateTime *time.Time `json:"update_time" gorm:"column:update_time"`        // 更新时间
+}
+
+func (p *PackEntry) TableName() string {
+	return PackEntryTableName
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+const RestoreJobTableName = "restore_job"
+
+// RestoreJob 从网盘批量恢复文件的任务，中断后可以按相同的条件继续
+type RestoreJob struct {
+	ID            uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"` // 自增ID
+	BackupPaths   string     `json:"backup_paths" gorm:"column:backup_paths"`      // 恢复的备份路径，json数组，为空时恢复全部
+	PointInTime   *time.Time `json:"point_in_time" gorm:"column:point_in_time"`    // 恢复到这个时间之前最近的快照，为空时恢复最新的文件
+	OldRoot       string     `json:"old_root" gorm:"column:old_root"`              // 原来的根目录
+	NewRoot       string     `json:"new_root" gorm:"column:new_root"`              // 恢复到的根目录，为空时恢复到原位置
+	Status        uint8      `json:"status" gorm:"column:status;index"`            // 任务状态
+	TotalCount    int64      `json:"total_count" gorm:"column:total_count"`        // 需要恢复的文件数
+	RestoredCount int64      `json:"restored_count" gorm:"column:restored_count"`  // 恢复成功的文件数，包括本地已经一致跳过的
+	FailedCount   int64      `json:"failed_count" gorm:"column:failed_count"`      // 恢复失败的文件数
+	TotalBytes    int64      `json:"total_bytes" gorm:"column:total_bytes"`        // 需要恢复的字节数
+	RestoredBytes int64      `json:"restored_bytes" gorm:"column:restored_bytes"`  // 已经恢复的字节数
+	ReportPath    string     `json:"report_path" gorm:"column:report_path"`        // 结束后生成的报告文件
+	StartTime     *time.Time `json:"start_time" gorm:"column:start_time"`          // 开始时间
+	EndTime       *time.Time `json:"end_time" gorm:"column:end_time"`              // 结束时间
+	CreateTime    *time.Time `json:"create_time" gorm:"column:create_time"`        // 创建时间
+	UpdateTime    *time.Time `json:"update_time" gorm:"column:update_time"`        // 更新时间
+}
+
+func (r *RestoreJob) TableName() string {
+	return RestoreJobTableName
+}
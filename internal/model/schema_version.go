@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+const SchemaVersionTableName = "schema_version"
+
+// SchemaVersion 已经执行的数据库迁移，最大的版本号就是数据库当前的版本
+type SchemaVersion struct {
+	Version     int        `json:"version" gorm:"column:version;primaryKey;autoIncrement:false"` // 迁移版本号
+	Name        string     `json:"name" gorm:"column:name"`                                      // 迁移名称
+	AppliedTime *time.Time `json:"applied_time" gorm:"column:applied_time"`                      // 执行时间
+}
+
+func (s *SchemaVersion) TableName() string {
+	return SchemaVersionTableName
+}
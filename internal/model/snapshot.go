@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+const (
+	SnapshotTableName      = "snapshot"
+	SnapshotEntryTableName = "snapshot_entry"
+)
+
+// Snapshot 备份路径在一次成功运行后的状态，文件列表按增量记录在SnapshotEntry中
+type Snapshot struct {
+	ID          uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"` // 自增ID
+	BackupPath  string     `json:"backup_path" gorm:"column:backup_path;index"`  // 备份路径
+	RunId       uint64     `json:"run_id" gorm:"column:run_id"`                  // 对应的运行记录
+	FileCount   int64      `json:"file_count" gorm:"column:file_count"`          // 快照中的文件数
+	TotalSize   int64      `json:"total_size" gorm:"column:total_size"`          // 快照中文件的总大小
+	ChangeCount int64      `json:"change_count" gorm:"column:change_count"`      // 和上一个快照相比变化的文件数
+	CreateTime  *time.Time `json:"create_time" gorm:"column:create_time"`        // 创建时间
+	UpdateTime  *time.Time `json:"update_time" gorm:"column:update_time"`        // 更新时间
+}
+
+func (s *Snapshot) TableName() string {
+	return SnapshotTableName
+}
+
+// SnapshotEntry 快照中相对上一个快照新增、修改或者删除的文件
+// 某个快照的完整文件列表是每个文件在这个快照及之前最新的一条记录，去掉已经删除的
+type SnapshotEntry struct {
+	ID         uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"`                                       // 自增ID
+	SnapshotId uint64     `json:"snapshot_id" gorm:"column:snapshot_id;uniqueIndex:idx_abs_path_snapshot,priority:2"` // 快照ID
+	BackupPath string     `json:"backup_path" gorm:"column:backup_path;index"`                                        // 备份路径
+	AbsPath    string     `json:"abs_path" gorm:"column:abs_path;uniqueIndex:idx_abs_path_snapshot,priority:1"`       // 文件绝对路径
+	Md5        string     `json:"md5" gorm:"column:md5;index"`                                                        // 文件md5
+	Size       int64      `json:"size" gorm:"column:size"`                                                            // 文件大小
+	ModTime    *time.Time `json:"mod_time" gorm:"column:mod_time"`                                                    // 文件修改时间
+	Deleted    bool       `json:"deleted" gorm:"column:deleted"`                                                      // 文件在这个快照中已经删除
+}
+
+func (s *SnapshotEntry) TableName() string {
+	return SnapshotEntryTableName
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+const UploadQueueTableName = "upload_queue"
+
+// UploadQueue 持久化的上传队列，自增ID即为入队顺序
+type UploadQueue struct {
+	ID             uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"`  // 自增ID
+	AbsPath        string     `json:"abs_path" gorm:"column:abs_path;unique"`        // 文件绝对路径
+	ServerPath     string     `json:"server_path" gorm:"column:server_path"`         // 上传到服务端的地址
+	State          uint8      `json:"state" gorm:"column:state;index"`               // 上传状态
+	Attempts       int        `json:"attempts" gorm:"column:attempts"`               // 已经失败的次数
+	LastError      string     `json:"last_error" gorm:"column:last_error"`           // 最近一次失败的原因
+	NextRetryTime  *time.Time `json:"next_retry_time" gorm:"column:next_retry_time"` // 下一次自动重试的时间
+	UploadId       string     `json:"upload_id" gorm:"column:upload_id"`             // 分片上传的上传ID，用于继续上传
+	BlockList      string     `json:"block_list" gorm:"column:block_list"`           // 上传ID对应的分片md5列表，json数组
+	CompletedParts string     `json:"completed_parts" gorm:"column:completed_parts"` // 已经上传完成的分片序号，json数组
+	Compress       string     `json:"compress" gorm:"column:compress"`               // 上传前使用的压缩算法
+	Mode           uint8      `json:"mode" gorm:"column:mode"`                       // 上传模式，为0时是手动上传
+	Priority       int        `json:"priority" gorm:"column:priority"`               // 所属备份路径的优先级
+	CreateTime     *time.Time `json:"create_time" gorm:"column:create_time"`         // 创建时间
+	UpdateTime     *time.Time `json:"update_time" gorm:"column:update_time"`         // 更新时间
+}
+
+func (u *UploadQueue) TableName() string {
+	return UploadQueueTableName
+}
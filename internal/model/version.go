@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+const VersionTableName = "version"
+
+// Version 网盘中的文件被覆盖前保留的旧内容，按md5查找，恢复快照时使用
+type Version struct {
+	ID         uint64     `json:"id" gorm:"column:id;primaryKey;autoIncrement"` // 自增ID
+	Md5        string     `json:"md5" gorm:"column:md5;unique"`                 // 内容的md5
+	ServerPath string     `json:"server_path" gorm:"column:server_path"`        // 保留的文件在网盘中带前缀的完整路径，可能是压缩后的文件
+	Packed     bool       `json:"packed" gorm:"column:packed"`                  // 保留的是打包文件，内容是其中的一段
+	Offset     int64      `json:"offset" gorm:"column:offset"`                  // 内容在打包文件中的偏移量
+	Size       int64      `json:"size" gorm:"column:size"`                      // 内容大小
+	CreateTime *time.Time `json:"create_time" gorm:"column:create_time"`        // 创建时间
+	UpdateTime *time.Time `json:"update_time" gorm:"column:update_time"`        // 更新时间
+}
+
+func (v *Version) TableName() string {
+	return VersionTableName
+}
@@ -0,0 +1,111 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const smtpsPort = 465 // 这个端口直接使用TLS连接，其他端口在服务器支持时使用STARTTLS
+
+// EmailSink 通过SMTP发送邮件
+type EmailSink struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func NewEmailSink(host string, port int, username, password, from string, to []string) *EmailSink {
+	if from == "" {
+		from = username
+	}
+	return &EmailSink{host: host, port: port, username: username, password: password, from: from, to: to}
+}
+
+func (s *EmailSink) Name() string {
+	return "email"
+}
+
+func (s *EmailSink) Send(ctx context.Context, event *Event) error {
+	address := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: sendTimeout}
+	if s.port == smtpsPort {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: s.host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return errors.Wrap(err, "dial smtp server fail")
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "new smtp client fail")
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && s.port != smtpsPort {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return errors.Wrap(err, "start tls fail")
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return errors.Wrap(err, "smtp auth fail")
+		}
+	}
+	if err := client.Mail(s.from); err != nil {
+		return errors.Wrap(err, "smtp mail fail")
+	}
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return errors.Wrapf(err, "smtp rcpt %s fail", to)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return errors.Wrap(err, "smtp data fail")
+	}
+	if _, err := writer.Write(s.message(event)); err != nil {
+		return errors.Wrap(err, "write mail fail")
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Wrap(err, "close mail fail")
+	}
+	return client.Quit()
+}
+
+// message 邮件内容，标题和正文都是中文，正文使用base64编码
+func (s *EmailSink) message(event *Event) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", "[网盘备份] "+event.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	body := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s\n\n%s", event.Content, event.Time.Format("2006-01-02 15:04:05"))))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+	return buf.Bytes()
+}
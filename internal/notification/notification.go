@@ -0,0 +1,101 @@
+package notification
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"backup/pkg/logger"
+)
+
+// Event 需要提醒用户的事件
+type Event struct {
+	Kind    string      `json:"kind"`           // 事件类型，consts中的Event开头的常量
+	Title   string      `json:"title"`          // 标题
+	Content string      `json:"content"`        // 内容
+	Time    time.Time   `json:"time"`           // 发生时间
+	Data    interface{} `json:"data,omitempty"` // 附带的结构化数据，例如运行记录，webhook中原样发送
+}
+
+// Sink 通知的发送渠道，例如桌面通知
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, event *Event) error
+}
+
+var (
+	lock  sync.RWMutex
+	sinks []Sink
+)
+
+// Register 添加发送渠道，同名的渠道会被替换
+func Register(sink Sink) {
+	lock.Lock()
+	defer lock.Unlock()
+	for i, s := range sinks {
+		if s.Name() == sink.Name() {
+			sinks[i] = sink
+			return
+		}
+	}
+	sinks = append(sinks, sink)
+}
+
+// Unregister 移除发送渠道
+func Unregister(name string) {
+	lock.Lock()
+	defer lock.Unlock()
+	for i, s := range sinks {
+		if s.Name() == name {
+			sinks = append(sinks[:i], sinks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Send 通过所有渠道发送通知，在协程中发送，不阻塞调用方
+func Send(ctx context.Context, kind, title, content string) {
+	SendData(ctx, kind, title, content, nil)
+}
+
+// SendData 发送附带结构化数据的通知
+func SendData(ctx context.Context, kind, title, content string, data interface{}) {
+	event := &Event{Kind: kind, Title: title, Content: content, Time: time.Now(), Data: data}
+	lock.RLock()
+	targets := make([]Sink, len(sinks))
+	copy(targets, sinks)
+	lock.RUnlock()
+
+	for _, sink := range targets {
+		go func(sink Sink) {
+			if err := sink.Send(ctx, event); err != nil {
+				logger.Logger.WithContext(ctx).WithError(err).WithField("sink", sink.Name()).WithField("event", event).Error("send notification fail")
+			}
+		}(sink)
+	}
+}
+
+// filterSink 只发送配置的事件类型，没有配置时发送所有事件
+type filterSink struct {
+	Sink
+	events map[string]bool
+}
+
+// WithEvents 包装发送渠道，只发送events中的事件
+func WithEvents(sink Sink, events []string) Sink {
+	if len(events) == 0 {
+		return sink
+	}
+	f := &filterSink{Sink: sink, events: make(map[string]bool, len(events))}
+	for _, event := range events {
+		f.events[event] = true
+	}
+	return f
+}
+
+func (f *filterSink) Send(ctx context.Context, event *Event) error {
+	if !f.events[event.Kind] {
+		return nil
+	}
+	return f.Sink.Send(ctx, event)
+}
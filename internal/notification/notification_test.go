@@ -0,0 +1,43 @@
+package notification
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type chanSink struct {
+	name   string
+	events chan *Event
+}
+
+func (s *chanSink) Name() string {
+	return s.name
+}
+
+func (s *chanSink) Send(_ context.Context, event *Event) error {
+	s.events <- event
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	old := &chanSink{name: "test", events: make(chan *Event, 1)}
+	sink := &chanSink{name: "test", events: make(chan *Event, 1)}
+	Register(old)
+	Register(sink) // 同名的渠道替换原来的
+	Send(context.Background(), "run_finish", "title", "content")
+
+	select {
+	case event := <-sink.events:
+		if event.Kind != "run_finish" || event.Title != "title" || event.Content != "content" {
+			t.Errorf("Send() event = %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send() event not received")
+	}
+	select {
+	case <-old.events:
+		t.Error("replaced sink should not receive event")
+	default:
+	}
+}
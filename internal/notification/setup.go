@@ -0,0 +1,34 @@
+package notification
+
+import (
+	"context"
+
+	"backup/internal/config"
+	"backup/pkg/logger"
+)
+
+// Setup 按配置文件注册通知渠道，启动时调用
+func Setup(ctx context.Context) {
+	Apply(ctx, config.GetNotificationConfig())
+}
+
+// Apply 按配置注册webhook、群机器人和邮件渠道，没有配置的渠道被移除
+func Apply(ctx context.Context, cfg config.NotificationConfig) {
+	webhook := NewWebhookSink(cfg.Webhook.Url)
+	apply(ctx, webhook.Name(), cfg.Webhook.Url != "", WithEvents(webhook, cfg.Webhook.Events))
+
+	bot := NewBotSink(cfg.Bot.Type, cfg.Bot.Url, cfg.Bot.Secret)
+	apply(ctx, bot.Name(), cfg.Bot.Url != "", WithEvents(bot, cfg.Bot.Events))
+
+	email := NewEmailSink(cfg.Email.Host, cfg.Email.Port, cfg.Email.Username, cfg.Email.Password, cfg.Email.From, cfg.Email.To)
+	apply(ctx, email.Name(), cfg.Email.Host != "" && cfg.Email.Port > 0 && len(cfg.Email.To) > 0, WithEvents(email, cfg.Email.Events))
+}
+
+func apply(ctx context.Context, name string, enabled bool, sink Sink) {
+	if !enabled {
+		Unregister(name)
+		return
+	}
+	Register(sink)
+	logger.Logger.WithContext(ctx).WithField("sink", name).Info("register notification sink")
+}
@@ -0,0 +1,178 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"backup/consts"
+)
+
+func TestWebhookSink_Send(t *testing.T) {
+	var got Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %s", r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := jsoniter.Unmarshal(body, &got); err != nil {
+			t.Errorf("unmarshal body fail: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	event := &Event{Kind: consts.EventRunFinish, Title: "备份完成", Content: "/data", Time: time.Now()}
+	if err := NewWebhookSink(server.URL).Send(context.Background(), event); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got.Kind != event.Kind || got.Title != event.Title || got.Content != event.Content {
+		t.Errorf("Send() got = %+v, want %+v", got, event)
+	}
+
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fail.Close()
+	if err := NewWebhookSink(fail.URL).Send(context.Background(), event); err == nil {
+		t.Error("Send() should fail on status 500")
+	}
+}
+
+func TestBotSink_Send(t *testing.T) {
+	tests := []struct {
+		name     string
+		botType  string
+		secret   string
+		response string
+		wantSign bool
+		wantErr  bool
+	}{
+		{name: "wecom", botType: consts.BotTypeWeCom, response: `{"errcode":0,"errmsg":"ok"}`},
+		{name: "dingtalk sign", botType: consts.BotTypeDingTalk, secret: "SEC123", response: `{"errcode":0,"errmsg":"ok"}`, wantSign: true},
+		{name: "errcode", botType: consts.BotTypeDingTalk, response: `{"errcode":310000,"errmsg":"sign not match"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var content string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if hasSign := r.URL.Query().Get("sign") != "" && r.URL.Query().Get("timestamp") != ""; hasSign != tt.wantSign {
+					t.Errorf("query = %s, wantSign %v", r.URL.RawQuery, tt.wantSign)
+				}
+				var message struct {
+					MsgType string `json:"msgtype"`
+					Text    struct {
+						Content string `json:"content"`
+					} `json:"text"`
+				}
+				body, _ := io.ReadAll(r.Body)
+				jsoniter.Unmarshal(body, &message)
+				content = message.Text.Content
+				io.WriteString(w, tt.response)
+			}))
+			defer server.Close()
+
+			event := &Event{Kind: consts.EventRunFail, Title: "备份失败", Content: "/data", Time: time.Now()}
+			err := NewBotSink(tt.botType, server.URL+"/robot/send?access_token=token", tt.secret).Send(context.Background(), event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(content, event.Title) || !strings.Contains(content, event.Content) {
+				t.Errorf("Send() content = %s", content)
+			}
+		})
+	}
+}
+
+// fakeSmtpServer 只处理一个连接的SMTP服务器，返回收到的邮件内容
+func fakeSmtpServer(t *testing.T) (string, int, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen fail: %v", err)
+	}
+	mails := make(chan string, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		io.WriteString(conn, "220 localhost ESMTP\r\n")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line)[0]); command {
+			case "EHLO", "HELO":
+				io.WriteString(conn, "250 localhost\r\n")
+			case "DATA":
+				io.WriteString(conn, "354 go ahead\r\n")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				mails <- data.String()
+				io.WriteString(conn, "250 OK\r\n")
+			case "QUIT":
+				io.WriteString(conn, "221 bye\r\n")
+				return
+			default:
+				io.WriteString(conn, "250 OK\r\n")
+			}
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	return host, portNum, mails
+}
+
+func TestEmailSink_Send(t *testing.T) {
+	host, port, mails := fakeSmtpServer(t)
+	event := &Event{Kind: consts.EventNoBackup, Title: "长时间没有成功备份", Content: "已经超过3天", Time: time.Now()}
+	sink := NewEmailSink(host, port, "", "", "backup@example.com", []string{"a@example.com", "b@example.com"})
+	if err := sink.Send(context.Background(), event); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	mail := <-mails
+	if !strings.Contains(mail, "To: a@example.com, b@example.com") {
+		t.Errorf("mail header = %s", mail)
+	}
+	parts := strings.SplitN(mail, "\r\n\r\n", 2)
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(parts[1], "\r\n", ""))
+	if err != nil {
+		t.Fatalf("decode body fail: %v", err)
+	}
+	if !strings.Contains(string(body), event.Content) {
+		t.Errorf("mail body = %s", body)
+	}
+}
+
+func TestWithEvents(t *testing.T) {
+	sink := &chanSink{name: "test", events: make(chan *Event, 2)}
+	filtered := WithEvents(sink, []string{consts.EventRunFail})
+	filtered.Send(context.Background(), &Event{Kind: consts.EventRunFinish})
+	filtered.Send(context.Background(), &Event{Kind: consts.EventRunFail})
+	if len(sink.events) != 1 || (<-sink.events).Kind != consts.EventRunFail {
+		t.Error("WithEvents() should only send configured events")
+	}
+	if WithEvents(sink, nil) != Sink(sink) {
+		t.Error("WithEvents() without events should send all events")
+	}
+}
@@ -0,0 +1,123 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+
+	"backup/consts"
+)
+
+const sendTimeout = 10 * time.Second // 发送webhook和连接邮件服务器的超时时间
+
+var httpClient = &http.Client{Timeout: sendTimeout}
+
+// WebhookSink 通用webhook，以JSON格式POST事件
+type WebhookSink struct {
+	url string
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Send(ctx context.Context, event *Event) error {
+	_, err := postJson(ctx, s.url, event)
+	return err
+}
+
+// BotSink 钉钉或者企业微信的群机器人，两者的文本消息格式相同
+type BotSink struct {
+	botType string
+	url     string
+	secret  string
+}
+
+func NewBotSink(botType, url, secret string) *BotSink {
+	return &BotSink{botType: botType, url: url, secret: secret}
+}
+
+func (s *BotSink) Name() string {
+	return "bot"
+}
+
+// botResponse 钉钉和企业微信机器人的返回，errcode不为0时发送失败
+type botResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (s *BotSink) Send(ctx context.Context, event *Event) error {
+	address := s.url
+	if s.botType == consts.BotTypeDingTalk && s.secret != "" {
+		address = signDingTalk(address, s.secret, time.Now())
+	}
+	message := map[string]interface{}{
+		"msgtype": "text",
+		"text": map[string]string{
+			"content": fmt.Sprintf("%s\n%s\n%s", event.Title, event.Content, event.Time.Format("2006-01-02 15:04:05")),
+		},
+	}
+	body, err := postJson(ctx, address, message)
+	if err != nil {
+		return err
+	}
+	var resp botResponse
+	if err := jsoniter.Unmarshal(body, &resp); err != nil {
+		return errors.Wrap(err, "unmarshal bot response fail")
+	}
+	if resp.ErrCode != 0 {
+		return errors.Errorf("bot response errcode: %d, errmsg: %s", resp.ErrCode, resp.ErrMsg)
+	}
+	return nil
+}
+
+// signDingTalk 钉钉机器人开启加签时，在地址中加上时间戳和签名
+func signDingTalk(address, secret string, now time.Time) string {
+	timestamp := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return fmt.Sprintf("%s&timestamp=%s&sign=%s", address, timestamp, url.QueryEscape(sign))
+}
+
+// postJson 以JSON格式POST数据，返回响应内容，状态码不是2xx时返回错误
+func postJson(ctx context.Context, address string, data interface{}) ([]byte, error) {
+	payload, err := jsoniter.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal payload fail")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, address, bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "new request fail")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "post fail")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read response fail")
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, errors.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,177 @@
+package restore
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/pkg/compress"
+	"backup/pkg/logger"
+	"backup/pkg/pcs_client"
+)
+
+// remoteDirs 缓存网盘目录下的文件列表，同一个目录只查询一次
+type remoteDirs struct {
+	mux  sync.Mutex
+	dirs map[string]*remoteDir
+}
+
+type remoteDir struct {
+	once  sync.Once
+	files map[string]*pcs_client.RemoteFile
+	err   error
+}
+
+func newRemoteDirs() *remoteDirs {
+	return &remoteDirs{dirs: map[string]*remoteDir{}}
+}
+
+// lookup 查询网盘中的文件，fullPath带路径前缀，不存在时返回pcs_client.ErrNotFound
+func (r *remoteDirs) lookup(ctx context.Context, fullPath string) (*pcs_client.RemoteFile, error) {
+	dirPath := path.Dir(fullPath)
+	r.mux.Lock()
+	dir, ok := r.dirs[dirPath]
+	if !ok {
+		dir = &remoteDir{}
+		r.dirs[dirPath] = dir
+	}
+	r.mux.Unlock()
+
+	dir.once.Do(func() {
+		files, err := pcs_client.List(ctx, dirPath)
+		if err != nil {
+			dir.err = err
+			return
+		}
+		dir.files = make(map[string]*pcs_client.RemoteFile, len(files))
+		for _, file := range files {
+			dir.files[file.Path] = file
+		}
+	})
+	if dir.err != nil {
+		// 查询失败不缓存，重试时重新查询
+		r.mux.Lock()
+		if r.dirs[dirPath] == dir {
+			delete(r.dirs, dirPath)
+		}
+		r.mux.Unlock()
+		return nil, errors.Wrap(dir.err, "list dir fail")
+	}
+	if file, ok := dir.files[fullPath]; ok {
+		return file, nil
+	}
+	return nil, errors.Wrapf(pcs_client.ErrNotFound, "path is %s", fullPath)
+}
+
+// fetch 把网盘中serverPath对应的原文件内容下载到target，serverPath不带路径前缀
+// 上传时可能压缩或者拆分，查找原文件名、压缩后的文件名和清单文件
+func (r *remoteDirs) fetch(ctx context.Context, serverPath, target string) error {
+	return r.fetchFull(ctx, pcs_client.FullPath(serverPath), target)
+}
+
+// fetchFull 和fetch相同，fullPath带路径前缀
+func (r *remoteDirs) fetchFull(ctx context.Context, fullPath, target string) error {
+	file, suffix, split, err := r.locate(ctx, fullPath)
+	if err != nil {
+		return err
+	}
+	if split {
+		return r.join(ctx, file, suffix, target)
+	}
+	return r.download(ctx, file, suffix, target)
+}
+
+// locate 查找fullPath上传后在网盘中的文件，split表示找到的是清单文件
+// 开启或者关闭压缩前后上传的内容可能同时存在，使用最近上传的一个
+func (r *remoteDirs) locate(ctx context.Context, fullPath string) (file *pcs_client.RemoteFile, suffix string, split bool, err error) {
+	for _, candidateSuffix := range compress.Suffixes() {
+		for _, manifest := range []bool{false, true} {
+			name := fullPath + candidateSuffix
+			if manifest {
+				name += consts.ManifestSuffix
+			}
+			candidate, err := r.lookup(ctx, name)
+			if errors.Is(err, pcs_client.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, "", false, err
+			}
+			if file == nil || candidate.ServerMtime > file.ServerMtime {
+				file, suffix, split = candidate, candidateSuffix, manifest
+			}
+		}
+	}
+	if file == nil {
+		return nil, "", false, errors.Wrapf(pcs_client.ErrNotFound, "path is %s", fullPath)
+	}
+	return file, suffix, split, nil
+}
+
+// download 下载单个文件，压缩过的文件下载后解压
+func (r *remoteDirs) download(ctx context.Context, file *pcs_client.RemoteFile, suffix, target string) error {
+	if suffix == "" {
+		return pcs_client.DownloadFile(ctx, file, target)
+	}
+	compressed := target + suffix
+	if err := pcs_client.DownloadFile(ctx, file, compressed); err != nil {
+		return err
+	}
+	defer os.Remove(compressed)
+	return compress.Decompress(ctx, compress.Algorithm(compressed), compressed, target)
+}
+
+// join 按清单下载各个部分后拼接，已经下载完整的部分不再下载
+func (r *remoteDirs) join(ctx context.Context, file *pcs_client.RemoteFile, suffix, target string) error {
+	baseLogger := logger.Logger.WithContext(ctx).WithField("manifest", file.Path)
+	manifestPath := target + consts.ManifestSuffix
+	if err := pcs_client.DownloadFile(ctx, file, manifestPath); err != nil {
+		return errors.Wrap(err, "download manifest fail")
+	}
+	defer os.Remove(manifestPath)
+	reader, err := os.Open(manifestPath)
+	if err != nil {
+		return errors.Wrap(err, "open manifest fail")
+	}
+	manifest, err := pcs_client.ReadManifest(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	partDir := target + ".parts"
+	if err := os.MkdirAll(partDir, 0755); err != nil {
+		return errors.Wrap(err, "create part dir fail")
+	}
+	for _, part := range manifest.Parts {
+		local := filepath.Join(partDir, path.Base(part.Path))
+		if stat, err := os.Stat(local); err == nil && stat.Size() == part.Size {
+			baseLogger.WithField("part", part.Seq).Info("part already downloaded, skip")
+			continue
+		}
+		remote, err := r.lookup(ctx, part.Path)
+		if err != nil {
+			return errors.Wrapf(err, "lookup part %d fail", part.Seq)
+		}
+		if err := pcs_client.DownloadFile(ctx, remote, local); err != nil {
+			return errors.Wrapf(err, "download part %d fail", part.Seq)
+		}
+	}
+
+	joined := target + suffix
+	if err := pcs_client.JoinParts(ctx, manifest, partDir, joined); err != nil {
+		os.RemoveAll(partDir) // 部分的内容有误，重试时重新下载
+		return errors.Wrap(err, "join parts fail")
+	}
+	os.RemoveAll(partDir)
+	if suffix == "" {
+		return nil
+	}
+	defer os.Remove(joined)
+	return compress.Decompress(ctx, compress.Algorithm(joined), joined, target)
+}
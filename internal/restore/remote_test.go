@@ -0,0 +1,96 @@
+package restore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/pkg/pcs_client"
+)
+
+func TestRemoteDirs_Locate(t *testing.T) {
+	const dir = "/apps/backup/a"
+	const fullPath = dir + "/1.txt"
+	tests := []struct {
+		name       string
+		files      []*pcs_client.RemoteFile
+		wantPath   string
+		wantSuffix string
+		wantSplit  bool
+		wantErr    error
+	}{
+		{
+			name:     "plain",
+			files:    []*pcs_client.RemoteFile{{Path: fullPath, ServerMtime: 1}},
+			wantPath: fullPath,
+		},
+		{
+			name: "plain and gz both exist, gz is newer",
+			files: []*pcs_client.RemoteFile{
+				{Path: fullPath, ServerMtime: 1},
+				{Path: fullPath + consts.CompressSuffixGzip, ServerMtime: 2},
+			},
+			wantPath:   fullPath + consts.CompressSuffixGzip,
+			wantSuffix: consts.CompressSuffixGzip,
+		},
+		{
+			name: "plain and gz both exist, plain is newer",
+			files: []*pcs_client.RemoteFile{
+				{Path: fullPath, ServerMtime: 3},
+				{Path: fullPath + consts.CompressSuffixGzip, ServerMtime: 2},
+			},
+			wantPath: fullPath,
+		},
+		{
+			name: "gz and zst both exist, zst is newer",
+			files: []*pcs_client.RemoteFile{
+				{Path: fullPath + consts.CompressSuffixGzip, ServerMtime: 1},
+				{Path: fullPath + consts.CompressSuffixZstd, ServerMtime: 2},
+			},
+			wantPath:   fullPath + consts.CompressSuffixZstd,
+			wantSuffix: consts.CompressSuffixZstd,
+		},
+		{
+			name: "plain and split gz",
+			files: []*pcs_client.RemoteFile{
+				{Path: fullPath, ServerMtime: 1},
+				{Path: fullPath + consts.CompressSuffixGzip + consts.ManifestSuffix, ServerMtime: 2},
+			},
+			wantPath:   fullPath + consts.CompressSuffixGzip + consts.ManifestSuffix,
+			wantSuffix: consts.CompressSuffixGzip,
+			wantSplit:  true,
+		},
+		{
+			name:    "not found",
+			files:   []*pcs_client.RemoteFile{{Path: dir + "/2.txt", ServerMtime: 1}},
+			wantErr: pcs_client.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRemoteDirs()
+			cached := &remoteDir{files: map[string]*pcs_client.RemoteFile{}}
+			cached.once.Do(func() {}) // 已经查询过目录，不请求网盘
+			for _, file := range tt.files {
+				cached.files[file.Path] = file
+			}
+			r.dirs[dir] = cached
+
+			file, suffix, split, err := r.locate(context.Background(), fullPath)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("locate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("locate() error = %v", err)
+			}
+			if file.Path != tt.wantPath || suffix != tt.wantSuffix || split != tt.wantSplit {
+				t.Errorf("locate() = %s, %q, %v, want %s, %q, %v", file.Path, suffix, split, tt.wantPath, tt.wantSuffix, tt.wantSplit)
+			}
+		})
+	}
+}
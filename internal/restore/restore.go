@@ -0,0 +1,629 @@
+package restore
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+	"backup/pkg/pack"
+	"backup/pkg/util"
+	"backup/pkg/work_pool"
+)
+
+const progressInterval = 10 * time.Second // 恢复进度写入数据库的间隔
+
+var p = work_pool.NewWorkPool(context.Background(), consts.RestoreWorkerCount, 10, work_pool.WorkModeSlowStart)
+
+func init() {
+	p.Start()
+}
+
+// Options 批量恢复的条件
+type Options struct {
+	BackupPaths []string   // 恢复的备份路径
+	PointInTime *time.Time // 恢复到这个时间之前最近的快照，为空时恢复最新的文件
+	OldRoot     string     // 原来的根目录
+	NewRoot     string     // 恢复到的根目录，为空时恢复到原位置
+}
+
+// Target 文件恢复到的位置，OldRoot下的文件替换成NewRoot，其他文件保留完整路径放在NewRoot下
+func (o *Options) Target(absPath string) string {
+	if o.NewRoot == "" {
+		return absPath
+	}
+	if o.OldRoot != "" {
+		if rel, err := filepath.Rel(o.OldRoot, absPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return filepath.Join(o.NewRoot, rel)
+		}
+	}
+	return filepath.Join(o.NewRoot, strings.TrimPrefix(absPath, filepath.VolumeName(absPath)))
+}
+
+// Progress 恢复进度
+type Progress struct {
+	TotalCount    int64
+	RestoredCount int64
+	FailedCount   int64
+	TotalBytes    int64
+	RestoredBytes int64
+	ETA           time.Duration // 按本次下载的速度估算的剩余时间，还没有下载时为0
+}
+
+// Failure 恢复失败的文件
+type Failure struct {
+	AbsPath string
+	Target  string
+	Err     error
+}
+
+// Job 从网盘批量恢复文件的任务，按数据库中上传成功的文件记录下载并校验md5
+// 中断后按相同的条件继续，本地已经恢复的文件按大小和修改时间跳过
+type Job struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	record  *model.RestoreJob
+	options *Options
+	workDir string
+	remote  *remoteDirs
+	objects *objectCache
+
+	totalCount    int64
+	totalBytes    int64
+	restoredCount int64
+	failedCount   int64
+	restoredBytes int64
+	sessionBytes  int64 // 本次实际下载的字节数，用于估算剩余时间
+	startTime     time.Time
+
+	mux      sync.Mutex
+	failures []*Failure
+	done     chan struct{}
+}
+
+// New 创建新的恢复任务，没有指定备份路径时恢复全部备份路径
+func New(ctx context.Context, options *Options) (*Job, error) {
+	if len(options.BackupPaths) == 0 {
+		for _, backupPath := range dao.NewBackupPathDao(ctx, database.DB).GetAll() {
+			options.BackupPaths = append(options.BackupPaths, backupPath.AbsPath)
+		}
+	}
+	backupPaths, _ := jsoniter.MarshalToString(options.BackupPaths)
+	record := &model.RestoreJob{
+		BackupPaths: backupPaths,
+		PointInTime: options.PointInTime,
+		OldRoot:     options.OldRoot,
+		NewRoot:     options.NewRoot,
+		Status:      consts.RestoreStatusPaused,
+	}
+	if err := dao.NewRestoreJobDao(ctx, database.DB).Add(record); err != nil {
+		return nil, errors.Wrap(err, "add restore job fail")
+	}
+	return newJob(ctx, record, options), nil
+}
+
+// Resume 加载最近一个没有完成的恢复任务，没有时返回gorm.ErrRecordNotFound
+func Resume(ctx context.Context) (*Job, error) {
+	record, err := dao.NewRestoreJobDao(ctx, database.DB).QueryUnfinished()
+	if err != nil {
+		return nil, err
+	}
+	options := &Options{
+		PointInTime: record.PointInTime,
+		OldRoot:     record.OldRoot,
+		NewRoot:     record.NewRoot,
+	}
+	if err := jsoniter.UnmarshalFromString(record.BackupPaths, &options.BackupPaths); err != nil {
+		return nil, errors.Wrap(err, "unmarshal backup paths fail")
+	}
+	return newJob(ctx, record, options), nil
+}
+
+func newJob(ctx context.Context, record *model.RestoreJob, options *Options) *Job {
+	workDir := filepath.Join(filepath.Dir(database.Path), consts.RestoreDir, fmt.Sprint(record.ID))
+	return &Job{
+		ctx:     ctx,
+		record:  record,
+		options: options,
+		workDir: workDir,
+		remote:  newRemoteDirs(),
+		objects: newObjectCache(filepath.Join(workDir, "objects")),
+		done:    make(chan struct{}),
+	}
+}
+
+func (j *Job) Options() *Options {
+	return j.options
+}
+
+// Start 在后台开始恢复，Done返回的通道关闭时结束
+func (j *Job) Start() {
+	j.ctx, j.cancel = context.WithCancel(j.ctx)
+	go j.run()
+}
+
+// Pause 暂停恢复，已经下载的临时文件保留，继续时接着下载
+func (j *Job) Pause() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+}
+
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Finished 任务是否已经完成，暂停时返回false
+func (j *Job) Finished() bool {
+	return j.record.Status == consts.RestoreStatusFinished
+}
+
+// ReportPath 任务完成后生成的报告文件
+func (j *Job) ReportPath() string {
+	return j.record.ReportPath
+}
+
+func (j *Job) Progress() Progress {
+	progress := Progress{
+		TotalCount:    atomic.LoadInt64(&j.totalCount),
+		RestoredCount: atomic.LoadInt64(&j.restoredCount),
+		FailedCount:   atomic.LoadInt64(&j.failedCount),
+		TotalBytes:    atomic.LoadInt64(&j.totalBytes),
+		RestoredBytes: atomic.LoadInt64(&j.restoredBytes),
+	}
+	progress.ETA = eta(progress.TotalBytes-progress.RestoredBytes, atomic.LoadInt64(&j.sessionBytes), time.Since(j.startTime))
+	return progress
+}
+
+// eta 按已经下载的速度估算剩余的时间
+func eta(remaining, downloaded int64, elapsed time.Duration) time.Duration {
+	if downloaded <= 0 || elapsed <= 0 || remaining <= 0 {
+		return 0
+	}
+	return time.Duration(float64(remaining) / float64(downloaded) * float64(elapsed)).Round(time.Second)
+}
+
+func (j *Job) run() {
+	defer close(j.done)
+	baseLogger := logger.Logger.WithContext(j.ctx).WithField("job_id", j.record.ID)
+	baseLogger.WithField("options", j.options).Info("restore start")
+	j.startTime = time.Now()
+	j.update(map[string]interface{}{"status": consts.RestoreStatusRunning, "start_time": &j.startTime})
+
+	latestPaths, snapshotEntries, err := j.plan()
+	if err != nil {
+		j.finish(err)
+		return
+	}
+	var count, size int64
+	var entries []*model.PackEntry
+	fileInfoDao := dao.NewFileInfoDao(j.ctx, database.DB)
+	if len(latestPaths) > 0 {
+		if count, size, err = fileInfoDao.CountRestore(latestPaths, j.options.PointInTime); err != nil {
+			j.finish(err)
+			return
+		}
+		if entries, err = dao.NewPackEntryDao(j.ctx, database.DB).QueryRestore(latestPaths, j.options.PointInTime); err != nil {
+			j.finish(err)
+			return
+		}
+	}
+	var changed []string
+	if len(latestPaths) > 0 && j.options.PointInTime != nil {
+		if changed, err = j.changedAfter(latestPaths); err != nil {
+			j.finish(err)
+			return
+		}
+	}
+	count += int64(len(changed))
+	for _, entry := range entries {
+		count++
+		size += entry.Size
+	}
+	for _, entry := range snapshotEntries {
+		count++
+		size += entry.Size
+	}
+	atomic.StoreInt64(&j.totalCount, count)
+	atomic.StoreInt64(&j.totalBytes, size)
+	j.update(map[string]interface{}{"total_count": count, "total_bytes": size})
+
+	stop := make(chan struct{})
+	go j.saveProgress(stop)
+	defer close(stop)
+
+	var wg sync.WaitGroup
+	group := work_pool.NewTaskGroup(j.ctx, int(count))
+	group.RunFail = func(ctx context.Context, task *work_pool.Task, err error) {
+		if ctx.Err() != nil { // 暂停后不再重试
+			task.Discard(task)
+			return
+		}
+		baseLogger.WithFields(map[string]interface{}{
+			"task":          task.Name,
+			logrus.ErrorKey: err,
+		}).Warn("restore task fail, retry")
+		if err := task.Retry(p); err != nil {
+			baseLogger.WithField("task", task.Name).WithError(err).Error("restore task retry fail")
+		}
+	}
+	group.RunSuccess = func(ctx context.Context, task *work_pool.Task) {
+		wg.Done()
+	}
+	// submit 提交恢复一个文件的任务，超过重试次数后记录失败
+	submit := func(absPath string, run func(ctx context.Context) error) bool {
+		var lastErr error
+		task := work_pool.NewTask(group, absPath, consts.MaxRetryCount)
+		task.Run = func(ctx context.Context, task *work_pool.Task) error {
+			lastErr = run(ctx)
+			return lastErr
+		}
+		task.Discard = func(task *work_pool.Task) {
+			defer wg.Done()
+			if j.ctx.Err() == nil {
+				j.fail(absPath, lastErr)
+			}
+		}
+		wg.Add(1)
+		if err := p.Submit(task); err != nil {
+			wg.Done()
+			return false
+		}
+		return j.ctx.Err() == nil
+	}
+
+	// 没有快照时之后被修改过的文件只保留了最新的内容，记录为失败，在报告中列出
+	for _, absPath := range changed {
+		j.fail(absPath, errors.Wrapf(ErrNotRecoverable, "point in time is %s", j.options.PointInTime.Format(consts.TimeFormatSecond)))
+	}
+
+	bundleDir := bundleLocalDir(j.workDir)
+	for bundlePath, bundleEntries := range groupByBundle(entries) {
+		bundlePath, bundleEntries := bundlePath, bundleEntries
+		var lastErr error
+		var pending []*model.PackEntry
+		task := work_pool.NewTask(group, bundlePath, consts.MaxRetryCount)
+		task.Run = func(ctx context.Context, task *work_pool.Task) error {
+			if pending == nil { // 重试时不再重复统计已经恢复的文件
+				pending = j.pendingEntries(bundleEntries)
+			}
+			lastErr = j.restoreBundle(ctx, bundlePath, filepath.Join(bundleDir, bundleName(bundlePath)), pending)
+			return lastErr
+		}
+		task.Discard = func(task *work_pool.Task) {
+			defer wg.Done()
+			if j.ctx.Err() != nil {
+				return
+			}
+			for _, entry := range pending {
+				j.fail(entry.AbsPath, lastErr)
+			}
+		}
+		wg.Add(1)
+		if err := p.Submit(task); err != nil || j.ctx.Err() != nil {
+			if err != nil {
+				wg.Done()
+			}
+			break
+		}
+	}
+
+	for _, entry := range snapshotEntries {
+		entry := entry
+		if !submit(entry.AbsPath, func(ctx context.Context) error { return j.restoreEntry(ctx, entry) }) {
+			break
+		}
+	}
+
+	if len(latestPaths) > 0 && j.ctx.Err() == nil {
+		err = fileInfoDao.EachRestore(latestPaths, j.options.PointInTime, func(infos []*model.FileInfo) error {
+			for _, info := range infos {
+				info := info
+				if !submit(info.AbsPath, func(ctx context.Context) error { return j.restoreFile(ctx, info) }) {
+					return j.ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+
+	allDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allDone)
+	}()
+	select {
+	case <-allDone:
+	case <-j.ctx.Done():
+	}
+	if err == nil {
+		err = j.ctx.Err()
+	}
+	j.finish(err)
+}
+
+// changedAfter 没有快照的路径下修改时间晚于时间点的文件，包括单独上传的文件和打包的小文件
+func (j *Job) changedAfter(latestPaths []string) ([]string, error) {
+	files, err := dao.NewFileInfoDao(j.ctx, database.DB).QueryChangedAfter(latestPaths, *j.options.PointInTime)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := dao.NewPackEntryDao(j.ctx, database.DB).QueryChangedAfter(latestPaths, *j.options.PointInTime)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, packed...), nil
+}
+
+// restoreFile 恢复一个单独上传的文件，先下载到临时文件，校验md5后再替换
+func (j *Job) restoreFile(ctx context.Context, info *model.FileInfo) error {
+	target := j.options.Target(info.AbsPath)
+	if upToDate(target, info.Size, info.ModTime) {
+		j.restored(info.Size, false)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return errors.Wrap(err, "create target dir fail")
+	}
+	tmp := target + ".restore"
+	if err := j.remote.fetch(ctx, info.ServerPath, tmp); err != nil {
+		return err
+	}
+	if err := verify(ctx, tmp, info.Md5); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if info.ModTime != nil {
+		if err := os.Chtimes(tmp, *info.ModTime, *info.ModTime); err != nil {
+			logger.Logger.WithContext(ctx).WithError(err).WithField("target", target).Warn("restore mod time fail")
+		}
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "rename restored file fail")
+	}
+	j.restored(info.Size, true)
+	return nil
+}
+
+// pendingEntries 包中本地还没有恢复的文件，已经恢复的直接计入进度
+func (j *Job) pendingEntries(entries []*model.PackEntry) []*model.PackEntry {
+	pending := make([]*model.PackEntry, 0, len(entries))
+	for _, entry := range entries {
+		if upToDate(j.options.Target(entry.AbsPath), entry.Size, entry.ModTime) {
+			j.restored(entry.Size, false)
+			continue
+		}
+		pending = append(pending, entry)
+	}
+	return pending
+}
+
+// restoreBundle 下载打包上传的小文件所在的包，取出其中需要恢复的文件
+// 取出失败的文件单独记录，只有包下载失败时才重试
+func (j *Job) restoreBundle(ctx context.Context, bundlePath, local string, pending []*model.PackEntry) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(local); err != nil {
+		if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+			return errors.Wrap(err, "create bundle dir fail")
+		}
+		if err := j.remote.fetch(ctx, bundlePath, local); err != nil {
+			return errors.Wrap(err, "download bundle fail")
+		}
+	}
+	bundle, err := os.Open(local)
+	if err != nil {
+		return errors.Wrap(err, "open bundle fail")
+	}
+	defer bundle.Close()
+
+	for _, entry := range pending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if err := j.extract(ctx, bundle, entry); err != nil {
+			j.fail(entry.AbsPath, err)
+		}
+	}
+	bundle.Close()
+	os.Remove(local)
+	return nil
+}
+
+func (j *Job) extract(ctx context.Context, bundle *os.File, entry *model.PackEntry) error {
+	target := j.options.Target(entry.AbsPath)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return errors.Wrap(err, "create target dir fail")
+	}
+	packEntry := &pack.Entry{
+		Path:   entry.AbsPath,
+		Name:   entry.Name,
+		Offset: entry.Offset,
+		Size:   entry.Size,
+		Md5:    entry.Md5,
+	}
+	if entry.ModTime != nil {
+		packEntry.ModTime = *entry.ModTime
+	}
+	tmp := target + ".restore"
+	if err := pack.Extract(ctx, bundle, packEntry, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "rename restored file fail")
+	}
+	j.restored(entry.Size, true)
+	return nil
+}
+
+func (j *Job) restored(size int64, downloaded bool) {
+	atomic.AddInt64(&j.restoredCount, 1)
+	atomic.AddInt64(&j.restoredBytes, size)
+	if downloaded {
+		atomic.AddInt64(&j.sessionBytes, size)
+	}
+}
+
+func (j *Job) fail(absPath string, err error) {
+	atomic.AddInt64(&j.failedCount, 1)
+	logger.Logger.WithContext(j.ctx).WithField("abs_path", absPath).WithError(err).Error("restore file fail")
+	j.mux.Lock()
+	j.failures = append(j.failures, &Failure{AbsPath: absPath, Target: j.options.Target(absPath), Err: err})
+	j.mux.Unlock()
+}
+
+// saveProgress 定时把进度写入数据库
+func (j *Job) saveProgress(stop <-chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			j.update(j.progressUpdates())
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (j *Job) progressUpdates() map[string]interface{} {
+	progress := j.Progress()
+	return map[string]interface{}{
+		"restored_count": progress.RestoredCount,
+		"failed_count":   progress.FailedCount,
+		"restored_bytes": progress.RestoredBytes,
+	}
+}
+
+func (j *Job) update(updates map[string]interface{}) {
+	dao.NewRestoreJobDao(j.ctx, database.DB).Update(updates, j.record.ID)
+}
+
+// finish 暂停时保留临时文件，完成时生成报告并删除临时文件
+func (j *Job) finish(err error) {
+	baseLogger := logger.Logger.WithContext(j.ctx).WithField("job_id", j.record.ID)
+	ctx := context.Background() // 暂停后任务的ctx已经取消
+	updates := j.progressUpdates()
+	if err != nil && j.ctx.Err() != nil {
+		j.record.Status = consts.RestoreStatusPaused
+		updates["status"] = j.record.Status
+		dao.NewRestoreJobDao(ctx, database.DB).Update(updates, j.record.ID)
+		baseLogger.WithField("progress", j.Progress()).Info("restore paused")
+		return
+	}
+
+	now := time.Now()
+	j.record.Status = consts.RestoreStatusFinished
+	j.record.EndTime = &now
+	if err != nil { // 读取数据库失败，没有可以恢复的文件
+		baseLogger.WithError(err).Error("restore fail")
+		j.mux.Lock()
+		j.failures = append(j.failures, &Failure{Err: err})
+		j.mux.Unlock()
+	}
+	reportPath := filepath.Join(filepath.Dir(j.workDir), fmt.Sprintf("report_%d_%s.txt", j.record.ID, now.Format("20060102150405")))
+	if reportErr := j.writeReport(reportPath); reportErr != nil {
+		baseLogger.WithError(reportErr).Error("write restore report fail")
+	} else {
+		j.record.ReportPath = reportPath
+	}
+	os.RemoveAll(j.workDir)
+
+	updates["status"] = j.record.Status
+	updates["end_time"] = j.record.EndTime
+	updates["report_path"] = j.record.ReportPath
+	dao.NewRestoreJobDao(ctx, database.DB).Update(updates, j.record.ID)
+	baseLogger.WithField("progress", j.Progress()).WithField("report", reportPath).Info("restore finish")
+}
+
+// writeReport 报告中记录恢复的条件、结果和每个失败的文件
+func (j *Job) writeReport(reportPath string) error {
+	if err := os.MkdirAll(filepath.Dir(reportPath), 0755); err != nil {
+		return errors.Wrap(err, "create report dir fail")
+	}
+	file, err := os.Create(reportPath)
+	if err != nil {
+		return errors.Wrap(err, "create report fail")
+	}
+	defer file.Close()
+
+	progress := j.Progress()
+	pointInTime := "最新"
+	if j.options.PointInTime != nil {
+		pointInTime = j.options.PointInTime.Format(consts.TimeFormatSecond)
+	}
+	fmt.Fprintf(file, "备份路径：%s\n", strings.Join(j.options.BackupPaths, ", "))
+	fmt.Fprintf(file, "时间点：%s\n", pointInTime)
+	fmt.Fprintf(file, "原根目录：%s\n恢复到：%s\n", j.options.OldRoot, j.options.NewRoot)
+	fmt.Fprintf(file, "开始时间：%s\n结束时间：%s\n", j.startTime.Format(consts.TimeFormatSecond), j.record.EndTime.Format(consts.TimeFormatSecond))
+	fmt.Fprintf(file, "文件总数：%d，恢复成功：%d，恢复失败：%d，共%d字节\n\n", progress.TotalCount, progress.RestoredCount, progress.FailedCount, progress.TotalBytes)
+
+	j.mux.Lock()
+	failures := append([]*Failure(nil), j.failures...)
+	j.mux.Unlock()
+	sort.Slice(failures, func(a, b int) bool {
+		return failures[a].AbsPath < failures[b].AbsPath
+	})
+	for _, failure := range failures {
+		fmt.Fprintf(file, "%s\t%s\t%v\n", failure.AbsPath, failure.Target, failure.Err)
+	}
+	return file.Close()
+}
+
+// upToDate 本地文件的大小和修改时间与备份时一致，不需要再恢复
+func upToDate(target string, size int64, modTime *time.Time) bool {
+	stat, err := os.Stat(target)
+	if err != nil || modTime == nil {
+		return false
+	}
+	return stat.Mode().IsRegular() && stat.Size() == size && stat.ModTime().Unix() == modTime.Unix()
+}
+
+// verify 校验恢复的文件内容
+func verify(ctx context.Context, filename, want string) error {
+	sum, err := util.GetFileMd5(ctx, filename)
+	if err != nil {
+		return errors.Wrap(err, "hash restored file fail")
+	}
+	if sum != want {
+		return errors.Errorf("restored md5 is %s, want %s", sum, want)
+	}
+	return nil
+}
+
+func groupByBundle(entries []*model.PackEntry) map[string][]*model.PackEntry {
+	res := map[string][]*model.PackEntry{}
+	for _, entry := range entries {
+		res[entry.BundlePath] = append(res[entry.BundlePath], entry)
+	}
+	return res
+}
+
+func bundleLocalDir(workDir string) string {
+	return filepath.Join(workDir, consts.BundleDir)
+}
+
+// bundleName 包下载到本地的文件名，按包在网盘中路径的md5命名
+func bundleName(bundlePath string) string {
+	return fmt.Sprintf("%x.tar", md5.Sum([]byte(bundlePath)))
+}
@@ -0,0 +1,114 @@
+package restore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backup/internal/model"
+	"backup/pkg/pack"
+)
+
+func TestOptions_Target(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		absPath string
+		want    string
+	}{
+		{name: "in place", options: Options{}, absPath: "/home/a/1.txt", want: "/home/a/1.txt"},
+		{name: "remap root", options: Options{OldRoot: "/home/a", NewRoot: "/mnt/new"}, absPath: "/home/a/b/1.txt", want: "/mnt/new/b/1.txt"},
+		{name: "outside old root", options: Options{OldRoot: "/home/a", NewRoot: "/mnt/new"}, absPath: "/home/ab/1.txt", want: "/mnt/new/home/ab/1.txt"},
+		{name: "no old root", options: Options{NewRoot: "/mnt/new"}, absPath: "/home/a/1.txt", want: "/mnt/new/home/a/1.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.Target(filepath.FromSlash(tt.absPath)); got != filepath.FromSlash(tt.want) {
+				t.Errorf("Target() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEta(t *testing.T) {
+	if got := eta(300, 100, 10*time.Second); got != 30*time.Second {
+		t.Errorf("eta() = %v, want 30s", got)
+	}
+	if got := eta(300, 0, 10*time.Second); got != 0 {
+		t.Errorf("eta() without download = %v, want 0", got)
+	}
+}
+
+func TestJob_RestoreBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restore")
+	if err != nil {
+		t.Fatalf("create temp dir error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(src, 0755)
+	var files []string
+	for name, content := range map[string]string{"a.txt": "hello", "b.txt": "world"} {
+		path := filepath.Join(src, name)
+		ioutil.WriteFile(path, []byte(content), 0644)
+		files = append(files, path)
+	}
+	// 已经下载的包不再从网盘下载
+	bundle := filepath.Join(dir, "work", "bundle.tar")
+	packed, err := pack.WriteBundle(context.Background(), bundle, files)
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+	var entries []*model.PackEntry
+	for _, entry := range packed {
+		modTime := entry.ModTime
+		entries = append(entries, &model.PackEntry{AbsPath: entry.Path, Name: entry.Name, Offset: entry.Offset, Size: entry.Size, Md5: entry.Md5, ModTime: &modTime})
+	}
+	entries[1].Md5 = "bad"
+
+	j := newJob(context.Background(), &model.RestoreJob{}, &Options{OldRoot: src, NewRoot: filepath.Join(dir, "dst")})
+	if err := j.restoreBundle(context.Background(), "/bundle.tar", bundle, j.pendingEntries(entries)); err != nil {
+		t.Fatalf("restoreBundle() error = %v", err)
+	}
+	if progress := j.Progress(); progress.RestoredCount != 1 || progress.FailedCount != 1 || progress.RestoredBytes != entries[0].Size {
+		t.Errorf("Progress() = %+v, want 1 restored and 1 failed", progress)
+	}
+	target := j.options.Target(entries[0].AbsPath)
+	if data, _ := ioutil.ReadFile(target); filepath.Base(target) != entries[0].Name || len(data) != int(entries[0].Size) {
+		t.Errorf("restored file %s content = %q", target, data)
+	}
+	if _, err := os.Stat(bundle); !os.IsNotExist(err) {
+		t.Errorf("bundle not removed after extract, err = %v", err)
+	}
+
+	// 再次恢复时按大小和修改时间跳过
+	j = newJob(context.Background(), &model.RestoreJob{}, j.options)
+	if pending := j.pendingEntries(entries[:1]); len(pending) != 0 || j.Progress().RestoredCount != 1 {
+		t.Errorf("pendingEntries() = %d, want restored file skipped", len(pending))
+	}
+}
+
+func TestBackupRoot(t *testing.T) {
+	roots := []string{filepath.FromSlash("/home"), filepath.FromSlash("/home/a"), filepath.FromSlash("/data")}
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{name: "backup path", dir: "/data", want: "/data"},
+		{name: "nearest root", dir: "/home/a/b", want: "/home/a"},
+		{name: "sibling prefix", dir: "/home/ab", want: "/home"},
+		{name: "not backed up", dir: "/tmp/x", want: "/tmp/x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backupRoot(filepath.FromSlash(tt.dir), roots); got != filepath.FromSlash(tt.want) {
+				t.Errorf("backupRoot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package restore
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+	"backup/pkg/pack"
+)
+
+// ErrVersionNotFound 快照中的内容已经被覆盖，网盘中没有保留
+var ErrVersionNotFound = errors.New("version not found")
+
+// ErrNotRecoverable 没有快照的路径下的文件在时间点之后被修改过，时间点时的内容已经无法恢复
+var ErrNotRecoverable = errors.New("not recoverable at point in time")
+
+// plan 指定时间点时，有快照的路径按快照中的文件恢复，没有快照的路径只能恢复修改时间不晚于时间点的文件
+// 没有快照的路径下之后被修改过的文件由run记录为无法恢复
+func (j *Job) plan() ([]string, []*model.SnapshotEntry, error) {
+	if j.options.PointInTime == nil {
+		return j.options.BackupPaths, nil, nil
+	}
+	var roots []string
+	for _, backupPath := range dao.NewBackupPathDao(j.ctx, database.DB).GetAll() {
+		roots = append(roots, backupPath.AbsPath)
+	}
+
+	snapshotDao := dao.NewSnapshotDao(j.ctx, database.DB)
+	var latestPaths []string
+	var entries []*model.SnapshotEntry
+	for _, dir := range j.options.BackupPaths {
+		root := backupRoot(dir, roots)
+		snapshot, err := snapshotDao.QueryAsOf(root, j.options.PointInTime)
+		if err == gorm.ErrRecordNotFound {
+			logger.Logger.WithContext(j.ctx).WithField("dir", dir).Warn("no snapshot before point in time, files changed later are not recoverable")
+			latestPaths = append(latestPaths, dir)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if dir == root {
+			dir = ""
+		}
+		state, err := snapshotDao.QueryState(root, snapshot.ID, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, state...)
+	}
+	return latestPaths, entries, nil
+}
+
+// backupRoot 包含dir的备份路径，选择的是备份路径下的子目录时快照按备份路径查询
+func backupRoot(dir string, roots []string) string {
+	res := dir
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			continue
+		}
+		if res == dir || len(root) > len(res) {
+			res = root
+		}
+	}
+	return res
+}
+
+// restoreEntry 恢复快照中的一个文件，内容按md5查找，可能是当前上传的文件、打包的小文件或者保留的旧内容
+func (j *Job) restoreEntry(ctx context.Context, entry *model.SnapshotEntry) error {
+	target := j.options.Target(entry.AbsPath)
+	if upToDate(target, entry.Size, entry.ModTime) {
+		j.restored(entry.Size, false)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return errors.Wrap(err, "create target dir fail")
+	}
+	tmp := target + ".restore"
+	if err := j.fetchContent(ctx, entry, tmp); err != nil {
+		return err
+	}
+	if err := verify(ctx, tmp, entry.Md5); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if entry.ModTime != nil {
+		if err := os.Chtimes(tmp, *entry.ModTime, *entry.ModTime); err != nil {
+			logger.Logger.WithContext(ctx).WithError(err).WithField("target", target).Warn("restore mod time fail")
+		}
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "rename restored file fail")
+	}
+	j.restored(entry.Size, true)
+	return nil
+}
+
+func (j *Job) fetchContent(ctx context.Context, entry *model.SnapshotEntry, target string) error {
+	if info, err := dao.NewFileInfoDao(ctx, database.DB).QueryUploadedByMd5(entry.Md5, ""); err == nil {
+		return j.remote.fetch(ctx, info.ServerPath, target)
+	}
+	if packEntry, err := dao.NewPackEntryDao(ctx, database.DB).QueryByMd5(entry.Md5); err == nil {
+		bundle, err := j.objects.get(packEntry.BundlePath, func(local string) error {
+			return j.remote.fetch(ctx, packEntry.BundlePath, local)
+		})
+		if err != nil {
+			return errors.Wrap(err, "download bundle fail")
+		}
+		return extractSection(ctx, bundle, entry, packEntry.Offset, target)
+	}
+	version, err := dao.NewVersionDao(ctx, database.DB).QueryByMd5(entry.Md5)
+	if err != nil {
+		return errors.Wrapf(ErrVersionNotFound, "md5 is %s", entry.Md5)
+	}
+	if !version.Packed {
+		return j.remote.fetchFull(ctx, version.ServerPath, target)
+	}
+	object, err := j.objects.get(version.ServerPath, func(local string) error {
+		return j.remote.fetchFull(ctx, version.ServerPath, local)
+	})
+	if err != nil {
+		return errors.Wrap(err, "download version fail")
+	}
+	return extractSection(ctx, object, entry, version.Offset, target)
+}
+
+// extractSection 从下载的包中取出一段内容，pack.Extract会校验md5
+func extractSection(ctx context.Context, bundle string, entry *model.SnapshotEntry, offset int64, target string) error {
+	file, err := os.Open(bundle)
+	if err != nil {
+		return errors.Wrap(err, "open bundle fail")
+	}
+	defer file.Close()
+	section := &pack.Entry{Path: entry.AbsPath, Offset: offset, Size: entry.Size, Md5: entry.Md5}
+	if entry.ModTime != nil {
+		section.ModTime = *entry.ModTime
+	}
+	return pack.Extract(ctx, file, section, target)
+}
+
+// objectCache 多个文件共用的包只下载一次，任务结束时随临时目录一起删除
+type objectCache struct {
+	dir     string
+	mux     sync.Mutex
+	objects map[string]*cachedObject
+}
+
+type cachedObject struct {
+	once  sync.Once
+	local string
+	err   error
+}
+
+func newObjectCache(dir string) *objectCache {
+	return &objectCache{dir: dir, objects: map[string]*cachedObject{}}
+}
+
+// get 返回key对应的本地文件，第一次使用时调用fetch下载，下载失败不缓存
+func (c *objectCache) get(key string, fetch func(local string) error) (string, error) {
+	c.mux.Lock()
+	object, ok := c.objects[key]
+	if !ok {
+		object = &cachedObject{local: filepath.Join(c.dir, fmt.Sprintf("%x", md5.Sum([]byte(key))))}
+		c.objects[key] = object
+	}
+	c.mux.Unlock()
+
+	object.once.Do(func() {
+		if _, err := os.Stat(object.local); err == nil { // 上次中断前已经下载完整
+			return
+		}
+		if err := os.MkdirAll(c.dir, 0755); err != nil {
+			object.err = errors.Wrap(err, "create cache dir fail")
+			return
+		}
+		object.err = fetch(object.local)
+	})
+	if object.err != nil {
+		c.mux.Lock()
+		if c.objects[key] == object {
+			delete(c.objects, key)
+		}
+		c.mux.Unlock()
+		return "", object.err
+	}
+	return object.local, nil
+}
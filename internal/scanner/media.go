@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/internal/statistics"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+	"backup/pkg/media"
+	"backup/pkg/util"
+	"backup/ui/upload_ui"
+)
+
+// uploadMedia 媒体模式下上传照片和视频，按拍摄时间放到相册目录，不同文件夹中的重复文件只上传一次
+func uploadMedia(ctx context.Context, path string, kind int, hash *util.FileHash, fileInfo *model.FileInfo, isNew bool, task *scanTask, recorder *statistics.RunRecorder) {
+	baseLogger := logger.Logger.WithContext(ctx).WithField("path", path)
+	fileInfoDao := dao.NewFileInfoDao(ctx, database.DB)
+	mediaFileDao := dao.NewMediaFileDao(ctx, database.DB)
+
+	if !needUpload(fileInfo, hash, isNew) {
+		recorder.Skipped()
+		if fileInfo.ChunkSize != hash.ChunkSize || fileInfo.BlockList == "" { // 内容没变，只更新缓存的分片MD5
+			fileInfoDao.Update(model.HashUpdates(hash), path)
+		}
+		return
+	}
+
+	updates := model.HashUpdates(hash)
+	record, err := mediaFileDao.QueryByMd5(hash.Md5)
+	if err == nil && record.AbsPath != path { // 其他文件夹中已经有相同的文件
+		switch originStatus(ctx, record, hash.Md5) {
+		case consts.UploadStatusUploaded: // 原文件已经上传成功，不再上传
+			baseLogger.WithField("origin", record.AbsPath).WithField("server_path", record.ServerPath).Info("duplicate media file, skip")
+			recorder.Skipped()
+			updates["server_path"] = record.ServerPath
+			updates["upload_status"] = consts.UploadStatusUploaded
+			fileInfoDao.Update(updates, path)
+			return
+		case consts.UploadStatusWaitUploaded, consts.UploadStatusUploading, consts.UploadStatusPaused:
+			// 原文件还在上传队列中，不知道能不能上传成功，保持未上传状态，下次扫描时再检查
+			baseLogger.WithField("origin", record.AbsPath).Info("duplicate media file, origin is not uploaded yet")
+			recorder.Skipped()
+			return
+		}
+		// 原文件上传失败、已经修改或者删除，由当前文件上传到原来的路径
+		baseLogger.WithField("origin", record.AbsPath).WithField("server_path", record.ServerPath).Info("duplicate media file, origin upload fail, take over")
+		if err := mediaFileDao.Save(&model.MediaFile{Md5: hash.Md5, AbsPath: path, ServerPath: record.ServerPath}); err != nil {
+			return
+		}
+	}
+
+	var serverPath string
+	if err == nil { // 同一个文件重新上传，使用原来的路径
+		serverPath = record.ServerPath
+	} else {
+		serverPath = albumServerPath(ctx, path, hash.Md5, mediaFileDao)
+		if err := mediaFileDao.Save(&model.MediaFile{Md5: hash.Md5, AbsPath: path, ServerPath: serverPath}); err != nil {
+			return
+		}
+	}
+	updates["server_path"] = serverPath
+	if err := fileInfoDao.Update(updates, path); err != nil {
+		baseLogger.WithError(err).Error("update media file info fail")
+	}
+
+	recorder.Changed()
+	item := upload_ui.NewUploadItem(path, serverPath, task.list).WithRecorder(recorder).WithPriority(task.priority).WithMode(media.Mode(kind)).WithHash(hash)
+	task.list.AddItem(ctx, item)
+}
+
+// originStatus 记录中原文件的上传状态，原文件内容已经改变或者不存在时返回上传失败
+// 记录在入队时就保存，用来占用相册中的路径，是否上传成功需要查看原文件的状态
+func originStatus(ctx context.Context, record *model.MediaFile, md5 string) int {
+	origin, err := dao.NewFileInfoDao(ctx, database.DB).QueryByAbsPath(record.AbsPath)
+	if err != nil || origin.Md5 != md5 || origin.ServerPath != record.ServerPath {
+		return consts.UploadStatusFail
+	}
+	return int(origin.UploadStatus)
+}
+
+// albumServerPath 相册中的路径，同一个月中有同名的不同文件时在文件名后加上md5前缀
+func albumServerPath(ctx context.Context, path, md5 string, mediaFileDao *dao.MediaFileDao) string {
+	name := filepath.Base(path)
+	serverPath := media.AlbumPath(media.CaptureTime(path), name)
+	if exist, err := mediaFileDao.ExistServerPath(serverPath); err == nil && !exist {
+		return serverPath
+	}
+	ext := filepath.Ext(name)
+	name = strings.TrimSuffix(name, ext) + "_" + md5[:8] + ext
+	logger.Logger.WithContext(ctx).WithField("path", path).WithField("name", name).Info("album name conflict, rename")
+	return media.AlbumPath(media.CaptureTime(path), name)
+}
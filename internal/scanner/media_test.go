@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/pkg/database"
+)
+
+func Test_originStatus(t *testing.T) {
+	const md5 = "0123456789abcdef0123456789abcdef"
+	const serverPath = "/相册/2026/10/1.jpg"
+	fileInfoDao := dao.NewFileInfoDao(context.Background(), database.DB)
+	tests := []struct {
+		name   string
+		origin *model.FileInfo
+		want   int
+	}{
+		{
+			name:   "uploaded",
+			origin: &model.FileInfo{AbsPath: "/media_test/uploaded.jpg", Md5: md5, ServerPath: serverPath, UploadStatus: consts.UploadStatusUploaded},
+			want:   consts.UploadStatusUploaded,
+		},
+		{
+			name:   "wait uploaded",
+			origin: &model.FileInfo{AbsPath: "/media_test/wait.jpg", Md5: md5, ServerPath: serverPath, UploadStatus: consts.UploadStatusWaitUploaded},
+			want:   consts.UploadStatusWaitUploaded,
+		},
+		{
+			name:   "upload fail",
+			origin: &model.FileInfo{AbsPath: "/media_test/fail.jpg", Md5: md5, ServerPath: serverPath, UploadStatus: consts.UploadStatusFail},
+			want:   consts.UploadStatusFail,
+		},
+		{
+			name:   "origin changed",
+			origin: &model.FileInfo{AbsPath: "/media_test/changed.jpg", Md5: "fedcba9876543210fedcba9876543210", ServerPath: serverPath, UploadStatus: consts.UploadStatusUploaded},
+			want:   consts.UploadStatusFail,
+		},
+		{
+			name: "origin removed",
+			want: consts.UploadStatusFail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			absPath := "/media_test/removed.jpg"
+			if tt.origin != nil {
+				absPath = tt.origin.AbsPath
+				if err := fileInfoDao.Add(tt.origin); err != nil {
+					t.Fatalf("add file info fail: %v", err)
+				}
+				defer fileInfoDao.DB.Table(model.FileInfoTableName).Where("abs_path = ?", absPath).Delete(&model.FileInfo{})
+			}
+			record := &model.MediaFile{Md5: md5, AbsPath: absPath, ServerPath: serverPath}
+			if got := originStatus(context.Background(), record, md5); got != tt.want {
+				t.Errorf("originStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"path/filepath"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/internal/snapshot"
+	"backup/internal/statistics"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+	"backup/pkg/pack"
+	"backup/pkg/util"
+	"backup/ui/upload_ui"
+)
+
+// smallFile 需要打包上传的小文件
+type smallFile struct {
+	path string
+	hash *util.FileHash
+}
+
+// bundleLocalPath 目录对应的本地打包文件，按目录路径的md5命名
+func bundleLocalPath(dir string) string {
+	sum := md5.Sum([]byte(dir))
+	path, _ := filepath.Abs(filepath.Join(consts.BundleDir, hex.EncodeToString(sum[:])+".tar"))
+	return path
+}
+
+// packAndUpload 把目录下的小文件打包成一个tar上传，有文件变化或者包还没有上传成功时重新打包
+func packAndUpload(ctx context.Context, dir string, files []*smallFile, task *scanTask, recorder *statistics.RunRecorder) {
+	baseLogger := logger.Logger.WithContext(ctx).WithField("dir", dir)
+	serverPath := util.GenerateServerFile(filepath.Join(dir, consts.BundleName), task.excludePrefix)
+	localPath := bundleLocalPath(dir)
+	packEntryDao := dao.NewPackEntryDao(ctx, database.DB)
+	fileInfoDao := dao.NewFileInfoDao(ctx, database.DB)
+
+	// 和上一次打包的内容比较，文件有增删或者md5变化时需要重新打包
+	entries, err := packEntryDao.QueryByBundlePath(serverPath)
+	packedMd5 := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		packedMd5[entry.AbsPath] = entry.Md5
+	}
+	changed := err != nil || len(entries) != len(files)
+	for _, file := range files {
+		if packedMd5[file.path] != file.hash.Md5 {
+			changed = true
+			recorder.Changed()
+		} else {
+			recorder.Skipped()
+		}
+	}
+	bundleInfo, err := fileInfoDao.QueryByAbsPath(localPath)
+	if !changed && err == nil && (bundleInfo.UploadStatus == consts.UploadStatusUploaded || bundleInfo.UploadStatus == consts.UploadStatusUploading || bundleInfo.UploadStatus == consts.UploadStatusWaitUploaded) {
+		return
+	}
+	if bundleInfo != nil && bundleInfo.UploadStatus == consts.UploadStatusUploaded { // 重新打包上传前保留快照引用的旧包
+		snapshot.PreserveBundle(ctx, serverPath, bundleInfo.Md5, entries)
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.path)
+	}
+	packed, err := pack.WriteBundle(ctx, localPath, paths)
+	if err != nil {
+		baseLogger.WithError(err).Error("write bundle fail")
+		return
+	}
+	hash, err := util.HashFile(ctx, localPath, task.chunkSize)
+	if err != nil {
+		baseLogger.WithError(err).Error("hash bundle fail")
+		return
+	}
+
+	records := make([]*model.PackEntry, 0, len(packed))
+	for _, entry := range packed {
+		modTime := entry.ModTime
+		records = append(records, &model.PackEntry{
+			AbsPath:    entry.Path,
+			BundlePath: serverPath,
+			Name:       entry.Name,
+			Offset:     entry.Offset,
+			Size:       entry.Size,
+			Md5:        entry.Md5,
+			ModTime:    &modTime,
+		})
+	}
+	if err := packEntryDao.Replace(serverPath, records); err != nil {
+		return
+	}
+
+	// 包按普通文件上传，上传状态记录在包的文件信息中
+	if bundleInfo == nil {
+		if err := fileInfoDao.Add(model.NewFileInfoWithHash(localPath, filepath.Dir(localPath), hash)); err != nil {
+			baseLogger.WithError(err).Error("add bundle file info fail")
+			return
+		}
+	} else {
+		fileInfoDao.Update(model.HashUpdates(hash), localPath)
+	}
+	baseLogger.WithField("server_path", serverPath).WithField("file_count", len(packed)).Info("pack small files success")
+	item := upload_ui.NewUploadItem(localPath, serverPath, task.list).WithRecorder(recorder).WithPriority(task.priority).WithHash(hash)
+	task.list.AddItem(ctx, item)
+}
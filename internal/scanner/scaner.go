@@ -5,14 +5,22 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gorm.io/gorm"
 
 	"backup/consts"
+	"backup/internal/config"
 	"backup/internal/dao"
+	"backup/internal/guard"
 	"backup/internal/model"
+	"backup/internal/snapshot"
+	"backup/internal/statistics"
 	"backup/pkg/database"
 	"backup/pkg/logger"
+	"backup/pkg/media"
+	"backup/pkg/metrics"
+	"backup/pkg/pcs_client"
 	"backup/pkg/util"
 	"backup/ui/upload_ui"
 )
@@ -63,9 +71,44 @@ func (s *Scanner) Cancel() {
 	s.cancelFunc()
 }
 
+// scanTask 一次扫描上传过程中共享的参数
+type scanTask struct {
+	excludePrefix string                  // 上传文件时需要排除的
+	priority      int                     // 备份路径的上传优先级
+	list          *upload_ui.UploadList   // 上传列表
+	recorder      *statistics.RunRecorder // 本次备份的统计
+	chunkSize     int64                   // 计算分片MD5的分片大小，和上传时一致
+	pack          bool                    // 是否把小文件打包上传
+	compress      string                  // 上传前使用的压缩算法
+	packThreshold int64                   // 小于这个大小的文件打包上传
+	media         bool                    // 照片和视频是否按拍摄时间上传到相册目录
+	guard         *guard.Guard            // 检查疑似勒索软件加密的异常修改
+}
+
 // ScanAndUpload 扫描并上传
 func (s *Scanner) ScanAndUpload() {
-	scanAndUpload(s.ctx, s.root, s.excludePrefix, upload_ui.ExportUploadList) // 扫描并上传
+	start := time.Now()
+	task := &scanTask{
+		excludePrefix: s.excludePrefix,
+		list:          upload_ui.ExportUploadList,
+		recorder:      statistics.NewRunRecorder(s.ctx, s.root),
+		chunkSize:     pcs_client.ChunkSize(s.ctx),
+		packThreshold: config.GetPackThreshold(),
+	}
+	// 每次扫描时重新读取优先级和打包设置，界面上修改后下一次扫描生效
+	if backupPath, err := dao.NewBackupPathDao(s.ctx, database.DB).QueryByAbsPath(s.root); err == nil {
+		task.priority = backupPath.Priority
+		task.pack = backupPath.Pack
+		task.compress = backupPath.Compress
+		task.media = backupPath.Media
+	}
+	task.guard = guard.New(s.ctx, s.root, task.recorder)
+	err := scanAndUpload(s.ctx, s.root, task) // 扫描并上传
+	if reason := task.guard.Finish(); reason != "" {
+		task.list.Suspend(s.root, reason)
+	}
+	task.recorder.ScanFinish(err)
+	metrics.ScanDuration.Observe(time.Since(start).Seconds())
 }
 
 // 扫描入库
@@ -111,10 +154,12 @@ func (s *Scanner) scan(dirname string, fileInfoDao *dao.FileInfoDao) {
 	logger.Logger.WithField("path", dirname).Info("end get subdir")
 }
 
-func scanAndUpload(ctx context.Context, root, excludePrefix string, list *upload_ui.UploadList) {
+func scanAndUpload(ctx context.Context, root string, task *scanTask) error {
+	excludePrefix, list, recorder := task.excludePrefix, task.list, task.recorder
 	baseLogger := logger.Logger.WithContext(ctx)
 
 	fileInfoDao := dao.NewFileInfoDao(ctx, database.DB)
+	var smallFiles []*smallFile // 当前目录下需要打包的小文件，子目录单独打包
 	err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
 		select {
 		case <-ctx.Done(): // 监听取消
@@ -137,53 +182,92 @@ func scanAndUpload(ctx context.Context, root, excludePrefix string, list *upload
 		// 如果是文件夹，递归扫描上传
 		if info.IsDir() {
 			<-semaphore // 防止嵌套太深的情况下出现死锁
-			scanAndUpload(ctx, path, excludePrefix, upload_ui.ExportUploadList)
-			return nil
+			scanAndUpload(ctx, path, task)
+			return filepath.SkipDir // 子目录已经递归扫描过，防止重复扫描
 		}
 
 		defer func() {
 			<-semaphore
 		}()
 		path = filepath.Clean(path) // 路径规范
-		// 计算MD5值
-		md5, err := util.GetFileMd5(ctx, path)
+		recorder.Scanned()
+		// 一次读取同时计算文件MD5、分片MD5和校验段MD5，上传时直接使用
+		hash, err := util.HashFile(ctx, path, task.chunkSize)
 		if err != nil {
 			baseLogger.WithField("path", path).WithError(err).Error("generate file md5 fail")
+			return nil
 		}
 
 		fileInfo, err := fileInfoDao.QueryByAbsPath(path)
 		if err != nil && err != gorm.ErrRecordNotFound { // 查找出错了，当错没有查到
 			baseLogger.WithField("path", path).WithError(err).Error("query file info fail")
-			fileInfo = model.NewFileInfo(path, excludePrefix)
-			err := fileInfoDao.Add(fileInfo)
-			if err != nil {
+		}
+		if err != nil {
+			fileInfo = model.NewFileInfoWithHash(path, excludePrefix, hash)
+			if err := fileInfoDao.Add(fileInfo); err != nil {
 				baseLogger.WithField("path", path).WithError(err).Error("add file info fail")
 				return nil
 			}
-		} else if err == gorm.ErrRecordNotFound { // 如果没有查到
-			fileInfo = model.NewFileInfo(path, excludePrefix)
-			err := fileInfoDao.Add(fileInfo)
-			if err != nil {
-				baseLogger.WithField("path", path).WithError(err).Error("add file info fail")
+		}
+
+		isNew := err == gorm.ErrRecordNotFound
+		changed := isNew || hash.Md5 != fileInfo.Md5
+		if changed { // 新增或者修改的文件先检查是否是异常的修改
+			modified := !isNew && fileInfo.Md5 != ""
+			task.guard.Observe(path, modified, fileInfo.Entropy, hash)
+		}
+
+		if kind := media.KindOf(path); task.media && kind != media.KindOther { // 照片和视频单独上传，不打包也不压缩
+			if !needUpload(fileInfo, hash, isNew) {
+				uploadMedia(ctx, path, kind, hash, fileInfo, isNew, task, recorder)
 				return nil
 			}
+			// 照片和视频按md5放到相册目录，不会覆盖网盘中已有的内容
+			task.guard.Run(func(recorder *statistics.RunRecorder) {
+				uploadMedia(ctx, path, kind, hash, fileInfo, isNew, task, recorder)
+			})
+			return nil
 		}
 
-		if md5 == "" || err == gorm.ErrRecordNotFound {
-			item := upload_ui.NewUploadItem(path, util.GenerateServerFile(path, excludePrefix), list)
-			list.AddItem(ctx, item)
-		} else if md5 != fileInfo.Md5 || (fileInfo.UploadStatus != consts.UploadStatusUploaded && fileInfo.UploadStatus != consts.UploadStatusUploading && fileInfo.UploadStatus != consts.UploadStatusWaitUploaded) { // 如果不相等，或者状态为未上传
-			item := upload_ui.NewUploadItem(path, util.GenerateServerFile(path, excludePrefix), list)
-			list.AddItem(ctx, item)
-			err := fileInfoDao.Update(map[string]interface{}{
-				"md5":  md5,
-				"size": util.GetFileSize(ctx, path),
-			}, fileInfo.AbsPath)
+		if task.pack && info.Size() < task.packThreshold { // 小文件在目录扫描完成后一起打包
+			if err == nil && (fileInfo.Md5 != hash.Md5 || fileInfo.ChunkSize != hash.ChunkSize || fileInfo.BlockList == "") {
+				fileInfoDao.Update(model.HashUpdates(hash), fileInfo.AbsPath)
+			}
+			smallFiles = append(smallFiles, &smallFile{path: path, hash: hash})
+			return nil
+		}
+
+		if !needUpload(fileInfo, hash, isNew) {
+			recorder.Skipped()
+			if fileInfo.ChunkSize != hash.ChunkSize || fileInfo.BlockList == "" { // 内容没变，只更新缓存的分片MD5
+				if err := fileInfoDao.Update(model.HashUpdates(hash), fileInfo.AbsPath); err != nil {
+					baseLogger.WithField("path", path).WithError(err).Error("update file hash cache fail")
+				}
+			}
+			return nil
+		}
 
-			if err != nil {
+		recorder.Changed()
+		overwrite := !isNew && fileInfo.UploadStatus == consts.UploadStatusUploaded && hash.Md5 != fileInfo.Md5
+		upload := func(recorder *statistics.RunRecorder) {
+			if overwrite { // 重新上传前保留快照引用的旧内容
+				snapshot.Preserve(ctx, fileInfo)
+			}
+			item := upload_ui.NewUploadItem(path, util.GenerateServerFile(path, excludePrefix), list).WithRecorder(recorder).WithPriority(task.priority).WithCompress(task.compress).WithHash(hash)
+			list.AddItem(ctx, item)
+			if isNew {
+				return
+			}
+			// 上传入队后再更新md5，暂停期间程序退出时下一次扫描还能发现修改
+			if err := fileInfoDao.Update(model.HashUpdates(hash), fileInfo.AbsPath); err != nil {
 				baseLogger.WithField("path", path).WithError(err).Error("upload item md5 fail")
 			}
 		}
+		if overwrite { // 覆盖网盘中已有的内容，扫描结束确认没有异常后再上传
+			task.guard.Defer(upload)
+		} else {
+			task.guard.Run(upload)
+		}
 
 		return nil
 	})
@@ -191,4 +275,18 @@ func scanAndUpload(ctx context.Context, root, excludePrefix string, list *upload
 	if err != nil {
 		baseLogger.WithField("root", root).WithError(err).Errorf("walk fail")
 	}
+	if len(smallFiles) > 0 && ctx.Err() == nil { // 重新打包会覆盖网盘中的包，扫描结束确认没有异常后再上传
+		task.guard.Defer(func(recorder *statistics.RunRecorder) {
+			packAndUpload(ctx, root, smallFiles, task, recorder)
+		})
+	}
+	return err
+}
+
+// needUpload 新增、内容变化或者还没有上传的文件需要上传
+func needUpload(fileInfo *model.FileInfo, hash *util.FileHash, isNew bool) bool {
+	if isNew || hash.Md5 != fileInfo.Md5 {
+		return true
+	}
+	return fileInfo.UploadStatus != consts.UploadStatusUploaded && fileInfo.UploadStatus != consts.UploadStatusUploading && fileInfo.UploadStatus != consts.UploadStatusWaitUploaded
 }
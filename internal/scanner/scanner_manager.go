@@ -37,11 +37,7 @@ func (s *scannerManager) Start(ctx context.Context) {
 		for {
 			select {
 			case <-ticker.C:
-				s.lock.Lock()
-				for _, scanner := range s.scanners {
-					go scanner.ScanAndUpload()
-				}
-				s.lock.Unlock()
+				s.ScanNow()
 			case <-ctx.Done():
 				return
 			}
@@ -49,6 +45,15 @@ func (s *scannerManager) Start(ctx context.Context) {
 	}()
 }
 
+// ScanNow 立即扫描所有备份路径
+func (s *scannerManager) ScanNow() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, scanner := range s.scanners {
+		go scanner.ScanAndUpload()
+	}
+}
+
 func (s *scannerManager) Add(scanner *Scanner) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
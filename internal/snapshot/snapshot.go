@@ -0,0 +1,259 @@
+package snapshot
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/pkg/compress"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+	"backup/pkg/pcs_client"
+)
+
+// Create 备份路径成功运行一次之后创建快照，只记录和上一个快照相比变化的文件
+func Create(ctx context.Context, backupPath string, runId uint64) (*model.Snapshot, error) {
+	baseLogger := logger.Logger.WithContext(ctx).WithField("backup_path", backupPath)
+	snapshotDao := dao.NewSnapshotDao(ctx, database.DB)
+
+	current, err := currentState(ctx, backupPath)
+	if err != nil {
+		return nil, err
+	}
+	var previous []*model.SnapshotEntry
+	last, err := snapshotDao.QueryAsOf(backupPath, nil)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	if err == nil {
+		if previous, err = snapshotDao.QueryState(backupPath, last.ID, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := diff(previous, current)
+	snapshot := &model.Snapshot{
+		BackupPath:  backupPath,
+		RunId:       runId,
+		FileCount:   int64(len(current)),
+		ChangeCount: int64(len(changes)),
+	}
+	for _, entry := range current {
+		snapshot.TotalSize += entry.Size
+	}
+	if err := snapshotDao.Create(snapshot, changes); err != nil {
+		return nil, err
+	}
+	baseLogger.WithField("snapshot", snapshot).Info("create snapshot success")
+	return snapshot, nil
+}
+
+// currentState 数据库中备份路径下已经上传的文件，包括打包上传的小文件
+func currentState(ctx context.Context, backupPath string) ([]*model.SnapshotEntry, error) {
+	var res []*model.SnapshotEntry
+	err := dao.NewFileInfoDao(ctx, database.DB).EachRestore([]string{backupPath}, nil, func(infos []*model.FileInfo) error {
+		for _, info := range infos {
+			res = append(res, &model.SnapshotEntry{AbsPath: info.AbsPath, Md5: info.Md5, Size: info.Size, ModTime: info.ModTime})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := dao.NewPackEntryDao(ctx, database.DB).QueryRestore([]string{backupPath}, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		res = append(res, &model.SnapshotEntry{AbsPath: entry.AbsPath, Md5: entry.Md5, Size: entry.Size, ModTime: entry.ModTime})
+	}
+	return res, nil
+}
+
+// diff 和上一个快照相比新增、修改和删除的文件
+func diff(previous, current []*model.SnapshotEntry) []*model.SnapshotEntry {
+	before := make(map[string]*model.SnapshotEntry, len(previous))
+	for _, entry := range previous {
+		before[entry.AbsPath] = entry
+	}
+	var res []*model.SnapshotEntry
+	for _, entry := range current {
+		old, ok := before[entry.AbsPath]
+		delete(before, entry.AbsPath)
+		if ok && old.Md5 == entry.Md5 && old.Size == entry.Size && sameTime(old.ModTime, entry.ModTime) {
+			continue
+		}
+		res = append(res, entry)
+	}
+	for _, entry := range before {
+		res = append(res, &model.SnapshotEntry{AbsPath: entry.AbsPath, Deleted: true})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].AbsPath < res[j].AbsPath
+	})
+	return res
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// Node 浏览快照时目录下的一项
+type Node struct {
+	Name      string
+	Path      string
+	IsDir     bool
+	Size      int64      // 文件大小，目录是其中所有文件的大小
+	FileCount int64      // 目录中的文件数
+	ModTime   *time.Time // 文件修改时间
+}
+
+// Browse 查看备份路径在t之前最近的快照中dir目录下的文件和子目录，t为空时查看最新的快照
+func Browse(ctx context.Context, backupPath string, t *time.Time, dir string) (*model.Snapshot, []*Node, error) {
+	snapshotDao := dao.NewSnapshotDao(ctx, database.DB)
+	snapshot, err := snapshotDao.QueryAsOf(backupPath, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := snapshotDao.QueryState(backupPath, snapshot.ID, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, children(dir, entries), nil
+}
+
+// children 把目录下的所有文件按直接的子目录汇总
+func children(dir string, entries []*model.SnapshotEntry) []*Node {
+	var res []*Node
+	dirs := map[string]*Node{}
+	for _, entry := range entries {
+		rel, err := filepath.Rel(dir, entry.AbsPath)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		parts := strings.SplitN(rel, string(filepath.Separator), 2)
+		if len(parts) == 1 {
+			res = append(res, &Node{Name: parts[0], Path: entry.AbsPath, Size: entry.Size, FileCount: 1, ModTime: entry.ModTime})
+			continue
+		}
+		node, ok := dirs[parts[0]]
+		if !ok {
+			node = &Node{Name: parts[0], Path: filepath.Join(dir, parts[0]), IsDir: true}
+			dirs[parts[0]] = node
+			res = append(res, node)
+		}
+		node.Size += entry.Size
+		node.FileCount++
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].IsDir != res[j].IsDir {
+			return res[i].IsDir
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// Preserve 已经上传的文件内容发生变化，重新上传会覆盖网盘中的旧内容
+// 旧内容被快照引用并且没有其他副本时，先在网盘中复制到版本目录，拆分上传的大文件不保留
+func Preserve(ctx context.Context, fileInfo *model.FileInfo) {
+	baseLogger := logger.Logger.WithContext(ctx).WithField("abs_path", fileInfo.AbsPath).WithField("md5", fileInfo.Md5)
+	if !needPreserve(ctx, fileInfo.Md5, fileInfo.AbsPath) {
+		return
+	}
+	src, err := lookup(ctx, pcs_client.FullPath(fileInfo.ServerPath))
+	if err != nil {
+		baseLogger.WithError(err).Warn("old version not found, skip preserve")
+		return
+	}
+	dest := versionPath(fileInfo.Md5, strings.TrimPrefix(src.Path, pcs_client.FullPath(fileInfo.ServerPath)))
+	if err := pcs_client.Copy(ctx, src.Path, dest); err != nil {
+		baseLogger.WithError(err).Error("preserve old version fail")
+		return
+	}
+	dao.NewVersionDao(ctx, database.DB).Add(&model.Version{Md5: fileInfo.Md5, ServerPath: dest, Size: fileInfo.Size})
+	baseLogger.WithField("dest", dest).Info("preserve old version success")
+}
+
+// PreserveBundle 目录中的小文件重新打包前保留旧的包，快照引用的小文件按包中的位置记录
+func PreserveBundle(ctx context.Context, bundlePath, bundleMd5 string, entries []*model.PackEntry) {
+	baseLogger := logger.Logger.WithContext(ctx).WithField("bundle_path", bundlePath)
+	var preserve []*model.PackEntry
+	for _, entry := range entries {
+		if needPreserve(ctx, entry.Md5, entry.AbsPath) {
+			preserve = append(preserve, entry)
+		}
+	}
+	if len(preserve) == 0 || bundleMd5 == "" {
+		return
+	}
+	src, err := lookup(ctx, pcs_client.FullPath(bundlePath))
+	if err != nil {
+		baseLogger.WithError(err).Warn("old bundle not found, skip preserve")
+		return
+	}
+	dest := versionPath(bundleMd5, path.Ext(consts.BundleName)+strings.TrimPrefix(src.Path, pcs_client.FullPath(bundlePath)))
+	if err := pcs_client.Copy(ctx, src.Path, dest); err != nil {
+		baseLogger.WithError(err).Error("preserve old bundle fail")
+		return
+	}
+	versionDao := dao.NewVersionDao(ctx, database.DB)
+	for _, entry := range preserve {
+		versionDao.Add(&model.Version{Md5: entry.Md5, ServerPath: dest, Packed: true, Offset: entry.Offset, Size: entry.Size})
+	}
+	baseLogger.WithField("dest", dest).WithField("file_count", len(preserve)).Info("preserve old bundle success")
+}
+
+// needPreserve 内容被快照引用，并且没有保留过，也没有其他已经上传的文件是相同的内容
+func needPreserve(ctx context.Context, md5, absPath string) bool {
+	if md5 == "" || !dao.NewSnapshotDao(ctx, database.DB).ExistMd5(md5) {
+		return false
+	}
+	if _, err := dao.NewVersionDao(ctx, database.DB).QueryByMd5(md5); err == nil {
+		return false
+	}
+	_, err := dao.NewFileInfoDao(ctx, database.DB).QueryUploadedByMd5(md5, absPath)
+	return err == gorm.ErrRecordNotFound
+}
+
+// lookup 查找上传的文件，可能压缩过，原文件和压缩后的文件同时存在时使用最近上传的一个
+func lookup(ctx context.Context, fullPath string) (*pcs_client.RemoteFile, error) {
+	files, err := pcs_client.List(ctx, path.Dir(fullPath))
+	if err != nil {
+		return nil, errors.Wrap(err, "list dir fail")
+	}
+	candidates := map[string]bool{}
+	for _, suffix := range compress.Suffixes() {
+		candidates[fullPath+suffix] = true
+	}
+	var res *pcs_client.RemoteFile
+	for _, file := range files {
+		if !candidates[file.Path] {
+			continue
+		}
+		if res == nil || file.ServerMtime > res.ServerMtime {
+			res = file
+		}
+	}
+	if res == nil {
+		return nil, errors.Wrapf(pcs_client.ErrNotFound, "path is %s", fullPath)
+	}
+	return res, nil
+}
+
+// versionPath 保留的旧内容在网盘中带前缀的完整路径，按md5分目录
+func versionPath(md5, ext string) string {
+	return pcs_client.FullPath(path.Join(consts.VersionDir, md5[:2], md5+ext))
+}
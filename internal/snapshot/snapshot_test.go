@@ -0,0 +1,70 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"backup/internal/model"
+)
+
+func TestDiff(t *testing.T) {
+	t1 := time.Unix(1600000000, 0)
+	t2 := time.Unix(1600000100, 0)
+	previous := []*model.SnapshotEntry{
+		{AbsPath: "/a/1.txt", Md5: "m1", Size: 1, ModTime: &t1},
+		{AbsPath: "/a/2.txt", Md5: "m2", Size: 2, ModTime: &t1},
+		{AbsPath: "/a/3.txt", Md5: "m3", Size: 3, ModTime: &t1},
+	}
+	current := []*model.SnapshotEntry{
+		{AbsPath: "/a/4.txt", Md5: "m4", Size: 4, ModTime: &t2},
+		{AbsPath: "/a/1.txt", Md5: "m1", Size: 1, ModTime: &t1},
+		{AbsPath: "/a/2.txt", Md5: "m2-new", Size: 2, ModTime: &t2},
+	}
+	tests := []struct {
+		name     string
+		previous []*model.SnapshotEntry
+		current  []*model.SnapshotEntry
+		want     []*model.SnapshotEntry
+	}{
+		{name: "first snapshot", previous: nil, current: current[:1], want: current[:1]},
+		{name: "no change", previous: previous, current: previous, want: nil},
+		{
+			name:     "add modify delete",
+			previous: previous,
+			current:  current,
+			want: []*model.SnapshotEntry{
+				current[2],
+				{AbsPath: "/a/3.txt", Deleted: true},
+				current[0],
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diff(tt.previous, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChildren(t *testing.T) {
+	dir := filepath.FromSlash("/a")
+	entries := []*model.SnapshotEntry{
+		{AbsPath: filepath.FromSlash("/a/z.txt"), Size: 1},
+		{AbsPath: filepath.FromSlash("/a/b/1.txt"), Size: 2},
+		{AbsPath: filepath.FromSlash("/a/b/c/2.txt"), Size: 3},
+		{AbsPath: filepath.FromSlash("/a/c.txt"), Size: 4},
+		{AbsPath: filepath.FromSlash("/ab/3.txt"), Size: 5},
+	}
+	want := []*Node{
+		{Name: "b", Path: filepath.FromSlash("/a/b"), IsDir: true, Size: 5, FileCount: 2},
+		{Name: "c.txt", Path: filepath.FromSlash("/a/c.txt"), Size: 4, FileCount: 1},
+		{Name: "z.txt", Path: filepath.FromSlash("/a/z.txt"), Size: 1, FileCount: 1},
+	}
+	if got := children(dir, entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("children() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+package statistics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/internal/notification"
+	"backup/internal/snapshot"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+)
+
+// RunRecorder 记录一次扫描上传的统计信息
+// 扫描结束并且所有入队的文件都上传结束后，才认为本次运行结束
+type RunRecorder struct {
+	ctx context.Context
+	run *model.BackupRun
+
+	scannedCount     int64
+	changedCount     int64
+	skippedCount     int64
+	uploadedCount    int64
+	failedCount      int64
+	uploadBytes      int64
+	rapidUploadCount int64
+	dedupCount       int64
+	savedBytes       int64
+
+	pendingCount int64 // 已经入队但还没有上传结束的文件数
+	scanDone     int32 // 扫描是否结束
+	scanFail     int32 // 扫描是否出错
+
+	finishOnce sync.Once
+}
+
+func NewRunRecorder(ctx context.Context, backupPath string) *RunRecorder {
+	now := time.Now()
+	run := &model.BackupRun{
+		BackupPath: backupPath,
+		Status:     consts.BackupRunStatusRunning,
+		StartTime:  &now,
+	}
+	err := dao.NewBackupRunDao(ctx, database.DB).Add(run)
+	if err != nil {
+		logger.Logger.WithContext(ctx).WithField("backup_path", backupPath).WithError(err).Error("add backup run fail")
+	}
+
+	return &RunRecorder{
+		ctx: ctx,
+		run: run,
+	}
+}
+
+// Scanned 扫描到一个文件
+func (r *RunRecorder) Scanned() {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.scannedCount, 1)
+}
+
+// Changed 文件发生变更，需要上传
+func (r *RunRecorder) Changed() {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.changedCount, 1)
+}
+
+// Skipped 文件未发生变更，跳过上传
+func (r *RunRecorder) Skipped() {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.skippedCount, 1)
+}
+
+// UploadStart 文件进入上传队列
+func (r *RunRecorder) UploadStart() {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.pendingCount, 1)
+}
+
+// UploadSuccess 文件上传成功
+func (r *RunRecorder) UploadSuccess(size int64, rapidUpload bool) {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.uploadedCount, 1)
+	if rapidUpload {
+		atomic.AddInt64(&r.rapidUploadCount, 1)
+		atomic.AddInt64(&r.savedBytes, size)
+	} else {
+		atomic.AddInt64(&r.uploadBytes, size)
+	}
+	r.uploadDone()
+}
+
+// UploadCopied 文件通过复制网盘中内容相同的文件完成，没有上传内容
+func (r *RunRecorder) UploadCopied(size int64) {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.uploadedCount, 1)
+	atomic.AddInt64(&r.dedupCount, 1)
+	atomic.AddInt64(&r.savedBytes, size)
+	r.uploadDone()
+}
+
+// UploadFail 文件上传失败
+func (r *RunRecorder) UploadFail() {
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.failedCount, 1)
+	r.uploadDone()
+}
+
+// UploadCancel 文件取消上传，不计入成功或失败
+func (r *RunRecorder) UploadCancel() {
+	if r == nil {
+		return
+	}
+	r.uploadDone()
+}
+
+// ScanFinish 扫描结束，如果没有等待上传的文件，本次运行结束
+func (r *RunRecorder) ScanFinish(err error) {
+	if r == nil {
+		return
+	}
+	if err != nil {
+		atomic.StoreInt32(&r.scanFail, 1)
+	}
+	atomic.StoreInt32(&r.scanDone, 1)
+	if atomic.LoadInt64(&r.pendingCount) == 0 {
+		r.finish()
+	}
+}
+
+func (r *RunRecorder) uploadDone() {
+	if atomic.AddInt64(&r.pendingCount, -1) == 0 && atomic.LoadInt32(&r.scanDone) == 1 {
+		r.finish()
+	}
+}
+
+// finish 将统计结果写入数据库
+func (r *RunRecorder) finish() {
+	r.finishOnce.Do(func() {
+		now := time.Now()
+		status := consts.BackupRunStatusSuccess
+		if atomic.LoadInt32(&r.scanFail) == 1 {
+			status = consts.BackupRunStatusFail
+		} else if atomic.LoadInt64(&r.failedCount) > 0 {
+			status = consts.BackupRunStatusPartial
+		}
+
+		r.run.Status = uint8(status)
+		r.run.EndTime = &now
+		r.run.ScannedCount = atomic.LoadInt64(&r.scannedCount)
+		r.run.ChangedCount = atomic.LoadInt64(&r.changedCount)
+		r.run.SkippedCount = atomic.LoadInt64(&r.skippedCount)
+		r.run.UploadedCount = atomic.LoadInt64(&r.uploadedCount)
+		r.run.FailedCount = atomic.LoadInt64(&r.failedCount)
+		r.run.UploadBytes = atomic.LoadInt64(&r.uploadBytes)
+		r.run.RapidUploadCount = atomic.LoadInt64(&r.rapidUploadCount)
+		r.run.DedupCount = atomic.LoadInt64(&r.dedupCount)
+		r.run.SavedBytes = atomic.LoadInt64(&r.savedBytes)
+
+		err := dao.NewBackupRunDao(r.ctx, database.DB).Update(map[string]interface{}{
+			"status":             r.run.Status,
+			"end_time":           r.run.EndTime,
+			"scanned_count":      r.run.ScannedCount,
+			"changed_count":      r.run.ChangedCount,
+			"skipped_count":      r.run.SkippedCount,
+			"uploaded_count":     r.run.UploadedCount,
+			"failed_count":       r.run.FailedCount,
+			"upload_bytes":       r.run.UploadBytes,
+			"rapid_upload_count": r.run.RapidUploadCount,
+			"dedup_count":        r.run.DedupCount,
+			"saved_bytes":        r.run.SavedBytes,
+		}, r.run.ID)
+		if err != nil {
+			logger.Logger.WithContext(r.ctx).WithField("run", r.run).WithError(err).Error("update backup run fail")
+			return
+		}
+		logger.Logger.WithContext(r.ctx).WithField("run", r.run).Info("backup run finish")
+		if r.run.Status == consts.BackupRunStatusSuccess {
+			go snapshot.Create(r.ctx, r.run.BackupPath, r.run.ID)
+		}
+		r.notify()
+	})
+}
+
+// notify 运行失败或者有文件变化时通知用户，没有变化的定时扫描不通知，运行记录附带在通知中
+func (r *RunRecorder) notify() {
+	run := *r.run
+	switch {
+	case run.Status == consts.BackupRunStatusFail:
+		notification.SendData(r.ctx, consts.EventRunFail, "备份失败", fmt.Sprintf("%s：扫描出错，上传%d个文件，失败%d个", run.BackupPath, run.UploadedCount, run.FailedCount), &run)
+	case run.Status == consts.BackupRunStatusPartial:
+		notification.SendData(r.ctx, consts.EventRunFail, "部分文件备份失败", fmt.Sprintf("%s：上传%d个文件，失败%d个", run.BackupPath, run.UploadedCount, run.FailedCount), &run)
+	case run.ChangedCount > 0:
+		notification.SendData(r.ctx, consts.EventRunFinish, "备份完成", fmt.Sprintf("%s：扫描%d个文件，变更%d个，上传%d个，秒传%d个，跳过%d个",
+			run.BackupPath, run.ScannedCount, run.ChangedCount, run.UploadedCount, run.RapidUploadCount, run.SkippedCount), &run)
+	}
+}
@@ -0,0 +1,104 @@
+package statistics
+
+import (
+	"context"
+	"testing"
+
+	"backup/consts"
+)
+
+func TestRunRecorder_Finish(t *testing.T) {
+	type args struct {
+		success  int
+		rapid    int
+		copied   int
+		fail     int
+		cancel   int
+		scanFail bool
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantStatus uint8
+		wantBytes  int64
+		wantSaved  int64
+	}{
+		{
+			name:       "success",
+			args:       args{success: 3, rapid: 1},
+			wantStatus: consts.BackupRunStatusSuccess,
+			wantBytes:  300,
+			wantSaved:  100,
+		},
+		{
+			name:       "dedup",
+			args:       args{success: 1, copied: 2},
+			wantStatus: consts.BackupRunStatusSuccess,
+			wantBytes:  100,
+			wantSaved:  200,
+		},
+		{
+			name:       "partial",
+			args:       args{success: 1, fail: 1, cancel: 1},
+			wantStatus: consts.BackupRunStatusPartial,
+			wantBytes:  100,
+		},
+		{
+			name:       "scanFail",
+			args:       args{scanFail: true},
+			wantStatus: consts.BackupRunStatusFail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRunRecorder(context.Background(), "/backup/"+tt.name)
+			total := tt.args.success + tt.args.rapid + tt.args.copied + tt.args.fail + tt.args.cancel
+			for i := 0; i < total; i++ {
+				r.Scanned()
+				r.Changed()
+				r.UploadStart()
+			}
+
+			var err error
+			if tt.args.scanFail {
+				err = context.Canceled
+			}
+			r.ScanFinish(err)
+			if r.run.EndTime != nil && total > 0 {
+				t.Fatalf("run finished before uploads done")
+			}
+
+			for i := 0; i < tt.args.success; i++ {
+				r.UploadSuccess(100, false)
+			}
+			for i := 0; i < tt.args.rapid; i++ {
+				r.UploadSuccess(100, true)
+			}
+			for i := 0; i < tt.args.copied; i++ {
+				r.UploadCopied(100)
+			}
+			for i := 0; i < tt.args.fail; i++ {
+				r.UploadFail()
+			}
+			for i := 0; i < tt.args.cancel; i++ {
+				r.UploadCancel()
+			}
+
+			if r.run.EndTime == nil {
+				t.Fatalf("run not finished")
+			}
+			if r.run.Status != tt.wantStatus {
+				t.Errorf("Status = %v, want %v", r.run.Status, tt.wantStatus)
+			}
+			if r.run.UploadBytes != tt.wantBytes {
+				t.Errorf("UploadBytes = %v, want %v", r.run.UploadBytes, tt.wantBytes)
+			}
+			if r.run.DedupCount != int64(tt.args.copied) || r.run.SavedBytes != tt.wantSaved {
+				t.Errorf("DedupCount = %v, SavedBytes = %v, want %v, %v", r.run.DedupCount, r.run.SavedBytes, tt.args.copied, tt.wantSaved)
+			}
+			if r.run.RapidUploadCount != int64(tt.args.rapid) {
+				t.Errorf("RapidUploadCount = %v, want %v", r.run.RapidUploadCount, tt.args.rapid)
+			}
+		})
+	}
+}
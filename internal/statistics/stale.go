@@ -0,0 +1,51 @@
+package statistics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backup/consts"
+	"backup/internal/config"
+	"backup/internal/dao"
+	"backup/internal/notification"
+	"backup/pkg/database"
+)
+
+const staleCheckInterval = time.Hour // 检查是否长时间没有成功备份的间隔
+
+// WatchStale 定时检查最近一次成功的备份，超过配置的天数时提醒，每天最多提醒一次
+// 还没有成功的备份时从启动开始计算
+func WatchStale(ctx context.Context) {
+	go func() {
+		start := time.Now()
+		var lastNotify time.Time
+		ticker := time.NewTicker(staleCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				days := config.GetNotificationConfig().StaleDays
+				if days == 0 || dao.NewBackupPathDao(ctx, database.DB).Total() == 0 {
+					continue
+				}
+				lastSuccess := start
+				if run, err := dao.NewBackupRunDao(ctx, database.DB).QueryLastSuccess(); err == nil && run.EndTime != nil {
+					lastSuccess = *run.EndTime
+				}
+				if isStale(lastSuccess, lastNotify, now, days) {
+					lastNotify = now
+					notification.Send(ctx, consts.EventNoBackup, "长时间没有成功备份",
+						fmt.Sprintf("最近一次成功备份在%s，已经超过%d天", lastSuccess.Format("2006-01-02 15:04"), days))
+				}
+			}
+		}
+	}()
+}
+
+// isStale 最近一次成功备份超过days天，并且距离上次提醒超过一天
+func isStale(lastSuccess, lastNotify, now time.Time, days int) bool {
+	return now.Sub(lastSuccess) >= time.Duration(days)*24*time.Hour && now.Sub(lastNotify) >= 24*time.Hour
+}
@@ -0,0 +1,30 @@
+package statistics
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_isStale(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	tests := []struct {
+		name        string
+		lastSuccess time.Time
+		lastNotify  time.Time
+		days        int
+		want        bool
+	}{
+		{name: "recent success", lastSuccess: now.Add(-day), days: 3, want: false},
+		{name: "stale", lastSuccess: now.Add(-4 * day), days: 3, want: true},
+		{name: "notified today", lastSuccess: now.Add(-4 * day), lastNotify: now.Add(-time.Hour), days: 3, want: false},
+		{name: "notified yesterday", lastSuccess: now.Add(-4 * day), lastNotify: now.Add(-day), days: 3, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStale(tt.lastSuccess, tt.lastNotify, now, tt.days); got != tt.want {
+				t.Errorf("isStale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package token
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -12,7 +13,9 @@ import (
 
 	"backup/consts"
 	"backup/internal/config"
+	"backup/internal/notification"
 	"backup/pkg/logger"
+	"backup/pkg/metrics"
 )
 
 var AccessToken string
@@ -107,7 +110,12 @@ func RefreshTokenFromFile() error {
 	return nil
 }
 
-func RefreshTokenFromServerByCode(code string) error {
+func RefreshTokenFromServerByCode(code string) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.TokenRefreshFailures.Inc()
+		}
+	}()
 	url := fmt.Sprintf(consts.AccessTokenCodeUrl, code, config.Config.PcsConfig.AppKey, config.Config.PcsConfig.AppSecret)
 
 	logger.Logger.WithField("code", code).WithField("url", url).Info("start request token from server")
@@ -144,7 +152,13 @@ func RefreshTokenFromServerByCode(code string) error {
 	return nil
 }
 
-func RefreshTokenFromServerByRefreshCode() error {
+func RefreshTokenFromServerByRefreshCode() (err error) {
+	defer func() {
+		if err != nil {
+			metrics.TokenRefreshFailures.Inc()
+			notification.Send(context.Background(), consts.EventTokenExpire, "百度网盘授权已失效", "刷新access_token失败，请在配置中重新授权")
+		}
+	}()
 	url := fmt.Sprintf(consts.AccessTokenRefreshUrl, RefreshToken, config.Config.PcsConfig.AppKey, config.Config.PcsConfig.AppSecret)
 
 	logger.Logger.WithField("refreshToken", RefreshToken).WithField("url", url).Info("start request token from server")
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,11 +15,18 @@ import (
 	"fyne.io/fyne/v2/container"
 	"gopkg.in/natefinch/lumberjack.v2"
 
+	"backup/internal/catalog"
 	"backup/internal/config"
+	"backup/internal/notification"
 	"backup/internal/scanner"
+	"backup/internal/statistics"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+	"backup/pkg/metrics"
 	"backup/pkg/util"
 	"backup/ui"
 	"backup/ui/theme"
+	ui_util "backup/ui/util"
 )
 
 var (
@@ -26,7 +34,30 @@ var (
 	procSetStdHandle = kernel32.MustFindProc("SetStdHandle")
 )
 
+var (
+	restoreCatalog  = flag.Bool("restore-catalog", false, "从网盘恢复数据库和配置文件后退出，用于新安装的程序")
+	catalogPassword = flag.String("catalog-password", "", "目录备份的密码，为空时使用以前版本保存在上传配置中的密码")
+)
+
 func main() {
+	flag.Parse()
+	database.Init()
+	if err := config.MigrateCatalogPassword(); err != nil {
+		logger.Logger.WithError(err).Error("migrate legacy catalog password fail")
+	}
+	if *restoreCatalog {
+		password := *catalogPassword
+		if password == "" {
+			password = config.GetCatalogPassword()
+		}
+		if err := catalog.Restore(util.NewContext(), password); err != nil {
+			fmt.Printf("restore catalog fail: %+v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("restore catalog success, please restart")
+		return
+	}
+
 	fyneOutput := &lumberjack.Logger{
 		LocalTime: true,
 		Filename:  fmt.Sprintf("%s/%s.log", config.Config.LogConfig.Path, "fyne"),
@@ -44,24 +75,33 @@ func main() {
 	}
 	redirectStderr(panicOutput)
 
+	http.Handle("/metrics", metrics.Handler())
+	http.Handle("/log/level", logger.LevelHandler())
+	http.Handle("/log/tail", logger.TailHandler())
+	// 只监听本机地址，修改日志级别和查看日志的接口不能暴露到局域网
 	go func() {
-		log.Println(http.ListenAndServe(":6060", nil))
+		log.Println(http.ListenAndServe("127.0.0.1:6060", nil))
 	}()
 
 	background := canvas.NewImageFromResource(resourceBackgroundPng)
 	background.Translucency = 0.7
 	scanner.Manager.Start(util.NewContext())
+	catalog.Start(util.NewContext())
+	statistics.WatchStale(util.NewContext())
 	backupApp := app.New()
 	backupApp.Settings().SetTheme(theme.CustomTheme)
 	backupApp.SetIcon(resourceIconPng)
+	notification.Register(ui_util.DesktopSink{})
+	notification.Setup(util.NewContext())
 
 	w := backupApp.NewWindow("网盘备份")
-	//w.SetCloseIntercept(func() {
-	//	w.Hide()
-	//})
 	w.Resize(fyne.NewSize(1000, 600))
 
 	w.SetContent(container.NewMax(background, ui.Create(w)))
+	// 支持托盘时关闭窗口隐藏到托盘，备份继续运行
+	if !ui.SetupTray(backupApp, w) {
+		logger.Logger.Warn("system tray not supported, closing the window will exit")
+	}
 	w.ShowAndRun()
 }
 
@@ -1,33 +1,67 @@
 package byte_pool
 
-import "backup/consts"
+import (
+	"backup/consts"
+	"backup/internal/config"
+	"backup/pkg/metrics"
+)
 
-var DefaultBytePool = NewBytePool(consts.Size4MB, 100)
+// DefaultBytePool 计算md5时使用的缓冲区，最多占用 hash_buffer_count * 4MB 的内存
+var DefaultBytePool = NewBytePool(consts.Size4MB, config.GetHashBufferCount())
 
+func init() {
+	metrics.NewGaugeFunc("byte_pool_free_buffers", "Number of free buffers in the default byte pool.", func() float64 {
+		return float64(DefaultBytePool.Free())
+	})
+	metrics.NewGaugeFunc("byte_pool_allocated_bytes", "Bytes of memory allocated by the default byte pool.", func() float64 {
+		return float64(DefaultBytePool.Allocated() * DefaultBytePool.size)
+	})
+}
+
+// BytePool 固定大小的缓冲区池，缓冲区在第一次使用时才分配，数量达到上限后Get会阻塞
 type BytePool struct {
-	buffer chan []byte
+	buffer chan []byte   // 已经分配的空闲缓冲区
+	tokens chan struct{} // 还可以分配的缓冲区数量
 	size   int
 }
 
 func NewBytePool(size int, cap int) *BytePool {
 	pool := &BytePool{
 		buffer: make(chan []byte, cap),
+		tokens: make(chan struct{}, cap),
 		size:   size,
 	}
 	for i := 0; i < cap; i++ {
-		pool.buffer <- make([]byte, size)
+		pool.tokens <- struct{}{}
 	}
 	return pool
 }
 
 func (p *BytePool) Get() []byte {
+	select { // 优先复用已经分配的缓冲区
+	case buf := <-p.buffer:
+		return buf[:cap(buf)]
+	default:
+	}
+
 	select {
 	case buf := <-p.buffer:
-		buf = buf[:cap(buf)]
-		return buf
+		return buf[:cap(buf)]
+	case <-p.tokens:
+		return make([]byte, p.size)
 	}
 }
 
+// Free 空闲的缓冲区数量，包括还没有分配的
+func (p *BytePool) Free() int {
+	return len(p.buffer) + len(p.tokens)
+}
+
+// Allocated 已经分配的缓冲区数量
+func (p *BytePool) Allocated() int {
+	return cap(p.tokens) - len(p.tokens)
+}
+
 func (p *BytePool) Put(buf []byte) {
 	select {
 	case p.buffer <- buf:
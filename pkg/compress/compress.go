@@ -0,0 +1,206 @@
+package compress
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/pkg/logger"
+)
+
+// 已经压缩过的格式，再压缩几乎没有效果
+var compressedTypes = []string{
+	"image/", "video/", "audio/", "font/",
+	"application/zip", "application/x-gzip", "application/x-rar-compressed", "application/pdf", "application/wasm",
+}
+
+var compressedExts = map[string]bool{
+	".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".zip": true, ".7z": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp3": true, ".aac": true, ".flac": true, ".mp4": true, ".mkv": true, ".mov": true, ".avi": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".apk": true, ".jar": true,
+}
+
+// 无法通过内容判断类型时，这些扩展名通常是可以压缩的文本或者数据库
+var compressibleExts = map[string]bool{
+	".sql": true, ".dump": true, ".db": true, ".sqlite": true, ".csv": true, ".tsv": true, ".log": true,
+	".json": true, ".xml": true, ".txt": true, ".md": true, ".yaml": true, ".yml": true, ".tar": true,
+}
+
+// 支持的压缩算法和压缩后在网盘中的文件后缀
+var suffixes = map[string]string{
+	consts.CompressGzip: consts.CompressSuffixGzip,
+	consts.CompressZstd: consts.CompressSuffixZstd,
+}
+
+// Suffix 压缩后的文件在网盘中的后缀
+func Suffix(algorithm string) string {
+	return suffixes[algorithm]
+}
+
+// Suffixes 同一个文件在网盘中可能的后缀，第一个是没有压缩的原文件
+func Suffixes() []string {
+	return []string{"", consts.CompressSuffixGzip, consts.CompressSuffixZstd}
+}
+
+// Algorithm 根据网盘中的文件名判断压缩算法，没有压缩时返回空字符串
+func Algorithm(serverPath string) string {
+	for algorithm, suffix := range suffixes {
+		if strings.HasSuffix(serverPath, suffix) {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// ShouldCompress 根据文件开头的内容和扩展名判断是否值得压缩，图片、视频、压缩包等已经压缩过的文件不再压缩
+func ShouldCompress(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if compressedExts[ext] {
+		return false
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	contentType := http.DetectContentType(head[:n])
+	for _, prefix := range compressedTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	if strings.HasPrefix(contentType, "text/") {
+		return true
+	}
+	return compressibleExts[ext]
+}
+
+// File 压缩文件，内容不变时压缩结果不变，继续上传时分片md5也不变
+// gzip头中记录原文件名和修改时间，zstd不记录这些信息，恢复时按数据库中的记录设置修改时间
+func File(ctx context.Context, algorithm, filename, target string) error {
+	if Suffix(algorithm) == "" {
+		return errors.Errorf("unsupported compress algorithm %s", algorithm)
+	}
+	src, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrap(err, "open file fail")
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return errors.Wrap(err, "get file stat fail")
+	}
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create target file fail")
+	}
+	defer dst.Close()
+
+	writer, err := newWriter(algorithm, dst, stat)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, src); err != nil {
+		writer.Close()
+		return errors.Wrap(err, "compress file fail")
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Wrapf(err, "close %s writer fail", algorithm)
+	}
+	if err := dst.Close(); err != nil {
+		return errors.Wrap(err, "close target file fail")
+	}
+	if after, err := os.Stat(target); err == nil {
+		logger.Logger.WithContext(ctx).WithField("filename", filename).WithField("size", stat.Size()).WithField("compressed_size", after.Size()).Info("compress file success")
+	}
+	return nil
+}
+
+// newWriter 压缩的writer，zstd只使用一个协程，保证压缩结果稳定
+func newWriter(algorithm string, dst io.Writer, stat os.FileInfo) (io.WriteCloser, error) {
+	switch algorithm {
+	case consts.CompressGzip:
+		writer := gzip.NewWriter(dst)
+		writer.Name = stat.Name()
+		writer.ModTime = stat.ModTime()
+		return writer, nil
+	case consts.CompressZstd:
+		writer, err := zstd.NewWriter(dst, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, errors.Wrap(err, "create zstd writer fail")
+		}
+		return writer, nil
+	}
+	return nil, errors.Errorf("unsupported compress algorithm %s", algorithm)
+}
+
+// NewReader 解压缩的reader，algorithm为空时直接返回原内容
+func NewReader(algorithm string, reader io.Reader) (io.ReadCloser, error) {
+	switch algorithm {
+	case "":
+		return io.NopCloser(reader), nil
+	case consts.CompressGzip:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "create gzip reader fail")
+		}
+		return gzipReader, nil
+	case consts.CompressZstd:
+		zstdReader, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, errors.Wrap(err, "create zstd reader fail")
+		}
+		return zstdReader.IOReadCloser(), nil
+	}
+	return nil, errors.Errorf("unsupported compress algorithm %s", algorithm)
+}
+
+// Decompress 把下载的压缩文件解压到target，恢复原文件的修改时间
+func Decompress(ctx context.Context, algorithm, filename, target string) (err error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrap(err, "open file fail")
+	}
+	defer src.Close()
+	reader, err := NewReader(algorithm, src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create target file fail")
+	}
+	defer func() {
+		dst.Close()
+		if err != nil {
+			os.Remove(target)
+		}
+	}()
+	if _, err = io.Copy(dst, reader); err != nil {
+		return errors.Wrap(err, "decompress file fail")
+	}
+	if err = dst.Close(); err != nil {
+		return errors.Wrap(err, "close target file fail")
+	}
+	if gzipReader, ok := reader.(*gzip.Reader); ok && !gzipReader.ModTime.IsZero() {
+		if chtimesErr := os.Chtimes(target, gzipReader.ModTime, gzipReader.ModTime); chtimesErr != nil {
+			logger.Logger.WithContext(ctx).WithError(chtimesErr).WithField("target", target).Warn("restore mod time fail")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"backup/consts"
+)
+
+func TestShouldCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress")
+	if err != nil {
+		t.Fatalf("create temp dir error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{name: "dump.sql", content: []byte("INSERT INTO t VALUES (1);\n"), want: true},
+		{name: "app.log", content: []byte("2022-01-01 info start\n"), want: true},
+		{name: "data.bin", content: []byte{0x00, 0x01, 0x02, 0x03}, want: false},
+		{name: "photo.dat", content: []byte("\x89PNG\r\n\x1a\n0000"), want: false}, // 根据内容识别出图片
+		{name: "archive.gz", content: []byte("plain text"), want: false},           // 根据扩展名识别出压缩包
+		{name: "backup.db", content: []byte{0x00, 0x01, 0x02, 0x03}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			ioutil.WriteFile(path, tt.content, 0644)
+			if got := ShouldCompress(path); got != tt.want {
+				t.Errorf("ShouldCompress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileAndDecompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress")
+	if err != nil {
+		t.Fatalf("create temp dir error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("INSERT INTO t VALUES (1);\n"), 1000)
+	src := filepath.Join(dir, "dump.sql")
+	ioutil.WriteFile(src, content, 0644)
+
+	tests := []struct {
+		algorithm   string
+		wantModTime bool // gzip头中记录了修改时间
+	}{
+		{algorithm: consts.CompressGzip, wantModTime: true},
+		{algorithm: consts.CompressZstd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			suffix := Suffix(tt.algorithm)
+			first, second := filepath.Join(dir, "first"+suffix), filepath.Join(dir, "second"+suffix)
+			for _, target := range []string{first, second} {
+				if err := File(context.Background(), tt.algorithm, src, target); err != nil {
+					t.Fatalf("File() error = %v", err)
+				}
+			}
+			firstData, _ := ioutil.ReadFile(first)
+			secondData, _ := ioutil.ReadFile(second)
+			if !bytes.Equal(firstData, secondData) {
+				t.Errorf("File() output is not stable")
+			}
+			if len(firstData)*10 > len(content) {
+				t.Errorf("compressed size = %d, content size = %d", len(firstData), len(content))
+			}
+
+			restored := filepath.Join(dir, "restored_"+tt.algorithm+".sql")
+			if err := Decompress(context.Background(), Algorithm("/backup/dump.sql"+suffix), first, restored); err != nil {
+				t.Fatalf("Decompress() error = %v", err)
+			}
+			got, _ := ioutil.ReadFile(restored)
+			if !bytes.Equal(got, content) {
+				t.Errorf("Decompress() content is different")
+			}
+			if !tt.wantModTime {
+				return
+			}
+			srcStat, _ := os.Stat(src)
+			restoredStat, _ := os.Stat(restored)
+			if !srcStat.ModTime().Truncate(1e9).Equal(restoredStat.ModTime()) {
+				t.Errorf("Decompress() mod time = %v, want %v", restoredStat.ModTime(), srcStat.ModTime())
+			}
+		})
+	}
+}
+
+func TestAlgorithm(t *testing.T) {
+	tests := []struct {
+		serverPath string
+		want       string
+	}{
+		{serverPath: "/backup/dump.sql", want: ""},
+		{serverPath: "/backup/dump.sql.gz", want: consts.CompressGzip},
+		{serverPath: "/backup/dump.sql.zst", want: consts.CompressZstd},
+	}
+	for _, tt := range tests {
+		if got := Algorithm(tt.serverPath); got != tt.want {
+			t.Errorf("Algorithm(%s) = %s, want %s", tt.serverPath, got, tt.want)
+		}
+		if tt.want != "" && Suffix(tt.want) == "" {
+			t.Errorf("Suffix(%s) is empty", tt.want)
+		}
+	}
+}
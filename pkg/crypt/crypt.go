@@ -0,0 +1,121 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	saltSize   = 16
+	keySize    = 32 // AES-256
+	iterations = 100000
+)
+
+var magic = []byte("BKENC1") // 加密文件的头部，用于识别文件是否加密
+
+// ErrWrongPassword 密码错误或者文件被修改
+var ErrWrongPassword = errors.New("wrong password or corrupted data")
+
+// IsEncrypted 数据是否是Encrypt生成的
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Encrypt 使用密码加密，密钥由PBKDF2-SHA256派生，使用AES-256-GCM加密和校验
+// 格式：头部 + salt + nonce + 密文
+func Encrypt(plaintext []byte, password string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, errors.Wrap(err, "generate salt fail")
+	}
+	gcm, err := newGCM(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "generate nonce fail")
+	}
+
+	out := make([]byte, 0, len(magic)+saltSize+len(nonce)+len(plaintext)+gcm.Overhead())
+	out = append(out, magic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, magic), nil
+}
+
+// Decrypt 解密Encrypt生成的数据
+func Decrypt(data []byte, password string) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, errors.New("data is not encrypted")
+	}
+	data = data[len(magic):]
+	if len(data) < saltSize {
+		return nil, ErrWrongPassword
+	}
+	gcm, err := newGCM(password, data[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrWrongPassword
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], magic)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return plaintext, nil
+}
+
+func newGCM(password string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2([]byte(password), salt, iterations, keySize, sha256.New))
+	if err != nil {
+		return nil, errors.Wrap(err, "create cipher fail")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "create gcm fail")
+	}
+	return gcm, nil
+}
+
+// pbkdf2 RFC 8018中的PBKDF2，标准库中没有，依赖中也没有x/crypto
+func pbkdf2(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
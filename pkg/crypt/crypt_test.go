@@ -0,0 +1,89 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestEncrypt(t *testing.T) {
+	plaintext := []byte("files.db and token.json")
+	encrypted, err := Encrypt(plaintext, "secret")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !IsEncrypted(encrypted) || IsEncrypted(plaintext) {
+		t.Fatalf("IsEncrypted() result is wrong")
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		password string
+		wantErr  error
+	}{
+		{name: "right password", data: encrypted, password: "secret"},
+		{name: "wrong password", data: encrypted, password: "wrong", wantErr: ErrWrongPassword},
+		{name: "truncated", data: encrypted[:len(encrypted)-1], password: "secret", wantErr: ErrWrongPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.data, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decrypt() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(got, plaintext) {
+				t.Errorf("Decrypt() = %s, want %s", got, plaintext)
+			}
+		})
+	}
+}
+
+// RFC 6070中PBKDF2-HMAC-SHA1的测试向量，包括派生多个分块和包含\0的输入
+// 加密使用的SHA256按RFC 7914中的向量校验
+func Test_pbkdf2(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		salt     string
+		iter     int
+		keyLen   int
+		h        func() hash.Hash
+		want     string
+	}{
+		{name: "sha1 1", password: "password", salt: "salt", iter: 1, keyLen: 20, h: sha1.New, want: "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{name: "sha1 2", password: "password", salt: "salt", iter: 2, keyLen: 20, h: sha1.New, want: "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{name: "sha1 4096", password: "password", salt: "salt", iter: 4096, keyLen: 20, h: sha1.New, want: "4b007901b765489abead49d926f721d065a429c1"},
+		{
+			name:     "sha1 multi block",
+			password: "passwordPASSWORDpassword",
+			salt:     "saltSALTsaltSALTsaltSALTsaltSALTsalt",
+			iter:     4096,
+			keyLen:   25,
+			h:        sha1.New,
+			want:     "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038",
+		},
+		{name: "sha1 null byte", password: "pass\x00word", salt: "sa\x00lt", iter: 4096, keyLen: 16, h: sha1.New, want: "56fa6aa75548099dcc37d7f03425e0c3"},
+		{
+			name:     "sha256",
+			password: "passwd",
+			salt:     "salt",
+			iter:     1,
+			keyLen:   64,
+			h:        sha256.New,
+			want:     "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iter, tt.keyLen, tt.h)); got != tt.want {
+				t.Errorf("pbkdf2() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package database
 
 import (
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"time"
 
 	"gorm.io/driver/sqlite"
@@ -10,27 +14,107 @@ import (
 
 	"backup/consts"
 	"backup/internal/config"
-	"backup/internal/model"
 	"backup/pkg/logger"
 )
 
-var DB *gorm.DB
+var (
+	DB   *gorm.DB
+	Path string // 数据库文件的绝对路径
+)
+
+// Init 打开数据库并执行迁移，需要在访问数据库之前调用
+// 测试中先设置database.path再调用，防止测试数据写入用户的数据库
+func Init() {
+	Path = config.GetDatabasePath()
+	if err := os.MkdirAll(filepath.Dir(Path), 0755); err != nil {
+		log.Fatalf("create db dir fail, error: %+v", err)
+	}
+	moveLegacyDB(Path)
 
-func init() {
 	var err error
-	DB, err = gorm.Open(sqlite.Open("files.db"), &gorm.Config{
+	DB, err = gorm.Open(sqlite.Open(DSN(Path)), &gorm.Config{
 		Logger: New(logger.Logger, TransferLevel(config.Config.LogConfig.Level), 5*time.Second),
 	})
 	if err != nil {
 		log.Fatalf("init db fail, error: %+v", err)
 	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		log.Fatalf("get sql db fail, error: %+v", err)
+	}
+	sqlDB.SetMaxOpenConns(consts.DBMaxOpenConns)
 
 	DB.Callback().Create().Before("gorm:create").Register("gorm:create_time", CreateTimeCallback("create_time"))
 	DB.Callback().Create().Before("gorm:create").Register("gorm:update_time", UpdateTimeCallback("update_time"))
 	DB.Callback().Create().Before("gorm:update").Register("gorm:update_time", UpdateTimeCallback("update_time"))
 	DB.Callback().Create().Before("gorm:delete").Register("gorm:update_time", UpdateTimeCallback("update_time"))
-	DB.AutoMigrate(&model.FileInfo{})
-	DB.AutoMigrate(&model.BackupPath{})
+	if err := Migrate(DB, Path, Migrations); err != nil {
+		log.Fatalf("migrate db fail, error: %+v", err)
+	}
+	logger.Logger.WithField("path", Path).Info("open db success")
+}
+
+// Close 关闭数据库连接，替换数据库文件之前使用，之后不能再访问数据库
+func Close() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// DSN 连接参数，每个连接都需要设置
+// WAL模式下读写互不阻塞，写入冲突时等待而不是直接返回database is locked，事务开始时就获取写锁，防止读锁升级时死锁
+func DSN(path string) string {
+	return fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_synchronous=NORMAL&_txlock=immediate", path, consts.DBBusyTimeout)
+}
+
+// moveLegacyDB 旧版本在启动目录下创建数据库，新的位置还没有数据库时移动过去
+// 旧版本没有使用WAL模式，只需要移动数据库文件，不同磁盘之间不能重命名，复制完成后再删除
+func moveLegacyDB(path string) {
+	legacy, err := filepath.Abs(consts.DBFileName)
+	if err != nil || legacy == path {
+		return
+	}
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		return
+	}
+	if err := os.Rename(legacy, path); err != nil {
+		if err := copyFile(legacy, path); err != nil {
+			log.Fatalf("move legacy db %s to %s fail, error: %+v", legacy, path, err)
+		}
+		os.Remove(legacy)
+	}
+	logger.Logger.WithField("from", legacy).WithField("to", path).Info("move legacy db")
+}
+
+// copyFile 先复制到临时文件，复制完成后重命名，防止留下不完整的数据库
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
 }
 
 func TransferLevel(level string) gormLogger.LogLevel {
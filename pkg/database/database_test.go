@@ -0,0 +1,38 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestDSN(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsn")
+	if err != nil {
+		t.Fatalf("create temp dir error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := gorm.Open(sqlite.Open(DSN(filepath.Join(dir, "test.db"))), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db error = %v", err)
+	}
+	tests := []struct {
+		pragma string
+		want   string
+	}{
+		{pragma: "journal_mode", want: "wal"},
+		{pragma: "busy_timeout", want: "5000"},
+		{pragma: "synchronous", want: "1"}, // NORMAL
+	}
+	for _, tt := range tests {
+		var got string
+		if err := db.Raw("PRAGMA " + tt.pragma).Scan(&got).Error; err != nil || got != tt.want {
+			t.Errorf("PRAGMA %s = %s, %v, want %s", tt.pragma, got, err, tt.want)
+		}
+	}
+}
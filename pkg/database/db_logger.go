@@ -32,19 +32,19 @@ func (l *DBLogger) LogMode(level logger.LogLevel) logger.Interface {
 
 func (l *DBLogger) Info(ctx context.Context, format string, args ...interface{}) {
 	if l.LogLevel >= logger.Info {
-		l.logger.WithContext(ctx).Infof(format, args)
+		l.logger.WithContext(ctx).Infof(format, args...)
 	}
 }
 
 func (l *DBLogger) Warn(ctx context.Context, format string, args ...interface{}) {
 	if l.LogLevel >= logger.Warn {
-		l.logger.WithContext(ctx).Warnf(format, args)
+		l.logger.WithContext(ctx).Warnf(format, args...)
 	}
 }
 
 func (l *DBLogger) Error(ctx context.Context, format string, args ...interface{}) {
 	if l.LogLevel >= logger.Error {
-		l.logger.WithContext(ctx).Errorf(format, args)
+		l.logger.WithContext(ctx).Errorf(format, args...)
 	}
 }
 
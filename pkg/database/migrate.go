@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"backup/internal/model"
+	"backup/pkg/logger"
+)
+
+// ErrSchemaTooNew 数据库是更新版本的程序创建的，旧版本的程序不能使用
+var ErrSchemaTooNew = errors.New("database schema is newer than program")
+
+// Migration 一次数据库迁移，版本号递增，已经发布的迁移不能修改
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// SchemaVersion 数据库当前的版本，没有执行过迁移时返回0
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&model.SchemaVersion{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Table(model.SchemaVersionTableName).Select("coalesce(max(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Migrate 按版本号顺序执行还没有执行的迁移，每个迁移在一个事务中执行
+// 执行前把数据库备份到同目录下，迁移失败时可以手动恢复
+func Migrate(db *gorm.DB, dbPath string, migrations []*Migration) error {
+	baseLogger := logger.Logger.WithField("db_path", dbPath)
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			return errors.Errorf("migration %d is out of order", migrations[i].Version)
+		}
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return errors.Wrap(err, "query schema version fail")
+	}
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	if current > latest {
+		return errors.Wrapf(ErrSchemaTooNew, "schema version is %d, program supports %d", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	// 已经有数据的数据库先备份，新建的数据库不需要
+	if tables, err := db.Migrator().GetTables(); err == nil && len(tables) > 0 {
+		backupPath := fmt.Sprintf("%s.v%d.%s.bak", dbPath, current, time.Now().Format("20060102150405"))
+		if err := backup(db, backupPath); err != nil {
+			return errors.Wrap(err, "backup database fail")
+		}
+		baseLogger.WithField("backup_path", backupPath).Info("backup database before migrate")
+	}
+
+	if err := db.AutoMigrate(&model.SchemaVersion{}); err != nil {
+		return errors.Wrap(err, "create schema version table fail")
+	}
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			now := time.Now()
+			return tx.Create(&model.SchemaVersion{Version: migration.Version, Name: migration.Name, AppliedTime: &now}).Error
+		})
+		if err != nil {
+			return errors.Wrapf(err, "migrate to version %d (%s) fail", migration.Version, migration.Name)
+		}
+		baseLogger.WithField("version", migration.Version).WithField("name", migration.Name).Info("migrate success")
+	}
+	return nil
+}
+
+// Snapshot 生成当前数据库的一致副本，运行中也可以使用
+func Snapshot(target string) error {
+	return backup(DB, target)
+}
+
+// backup 使用VACUUM INTO生成一致的数据库副本，不需要停止其他连接的写入
+func backup(db *gorm.DB, backupPath string) error {
+	if _, err := os.Stat(backupPath); err == nil {
+		return errors.Errorf("backup file %s already exists", backupPath)
+	}
+	return db.Exec("VACUUM INTO ?", backupPath).Error
+}
+
+// createIndex 索引不存在时创建，索引在模型的gorm标签中定义
+func createIndex(tx *gorm.DB, value interface{}, field string) error {
+	if tx.Migrator().HasIndex(value, field) {
+		return nil
+	}
+	return tx.Migrator().CreateIndex(value, field)
+}
+
+// addColumn 字段不存在时添加，新建的数据库在初始迁移中已经按最新的模型建表
+func addColumn(tx *gorm.DB, value interface{}, field string) error {
+	if tx.Migrator().HasColumn(value, field) {
+		return nil
+	}
+	return tx.Migrator().AddColumn(value, field)
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"backup/consts"
+	"backup/internal/model"
+)
+
+type migrateTestTable struct {
+	ID   uint64
+	Name string
+}
+
+func openTestDB(t *testing.T, dir string) (*gorm.DB, string) {
+	dbPath := filepath.Join(dir, "test.db")
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db error = %v", err)
+	}
+	return db, dbPath
+}
+
+func TestMigrate(t *testing.T) {
+	createTable := &Migration{Version: 1, Name: "create", Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&migrateTestTable{})
+	}}
+	insert := &Migration{Version: 2, Name: "insert", Up: func(tx *gorm.DB) error {
+		return tx.Create(&migrateTestTable{Name: "backfill"}).Error
+	}}
+	fail := &Migration{Version: 3, Name: "fail", Up: func(tx *gorm.DB) error {
+		tx.Create(&migrateTestTable{Name: "rollback"})
+		return errors.New("fail")
+	}}
+	tests := []struct {
+		name        string
+		before      []*Migration // 已经执行的迁移
+		migrations  []*Migration
+		wantErr     error
+		wantVersion int
+		wantRows    int64
+		wantBackup  bool
+	}{
+		{name: "fresh", migrations: []*Migration{createTable, insert}, wantVersion: 2, wantRows: 1},
+		{name: "upgrade", before: []*Migration{createTable}, migrations: []*Migration{createTable, insert}, wantVersion: 2, wantRows: 1, wantBackup: true},
+		{name: "up to date", before: []*Migration{createTable, insert}, migrations: []*Migration{createTable, insert}, wantVersion: 2, wantRows: 1},
+		{name: "too new", before: []*Migration{createTable, insert}, migrations: []*Migration{createTable}, wantErr: ErrSchemaTooNew, wantVersion: 2, wantRows: 1},
+		{name: "rollback", before: []*Migration{createTable}, migrations: []*Migration{createTable, insert, fail}, wantErr: errors.New("fail"), wantVersion: 2, wantRows: 1, wantBackup: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "migrate")
+			if err != nil {
+				t.Fatalf("create temp dir error = %v", err)
+			}
+			defer os.RemoveAll(dir)
+			db, dbPath := openTestDB(t, dir)
+			if tt.before != nil {
+				if err := Migrate(db, dbPath, tt.before); err != nil {
+					t.Fatalf("Migrate() before error = %v", err)
+				}
+			}
+			backups, _ := filepath.Glob(dbPath + ".*.bak")
+
+			err = Migrate(db, dbPath, tt.migrations)
+			if (err != nil) != (tt.wantErr != nil) || (tt.wantErr == ErrSchemaTooNew && !errors.Is(err, ErrSchemaTooNew)) {
+				t.Fatalf("Migrate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if version, _ := SchemaVersion(db); version != tt.wantVersion {
+				t.Errorf("SchemaVersion() = %d, want %d", version, tt.wantVersion)
+			}
+			var rows int64
+			db.Model(&migrateTestTable{}).Count(&rows)
+			if rows != tt.wantRows {
+				t.Errorf("rows = %d, want %d", rows, tt.wantRows)
+			}
+			newBackups, _ := filepath.Glob(dbPath + ".*.bak")
+			if (len(newBackups) > len(backups)) != tt.wantBackup {
+				t.Errorf("backups = %v, want backup %v", newBackups, tt.wantBackup)
+			}
+		})
+	}
+}
+
+func TestMigrations_BackfillContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatalf("create temp dir error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, dbPath := openTestDB(t, dir)
+	if err := Migrate(db, dbPath, Migrations[:1]); err != nil {
+		t.Fatalf("Migrate() initial error = %v", err)
+	}
+	db.Create([]*model.FileInfo{
+		{AbsPath: "/a/1.txt", Md5: "md5_1", Size: 10, UploadStatus: consts.UploadStatusUploaded},
+		{AbsPath: "/b/1.txt", Md5: "md5_1", Size: 10, UploadStatus: consts.UploadStatusUploaded},
+		{AbsPath: "/c/2.txt", Md5: "md5_2", Size: 20, UploadStatus: consts.UploadStatusFail},
+	})
+
+	if err := Migrate(db, dbPath, Migrations); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	var infos []*model.FileInfo
+	db.Order("abs_path").Find(&infos)
+	if len(infos) != 3 || infos[0].ContentId == 0 || infos[0].ContentId != infos[1].ContentId || infos[2].ContentId != 0 {
+		t.Errorf("content id = %d, %d, %d, want two same ids and 0", infos[0].ContentId, infos[1].ContentId, infos[2].ContentId)
+	}
+}
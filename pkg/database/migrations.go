@@ -0,0 +1,102 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"backup/consts"
+	"backup/internal/model"
+)
+
+// Migrations 所有的数据库迁移，新的迁移追加在最后
+// 已经发布的迁移不能再修改，新的表和字段追加新的迁移，添加字段使用addColumn兼容新建的数据库
+var Migrations = []*Migration{
+	{
+		Version: 1,
+		Name:    "initial",
+		Up: func(tx *gorm.DB) error {
+			// 没有版本记录的旧数据库也会执行，AutoMigrate只会补充缺少的表和字段
+			return tx.AutoMigrate(
+				&model.FileInfo{},
+				&model.BackupPath{},
+				&model.BackupRun{},
+				&model.UploadQueue{},
+				&model.FilePart{},
+				&model.PackEntry{},
+				&model.MediaFile{},
+				&model.Content{},
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "backfill file content",
+		Up: func(tx *gorm.DB) error {
+			// 内容记录之前上传成功的文件补充关联，网盘路径未知，不作为复制来源
+			now := time.Now()
+			err := tx.Exec(`INSERT OR IGNORE INTO content (md5, size, server_path, create_time, update_time)
+				SELECT md5, max(size), '', ?, ? FROM file_info
+				WHERE md5 != '' AND upload_status = ? GROUP BY md5`, now, now, consts.UploadStatusUploaded).Error
+			if err != nil {
+				return err
+			}
+			return tx.Exec(`UPDATE file_info SET content_id = (SELECT id FROM content WHERE content.md5 = file_info.md5)
+				WHERE (content_id IS NULL OR content_id = 0) AND md5 != '' AND upload_status = ?`, consts.UploadStatusUploaded).Error
+		},
+	},
+	{
+		Version: 3,
+		Name:    "index file info status and md5",
+		Up: func(tx *gorm.DB) error {
+			// 扫描和重试时按状态查询，去重时按md5查询
+			for _, field := range []string{"UploadStatus", "Md5"} {
+				if err := createIndex(tx, &model.FileInfo{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create restore job",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&model.RestoreJob{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create snapshot and version",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&model.Snapshot{}, &model.SnapshotEntry{}, &model.Version{}); err != nil {
+				return err
+			}
+			// 恢复快照时按md5查找打包上传的文件
+			return createIndex(tx, &model.PackEntry{}, "Md5")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add ransomware guard columns",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumn(tx, &model.FileInfo{}, "Entropy"); err != nil {
+				return err
+			}
+			for _, field := range []string{"Suspended", "SuspendMsg"} {
+				if err := addColumn(tx, &model.BackupPath{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add upload queue priority",
+		Up: func(tx *gorm.DB) error {
+			// 恢复队列时按备份路径的优先级重新入队
+			return addColumn(tx, &model.UploadQueue{}, "Priority")
+		},
+	},
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"backup/consts"
+	"backup/internal/config"
+)
+
+// InitForTest 在临时目录中打开数据库，供各个包的TestMain调用，不影响用户的数据库
+// 返回的函数关闭数据库并删除临时目录
+func InitForTest(prefix string) func() {
+	dir, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		log.Fatalf("create temp dir fail, error: %+v", err)
+	}
+	config.SetDatabasePath(filepath.Join(dir, consts.DBFileName))
+	Init()
+	return func() {
+		Close()
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"net/http"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// LevelHandler 查询和修改日志级别的接口
+// GET返回当前级别，PUT或者POST时通过level参数修改，例如curl -X PUT 'localhost:6060/log/level?level=debug'
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			if err := SetLevel(request.FormValue("level")); err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := jsoniter.Marshal(map[string]string{"level": GetLevel()})
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(body)
+	})
+}
+
+// TailHandler 查看最近的日志，可以按level、trace_id、path过滤，limit指定返回的条数
+// 例如curl 'localhost:6060/log/tail?level=warn&limit=100'
+func TailHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		query := request.URL.Query()
+		filter := Filter{
+			Level:   query.Get("level"),
+			TraceId: query.Get("trace_id"),
+			Path:    query.Get("path"),
+		}
+		if limit := query.Get("limit"); limit != "" {
+			var err error
+			if filter.Limit, err = strconv.Atoi(limit); err != nil {
+				http.Error(writer, "illegal limit", http.StatusBadRequest)
+				return
+			}
+		}
+		lines, err := Tail(filter)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err := jsoniter.Marshal(lines)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(body)
+	})
+}
@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+
+	"backup/consts"
+)
+
+// JsonFormatter 每行输出一个JSON对象，便于日志采集
+// 和内置字段同名的字段加上fields.前缀，防止覆盖
+type JsonFormatter struct {
+}
+
+func (j *JsonFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(map[string]interface{}, len(entry.Data)+6)
+	for k, v := range entry.Data {
+		switch value := v.(type) {
+		case error: // 这样可以把errors包中的cause给打印出来
+			v = fmt.Sprintf("%+v", value)
+		}
+		data[k] = v
+	}
+
+	fixed := map[string]interface{}{
+		"level":                    strings.ToUpper(entry.Level.String()),
+		"time":                     entry.Time.Format(consts.LogTimeLayout),
+		"message":                  entry.Message,
+		string(consts.LogTraceKey): getTraceInfo(entry.Context),
+		string(consts.LogSpanId):   getSpanId(entry.Context),
+	}
+	if entry.Caller != nil {
+		fixed["caller"] = fmt.Sprintf("%s:%d", entry.Caller.File, entry.Caller.Line)
+	}
+	for k, v := range fixed {
+		if old, ok := data[k]; ok {
+			data["fields."+k] = old
+		}
+		data[k] = v
+	}
+
+	line, err := jsoniter.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"log"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -13,23 +14,35 @@ import (
 
 var Logger *logrus.Logger
 
-// 默认配置
+var logDir string // 日志文件所在目录，查看日志时使用
+
+// 默认配置，配置中没有填写的项使用默认值
 var defaultConfig = &config.LogConfig{
 	Path:    "./log",
 	Level:   "INFO",
+	Format:  consts.LogFormatText,
 	MaxSize: 20,
 	Backup:  10,
 }
 
 func init() {
-	Init(defaultConfig)
+	logConfig := config.Config.LogConfig
+	logConfig.Level = config.GetLogLevel()
+	Init(&logConfig)
 }
 
 func Init(config *config.LogConfig) {
-	filename := config.Path + "/" + time.Now().Format(consts.TimeFormatLog) + ".log"
+	path := config.Path
+	if path == "" {
+		path = defaultConfig.Path
+	}
+	logDir = path
+	filename := path + "/" + time.Now().Format(consts.TimeFormatLog) + ".log"
 	output := &lumberjack.Logger{
-		LocalTime: true,
-		Filename:  filename,
+		LocalTime:  true,
+		Filename:   filename,
+		MaxSize:    defaultConfig.MaxSize,
+		MaxBackups: defaultConfig.Backup,
 	}
 	if config.MaxSize != 0 {
 		output.MaxSize = config.MaxSize
@@ -38,12 +51,50 @@ func Init(config *config.LogConfig) {
 		output.MaxBackups = config.Backup
 	}
 	Logger = logrus.New()
-	level, err := logrus.ParseLevel(config.Level)
+	levelText := config.Level
+	if levelText == "" {
+		levelText = defaultConfig.Level
+	}
+	level, err := logrus.ParseLevel(levelText)
 	if err != nil {
-		log.Fatalf("log level is illegal: [%+v]", config.Level)
+		log.Fatalf("log level is illegal: [%+v]", levelText)
 	}
 	Logger.SetLevel(level)
 	Logger.SetOutput(output)
 	Logger.SetReportCaller(true)
-	Logger.SetFormatter(&LogFormatter{})
+	Logger.SetFormatter(NewFormatter(config.Format))
+}
+
+// NewFormatter 按配置的格式创建日志格式，不认识的格式使用默认的文本格式
+func NewFormatter(format string) logrus.Formatter {
+	if strings.ToLower(format) == consts.LogFormatJson {
+		return &JsonFormatter{}
+	}
+	return &LogFormatter{}
+}
+
+// SetLevel 运行时修改日志级别，不需要重启
+func SetLevel(levelText string) error {
+	level, err := logrus.ParseLevel(levelText)
+	if err != nil {
+		return err
+	}
+	old := Logger.GetLevel()
+	Logger.SetLevel(level)
+	// 使用修改前后较严重的级别记录，保证这条日志能输出
+	logLevel := level
+	if old < logLevel {
+		logLevel = old
+	}
+	Logger.WithField("old", old.String()).WithField("new", level.String()).Log(logLevel, "change log level")
+	return nil
+}
+
+// GetLevel 当前的日志级别
+func GetLevel() string {
+	level := Logger.GetLevel()
+	if level == logrus.WarnLevel { // logrus中是warning，和配置中的写法保持一致
+		return consts.LevelWarn
+	}
+	return level.String()
 }
@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+
+	"backup/consts"
+)
+
+func TestJsonFormatter_Format(t *testing.T) {
+	ctx := context.WithValue(context.Background(), consts.LogTraceKey, "trace")
+	entry := Logger.WithContext(ctx).WithField("path", "/data").WithField("level", "custom").WithError(errors.New("fail"))
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "upload fail"
+
+	line, err := (&JsonFormatter{}).Format(entry)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	var got map[string]interface{}
+	if err := jsoniter.Unmarshal(line, &got); err != nil {
+		t.Fatalf("unmarshal line fail: %v, line: %s", err, line)
+	}
+	want := map[string]interface{}{
+		"level":        "ERROR",
+		"message":      "upload fail",
+		"trace_id":     "trace",
+		"path":         "/data",
+		"fields.level": "custom",
+		"error":        "fail",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Format() %s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	defer Logger.SetLevel(Logger.GetLevel())
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantLevel  string
+	}{
+		{name: "set debug", method: http.MethodPut, target: "/log/level?level=debug", wantStatus: http.StatusOK, wantLevel: consts.LevelDebug},
+		{name: "get", method: http.MethodGet, target: "/log/level", wantStatus: http.StatusOK, wantLevel: consts.LevelDebug},
+		{name: "set warn", method: http.MethodPost, target: "/log/level?level=WARN", wantStatus: http.StatusOK, wantLevel: consts.LevelWarn},
+		{name: "illegal", method: http.MethodPut, target: "/log/level?level=verbose", wantStatus: http.StatusBadRequest, wantLevel: consts.LevelWarn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			LevelHandler().ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if recorder.Code == http.StatusOK && !strings.Contains(recorder.Body.String(), tt.wantLevel) {
+				t.Errorf("body = %s, want level %s", recorder.Body.String(), tt.wantLevel)
+			}
+			if GetLevel() != tt.wantLevel {
+				t.Errorf("GetLevel() = %s, want %s", GetLevel(), tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestTail(t *testing.T) {
+	dir := t.TempDir()
+	oldDir := logDir
+	logDir = dir
+	defer func() { logDir = oldDir }()
+
+	content := strings.Join([]string{
+		`[INFO][2026-10-19 10:00:00.000+08:00][scanner.go:10] trace_id=aaa||span_id=<nil>||path="C:\\data\\a.txt"||message=add item`,
+		`[ERROR][2026-10-19 10:00:01.000+08:00][upload.go:20] trace_id=aaa||span_id=<nil>||error=upload fail`,
+		`github.com/pkg/errors.New`,
+		`	/go/errors.go:10||message=upload file fail`,
+		`{"level":"WARNING","time":"2026-10-19 10:00:02.000+08:00","trace_id":"bbb","path":"/data/b.txt","message":"retry"}`,
+		`[INFO][2026-10-19 10:00:03.000+08:00][scanner.go:30] trace_id=<nil>||span_id=<nil>||message=scan finish`,
+	}, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "2026-10-19T10.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "panic.log"), []byte("[ERROR][x][y] message=panic\n"), 0644)
+
+	tests := []struct {
+		name        string
+		filter      Filter
+		wantMessage []string
+	}{
+		{name: "all", filter: Filter{}, wantMessage: []string{"add item", "upload file fail", "retry", "scan finish"}},
+		{name: "limit", filter: Filter{Limit: 1}, wantMessage: []string{"scan finish"}},
+		{name: "level", filter: Filter{Level: consts.LevelWarn}, wantMessage: []string{"upload file fail", "retry"}},
+		{name: "trace", filter: Filter{TraceId: "aaa"}, wantMessage: []string{"add item", "upload file fail"}},
+		{name: "windows path", filter: Filter{Path: `C:\data\a.txt`}, wantMessage: []string{"add item"}},
+		{name: "path", filter: Filter{Path: "/data/b.txt"}, wantMessage: []string{"retry"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := Tail(tt.filter)
+			if err != nil {
+				t.Fatalf("Tail() error = %v", err)
+			}
+			var got []string
+			for _, line := range lines {
+				got = append(got, line.Message)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantMessage, ",") {
+				t.Errorf("Tail() messages = %q, want %q", got, tt.wantMessage)
+			}
+		})
+	}
+
+	lines, _ := Tail(Filter{TraceId: "aaa", Level: consts.LevelError})
+	if len(lines) != 1 || !strings.Contains(lines[0].Text, "errors.go:10") {
+		t.Errorf("Tail() should merge stack lines, got %+v", lines)
+	}
+}
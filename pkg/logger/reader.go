@@ -0,0 +1,198 @@
+package logger
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"backup/consts"
+)
+
+// Line 一条日志，错误的堆栈会占多行，合并在一条日志中
+type Line struct {
+	Level   string `json:"level"`
+	Time    string `json:"time"`
+	TraceId string `json:"trace_id"`
+	Message string `json:"message"`
+	Text    string `json:"text"` // 日志的原始内容
+}
+
+// Filter 查看日志的过滤条件，为空的条件不过滤
+type Filter struct {
+	Level   string // 最低级别，例如warn时只返回warn和error
+	TraceId string
+	Path    string // 日志中包含这个文件路径
+	Limit   int    // 最多返回的条数，为0时使用默认值
+}
+
+// Tail 从最新的日志文件开始向前查找，返回符合条件的最后Limit条日志，按时间正序排列
+func Tail(filter Filter) ([]*Line, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = consts.LogTailLimit
+	}
+	if filter.Limit > consts.MaxLogTail {
+		filter.Limit = consts.MaxLogTail
+	}
+	var level logrus.Level
+	if filter.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(filter.Level); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := logFiles()
+	if err != nil {
+		return nil, err
+	}
+	var res []*Line
+	for _, file := range files {
+		lines, err := tailFile(file, filter, level, filter.Limit-len(res))
+		if err != nil {
+			return nil, err
+		}
+		res = append(lines, res...)
+		if len(res) >= filter.Limit {
+			break
+		}
+	}
+	return res, nil
+}
+
+// logFiles 日志目录中本程序的日志文件，按修改时间倒序，不包括fyne和panic的日志
+func logFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(logDir, "[0-9][0-9][0-9][0-9]-*.log"))
+	if err != nil {
+		return nil, errors.Wrap(err, "list log files fail")
+	}
+	modTimes := make(map[string]int64, len(files))
+	for _, file := range files {
+		if stat, err := os.Stat(file); err == nil {
+			modTimes[file] = stat.ModTime().UnixNano()
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return modTimes[files[i]] > modTimes[files[j]]
+	})
+	return files, nil
+}
+
+// tailFile 返回文件中符合条件的最后limit条日志
+func tailFile(file string, filter Filter, level logrus.Level, limit int) ([]*Line, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open log file %s fail", file)
+	}
+	defer f.Close()
+
+	var res []*Line
+	var current *Line
+	collect := func() {
+		if current != nil && current.match(filter, level) {
+			res = append(res, current)
+			if len(res) > limit*2 { // 只保留最后的limit条，防止文件很大时占用太多内存
+				res = append(res[:0], res[len(res)-limit:]...)
+			}
+		}
+	}
+	reader := bufio.NewReader(f)
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			if line := parseLine(strings.TrimRight(text, "\r\n")); line != nil {
+				collect()
+				current = line
+			} else if current != nil { // 错误堆栈的后续行，文本格式中message在堆栈之后
+				rest := strings.TrimRight(text, "\r\n")
+				current.Text += "\n" + rest
+				if i := strings.Index(rest, "||message="); i >= 0 {
+					current.Message = rest[i+len("||message="):]
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "read log file %s fail", file)
+		}
+	}
+	collect()
+	if len(res) > limit {
+		res = res[len(res)-limit:]
+	}
+	return res, nil
+}
+
+// parseLine 解析一条日志的第一行，支持文本和JSON两种格式，不是日志开头时返回nil
+func parseLine(text string) *Line {
+	switch {
+	case strings.HasPrefix(text, "{"):
+		var data map[string]interface{}
+		if err := jsoniter.UnmarshalFromString(text, &data); err != nil {
+			return nil
+		}
+		line := &Line{Text: text}
+		line.Level, _ = data["level"].(string)
+		line.Time, _ = data["time"].(string)
+		line.TraceId, _ = data[string(consts.LogTraceKey)].(string)
+		line.Message, _ = data["message"].(string)
+		return line
+	case strings.HasPrefix(text, "["):
+		// [LEVEL][time][caller] trace_id=xxx||span_id=xxx||k=v||message=xxx
+		parts := strings.SplitN(text, "]", 3)
+		if len(parts) < 3 {
+			return nil
+		}
+		line := &Line{
+			Level: strings.TrimPrefix(parts[0], "["),
+			Time:  strings.TrimPrefix(parts[1], "["),
+			Text:  text,
+		}
+		if _, err := logrus.ParseLevel(line.Level); err != nil {
+			return nil
+		}
+		if i := strings.Index(text, string(consts.LogTraceKey)+"="); i >= 0 {
+			traceId := text[i+len(consts.LogTraceKey)+1:]
+			if end := strings.Index(traceId, "||"); end >= 0 {
+				traceId = traceId[:end]
+			}
+			if traceId != "<nil>" { // 没有trace_id的ctx
+				line.TraceId = traceId
+			}
+		}
+		if i := strings.Index(text, "||message="); i >= 0 {
+			line.Message = text[i+len("||message="):]
+		}
+		return line
+	}
+	return nil
+}
+
+// match 日志是否符合过滤条件
+func (l *Line) match(filter Filter, level logrus.Level) bool {
+	if filter.Level != "" {
+		lineLevel, err := logrus.ParseLevel(l.Level)
+		if err != nil || lineLevel > level {
+			return false
+		}
+	}
+	if filter.TraceId != "" && l.TraceId != filter.TraceId {
+		return false
+	}
+	if filter.Path != "" && !strings.Contains(l.Text, filter.Path) {
+		// 日志中的路径经过JSON编码，Windows路径中的反斜杠会被转义
+		escaped, _ := jsoniter.MarshalToString(filter.Path)
+		if !strings.Contains(l.Text, strings.Trim(escaped, `"`)) {
+			return false
+		}
+	}
+	return true
+}
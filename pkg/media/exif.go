@@ -0,0 +1,186 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// exif中用到的tag
+const (
+	tagMake              = 0x010F
+	tagModel             = 0x0110
+	tagOrientation       = 0x0112
+	tagDateTime          = 0x0132
+	tagExifIFD           = 0x8769
+	tagDateTimeOriginal  = 0x9003
+	tagDateTimeDigitized = 0x9004
+	tagPixelXDimension   = 0xA002
+	tagPixelYDimension   = 0xA003
+)
+
+// ErrNoExif 文件中没有exif信息
+var ErrNoExif = errors.New("exif not found")
+
+// Exif 照片的exif中备份需要的信息
+type Exif struct {
+	Make              string // 相机厂商
+	Model             string // 相机型号
+	Orientation       int    // 方向
+	DateTime          string // 修改时间
+	DateTimeOriginal  string // 拍摄时间
+	DateTimeDigitized string // 数字化时间
+	Width             int    // 宽度
+	Height            int    // 高度
+}
+
+// CaptureTime 拍摄时间，exif中的时间没有时区，按本地时间解析
+func (e *Exif) CaptureTime() (time.Time, bool) {
+	for _, value := range []string{e.DateTimeOriginal, e.DateTimeDigitized, e.DateTime} {
+		if t, err := time.ParseInLocation(exifTimeLayout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ReadExif 读取JPEG文件中的exif信息
+func ReadExif(filename string) (*Exif, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file fail")
+	}
+	defer file.Close()
+
+	data, err := findExifSegment(bufio.NewReader(file))
+	if err != nil {
+		return nil, err
+	}
+	return parseTiff(data)
+}
+
+// findExifSegment 找到JPEG的APP1段，返回其中的TIFF数据
+func findExifSegment(reader *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(reader, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, ErrNoExif
+	}
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(reader, marker[:]); err != nil || marker[0] != 0xFF {
+			return nil, ErrNoExif
+		}
+		if marker[1] == 0xDA || marker[1] == 0xD9 { // 图像数据开始，后面不会再有exif
+			return nil, ErrNoExif
+		}
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, ErrNoExif
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(reader, segment); err != nil {
+			return nil, ErrNoExif
+		}
+		if marker[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// parseTiff 解析TIFF格式的IFD0和Exif子IFD
+func parseTiff(data []byte) (*Exif, error) {
+	if len(data) < 8 {
+		return nil, ErrNoExif
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, ErrNoExif
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, ErrNoExif
+	}
+
+	exif := &Exif{}
+	exifOffset := readIFD(data, order, order.Uint32(data[4:]), exif)
+	if exifOffset > 0 {
+		readIFD(data, order, exifOffset, exif)
+	}
+	return exif, nil
+}
+
+// readIFD 读取一个IFD中的tag，返回Exif子IFD的偏移量
+func readIFD(data []byte, order binary.ByteOrder, offset uint32, exif *Exif) uint32 {
+	if int(offset)+2 > len(data) {
+		return 0
+	}
+	count := int(order.Uint16(data[offset:]))
+	var exifOffset uint32
+	for i := 0; i < count; i++ {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(data) {
+			break
+		}
+		entry := data[start : start+12]
+		tag, kind, n := order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:])
+		switch tag {
+		case tagMake:
+			exif.Make = readString(data, order, entry, n)
+		case tagModel:
+			exif.Model = readString(data, order, entry, n)
+		case tagDateTime:
+			exif.DateTime = readString(data, order, entry, n)
+		case tagDateTimeOriginal:
+			exif.DateTimeOriginal = readString(data, order, entry, n)
+		case tagDateTimeDigitized:
+			exif.DateTimeDigitized = readString(data, order, entry, n)
+		case tagOrientation:
+			exif.Orientation = readInt(order, entry, kind)
+		case tagPixelXDimension:
+			exif.Width = readInt(order, entry, kind)
+		case tagPixelYDimension:
+			exif.Height = readInt(order, entry, kind)
+		case tagExifIFD:
+			exifOffset = order.Uint32(entry[8:])
+		}
+	}
+	return exifOffset
+}
+
+// readString 读取ASCII类型的值，不超过4个字节时直接存放在entry中
+func readString(data []byte, order binary.ByteOrder, entry []byte, n uint32) string {
+	var value []byte
+	if n <= 4 {
+		value = entry[8 : 8+n]
+	} else {
+		offset := order.Uint32(entry[8:])
+		if uint64(offset)+uint64(n) > uint64(len(data)) {
+			return ""
+		}
+		value = data[offset : offset+n]
+	}
+	return strings.TrimRight(string(value), "\x00 ")
+}
+
+// readInt 读取SHORT或者LONG类型的值
+func readInt(order binary.ByteOrder, entry []byte, kind uint16) int {
+	switch kind {
+	case 3: // SHORT
+		return int(order.Uint16(entry[8:]))
+	case 4: // LONG
+		return int(order.Uint32(entry[8:]))
+	}
+	return 0
+}
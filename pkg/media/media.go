@@ -0,0 +1,70 @@
+package media
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"backup/consts"
+)
+
+// 媒体文件的类型
+const (
+	KindOther = iota // 不是照片和视频
+	KindPhoto        // 照片
+	KindVideo        // 视频
+)
+
+var photoExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true, ".webp": true,
+	".heic": true, ".heif": true, ".tif": true, ".tiff": true, ".dng": true, ".cr2": true, ".nef": true, ".arw": true,
+}
+
+var videoExts = map[string]bool{
+	".mp4": true, ".mov": true, ".m4v": true, ".avi": true, ".mkv": true, ".3gp": true, ".mts": true, ".wmv": true,
+}
+
+// KindOf 根据扩展名判断媒体类型
+func KindOf(filename string) int {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch {
+	case photoExts[ext]:
+		return KindPhoto
+	case videoExts[ext]:
+		return KindVideo
+	}
+	return KindOther
+}
+
+// Mode 媒体类型对应的上传模式
+func Mode(kind int) uint8 {
+	switch kind {
+	case KindPhoto:
+		return consts.ModeAlbumAutoBackup
+	case KindVideo:
+		return consts.ModeVideoAutoBackup
+	}
+	return consts.ModeManual
+}
+
+// CaptureTime 拍摄时间，优先使用照片exif中的时间，没有时使用文件修改时间
+func CaptureTime(filename string) time.Time {
+	if KindOf(filename) == KindPhoto {
+		if exif, err := ReadExif(filename); err == nil {
+			if t, ok := exif.CaptureTime(); ok {
+				return t
+			}
+		}
+	}
+	if stat, err := os.Stat(filename); err == nil {
+		return stat.ModTime()
+	}
+	return time.Now()
+}
+
+// AlbumPath 按拍摄时间组织的网盘路径，例如 /相册/2026/10/IMG_0001.jpg
+func AlbumPath(captureTime time.Time, name string) string {
+	return path.Join(consts.AlbumRoot, captureTime.Format(consts.AlbumDateLayout), name)
+}
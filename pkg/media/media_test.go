@@ -0,0 +1,147 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// buildJpeg 生成只包含exif段的JPEG文件内容
+func buildJpeg(order binary.ByteOrder, dateTime string) []byte {
+	tiff := &bytes.Buffer{}
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(tiff, order, uint16(42))
+	binary.Write(tiff, order, uint32(8)) // IFD0紧跟在头部后面
+
+	// IFD0: Make、Orientation、ExifIFD，值区放在IFD后面
+	valueOffset := uint32(8 + 2 + 3*12 + 4)
+	exifOffset := valueOffset + 8
+	binary.Write(tiff, order, uint16(3))
+	writeEntry(tiff, order, tagMake, 2, 6, valueOffset)
+	writeEntry(tiff, order, tagOrientation, 3, 1, shortValue(order, 6))
+	writeEntry(tiff, order, tagExifIFD, 4, 1, exifOffset)
+	binary.Write(tiff, order, uint32(0))
+	tiff.WriteString("Canon\x00\x00\x00") // 补齐到8字节
+
+	// Exif IFD: DateTimeOriginal、宽度
+	dateOffset := exifOffset + 2 + 2*12 + 4
+	binary.Write(tiff, order, uint16(2))
+	writeEntry(tiff, order, tagDateTimeOriginal, 2, uint32(len(dateTime)+1), dateOffset)
+	writeEntry(tiff, order, tagPixelXDimension, 4, 1, 4032)
+	binary.Write(tiff, order, uint32(0))
+	tiff.WriteString(dateTime + "\x00")
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	jpeg := &bytes.Buffer{}
+	jpeg.Write([]byte{0xFF, 0xD8})
+	jpeg.Write([]byte{0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00}) // 一个无关的APP0段
+	jpeg.Write([]byte{0xFF, 0xE1})
+	binary.Write(jpeg, binary.BigEndian, uint16(len(segment)+2))
+	jpeg.Write(segment)
+	jpeg.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9})
+	return jpeg.Bytes()
+}
+
+func writeEntry(buffer *bytes.Buffer, order binary.ByteOrder, tag, kind uint16, count, value uint32) {
+	binary.Write(buffer, order, tag)
+	binary.Write(buffer, order, kind)
+	binary.Write(buffer, order, count)
+	binary.Write(buffer, order, value)
+}
+
+// shortValue SHORT类型的值放在值字段的前两个字节
+func shortValue(order binary.ByteOrder, value uint16) uint32 {
+	if order == binary.BigEndian {
+		return uint32(value) << 16
+	}
+	return uint32(value)
+}
+
+func TestReadExif(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatalf("create temp dir error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    *Exif
+		wantErr bool
+	}{
+		{
+			name:    "little endian",
+			content: buildJpeg(binary.LittleEndian, "2026:10:01 08:30:00"),
+			want:    &Exif{Make: "Canon", Orientation: 6, DateTimeOriginal: "2026:10:01 08:30:00", Width: 4032},
+		},
+		{
+			name:    "big endian",
+			content: buildJpeg(binary.BigEndian, "2025:01:31 23:59:59"),
+			want:    &Exif{Make: "Canon", Orientation: 6, DateTimeOriginal: "2025:01:31 23:59:59", Width: 4032},
+		},
+		{
+			name:    "not jpeg",
+			content: []byte("hello world"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(dir, tt.name+".jpg")
+			ioutil.WriteFile(filename, tt.content, 0644)
+
+			got, err := ReadExif(filename)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadExif() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("ReadExif() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlbumPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatalf("create temp dir error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	photo := filepath.Join(dir, "IMG_0001.jpg")
+	ioutil.WriteFile(photo, buildJpeg(binary.LittleEndian, "2026:10:01 08:30:00"), 0644)
+	// 没有exif的视频使用文件修改时间
+	video := filepath.Join(dir, "VID_0001.mp4")
+	ioutil.WriteFile(video, []byte("video"), 0644)
+	modTime := time.Date(2024, 2, 29, 12, 0, 0, 0, time.Local)
+	os.Chtimes(video, modTime, modTime)
+
+	tests := []struct {
+		filename string
+		kind     int
+		want     string
+	}{
+		{filename: photo, kind: KindPhoto, want: "/相册/2026/10/IMG_0001.jpg"},
+		{filename: video, kind: KindVideo, want: "/相册/2024/02/VID_0001.mp4"},
+	}
+	for _, tt := range tests {
+		if kind := KindOf(tt.filename); kind != tt.kind {
+			t.Errorf("KindOf(%s) = %d, want %d", tt.filename, kind, tt.kind)
+		}
+		if got := AlbumPath(CaptureTime(tt.filename), filepath.Base(tt.filename)); got != tt.want {
+			t.Errorf("AlbumPath(%s) = %s, want %s", tt.filename, got, tt.want)
+		}
+	}
+}
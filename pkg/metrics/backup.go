@@ -0,0 +1,24 @@
+package metrics
+
+// 备份程序的公共指标，队列长度等由各自的模块通过NewGaugeFunc注册
+var (
+	UploadBytes = NewCounter("upload_bytes_total",
+		"Total bytes of file chunks uploaded to the netdisk.")
+	UploadsInFlight = NewGauge("uploads_in_flight",
+		"Number of files currently being uploaded.")
+	Uploads = NewCounterVec("uploads_total",
+		"Number of finished file uploads by result.", "result")
+	ScanDuration = NewHistogram("scan_duration_seconds",
+		"Duration of a scan and upload pass over one backup path.",
+		[]float64{1, 5, 15, 60, 300, 900, 1800, 3600, 7200})
+	TokenRefreshFailures = NewCounter("token_refresh_failures_total",
+		"Number of failed access token refreshes.")
+	PcsErrors = NewCounterVec("pcs_errors_total",
+		"Number of PCS API responses with a non-zero errno, by method and errno.", "method", "errno")
+)
+
+// 上传结果的标签值
+const (
+	ResultSuccess = "success"
+	ResultFail    = "fail"
+)
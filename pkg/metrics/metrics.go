@@ -0,0 +1,286 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 指标统一前缀
+const namespace = "netdisk_backup_"
+
+// collector 所有指标都需要实现的接口，按Prometheus文本格式输出
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	metricName string
+	help       string
+	bits       uint64
+}
+
+func NewCounter(name, help string) *Counter {
+	c := &Counter{metricName: namespace + name, help: help}
+	DefaultRegistry.Register(c)
+	return c
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	addFloat(&c.bits, delta)
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+func (c *Counter) name() string {
+	return c.metricName
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.metricName, c.help, "counter")
+	writeSample(w, c.metricName, "", c.Value())
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	metricName string
+	help       string
+	labelNames []string
+
+	lock     sync.RWMutex
+	counters map[string]*Counter
+}
+
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		metricName: namespace + name,
+		help:       help,
+		labelNames: labelNames,
+		counters:   map[string]*Counter{},
+	}
+	DefaultRegistry.Register(c)
+	return c
+}
+
+// WithLabelValues 获取指定标签值的计数器，标签值的顺序与创建时的标签名一致
+func (c *CounterVec) WithLabelValues(values ...string) *Counter {
+	labels := formatLabels(c.labelNames, values)
+
+	c.lock.RLock()
+	counter, ok := c.counters[labels]
+	c.lock.RUnlock()
+	if ok {
+		return counter
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if counter, ok = c.counters[labels]; !ok {
+		counter = &Counter{metricName: c.metricName}
+		c.counters[labels] = counter
+	}
+	return counter
+}
+
+func (c *CounterVec) name() string {
+	return c.metricName
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	writeHeader(w, c.metricName, c.help, "counter")
+	labels := make([]string, 0, len(c.counters))
+	for label := range c.counters {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		writeSample(w, c.metricName, label, c.counters[label].Value())
+	}
+}
+
+// Gauge 可增可减的仪表盘
+type Gauge struct {
+	metricName string
+	help       string
+	bits       uint64
+}
+
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{metricName: namespace + name, help: help}
+	DefaultRegistry.Register(g)
+	return g
+}
+
+func (g *Gauge) Set(value float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(value))
+}
+
+func (g *Gauge) Inc() {
+	addFloat(&g.bits, 1)
+}
+
+func (g *Gauge) Dec() {
+	addFloat(&g.bits, -1)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) name() string {
+	return g.metricName
+}
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	writeSample(w, g.metricName, "", g.Value())
+}
+
+// GaugeFunc 采集时才计算值的仪表盘，适用于队列长度等已经在别处维护的数据
+type GaugeFunc struct {
+	metricName string
+	help       string
+	function   func() float64
+}
+
+// NewGaugeFunc 创建一个GaugeFunc，同名的指标会被替换，方便对象重建后重新注册
+func NewGaugeFunc(name, help string, function func() float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: namespace + name, help: help, function: function}
+	DefaultRegistry.Register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string {
+	return g.metricName
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	writeSample(w, g.metricName, "", g.function())
+}
+
+// Histogram 直方图，用于统计耗时的分布
+type Histogram struct {
+	metricName string
+	help       string
+	buckets    []float64
+
+	lock   sync.Mutex
+	counts []uint64 // 每个桶的计数，不累加
+	count  uint64
+	sum    float64
+}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &Histogram{
+		metricName: namespace + name,
+		help:       help,
+		buckets:    sorted,
+		counts:     make([]uint64, len(sorted)),
+	}
+	DefaultRegistry.Register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, bucket := range h.buckets {
+		if value <= bucket {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (h *Histogram) name() string {
+	return h.metricName
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	writeHeader(w, h.metricName, h.help, "histogram")
+	var cumulative uint64
+	for i, bucket := range h.buckets {
+		cumulative += h.counts[i]
+		writeSample(w, h.metricName+"_bucket", formatLabels([]string{"le"}, []string{formatFloat(bucket)}), float64(cumulative))
+	}
+	writeSample(w, h.metricName+"_bucket", formatLabels([]string{"le"}, []string{"+Inf"}), float64(h.count))
+	writeSample(w, h.metricName+"_sum", "", h.sum)
+	writeSample(w, h.metricName+"_count", "", float64(h.count))
+}
+
+func addFloat(bits *uint64, delta float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		newValue := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(bits, old, newValue) {
+			return
+		}
+	}
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func writeSample(w io.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(value))
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(names))
+	for i, name := range names {
+		var value string
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	help = strings.ReplaceAll(help, `\`, `\\`)
+	return strings.ReplaceAll(help, "\n", `\n`)
+}
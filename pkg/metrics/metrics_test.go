@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	registry := NewRegistry()
+
+	counter := &Counter{metricName: "test_counter", help: "test counter"}
+	counter.Add(3)
+	counter.Add(-1) // 计数器不能减少
+	registry.Register(counter)
+
+	vec := &CounterVec{metricName: "test_errors", help: "test errors", labelNames: []string{"method", "errno"}, counters: map[string]*Counter{}}
+	vec.WithLabelValues("upload", "-6").Inc()
+	vec.WithLabelValues("upload", "-6").Inc()
+	vec.WithLabelValues("create", "2").Inc()
+	registry.Register(vec)
+
+	gauge := &Gauge{metricName: "test_gauge", help: "test gauge"}
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	registry.Register(gauge)
+
+	registry.Register(&GaugeFunc{metricName: "test_queue", help: "test queue", function: func() float64 { return 7 }})
+
+	histogram := &Histogram{metricName: "test_duration", help: "test duration", buckets: []float64{1, 10}, counts: make([]uint64, 2)}
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+	histogram.Observe(100)
+	registry.Register(histogram)
+
+	buffer := &bytes.Buffer{}
+	registry.Write(buffer)
+	got := buffer.String()
+
+	tests := []string{
+		"# TYPE test_counter counter\ntest_counter 3\n",
+		"test_errors{method=\"create\",errno=\"2\"} 1\ntest_errors{method=\"upload\",errno=\"-6\"} 2\n",
+		"# TYPE test_gauge gauge\ntest_gauge 1\n",
+		"test_queue 7\n",
+		"test_duration_bucket{le=\"1\"} 1\ntest_duration_bucket{le=\"10\"} 2\ntest_duration_bucket{le=\"+Inf\"} 3\ntest_duration_sum 105.5\ntest_duration_count 3\n",
+	}
+	for _, want := range tests {
+		if !strings.Contains(got, want) {
+			t.Errorf("Write() missing %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %v", recorder.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(recorder.Body.String(), "# TYPE netdisk_backup_upload_bytes_total counter") {
+		t.Errorf("body missing upload bytes metric:\n%s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var DefaultRegistry = NewRegistry()
+
+// Registry 指标注册中心
+type Registry struct {
+	lock       sync.RWMutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: map[string]collector{},
+	}
+}
+
+// Register 注册指标，同名的指标会被替换
+func (r *Registry) Register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors[c.name()] = c
+}
+
+// Write 按名称顺序输出所有指标
+func (r *Registry) Write(w io.Writer) {
+	r.lock.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.lock.RUnlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler 暴露/metrics接口
+func Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		buffer := &bytes.Buffer{}
+		DefaultRegistry.Write(buffer)
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(buffer.Bytes())
+	})
+}
@@ -0,0 +1,148 @@
+package pack
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"backup/pkg/logger"
+)
+
+// Entry 包中的一个文件，tar不压缩，恢复时可以按偏移量直接读取这个文件的数据
+type Entry struct {
+	Path    string    `json:"path"`     // 本地绝对路径
+	Name    string    `json:"name"`     // 包中的文件名
+	Offset  int64     `json:"offset"`   // 数据在包中的偏移量
+	Size    int64     `json:"size"`     // 文件大小
+	Md5     string    `json:"md5"`      // 文件md5
+	ModTime time.Time `json:"mod_time"` // 文件修改时间
+}
+
+// countWriter 记录已经写入的长度，用于计算每个文件的数据在包中的偏移量
+type countWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+// WriteBundle 把同一个目录下的文件打包成tar，先写临时文件再重命名，返回每个文件在包中的位置
+func WriteBundle(ctx context.Context, target string, files []string) ([]*Entry, error) {
+	baseLogger := logger.Logger.WithContext(ctx)
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, errors.Wrap(err, "create bundle dir fail")
+	}
+	temp := target + ".tmp"
+	file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "create bundle file fail")
+	}
+	defer os.Remove(temp) // 重命名成功后删除不会有影响
+
+	counter := &countWriter{writer: file}
+	writer := tar.NewWriter(counter)
+	entries := make([]*Entry, 0, len(files))
+	for _, path := range files {
+		entry, err := writeEntry(writer, counter, path)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := writer.Close(); err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "close tar writer fail")
+	}
+	if err := file.Close(); err != nil {
+		return nil, errors.Wrap(err, "close bundle file fail")
+	}
+	if err := os.Rename(temp, target); err != nil {
+		return nil, errors.Wrap(err, "rename bundle file fail")
+	}
+	baseLogger.WithField("bundle", target).WithField("file_count", len(entries)).WithField("size", counter.count).Info("write bundle success")
+	return entries, nil
+}
+
+func writeEntry(writer *tar.Writer, counter *countWriter, path string) (*Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file fail")
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "get file stat fail")
+	}
+	header, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "generate tar header fail")
+	}
+	if err := writer.WriteHeader(header); err != nil {
+		return nil, errors.Wrap(err, "write tar header fail")
+	}
+
+	entry := &Entry{
+		Path:    path,
+		Name:    header.Name,
+		Offset:  counter.count, // 写完文件头之后就是数据的位置
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+	}
+	digest := md5.New()
+	n, err := io.Copy(writer, io.TeeReader(io.LimitReader(file, stat.Size()), digest))
+	if err != nil {
+		return nil, errors.Wrapf(err, "write file %s fail", path)
+	}
+	if n != stat.Size() { // 打包过程中文件变小了
+		return nil, errors.Errorf("file %s size changed, write %d, want %d", path, n, stat.Size())
+	}
+	entry.Md5 = hex.EncodeToString(digest.Sum(nil))
+	return entry, nil
+}
+
+// Extract 从包中取出一个文件，只读取这个文件的数据，校验md5后恢复修改时间
+func Extract(ctx context.Context, bundle io.ReaderAt, entry *Entry, target string) (err error) {
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create target file fail")
+	}
+	defer func() {
+		file.Close()
+		if err != nil {
+			os.Remove(target)
+		}
+	}()
+
+	digest := md5.New()
+	n, err := io.Copy(io.MultiWriter(file, digest), io.NewSectionReader(bundle, entry.Offset, entry.Size))
+	if err != nil {
+		return errors.Wrap(err, "copy entry fail")
+	}
+	if n != entry.Size {
+		return errors.Errorf("entry size is %d, want %d", n, entry.Size)
+	}
+	if sum := hex.EncodeToString(digest.Sum(nil)); sum != entry.Md5 {
+		return errors.Errorf("entry md5 is %s, want %s", sum, entry.Md5)
+	}
+	if err = file.Close(); err != nil {
+		return errors.Wrap(err, "close target file fail")
+	}
+	if chtimesErr := os.Chtimes(target, entry.ModTime, entry.ModTime); chtimesErr != nil {
+		logger.Logger.WithContext(ctx).WithError(chtimesErr).WithField("target", target).Warn("restore mod time fail")
+	}
+	return nil
+}
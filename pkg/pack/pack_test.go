@@ -0,0 +1,82 @@
+package pack
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteBundleAndExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pack")
+	if err != nil {
+		t.Fatalf("create temp dir error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := map[string][]byte{
+		"a.txt":   []byte("hello"),
+		"b.txt":   bytes.Repeat([]byte("0123456789"), 100), // 超过一个tar块
+		"c.empty": {},
+	}
+	var files []string
+	for name, content := range contents {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, content, 0644)
+		files = append(files, path)
+	}
+
+	bundle := filepath.Join(dir, "bundle", "bundle.tar")
+	entries, err := WriteBundle(context.Background(), bundle, files)
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+
+	// 标准的tar工具可以解开
+	bundleFile, err := os.Open(bundle)
+	if err != nil {
+		t.Fatalf("open bundle error = %v", err)
+	}
+	defer bundleFile.Close()
+	reader := tar.NewReader(bundleFile)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read tar error = %v", err)
+		}
+		data, _ := ioutil.ReadAll(reader)
+		if !bytes.Equal(data, contents[header.Name]) {
+			t.Errorf("tar entry %s = %q, want %q", header.Name, data, contents[header.Name])
+		}
+	}
+
+	for _, entry := range entries {
+		t.Run(entry.Name, func(t *testing.T) {
+			target := filepath.Join(dir, "restore_"+entry.Name)
+			if err := Extract(context.Background(), bundleFile, entry, target); err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			got, _ := ioutil.ReadFile(target)
+			if !bytes.Equal(got, contents[entry.Name]) {
+				t.Errorf("Extract() content = %q, want %q", got, contents[entry.Name])
+			}
+
+			// md5不一致时不保留文件
+			wrong := *entry
+			wrong.Md5 = "0"
+			if err := Extract(context.Background(), bundleFile, &wrong, target); err == nil {
+				t.Errorf("Extract() with wrong md5 error = nil")
+			}
+			if _, err := os.Stat(target); !os.IsNotExist(err) {
+				t.Errorf("target exists after Extract() fail")
+			}
+		})
+	}
+}
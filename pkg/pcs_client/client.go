@@ -2,37 +2,180 @@ package pcs_client
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
+	jsoniter "github.com/json-iterator/go"
 	"github.com/pkg/errors"
 
 	"backup/consts"
 	"backup/internal/config"
 	"backup/internal/token"
+	"backup/pkg/compress"
 	"backup/pkg/logger"
+	"backup/pkg/metrics"
+	"backup/pkg/util"
 	"backup/pkg/work_pool"
 )
 
+// ErrFileChanged 上传过程中文件被修改，已经上传的分片和预上传的分片md5不一致
+var ErrFileChanged = errors.New("file changed during upload")
+
 var p = work_pool.NewWorkPool(context.Background(), 20, 10, work_pool.WorkModeSlowStart)
 
 func init() {
 	p.Start()
+
+	metrics.NewGaugeFunc("work_pool_active_workers", "Number of upload workers currently running a chunk task.", func() float64 {
+		return float64(p.ActiveWorkers())
+	})
+	metrics.NewGaugeFunc("work_pool_queue_length", "Number of chunk tasks waiting in the work pool queue.", func() float64 {
+		return float64(p.QueueLength())
+	})
 }
 
 type UploadParams struct {
-	filename     string // 需要上传的本地文件
-	serverPath   string // 上传后在百度网盘的路径
-	refreshFunc  func() // 上传完一个分片后的刷新函数
-	completeFunc func() // 上传完成后的回调函数
+	filename     string         // 需要上传的本地文件
+	serverPath   string         // 上传后在百度网盘的路径
+	refreshFunc  func()         // 上传完一个分片后的刷新函数
+	completeFunc func()         // 上传完成后的回调函数
+	rapidUpload  bool           // 是否秒传成功
+	chunkSize    int64          // 分片大小
+	hash         *util.FileHash // 缓存的md5计算结果
+	compress     string         // 上传前使用的压缩算法，为空时不压缩
+	mode         uint8          // 上传模式，为0时是手动上传
+	copySource   string         // 本地相同内容的文件已经上传过时，在网盘中的路径
+	copied       bool           // 是否通过网盘复制完成
+	remotePath   string         // 上传完成后完整内容在网盘中的路径，拆分或者压缩上传时为空
+
+	resumed   bool                     // 是否是继续上一次的上传
+	state     *UploadState             // 分片上传的进度
+	stateFunc func(state *UploadState) // 上传进度变化后的回调函数，用于持久化进度
+
+	parts    []*FilePart          // 拆分上传时，上一次已经上传完成的部分
+	partFunc func(part *FilePart) // 拆分上传时，一个部分上传完成后的回调函数
+	manifest *Manifest            // 拆分上传的清单，没有拆分时为空
 }
 
 func NewUploadParams(filename string, serverPath string, refreshFunc func(), completeFunc func()) *UploadParams {
 	return &UploadParams{filename: filename, serverPath: serverPath, refreshFunc: refreshFunc, completeFunc: completeFunc}
 }
 
-func Upload(ctx context.Context, params *UploadParams) error {
+// WithChunkSize 设置分片大小，不设置时根据配置和会员等级选择
+func (p *UploadParams) WithChunkSize(chunkSize int64) *UploadParams {
+	p.chunkSize = chunkSize
+	return p
+}
+
+// WithHash 设置缓存的md5计算结果，文件没有变化时上传前不需要再读取文件计算md5
+func (p *UploadParams) WithHash(hash *util.FileHash) *UploadParams {
+	p.hash = hash
+	return p
+}
+
+// WithCompress 设置上传前使用的压缩算法，图片、视频等已经压缩过的文件不会再压缩
+func (p *UploadParams) WithCompress(algorithm string) *UploadParams {
+	p.compress = algorithm
+	return p
+}
+
+// WithMode 设置上传模式，照片和视频使用相册和视频的自动备份模式
+func (p *UploadParams) WithMode(mode uint8) *UploadParams {
+	p.mode = mode
+	return p
+}
+
+// WithCopySource 设置网盘中内容相同的文件，上传时直接复制，复制失败时再正常上传
+func (p *UploadParams) WithCopySource(serverPath string) *UploadParams {
+	p.copySource = serverPath
+	return p
+}
+
+// IsCopied 是否通过复制网盘中内容相同的文件完成，没有发送文件内容
+func (p *UploadParams) IsCopied() bool {
+	return p.copied
+}
+
+// RemotePath 完整内容在网盘中的路径，可以作为其他相同内容文件的复制来源
+func (p *UploadParams) RemotePath() string {
+	return p.remotePath
+}
+
+// IsResumed 是否继续了上一次的上传，没有重新预上传
+func (p *UploadParams) IsResumed() bool {
+	return p.resumed
+}
+
+// WithState 设置上一次的上传进度，如果文件没有变化，会跳过已经上传完成的分片
+func (p *UploadParams) WithState(state *UploadState) *UploadParams {
+	p.state = state
+	return p
+}
+
+// WithStateFunc 设置上传进度变化后的回调函数
+func (p *UploadParams) WithStateFunc(stateFunc func(state *UploadState)) *UploadParams {
+	p.stateFunc = stateFunc
+	return p
+}
+
+// WithParts 设置上一次已经上传完成的部分，内容没有变化的部分不再上传
+func (p *UploadParams) WithParts(parts []*FilePart) *UploadParams {
+	p.parts = parts
+	return p
+}
+
+// WithPartFunc 设置拆分上传时一个部分上传完成后的回调函数
+func (p *UploadParams) WithPartFunc(partFunc func(part *FilePart)) *UploadParams {
+	p.partFunc = partFunc
+	return p
+}
+
+// Manifest 拆分上传的清单，文件没有超过大小上限时为空
+func (p *UploadParams) Manifest() *Manifest {
+	return p.manifest
+}
+
+// isUploaded 这个部分上一次是否已经上传完成
+func (p *UploadParams) isUploaded(part *FilePart) bool {
+	for _, uploaded := range p.parts {
+		if uploaded.Seq == part.Seq && uploaded.Offset == part.Offset && uploaded.Size == part.Size && uploaded.Md5 == part.Md5 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *UploadParams) saveState() {
+	if p.stateFunc != nil {
+		p.stateFunc(p.state)
+	}
+}
+
+// Hash 上传时使用的md5计算结果
+func (p *UploadParams) Hash() *util.FileHash {
+	return p.hash
+}
+
+// IsRapidUpload 文件是否秒传成功，秒传成功时没有实际上传分片
+func (p *UploadParams) IsRapidUpload() bool {
+	return p.rapidUpload
+}
+
+func Upload(ctx context.Context, params *UploadParams) (err error) {
 	baseLogger := logger.Logger.WithContext(ctx)
+	metrics.UploadsInFlight.Inc()
+	defer func() {
+		metrics.UploadsInFlight.Dec()
+		if err != nil {
+			metrics.Uploads.WithLabelValues(metrics.ResultFail).Inc()
+		} else {
+			metrics.Uploads.WithLabelValues(metrics.ResultSuccess).Inc()
+		}
+	}()
 	serverPath := path.Join(config.Config.PcsConfig.PathPrefix, params.serverPath)
 	serverPath = filepath.Clean(serverPath)
 
@@ -41,11 +184,101 @@ func Upload(ctx context.Context, params *UploadParams) error {
 		"server_filename": serverPath,
 	}).Info("upload start")
 
-	preCreateReq, err := NewPreCreateRequest(ctx, params.filename, serverPath)
+	if params.chunkSize <= 0 {
+		params.chunkSize = ChunkSize(ctx)
+	}
+	stat, err := os.Stat(params.filename)
+	if err != nil {
+		return errors.Wrap(err, "get file stat fail")
+	}
+	// 剩余空间不足时不再计算md5和上传分片
+	if err = reserveSpace(ctx, stat.Size()); err != nil {
+		return err
+	}
+	if params.compress != "" && compress.ShouldCompress(params.filename) {
+		if err = uploadCompressed(ctx, params, serverPath, stat); err == nil {
+			removeStale(ctx, serverPath, serverPath+compress.Suffix(params.compress), params.manifest != nil)
+		}
+		return err
+	}
+	// 先检查大小上限再计算md5，超过上限的文件拆分成多个部分上传
+	if limit := MaxFileSize(ctx); stat.Size() > limit {
+		baseLogger.WithField("size", stat.Size()).WithField("limit", limit).Info("file exceeds size limit, upload in parts")
+		if err = uploadParts(ctx, params, serverPath, stat, limit); err == nil {
+			removeStale(ctx, serverPath, serverPath, true)
+		}
+		return err
+	}
+	// 本地有相同内容的文件已经上传过，直接在网盘中复制
+	// 复制前检查网盘中的源文件，源文件被删除或者被其他内容覆盖时正常上传
+	if params.copySource != "" && params.copySource != serverPath && params.hash.Valid(params.filename, params.chunkSize) {
+		err = checkCopySource(ctx, params.copySource, stat.Size(), params.hash.Md5)
+		if err == nil {
+			err = Copy(ctx, params.copySource, serverPath)
+		}
+		if err == nil {
+			params.copied, params.remotePath = true, serverPath
+			if params.completeFunc != nil {
+				params.completeFunc()
+			}
+			baseLogger.WithField("src", params.copySource).Info("copy duplicate content success")
+			return nil
+		}
+		if errors.Is(err, ErrSpaceFull) {
+			return err
+		}
+		baseLogger.WithField("src", params.copySource).WithError(err).Warn("copy duplicate content fail, upload instead")
+	}
+	// 分片的md5、上传的分片和进度都按照同一个分片大小计算
+	hash := params.hash
+	if !hash.Valid(params.filename, params.chunkSize) { // 缓存失效，重新计算
+		hash, err = util.HashFile(ctx, params.filename, params.chunkSize)
+		if err != nil {
+			return errors.Wrap(err, "hash file fail")
+		}
+		params.hash = hash
+	}
+	return uploadFile(ctx, params, serverPath)
+}
+
+// checkCopySource 网盘中的源文件是否还是本地文件的内容，大小或者md5不同时不能复制
+// 网盘返回的md5和本地计算的结果不一致时也按不同处理，正常上传时还可以秒传
+func checkCopySource(ctx context.Context, src string, size int64, md5 string) error {
+	remote, err := Lookup(ctx, src)
+	if err != nil {
+		return errors.Wrap(err, "lookup copy source fail")
+	}
+	return matchCopySource(remote, size, md5)
+}
+
+func matchCopySource(remote *RemoteFile, size int64, md5 string) error {
+	if remote.IsDir != 0 || remote.Size != size {
+		return errors.Errorf("copy source not match, remote size: %d, local size: %d", remote.Size, size)
+	}
+	if md5 == "" || !strings.EqualFold(remote.Md5, md5) {
+		return errors.Errorf("copy source not match, remote md5: %s, local md5: %s", remote.Md5, md5)
+	}
+	return nil
+}
+
+// uploadFile 预上传、上传分片并合并，上传前已经计算好md5
+func uploadFile(ctx context.Context, params *UploadParams, serverPath string) error {
+	baseLogger := logger.Logger.WithContext(ctx)
+
+	preCreateReq, err := NewPreCreateRequest(ctx, params.filename, serverPath, params.hash)
 	if err != nil {
 		return errors.Wrap(err, "construct precreateRequest fail")
 	}
 
+	if params.state == nil {
+		params.state = NewUploadState("", nil, nil)
+	}
+	if params.state.resumable(preCreateReq.BlockList) { // 文件没有变化，继续上一次的上传
+		baseLogger.WithField("upload_id", params.state.UploadId()).WithField("completed_count", params.state.CompletedCount()).Info("resume upload")
+		params.resumed = true
+		return upload(ctx, params, preCreateReq, serverPath, params.state.UploadId())
+	}
+
 retry:
 	preCreateResp, err := pcsPreCreate(ctx, preCreateReq)
 	if err != nil {
@@ -63,29 +296,73 @@ retry:
 		}
 	}
 
-	uploadReq := NewUploadRequest(preCreateResp.UploadId, serverPath, preCreateResp.BlockList, params.filename, params.refreshFunc)
-	err = pcsUpload(ctx, uploadReq)
+	if preCreateResp.ReturnType == consts.ReturnTypeExist { // 云端已存在相同文件，秒传成功
+		params.rapidUpload, params.remotePath = true, serverPath
+		if params.completeFunc != nil {
+			params.completeFunc()
+		}
+		baseLogger.Info("rapid upload success")
+		return nil
+	}
+
+	params.state.reset(preCreateResp.UploadId, preCreateReq.BlockList)
+	params.saveState()
+	return upload(ctx, params, preCreateReq, serverPath, preCreateResp.UploadId)
+}
+
+// upload 上传未完成的分片并合并文件
+func upload(ctx context.Context, params *UploadParams, preCreateReq *preCreateRequest, serverPath, uploadId string) error {
+	baseLogger := logger.Logger.WithContext(ctx)
+
+	var partSeq []int
+	for seq := range preCreateReq.BlockList {
+		if !params.state.isCompleted(seq) {
+			partSeq = append(partSeq, seq)
+		}
+	}
+	uploadReq := NewUploadRequest(uploadId, serverPath, partSeq, params.filename, params.refreshFunc)
+	uploadReq.ChunkSize = params.chunkSize
+	uploadReq.BlockList = preCreateReq.BlockList
+	uploadReq.Offset, uploadReq.Length = params.hash.Offset, params.hash.Length
+	uploadReq.PartFunc = func(seq int) {
+		params.state.complete(seq)
+		params.saveState()
+	}
+	err := pcsUpload(ctx, uploadReq)
 
 	if err != nil {
 		baseLogger.WithError(err).Error("pcs upload fail")
 		return err
 	}
 
+	// 合并之前再检查一次，分片都上传完之后文件也可能被修改
+	if !params.hash.Valid(params.filename, params.chunkSize) {
+		baseLogger.WithField("filename", params.filename).Warn("file changed after upload chunks")
+		return ErrFileChanged
+	}
+
 	createParams := &createRequest{
 		Path:       serverPath,
 		Size:       preCreateReq.Size,
 		IsDir:      preCreateReq.IsDir,
 		BlockList:  preCreateReq.BlockList,
-		UploadId:   preCreateResp.UploadId,
+		UploadId:   uploadId,
 		Mode:       consts.ModeManual,
 		IsRevision: consts.EnableMultiVersion,
 	}
+	if params.mode != 0 {
+		createParams.Mode = params.mode
+	}
+	if params.mode == consts.ModeAlbumAutoBackup {
+		createParams.ExifInfo = newExifInfo(ctx, params.filename)
+	}
 
 	_, err = pcsCreate(ctx, createParams)
 	if err != nil {
 		baseLogger.WithError(err).Errorf("create fail")
 		return err
 	}
+	params.remotePath = serverPath
 
 	if params.completeFunc != nil {
 		params.completeFunc()
@@ -93,3 +370,185 @@ retry:
 	baseLogger.Info("upload success")
 	return nil
 }
+
+// removeStale 压缩或者拆分上传成功后删除同一个文件以前按其他方式上传的内容，例如开启压缩前上传的原文件
+// 恢复时先按原文件名查找，旧的内容不删除会被当作最新的内容恢复，删除失败不影响上传结果
+func removeStale(ctx context.Context, serverPath, name string, split bool) {
+	current := name
+	if split {
+		current += consts.ManifestSuffix
+	}
+	variants := map[string]bool{}
+	for _, suffix := range compress.Suffixes() {
+		variants[serverPath+suffix] = true
+		variants[serverPath+suffix+consts.ManifestSuffix] = true
+	}
+	baseLogger := logger.Logger.WithContext(ctx).WithField("server_path", current)
+	files, err := List(ctx, path.Dir(serverPath))
+	if err != nil {
+		baseLogger.WithError(err).Warn("list dir for stale file fail")
+		return
+	}
+	var stale []string
+	for _, file := range files {
+		if file.Path != current && variants[file.Path] {
+			stale = append(stale, file.Path)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+	if err := Delete(ctx, stale); err != nil {
+		baseLogger.WithError(err).WithField("stale", stale).Warn("delete stale file fail")
+	}
+}
+
+// uploadParts 文件超过大小上限时拆分成多个部分上传，每个部分是原文件中的一段，最后上传清单文件
+func uploadParts(ctx context.Context, params *UploadParams, serverPath string, stat os.FileInfo, limit int64) error {
+	baseLogger := logger.Logger.WithContext(ctx)
+
+	partSize := limit - limit%params.chunkSize // 每个部分都是完整的分片
+	manifest := NewManifest(stat)
+	manifest.Name = path.Base(serverPath) // 上传的可能是压缩后的临时文件，使用网盘中的文件名
+	if hash := params.hash; hash != nil && hash.Length == 0 && hash.Size == stat.Size() && hash.ModTime.Equal(stat.ModTime()) {
+		manifest.Md5 = hash.Md5
+	}
+
+	rapidUpload := true
+	for seq, offset := 1, int64(0); offset < stat.Size(); seq, offset = seq+1, offset+partSize {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		part := &FilePart{
+			Seq:    seq,
+			Path:   fmt.Sprintf(consts.PartNameFormat, serverPath, seq),
+			Offset: offset,
+			Size:   stat.Size() - offset,
+		}
+		if part.Size > partSize {
+			part.Size = partSize
+		}
+		hash, err := util.HashSection(ctx, params.filename, part.Offset, part.Size, params.chunkSize)
+		if err != nil {
+			return errors.Wrapf(err, "hash part %d fail", seq)
+		}
+		part.Md5 = hash.Md5
+		manifest.Parts = append(manifest.Parts, part)
+
+		if params.isUploaded(part) {
+			baseLogger.WithField("part", part).Info("part already uploaded, skip")
+			continue
+		}
+		partParams := &UploadParams{
+			filename:    params.filename,
+			serverPath:  part.Path,
+			refreshFunc: params.refreshFunc,
+			chunkSize:   params.chunkSize,
+			hash:        hash,
+			state:       NewUploadState("", nil, nil),
+		}
+		if err := uploadFile(ctx, partParams, part.Path); err != nil {
+			return errors.Wrapf(err, "upload part %d fail", seq)
+		}
+		rapidUpload = rapidUpload && partParams.rapidUpload
+		if params.partFunc != nil {
+			params.partFunc(part)
+		}
+	}
+
+	if err := uploadManifest(ctx, params, serverPath+consts.ManifestSuffix, manifest); err != nil {
+		return errors.Wrap(err, "upload manifest fail")
+	}
+	params.manifest = manifest
+	params.rapidUpload = rapidUpload
+	if params.completeFunc != nil {
+		params.completeFunc()
+	}
+	baseLogger.WithField("part_count", len(manifest.Parts)).Info("upload parts success")
+	return nil
+}
+
+// uploadManifest 清单文件写到临时文件后按普通文件上传
+func uploadManifest(ctx context.Context, params *UploadParams, serverPath string, manifest *Manifest) error {
+	file, err := ioutil.TempFile("", "manifest")
+	if err != nil {
+		return errors.Wrap(err, "create temp file fail")
+	}
+	defer os.Remove(file.Name())
+
+	err = jsoniter.NewEncoder(file).Encode(manifest)
+	file.Close()
+	if err != nil {
+		return errors.Wrap(err, "encode manifest fail")
+	}
+
+	hash, err := util.HashFile(ctx, file.Name(), params.chunkSize)
+	if err != nil {
+		return errors.Wrap(err, "hash manifest fail")
+	}
+	manifestParams := &UploadParams{
+		filename:    file.Name(),
+		serverPath:  serverPath,
+		refreshFunc: func() {}, // 清单文件不计入上传进度
+		chunkSize:   params.chunkSize,
+		hash:        hash,
+		state:       NewUploadState("", nil, nil),
+	}
+	return uploadFile(ctx, manifestParams, serverPath)
+}
+
+// uploadCompressed 压缩到临时文件后上传，网盘中的文件名加上压缩算法的后缀
+// 相同内容的压缩结果不变，继续上传和拆分上传的进度都可以沿用
+func uploadCompressed(ctx context.Context, params *UploadParams, serverPath string, stat os.FileInfo) error {
+	baseLogger := logger.Logger.WithContext(ctx)
+
+	file, err := ioutil.TempFile("", "compress")
+	if err != nil {
+		return errors.Wrap(err, "create temp file fail")
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	if err := compress.File(ctx, params.compress, params.filename, file.Name()); err != nil {
+		return errors.Wrap(err, "compress file fail")
+	}
+	// 压缩过程中文件被修改，压缩结果可能是不完整的内容
+	if after, err := os.Stat(params.filename); err != nil || after.Size() != stat.Size() || !after.ModTime().Equal(stat.ModTime()) {
+		baseLogger.WithField("filename", params.filename).Warn("file changed during compress")
+		return ErrFileChanged
+	}
+	compressed, err := os.Stat(file.Name())
+	if err != nil {
+		return errors.Wrap(err, "get compressed file stat fail")
+	}
+	hash, err := util.HashFile(ctx, file.Name(), params.chunkSize)
+	if err != nil {
+		return errors.Wrap(err, "hash compressed file fail")
+	}
+
+	target := serverPath + compress.Suffix(params.compress)
+	compressedParams := &UploadParams{
+		filename:     file.Name(),
+		serverPath:   target,
+		refreshFunc:  params.refreshFunc,
+		completeFunc: params.completeFunc,
+		chunkSize:    params.chunkSize,
+		hash:         hash,
+		state:        params.state,
+		stateFunc:    params.stateFunc,
+		parts:        params.parts,
+		partFunc:     params.partFunc,
+	}
+	if limit := MaxFileSize(ctx); compressed.Size() > limit {
+		err = uploadParts(ctx, compressedParams, target, compressed, limit)
+	} else {
+		err = uploadFile(ctx, compressedParams, target)
+	}
+	params.rapidUpload = compressedParams.rapidUpload
+	params.resumed = compressedParams.resumed
+	params.manifest = compressedParams.manifest
+	return err
+}
@@ -46,3 +46,26 @@ func TestUpload(t *testing.T) {
 		})
 	}
 }
+
+func Test_matchCopySource(t *testing.T) {
+	const md5 = "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name    string
+		remote  *RemoteFile
+		wantErr bool
+	}{
+		{name: "match", remote: &RemoteFile{Size: 10, Md5: md5}},
+		{name: "upper case md5", remote: &RemoteFile{Size: 10, Md5: "0123456789ABCDEF0123456789ABCDEF"}},
+		{name: "same size, different content", remote: &RemoteFile{Size: 10, Md5: "fedcba9876543210fedcba9876543210"}, wantErr: true},
+		{name: "remote md5 missing", remote: &RemoteFile{Size: 10}, wantErr: true},
+		{name: "size not match", remote: &RemoteFile{Size: 11, Md5: md5}, wantErr: true},
+		{name: "dir", remote: &RemoteFile{Size: 10, Md5: md5, IsDir: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := matchCopySource(tt.remote, 10, md5); (err != nil) != tt.wantErr {
+				t.Errorf("matchCopySource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
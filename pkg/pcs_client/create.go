@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	jsoniter "github.com/json-iterator/go"
@@ -15,6 +16,8 @@ import (
 	"backup/consts"
 	"backup/internal/token"
 	"backup/pkg/logger"
+	"backup/pkg/media"
+	"backup/pkg/metrics"
 )
 
 func pcsCreate(ctx context.Context, createReq *createRequest) (*createResponse, error) {
@@ -49,12 +52,16 @@ func pcsCreate(ctx context.Context, createReq *createRequest) (*createResponse,
 	baseLogger.WithField("response_body", string(data)).Info("pcs create: response body")
 
 	var createResp = &createResponse{}
-	err = jsoniter.Unmarshal(data, resp)
+	err = jsoniter.Unmarshal(data, createResp)
 	if err != nil {
 		return nil, errors.Wrap(err, "unmarshal createResp fail")
 	}
 
 	if createResp.Errno != consts.ErrnoSuccess {
+		metrics.PcsErrors.WithLabelValues(consts.MethodCreate, strconv.Itoa(createResp.Errno)).Inc()
+		if createResp.Errno == consts.ErrnoSpaceFull {
+			return nil, errors.Wrap(ErrSpaceFull, "create fail")
+		}
 		return nil, errors.Errorf("errno is not zero")
 	}
 
@@ -76,7 +83,42 @@ type createRequest struct {
 	ZipSign      string   `json:"zip_sign,omitempty"`         // 未压缩原始图片的MD5
 	IsRevision   uint8    `json:"is_revision,omitempty"`      // 是否开启多版本，1开启，0不开启
 	Mode         uint8    `json:"mode,omitempty"`             // 上传模式
-	//ExifInfo     ExifInfo `json:"exif_info"`                  // 图片的ExifInfo信息
+	ExifInfo     string   `json:"exif_info,omitempty"`        // 图片的ExifInfo信息，json格式
+}
+
+// ExifInfo 相册备份模式下随文件一起提交的图片信息
+type ExifInfo struct {
+	DateTimeOriginal  string `json:"date_time_original,omitempty"`  // 拍摄时间
+	DateTimeDigitized string `json:"date_time_digitized,omitempty"` // 数字化时间
+	DateTime          string `json:"date_time,omitempty"`           // 修改时间
+	Model             string `json:"model,omitempty"`               // 相机型号
+	Make              string `json:"make,omitempty"`                // 相机厂商
+	Width             int    `json:"width,omitempty"`               // 宽度
+	Height            int    `json:"height,omitempty"`              // 高度
+	Orientation       int    `json:"orientation,omitempty"`         // 方向
+}
+
+// newExifInfo 读取照片的exif，没有exif信息时返回空字符串
+func newExifInfo(ctx context.Context, filename string) string {
+	exif, err := media.ReadExif(filename)
+	if err != nil {
+		logger.Logger.WithContext(ctx).WithField("filename", filename).WithError(err).Info("read exif fail")
+		return ""
+	}
+	info, err := jsoniter.MarshalToString(&ExifInfo{
+		DateTimeOriginal:  exif.DateTimeOriginal,
+		DateTimeDigitized: exif.DateTimeDigitized,
+		DateTime:          exif.DateTime,
+		Model:             exif.Model,
+		Make:              exif.Make,
+		Width:             exif.Width,
+		Height:            exif.Height,
+		Orientation:       exif.Orientation,
+	})
+	if err != nil {
+		return ""
+	}
+	return info
 }
 
 type createResponse struct {
@@ -0,0 +1,218 @@
+package pcs_client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/internal/config"
+	"backup/internal/token"
+	"backup/pkg/logger"
+	"backup/pkg/metrics"
+)
+
+const listLimit = 1000 // 每次查询目录的文件数
+
+// ErrNotFound 网盘中没有这个文件
+var ErrNotFound = errors.New("remote file not found")
+
+// RemoteFile 网盘中的文件信息
+type RemoteFile struct {
+	FsId           int64  `json:"fs_id"`
+	Path           string `json:"path"`
+	ServerFilename string `json:"server_filename"`
+	Size           int64  `json:"size"`
+	IsDir          int    `json:"isdir"`
+	ServerMtime    int64  `json:"server_mtime"`
+	Md5            string `json:"md5"`   // 网盘记录的md5，部分文件和本地计算的结果不同
+	Dlink          string `json:"dlink"` // 下载地址，查询文件信息时才有
+}
+
+type listResponse struct {
+	Errno int           `json:"errno"`
+	List  []*RemoteFile `json:"list"`
+}
+
+// List 查询网盘目录下的文件，dir是带路径前缀的完整路径
+func List(ctx context.Context, dir string) ([]*RemoteFile, error) {
+	var files []*RemoteFile
+	for start := 0; ; start += listLimit {
+		values := url.Values{}
+		values.Set("dir", dir)
+		values.Set("start", strconv.Itoa(start))
+		values.Set("limit", strconv.Itoa(listLimit))
+		address := fmt.Sprintf("https://pan.baidu.com/rest/2.0/xpan/file?method=%s&access_token=%s&%s", consts.MethodList, token.AccessToken, values.Encode())
+		resp := &listResponse{}
+		if err := getJSON(ctx, consts.MethodList, address, resp); err != nil {
+			return nil, err
+		}
+		files = append(files, resp.List...)
+		if len(resp.List) < listLimit {
+			return files, nil
+		}
+	}
+}
+
+// FullPath 网盘中带路径前缀的完整路径，serverPath不带路径前缀
+func FullPath(serverPath string) string {
+	return path.Join(config.Config.PcsConfig.PathPrefix, serverPath)
+}
+
+// Stat 查询网盘中的文件信息，包括下载地址，serverPath不带路径前缀
+func Stat(ctx context.Context, serverPath string) (*RemoteFile, error) {
+	file, err := Lookup(ctx, FullPath(serverPath))
+	if err != nil {
+		return nil, err
+	}
+	return Meta(ctx, file.FsId)
+}
+
+// Lookup 在父目录中查找文件，fullPath带路径前缀，返回的信息中没有下载地址
+func Lookup(ctx context.Context, fullPath string) (*RemoteFile, error) {
+	files, err := List(ctx, path.Dir(fullPath))
+	if err != nil {
+		return nil, errors.Wrap(err, "list dir fail")
+	}
+	for _, file := range files {
+		if file.Path == fullPath {
+			return file, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrNotFound, "path is %s", fullPath)
+}
+
+// Meta 按fs_id查询文件信息，包括下载地址
+func Meta(ctx context.Context, fsId int64) (*RemoteFile, error) {
+	address := fmt.Sprintf("https://pan.baidu.com/rest/2.0/xpan/multimedia?method=%s&fsids=[%d]&dlink=1&access_token=%s", consts.MethodFileMetas, fsId, token.AccessToken)
+	resp := &listResponse{}
+	if err := getJSON(ctx, consts.MethodFileMetas, address, resp); err != nil {
+		return nil, err
+	}
+	if len(resp.List) == 0 {
+		return nil, errors.Wrapf(ErrNotFound, "file meta of %d is empty", fsId)
+	}
+	return resp.List[0], nil
+}
+
+// Download 下载网盘中的文件，先写到临时文件，下载完整后再重命名
+func Download(ctx context.Context, serverPath, target string) error {
+	file, err := Stat(ctx, serverPath)
+	if err != nil {
+		return errors.Wrap(err, "stat remote file fail")
+	}
+	return DownloadFile(ctx, file, target)
+}
+
+// DownloadFile 下载List或者Stat查询到的文件，没有下载地址时先查询
+// 临时文件保留到下载完整为止，再次下载时从临时文件的末尾继续
+func DownloadFile(ctx context.Context, file *RemoteFile, target string) error {
+	baseLogger := logger.Logger.WithContext(ctx).WithField("server_path", file.Path).WithField("target", target)
+	baseLogger.Info("pcs download start")
+
+	if file.Dlink == "" {
+		meta, err := Meta(ctx, file.FsId)
+		if err != nil {
+			return errors.Wrap(err, "query file meta fail")
+		}
+		file = meta
+	}
+
+	tmp := target + ".download"
+	var offset int64
+	if stat, err := os.Stat(tmp); err == nil && stat.Size() < file.Size {
+		offset = stat.Size()
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s&access_token=%s", file.Dlink, token.AccessToken), nil)
+	if err != nil {
+		return errors.Wrap(err, "construct request fail")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", "pan.baidu.com") // 下载地址要求的UA
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "download request fail")
+	}
+	defer resp.Body.Close()
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	switch resp.StatusCode {
+	case http.StatusOK:
+		offset = 0 // 不支持断点续传，从头下载
+	case http.StatusPartialContent:
+		flag = os.O_WRONLY | os.O_APPEND
+		baseLogger.WithField("offset", offset).Info("resume download")
+	default:
+		metrics.PcsErrors.WithLabelValues(consts.MethodDownload, strconv.Itoa(resp.StatusCode)).Inc()
+		return errors.Errorf("response status code is %+v", resp.StatusCode)
+	}
+
+	out, err := os.OpenFile(tmp, flag, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create temp file fail")
+	}
+	written, err := io.Copy(out, resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil { // 保留已经下载的部分，下次继续
+		return errors.Wrap(err, "write file fail")
+	}
+	if offset+written != file.Size {
+		os.Remove(tmp)
+		return errors.Errorf("download size is %d, want %d", offset+written, file.Size)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "rename temp file fail")
+	}
+	baseLogger.WithField("size", file.Size).Info("pcs download success")
+	return nil
+}
+
+// getJSON 请求接口并解析返回的json，errno不为0时返回错误
+func getJSON(ctx context.Context, method, address string, result interface{}) error {
+	baseLogger := logger.Logger.WithContext(ctx)
+	req, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return errors.Wrap(err, "construct request fail")
+	}
+	req = req.WithContext(ctx)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s request fail", method)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("response status code is %+v", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response data fail")
+	}
+	baseLogger.WithField("method", method).WithField("response_body", string(data)).Info("pcs response")
+
+	var errnoResp struct {
+		Errno int `json:"errno"`
+	}
+	if err := jsoniter.Unmarshal(data, &errnoResp); err != nil {
+		return errors.Wrap(err, "unmarshal response fail")
+	}
+	if errnoResp.Errno != consts.ErrnoSuccess {
+		metrics.PcsErrors.WithLabelValues(method, strconv.Itoa(errnoResp.Errno)).Inc()
+		return errors.Errorf("%s errno is %d", method, errnoResp.Errno)
+	}
+	return jsoniter.Unmarshal(data, result)
+}
@@ -0,0 +1,113 @@
+package pcs_client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/internal/token"
+	"backup/pkg/logger"
+	"backup/pkg/metrics"
+)
+
+type copyItem struct {
+	Path    string `json:"path"`    // 源文件路径
+	Dest    string `json:"dest"`    // 目标目录
+	NewName string `json:"newname"` // 目标文件名
+	Ondup   string `json:"ondup"`   // 目标文件已经存在时的处理方式
+}
+
+type fileManagerResponse struct {
+	Errno     int   `json:"errno"`
+	RequestId int64 `json:"request_id"`
+	TaskId    int64 `json:"taskid"`
+	Info      []struct {
+		Errno int    `json:"errno"`
+		Path  string `json:"path"`
+	} `json:"info"`
+}
+
+// Copy 复制网盘中的文件，本地内容相同的文件不需要重新上传，目标文件已经存在时覆盖
+func Copy(ctx context.Context, src, dest string) error {
+	logger.Logger.WithContext(ctx).WithField("src", src).WithField("dest", dest).Info("pcs copy start")
+	fileList, err := jsoniter.MarshalToString([]*copyItem{{
+		Path:    src,
+		Dest:    path.Dir(dest),
+		NewName: path.Base(dest),
+		Ondup:   "overwrite",
+	}})
+	if err != nil {
+		return errors.Wrap(err, "marshal file list fail")
+	}
+	return fileManager(ctx, "copy", fileList)
+}
+
+// Delete 删除网盘中的文件，paths是带路径前缀的完整路径
+func Delete(ctx context.Context, paths []string) error {
+	logger.Logger.WithContext(ctx).WithField("paths", paths).Info("pcs delete start")
+	fileList, err := jsoniter.MarshalToString(paths)
+	if err != nil {
+		return errors.Wrap(err, "marshal file list fail")
+	}
+	return fileManager(ctx, "delete", fileList)
+}
+
+// fileManager 同步执行文件管理操作，任意一个文件失败时返回错误
+func fileManager(ctx context.Context, opera, fileList string) error {
+	baseLogger := logger.Logger.WithContext(ctx)
+	values := url.Values{}
+	values.Set("async", "0") // 同步执行，返回时已经完成
+	values.Set("filelist", fileList)
+
+	address := fmt.Sprintf("https://pan.baidu.com/rest/2.0/xpan/file?method=%s&opera=%s&access_token=%s", consts.MethodFileManager, opera, token.AccessToken)
+	req, err := http.NewRequest(http.MethodPost, address, strings.NewReader(values.Encode()))
+	if err != nil {
+		return errors.Wrap(err, "construct request fail")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s request fail", opera)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("response status code is %+v", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response data fail")
+	}
+	baseLogger.WithField("opera", opera).WithField("response_body", string(data)).Info("pcs file manager response")
+
+	var managerResp = &fileManagerResponse{}
+	if err = jsoniter.Unmarshal(data, managerResp); err != nil {
+		return errors.Wrap(err, "unmarshal response fail")
+	}
+	errno := managerResp.Errno
+	for _, info := range managerResp.Info {
+		if errno == consts.ErrnoSuccess {
+			errno = info.Errno
+		}
+	}
+	if errno != consts.ErrnoSuccess {
+		metrics.PcsErrors.WithLabelValues(consts.MethodFileManager, strconv.Itoa(errno)).Inc()
+		if errno == consts.ErrnoSpaceFull {
+			return errors.Wrapf(ErrSpaceFull, "%s fail", opera)
+		}
+		return errors.Errorf("errno isn't 0, response is [%+v]", managerResp)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package pcs_client
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/pkg/logger"
+)
+
+// Manifest 拆分上传的清单文件，记录原文件的信息和每个部分的位置，恢复时按顺序拼接
+type Manifest struct {
+	Version int         `json:"version"`       // 清单格式的版本
+	Name    string      `json:"name"`          // 原文件名
+	Size    int64       `json:"size"`          // 原文件大小
+	Md5     string      `json:"md5,omitempty"` // 原文件md5，上传前没有计算时为空
+	ModTime time.Time   `json:"mod_time"`      // 原文件修改时间
+	Parts   []*FilePart `json:"parts"`         // 按序号排列的各个部分
+}
+
+// FilePart 拆分后的一个部分，内容是原文件中的一段
+type FilePart struct {
+	Seq    int    `json:"seq"`    // 序号，从1开始
+	Path   string `json:"path"`   // 在网盘中的路径
+	Offset int64  `json:"offset"` // 在原文件中的偏移量
+	Size   int64  `json:"size"`   // 大小
+	Md5    string `json:"md5"`    // md5
+}
+
+// ManifestPath 这个部分对应的清单文件在网盘中的路径
+func (p *FilePart) ManifestPath() string {
+	return strings.TrimSuffix(p.Path, fmt.Sprintf(consts.PartNameFormat, "", p.Seq)) + consts.ManifestSuffix
+}
+
+func NewManifest(stat os.FileInfo) *Manifest {
+	return &Manifest{
+		Version: consts.ManifestVersion,
+		Name:    stat.Name(),
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+	}
+}
+
+// IsManifest 网盘中的文件是否是拆分上传的清单文件
+func IsManifest(serverPath string) bool {
+	return strings.HasSuffix(serverPath, consts.ManifestSuffix)
+}
+
+// ReadManifest 解析下载的清单文件
+func ReadManifest(reader io.Reader) (*Manifest, error) {
+	var manifest = &Manifest{}
+	if err := jsoniter.NewDecoder(reader).Decode(manifest); err != nil {
+		return nil, errors.Wrap(err, "decode manifest fail")
+	}
+	if manifest.Version > consts.ManifestVersion {
+		return nil, errors.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	return manifest, nil
+}
+
+// JoinParts 把下载到dir中的各个部分按清单拼接成原文件，校验每个部分和原文件的md5，失败时删除拼接了一半的文件
+func JoinParts(ctx context.Context, manifest *Manifest, dir, target string) (err error) {
+	baseLogger := logger.Logger.WithContext(ctx)
+
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create target file fail")
+	}
+	defer func() {
+		file.Close()
+		if err != nil {
+			os.Remove(target)
+		}
+	}()
+
+	full := md5.New()
+	var offset int64
+	for _, part := range manifest.Parts {
+		if part.Offset != offset {
+			return errors.Errorf("part %d offset is %d, want %d", part.Seq, part.Offset, offset)
+		}
+		if err = appendPart(filepath.Join(dir, path.Base(part.Path)), part, io.MultiWriter(file, full)); err != nil {
+			return err
+		}
+		offset += part.Size
+	}
+	if offset != manifest.Size {
+		return errors.Errorf("joined size is %d, want %d", offset, manifest.Size)
+	}
+	if sum := hex.EncodeToString(full.Sum(nil)); manifest.Md5 != "" && sum != manifest.Md5 {
+		return errors.Errorf("joined md5 is %s, want %s", sum, manifest.Md5)
+	}
+	if err = file.Close(); err != nil {
+		return errors.Wrap(err, "close target file fail")
+	}
+	if chtimesErr := os.Chtimes(target, manifest.ModTime, manifest.ModTime); chtimesErr != nil {
+		baseLogger.WithError(chtimesErr).WithField("target", target).Warn("restore mod time fail")
+	}
+	baseLogger.WithField("target", target).WithField("part_count", len(manifest.Parts)).Info("join parts success")
+	return nil
+}
+
+func appendPart(filename string, part *FilePart, writer io.Writer) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "open part %d fail", part.Seq)
+	}
+	defer file.Close()
+
+	digest := md5.New()
+	n, err := io.Copy(io.MultiWriter(writer, digest), file)
+	if err != nil {
+		return errors.Wrapf(err, "copy part %d fail", part.Seq)
+	}
+	if n != part.Size {
+		return errors.Errorf("part %d size is %d, want %d", part.Seq, n, part.Size)
+	}
+	if sum := hex.EncodeToString(digest.Sum(nil)); sum != part.Md5 {
+		return errors.Errorf("part %d md5 is %s, want %s", part.Seq, sum, part.Md5)
+	}
+	return nil
+}
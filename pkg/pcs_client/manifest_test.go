@@ -0,0 +1,91 @@
+package pcs_client
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJoinParts(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	sum := func(data []byte) string {
+		s := md5.Sum(data)
+		return hex.EncodeToString(s[:])
+	}
+	tests := []struct {
+		name     string
+		partSize int
+		corrupt  int // 写入时损坏的部分序号，0表示不损坏
+		md5      string
+		wantErr  bool
+	}{
+		{name: "success", partSize: 10, md5: sum(content)},
+		{name: "without md5", partSize: 16, md5: ""},
+		{name: "corrupt part", partSize: 10, corrupt: 2, md5: sum(content), wantErr: true},
+		{name: "wrong md5", partSize: 10, md5: sum(nil), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "join_parts")
+			if err != nil {
+				t.Fatalf("create temp dir error = %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			manifest := &Manifest{Name: "disk.vmdk", Size: int64(len(content)), Md5: tt.md5}
+			for seq, offset := 1, 0; offset < len(content); seq, offset = seq+1, offset+tt.partSize {
+				end := offset + tt.partSize
+				if end > len(content) {
+					end = len(content)
+				}
+				data := content[offset:end]
+				part := &FilePart{Seq: seq, Path: fmt.Sprintf("/backup/disk.vmdk.part%03d", seq), Offset: int64(offset), Size: int64(len(data)), Md5: sum(data)}
+				manifest.Parts = append(manifest.Parts, part)
+				if part.ManifestPath() != "/backup/disk.vmdk.manifest" {
+					t.Errorf("ManifestPath() = %s", part.ManifestPath())
+				}
+				if seq == tt.corrupt {
+					data = bytes.ToUpper(data)
+				}
+				ioutil.WriteFile(filepath.Join(dir, filepath.Base(part.Path)), data, 0644)
+			}
+
+			// 清单文件经过序列化后再解析
+			var buffer bytes.Buffer
+			fmt.Fprintf(&buffer, `{"version":1,"name":%q,"size":%d,"md5":%q,"parts":[`, manifest.Name, manifest.Size, manifest.Md5)
+			for i, part := range manifest.Parts {
+				if i > 0 {
+					buffer.WriteString(",")
+				}
+				fmt.Fprintf(&buffer, `{"seq":%d,"path":%q,"offset":%d,"size":%d,"md5":%q}`, part.Seq, part.Path, part.Offset, part.Size, part.Md5)
+			}
+			buffer.WriteString("]}")
+			parsed, err := ReadManifest(&buffer)
+			if err != nil {
+				t.Fatalf("ReadManifest() error = %v", err)
+			}
+
+			target := filepath.Join(dir, "disk.vmdk")
+			err = JoinParts(context.Background(), parsed, dir, target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("JoinParts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, err := os.Stat(target); !os.IsNotExist(err) {
+					t.Errorf("target file exists after JoinParts() fail")
+				}
+				return
+			}
+			got, _ := ioutil.ReadFile(target)
+			if !bytes.Equal(got, content) {
+				t.Errorf("joined content = %q, want %q", got, content)
+			}
+		})
+	}
+}
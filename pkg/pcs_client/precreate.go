@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 
 	jsoniter "github.com/json-iterator/go"
@@ -18,6 +19,7 @@ import (
 	"backup/internal/config"
 	"backup/internal/token"
 	"backup/pkg/logger"
+	"backup/pkg/metrics"
 	"backup/pkg/util"
 )
 
@@ -59,6 +61,10 @@ func pcsPreCreate(ctx context.Context, preCreateReq *preCreateRequest) (*preCrea
 	}
 
 	if preCreateResp.Errno != consts.ErrnoSuccess {
+		metrics.PcsErrors.WithLabelValues(consts.MethodPrecreate, strconv.Itoa(preCreateResp.Errno)).Inc()
+		if preCreateResp.Errno == consts.ErrnoSpaceFull {
+			return preCreateResp, errors.Wrap(ErrSpaceFull, "precreate fail")
+		}
 		return preCreateResp, errors.Errorf("errno isn't 0, preCreateResp is [%+v]", resp)
 	}
 
@@ -89,7 +95,8 @@ type preCreateResponse struct {
 	BlockList  []int  `json:"block_list"`  // 需要上传的分片序号列表，索引从0开始
 }
 
-func NewPreCreateRequest(ctx context.Context, filename, serverPath string) (*preCreateRequest, error) {
+// NewPreCreateRequest 使用文件的md5计算结果构造预上传请求，不会再读取文件内容
+func NewPreCreateRequest(ctx context.Context, filename, serverPath string, hash *util.FileHash) (*preCreateRequest, error) {
 	baseLogger := logger.Logger.WithContext(ctx)
 	baseLogger.WithFields(map[string]interface{}{
 		"filename":   filename,
@@ -100,11 +107,6 @@ func NewPreCreateRequest(ctx context.Context, filename, serverPath string) (*pre
 	if serverPath == "" {
 		return nil, errors.Errorf("serverFilename is empty, filename is %s", filename)
 	}
-	list, err := util.GetBlockList(ctx, filename)
-	if err != nil {
-		return nil, errors.Wrap(err, "get block list fail")
-	}
-
 	serverPath = path.Join(config.Config.PcsConfig.PathPrefix, serverPath)
 	stat, err := os.Stat(filename)
 	if err != nil {
@@ -117,11 +119,13 @@ func NewPreCreateRequest(ctx context.Context, filename, serverPath string) (*pre
 	}
 
 	request := &preCreateRequest{
-		Path:      serverPath,
-		Size:      stat.Size(),
-		IsDir:     isDir,
-		BlockList: list,
-		RType:     consts.RTypeOverride,
+		Path:       serverPath,
+		Size:       hash.ContentSize(),
+		IsDir:      isDir,
+		BlockList:  hash.BlockList,
+		RType:      consts.RTypeOverride,
+		ContentMd5: hash.Md5,
+		SliceMd5:   hash.SliceMd5,
 	}
 
 	baseLogger.WithField("result", request).Infof("construct preCreateRequest end")
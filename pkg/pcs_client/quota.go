@@ -0,0 +1,130 @@
+package pcs_client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/internal/token"
+	"backup/pkg/logger"
+	"backup/pkg/metrics"
+)
+
+// ErrSpaceFull 网盘剩余空间不足，重试也不会成功
+var ErrSpaceFull = errors.New("netdisk space is full")
+
+const quotaCacheTime = time.Minute // 剩余空间的缓存时间
+
+// quotaCache 缓存的网盘容量，上传开始时预留文件大小，防止同时上传的文件总大小超过剩余空间
+var quotaCache = struct {
+	lock       sync.Mutex
+	quota      *Quota
+	reserved   int64 // 缓存之后开始上传的文件大小
+	updateTime time.Time
+}{}
+
+type Quota struct {
+	Errno  int   `json:"errno"`
+	Total  int64 `json:"total"`  // 总空间，单位B
+	Used   int64 `json:"used"`   // 已使用空间，单位B
+	Free   int64 `json:"free"`   // 免费容量，单位B
+	Expire bool  `json:"expire"` // 7天内是否有容量到期
+}
+
+// Remain 剩余空间
+func (q *Quota) Remain() int64 {
+	if q.Used >= q.Total {
+		return 0
+	}
+	return q.Total - q.Used
+}
+
+// GetQuota 获取网盘容量
+func GetQuota(ctx context.Context) (*Quota, error) {
+	baseLogger := logger.Logger.WithContext(ctx)
+	baseLogger.Info("pcs quota start")
+
+	address := fmt.Sprintf("https://pan.baidu.com/api/quota?checkfree=1&checkexpire=1&access_token=%s", token.AccessToken)
+	req, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "construct request fail")
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "quota request fail")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("response status code is %+v", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read response data fail")
+	}
+	baseLogger.WithField("response_body", string(data)).Info("pcs quota response")
+
+	var quota = &Quota{}
+	err = jsoniter.Unmarshal(data, quota)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal quota fail")
+	}
+
+	if quota.Errno != consts.ErrnoSuccess {
+		metrics.PcsErrors.WithLabelValues(consts.MethodQuota, strconv.Itoa(quota.Errno)).Inc()
+		return nil, errors.Errorf("errno isn't 0, quota is [%+v]", quota)
+	}
+	return quota, nil
+}
+
+// RefreshQuota 重新获取网盘容量并更新缓存
+func RefreshQuota(ctx context.Context) (*Quota, error) {
+	quota, err := GetQuota(ctx)
+	if err != nil {
+		return nil, err
+	}
+	quotaCache.lock.Lock()
+	quotaCache.quota = quota
+	quotaCache.reserved = 0
+	quotaCache.updateTime = time.Now()
+	quotaCache.lock.Unlock()
+	return quota, nil
+}
+
+// reserveSpace 上传前检查剩余空间是否足够，足够时预留文件大小
+// 获取容量失败时不阻止上传，由上传接口返回的错误码判断
+func reserveSpace(ctx context.Context, size int64) error {
+	quotaCache.lock.Lock()
+	expired := time.Since(quotaCache.updateTime) >= quotaCacheTime
+	quotaCache.lock.Unlock()
+	if expired {
+		if _, err := RefreshQuota(ctx); err != nil {
+			logger.Logger.WithContext(ctx).WithError(err).Warn("get quota fail, skip space check")
+			return nil
+		}
+	}
+
+	quotaCache.lock.Lock()
+	defer quotaCache.lock.Unlock()
+	if quotaCache.quota == nil {
+		return nil
+	}
+	remain := quotaCache.quota.Remain() - quotaCache.reserved
+	if size > remain {
+		logger.Logger.WithContext(ctx).WithField("size", size).WithField("remain", remain).Warn("netdisk space is not enough")
+		return errors.Wrapf(ErrSpaceFull, "file size is %d, remain space is %d", size, remain)
+	}
+	quotaCache.reserved += size
+	return nil
+}
@@ -0,0 +1,41 @@
+package pcs_client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_reserveSpace(t *testing.T) {
+	quotaCache.quota = &Quota{Total: 100, Used: 40}
+	quotaCache.reserved = 0
+	quotaCache.updateTime = time.Now()
+	defer func() {
+		quotaCache.quota = nil
+		quotaCache.updateTime = time.Time{}
+	}()
+
+	tests := []struct {
+		name    string
+		size    int64
+		wantErr bool
+	}{
+		{name: "fit", size: 30},
+		{name: "exceed reserved", size: 40, wantErr: true},
+		{name: "fill", size: 30},
+		{name: "full", size: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := reserveSpace(context.Background(), tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reserveSpace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrSpaceFull) {
+				t.Errorf("reserveSpace() error = %v, want ErrSpaceFull", err)
+			}
+		})
+	}
+}
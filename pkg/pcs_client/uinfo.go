@@ -0,0 +1,132 @@
+package pcs_client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/internal/config"
+	"backup/internal/token"
+	"backup/pkg/logger"
+	"backup/pkg/metrics"
+)
+
+const (
+	vipTypeCacheTime = time.Hour       // 会员等级的缓存时间
+	vipTypeRetryTime = 5 * time.Minute // 获取失败后的重试间隔
+)
+
+var vipTypeCache = struct {
+	lock       sync.Mutex
+	vipType    int
+	updateTime time.Time
+}{vipType: consts.VipTypeNormal}
+
+type UserInfo struct {
+	Errno       int    `json:"errno"`
+	BaiduName   string `json:"baidu_name"`   // 百度账号
+	NetdiskName string `json:"netdisk_name"` // 网盘账号
+	AvatarUrl   string `json:"avatar_url"`   // 头像地址
+	VipType     int    `json:"vip_type"`     // 会员类型，0普通用户、1普通会员、2超级会员
+	Uk          int64  `json:"uk"`           // 用户ID
+}
+
+// GetUserInfo 获取网盘用户信息
+func GetUserInfo(ctx context.Context) (*UserInfo, error) {
+	baseLogger := logger.Logger.WithContext(ctx)
+	baseLogger.Info("pcs uinfo start")
+
+	address := fmt.Sprintf("https://pan.baidu.com/rest/2.0/xpan/nas?method=%s&access_token=%s", consts.MethodUinfo, token.AccessToken)
+	req, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "construct request fail")
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "uinfo request fail")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("response status code is %+v", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read response data fail")
+	}
+	baseLogger.WithField("response_body", string(data)).Info("pcs uinfo response")
+
+	var userInfo = &UserInfo{}
+	err = jsoniter.Unmarshal(data, userInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal user info fail")
+	}
+
+	if userInfo.Errno != consts.ErrnoSuccess {
+		metrics.PcsErrors.WithLabelValues(consts.MethodUinfo, strconv.Itoa(userInfo.Errno)).Inc()
+		return nil, errors.Errorf("errno isn't 0, userInfo is [%+v]", userInfo)
+	}
+	return userInfo, nil
+}
+
+// ChunkSize 上传使用的分片大小，优先使用配置，否则根据会员等级选择
+func ChunkSize(ctx context.Context) int64 {
+	if size := config.GetChunkSize(); size > 0 {
+		return size
+	}
+	return chunkSizeOfVipType(getVipType(ctx))
+}
+
+// MaxFileSize 单个文件的大小上限，超过时拆分上传
+func MaxFileSize(ctx context.Context) int64 {
+	switch getVipType(ctx) {
+	case consts.VipTypeVip:
+		return consts.MaxFileSizeVip
+	case consts.VipTypeSVip:
+		return consts.MaxFileSizeSVip
+	}
+	return consts.MaxFileSizeNormal
+}
+
+func chunkSizeOfVipType(vipType int) int64 {
+	switch vipType {
+	case consts.VipTypeVip:
+		return consts.Size16MB
+	case consts.VipTypeSVip:
+		return consts.Size32MB
+	}
+	return consts.Size4MB
+}
+
+// getVipType 获取会员等级，获取失败时使用上一次的结果
+func getVipType(ctx context.Context) int {
+	vipTypeCache.lock.Lock()
+	defer vipTypeCache.lock.Unlock()
+
+	if time.Since(vipTypeCache.updateTime) < vipTypeCacheTime {
+		return vipTypeCache.vipType
+	}
+
+	userInfo, err := GetUserInfo(ctx)
+	if err != nil {
+		// 失败了等一段时间再获取，防止每个文件都请求一次
+		vipTypeCache.updateTime = time.Now().Add(vipTypeRetryTime - vipTypeCacheTime)
+		logger.Logger.WithContext(ctx).WithError(err).WithField("vip_type", vipTypeCache.vipType).Warn("get vip type fail, use last vip type")
+		return vipTypeCache.vipType
+	}
+	vipTypeCache.vipType = userInfo.VipType
+	vipTypeCache.updateTime = time.Now()
+	logger.Logger.WithContext(ctx).WithField("vip_type", userInfo.VipType).Info("get vip type success")
+	return vipTypeCache.vipType
+}
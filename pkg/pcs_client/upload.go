@@ -3,12 +3,18 @@ package pcs_client
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"sync"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pkg/errors"
@@ -16,8 +22,8 @@ import (
 
 	"backup/consts"
 	"backup/internal/token"
-	"backup/pkg/byte_pool"
 	"backup/pkg/logger"
+	"backup/pkg/metrics"
 	"backup/pkg/work_pool"
 )
 
@@ -25,17 +31,44 @@ func pcsUpload(ctx context.Context, uploadReq *uploadRequest) error {
 	baseLogger := logger.Logger.WithContext(ctx)
 	baseLogger.WithField("uploadReq", uploadReq).Info("pcs upload start")
 
-	if len(uploadReq.PartSeq) == 0 {
-		uploadReq.PartSeq = append(uploadReq.PartSeq, 0)
+	if len(uploadReq.PartSeq) == 0 { // 所有分片都已经上传完成
+		return nil
 	}
 	file, err := os.OpenFile(uploadReq.Filename, os.O_RDONLY, 0644)
 	if err != nil {
 		return errors.Wrap(err, "open file fail")
 	}
-	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "get file stat fail")
+	}
+	end := stat.Size() // 上传内容的结束位置
+	if uploadReq.Length > 0 {
+		end = uploadReq.Offset + uploadReq.Length
+	}
+	// 分片直接从文件中读取，暂停后正在上传的分片需要等请求中断后退出，所有分片结束后才能关闭文件
+	var pending sync.WaitGroup
+	defer func() {
+		go func() {
+			pending.Wait()
+			file.Close()
+		}()
+	}()
 
 	var group = work_pool.NewTaskGroup(ctx, len(uploadReq.PartSeq))
+	defer group.Cancel() // 提前返回时，跳过还没有执行的分片
 	group.RunFail = func(ctx context.Context, task *work_pool.Task, err error) {
+		if ctx.Err() != nil { // 暂停或者取消时中断的分片不需要重试
+			task.Discard(task)
+			return
+		}
+		if errors.Is(err, ErrFileChanged) || errors.Is(err, ErrSpaceFull) { // 文件已经变化或者空间不足，重试也没有意义
+			baseLogger.WithField("task", task).WithError(err).Warn("stop upload without retry")
+			task.Discard(task)
+			group.Fail(err)
+			return
+		}
 		baseLogger.WithFields(map[string]interface{}{
 			"task":          task,
 			logrus.ErrorKey: err,
@@ -54,28 +87,54 @@ func pcsUpload(ctx context.Context, uploadReq *uploadRequest) error {
 		uploadReq.RefreshFunc()
 	}
 	for _, seq := range uploadReq.PartSeq {
-		chunk := byte_pool.DefaultBytePool.Get()
-		n, err := file.Read(chunk)
-		if err != nil {
-			return errors.Wrap(err, "read chunk from file")
+		select {
+		case <-ctx.Done(): // 暂停或者取消后不再提交分片，正在上传的分片通过ctx中断
+			return ctx.Err()
+		default:
 		}
 
+		// 继续上传时分片不连续，按序号定位
+		offset := uploadReq.Offset + int64(seq)*uploadReq.ChunkSize
+		size := end - offset
+		if size > uploadReq.ChunkSize {
+			size = uploadReq.ChunkSize
+		}
+		if size < 0 {
+			size = 0
+		}
 		params := &uploadTaskParams{
 			UploadId:   uploadReq.UploadId,
 			ServerPath: uploadReq.ServerPath,
 			PartSeq:    seq,
-			Content:    chunk[:n],
+			File:       file,
+			Offset:     offset,
+			Size:       size,
+		}
+		if seq < len(uploadReq.BlockList) {
+			params.BlockMd5 = uploadReq.BlockList[seq]
 		}
 
 		task := work_pool.NewTask(group, fmt.Sprintf("%s_%d", uploadReq.ServerPath, seq), consts.MaxRetryCount)
 		task.Run = func(ctx context.Context, task *work_pool.Task) error {
-			return uploadChunk(ctx, params, http.DefaultClient)
+			if err := uploadChunk(ctx, params, http.DefaultClient); err != nil {
+				return err
+			}
+			pending.Done()
+			if uploadReq.PartFunc != nil {
+				uploadReq.PartFunc(params.PartSeq)
+			}
+			return nil
+		}
+		task.Discard = func(task *work_pool.Task) {
+			pending.Done()
 		}
 
 		baseLogger.WithField("task", task).Info("task submit")
 
+		pending.Add(1)
 		err = p.Submit(task)
 		if err != nil {
+			pending.Done()
 			return errors.Wrap(err, "submit task fail")
 		}
 	}
@@ -92,16 +151,15 @@ func uploadChunk(ctx context.Context, params *uploadTaskParams, client *http.Cli
 	baseLogger := logger.Logger.WithContext(ctx)
 	baseLogger.WithFields(map[string]interface{}{
 		"params":        params,
-		"file_size(B)":  len(params.Content),
-		"file_size(KB)": len(params.Content) / 1024,
-		"file_size(MB)": len(params.Content) / 1024 / 1024,
+		"file_size(B)":  params.Size,
+		"file_size(KB)": params.Size / 1024,
+		"file_size(MB)": params.Size / 1024 / 1024,
 	}).Info("pcs upload chunk start")
 
 	request, err := params.GenerateRequest(ctx, params.ServerPath)
 	if err != nil {
 		return errors.Wrap(err, "generate upload request fail")
 	}
-	request.WithContext(ctx)
 	response, err := client.Do(request)
 	if err != nil {
 		return errors.Wrap(err, "upload request fail")
@@ -127,25 +185,45 @@ func uploadChunk(ctx context.Context, params *uploadTaskParams, client *http.Cli
 		return errors.Wrap(err, "unmarshal response fail")
 	}
 
+	// 上传的内容和预上传时的分片md5不一致，说明文件在上传过程中被修改了
+	sum := params.Md5()
+	if params.BlockMd5 != "" && ((sum != "" && sum != params.BlockMd5) || (resp.Md5 != "" && resp.Md5 != params.BlockMd5)) {
+		baseLogger.WithField("block_md5", params.BlockMd5).WithField("read_md5", sum).WithField("server_md5", resp.Md5).Warn("chunk md5 mismatch")
+		return ErrFileChanged
+	}
+
 	if resp.Errno != consts.ErrnoSuccess || resp.ErrorCode != consts.ErrnoSuccess {
+		errno := resp.Errno
+		if errno == consts.ErrnoSuccess {
+			errno = resp.ErrorCode
+		}
+		metrics.PcsErrors.WithLabelValues(consts.MethodUpload, strconv.Itoa(errno)).Inc()
+		if errno == consts.ErrnoSpaceFull {
+			return errors.Wrap(ErrSpaceFull, "upload chunk fail")
+		}
 		return errors.Errorf("upload chunk fail")
 	}
 
-	byte_pool.DefaultBytePool.Put(params.Content)
+	metrics.UploadBytes.Add(float64(params.Size))
 	baseLogger.WithError(err).WithField("response", resp).Info("upload chunk success")
 	return nil
 }
 
 type uploadRequest struct {
-	UploadId    string `json:"upload_id"`
-	ServerPath  string `json:"server_path"`
-	PartSeq     []int  `json:"part_seq"`
-	Filename    string `json:"filename"`
-	RefreshFunc func() `json:"-"`
+	UploadId    string        `json:"upload_id"`
+	ServerPath  string        `json:"server_path"`
+	PartSeq     []int         `json:"part_seq"`
+	Filename    string        `json:"filename"`
+	RefreshFunc func()        `json:"-"`
+	PartFunc    func(seq int) `json:"-"` // 分片上传完成后的回调函数
+	ChunkSize   int64         `json:"chunk_size"`
+	BlockList   []string      `json:"-"`      // 预上传时的分片md5，用于校验上传的内容
+	Offset      int64         `json:"offset"` // 拆分上传时，上传的内容在文件中的偏移量
+	Length      int64         `json:"length"` // 拆分上传时，上传的内容长度，0表示整个文件
 }
 
 func NewUploadRequest(uploadId string, serverPath string, partSeq []int, filename string, refreshFunc func()) *uploadRequest {
-	return &uploadRequest{UploadId: uploadId, ServerPath: serverPath, PartSeq: partSeq, Filename: filename, RefreshFunc: refreshFunc}
+	return &uploadRequest{UploadId: uploadId, ServerPath: serverPath, PartSeq: partSeq, Filename: filename, RefreshFunc: refreshFunc, ChunkSize: consts.Size4MB}
 }
 
 type uploadResponse struct {
@@ -160,7 +238,28 @@ type uploadTaskParams struct {
 	ServerPath string `json:"path"`
 	UploadId   string `json:"uploadid"`
 	PartSeq    int    `json:"partseq"`
-	Content    []byte `json:"-"`
+
+	File   io.ReaderAt `json:"-"` // 分片所在的文件
+	Offset int64       `json:"-"` // 分片在文件中的偏移量
+	Size   int64       `json:"-"` // 分片大小
+
+	BlockMd5 string    `json:"-"` // 预上传时分片的md5
+	digest   hash.Hash // 发送请求时计算的分片md5
+	sent     int64     // 发送请求时读取的分片长度
+}
+
+// Md5 最近一次发送的分片内容的md5，内容没有读完整时返回空字符串
+func (p *uploadTaskParams) Md5() string {
+	if p.digest == nil || p.sent != p.Size {
+		return ""
+	}
+	return hex.EncodeToString(p.digest.Sum(nil))
+}
+
+// Write 发送分片内容时同时计算md5
+func (p *uploadTaskParams) Write(data []byte) (int, error) {
+	p.sent += int64(len(data))
+	return p.digest.Write(data)
 }
 
 func (p *uploadTaskParams) GenerateRequest(ctx context.Context, filename string) (*http.Request, error) {
@@ -175,28 +274,37 @@ func (p *uploadTaskParams) GenerateRequest(ctx context.Context, filename string)
 	}
 
 	address = fmt.Sprintf("%s&%s", address, encodeString)
+
+	// multipart的头部和尾部很小，放在内存中，分片内容直接从文件中流式读取
 	buffer := bytes.NewBufferString("")
 	writer := multipart.NewWriter(buffer)
-
-	part, err := writer.CreateFormFile("file", filename)
+	_, err = writer.CreateFormFile("file", filename)
 	if err != nil {
 		return nil, errors.Wrap(err, "create form file fail")
 	}
-
-	_, err = part.Write(p.Content)
-	if err != nil {
-		return nil, errors.Wrap(err, "write to form file fail")
-	}
+	headLength := buffer.Len()
 
 	err = writer.Close()
 	if err != nil {
 		return nil, errors.Wrap(err, "close form file fail")
 	}
-
-	req, err := http.NewRequest("POST", address, buffer)
+	head, tail := buffer.Bytes()[:headLength], buffer.Bytes()[headLength:]
+
+	getBody := func() (io.ReadCloser, error) {
+		p.digest, p.sent = md5.New(), 0 // 重新发送时重新计算
+		return ioutil.NopCloser(io.MultiReader(
+			bytes.NewReader(head),
+			io.TeeReader(io.NewSectionReader(p.File, p.Offset, p.Size), p),
+			bytes.NewReader(tail),
+		)), nil
+	}
+	body, _ := getBody()
+	req, err := http.NewRequestWithContext(ctx, "POST", address, body) // 暂停或取消时中断正在上传的分片
 	if err != nil {
 		return nil, errors.Wrap(err, "request generate fail")
 	}
+	req.ContentLength = int64(len(head)) + p.Size + int64(len(tail))
+	req.GetBody = getBody
 
 	req.Header.Add("Content-Type", writer.FormDataContentType())
 	baseLogger.Info("generate request success")
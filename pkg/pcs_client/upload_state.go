@@ -0,0 +1,93 @@
+package pcs_client
+
+import (
+	"sort"
+	"sync"
+)
+
+// UploadState 分片上传的进度，暂停或者中断后可以根据上传ID和已完成的分片继续上传
+type UploadState struct {
+	lock           sync.Mutex
+	uploadId       string
+	blockList      []string
+	completedParts map[int]bool
+}
+
+func NewUploadState(uploadId string, blockList []string, completedParts []int) *UploadState {
+	s := &UploadState{
+		uploadId:       uploadId,
+		blockList:      blockList,
+		completedParts: make(map[int]bool, len(completedParts)),
+	}
+	for _, seq := range completedParts {
+		s.completedParts[seq] = true
+	}
+	return s
+}
+
+func (s *UploadState) UploadId() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.uploadId
+}
+
+func (s *UploadState) BlockList() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.blockList...)
+}
+
+// CompletedParts 已经上传完成的分片序号，从小到大排列
+func (s *UploadState) CompletedParts() []int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	parts := make([]int, 0, len(s.completedParts))
+	for seq := range s.completedParts {
+		parts = append(parts, seq)
+	}
+	sort.Ints(parts)
+	return parts
+}
+
+// CompletedCount 已经上传完成的分片数量
+func (s *UploadState) CompletedCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.completedParts)
+}
+
+// resumable 是否可以继续上传，文件内容变化后分片的md5也会变化，只能重新上传
+func (s *UploadState) resumable(blockList []string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.uploadId == "" || len(s.blockList) != len(blockList) {
+		return false
+	}
+	for i := range blockList {
+		if s.blockList[i] != blockList[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *UploadState) isCompleted(seq int) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.completedParts[seq]
+}
+
+func (s *UploadState) complete(seq int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.completedParts[seq] = true
+}
+
+// reset 使用新的上传ID重新开始上传
+func (s *UploadState) reset(uploadId string, blockList []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.uploadId = uploadId
+	s.blockList = blockList
+	s.completedParts = map[int]bool{}
+}
@@ -0,0 +1,64 @@
+package pcs_client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUploadState_resumable(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     *UploadState
+		blockList []string
+		want      bool
+	}{
+		{
+			name:      "noUploadId",
+			state:     NewUploadState("", []string{"a", "b"}, []int{0}),
+			blockList: []string{"a", "b"},
+			want:      false,
+		},
+		{
+			name:      "same",
+			state:     NewUploadState("id", []string{"a", "b"}, []int{0}),
+			blockList: []string{"a", "b"},
+			want:      true,
+		},
+		{
+			name:      "contentChanged",
+			state:     NewUploadState("id", []string{"a", "b"}, []int{0}),
+			blockList: []string{"a", "c"},
+			want:      false,
+		},
+		{
+			name:      "sizeChanged",
+			state:     NewUploadState("id", []string{"a", "b"}, []int{0}),
+			blockList: []string{"a", "b", "c"},
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.resumable(tt.blockList); got != tt.want {
+				t.Errorf("resumable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadState_complete(t *testing.T) {
+	state := NewUploadState("id", []string{"a", "b", "c"}, []int{2})
+	state.complete(0)
+	state.complete(2)
+	if got, want := state.CompletedParts(), []int{0, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CompletedParts() = %v, want %v", got, want)
+	}
+	if !state.isCompleted(0) || state.isCompleted(1) {
+		t.Errorf("isCompleted() mismatch, completed parts = %v", state.CompletedParts())
+	}
+
+	state.reset("new", []string{"d"})
+	if state.UploadId() != "new" || state.CompletedCount() != 0 {
+		t.Errorf("reset() upload_id = %s, completed count = %d", state.UploadId(), state.CompletedCount())
+	}
+}
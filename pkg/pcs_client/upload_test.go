@@ -0,0 +1,102 @@
+package pcs_client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"testing"
+)
+
+func Test_uploadTaskParams_GenerateRequest(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	tests := []struct {
+		name   string
+		offset int64
+		size   int64
+		want   []byte
+	}{
+		{name: "head", offset: 0, size: 10, want: content[:10]},
+		{name: "middle", offset: 5, size: 10, want: content[5:15]},
+		{name: "empty", offset: 0, size: 0, want: []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &uploadTaskParams{
+				ServerPath: "/test.txt",
+				UploadId:   "upload_id",
+				PartSeq:    0,
+				File:       bytes.NewReader(content),
+				Offset:     tt.offset,
+				Size:       tt.size,
+			}
+			req, err := p.GenerateRequest(context.Background(), p.ServerPath)
+			if err != nil {
+				t.Fatalf("GenerateRequest() error = %v", err)
+			}
+
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("read body error = %v", err)
+			}
+			if int64(len(body)) != req.ContentLength {
+				t.Errorf("ContentLength = %d, body length = %d", req.ContentLength, len(body))
+			}
+
+			_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("parse content type error = %v", err)
+			}
+			part, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).NextPart()
+			if err != nil {
+				t.Fatalf("read part error = %v", err)
+			}
+			got, _ := ioutil.ReadAll(part)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("part content = %q, want %q", got, tt.want)
+			}
+
+			// 重试时可以重新获取完整的body
+			again, _ := req.GetBody()
+			againData, _ := ioutil.ReadAll(again)
+			if !bytes.Equal(againData, body) {
+				t.Errorf("GetBody() returns different body")
+			}
+		})
+	}
+}
+
+func Test_uploadTaskParams_Md5(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	tests := []struct {
+		name   string
+		offset int64
+		size   int64
+		read   bool
+		want   string
+	}{
+		{name: "read", offset: 5, size: 10, read: true, want: "d5f8745e16fc384dd522830ec45ea071"},
+		{name: "not read", offset: 5, size: 10, read: false, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &uploadTaskParams{
+				ServerPath: "/test.txt",
+				File:       bytes.NewReader(content),
+				Offset:     tt.offset,
+				Size:       tt.size,
+			}
+			req, err := p.GenerateRequest(context.Background(), p.ServerPath)
+			if err != nil {
+				t.Fatalf("GenerateRequest() error = %v", err)
+			}
+			if tt.read {
+				ioutil.ReadAll(req.Body)
+			}
+			if got := p.Md5(); got != tt.want {
+				t.Errorf("Md5() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
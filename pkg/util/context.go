@@ -13,3 +13,9 @@ func NewContext() context.Context {
 	ctx := context.WithValue(baseContext, consts.LogTraceKey, uuid.New().String())
 	return ctx
 }
+
+// TraceId ctx中的trace_id，没有时返回空字符串
+func TraceId(ctx context.Context) string {
+	traceId, _ := ctx.Value(consts.LogTraceKey).(string)
+	return traceId
+}
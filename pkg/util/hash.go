@@ -0,0 +1,182 @@
+package util
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"backup/pkg/byte_pool"
+	"backup/pkg/logger"
+)
+
+const SliceSize = 256 * 1024 // 校验段大小，文件的前256KB
+
+// FileHash 文件的md5、分片md5列表和校验段md5，一次读取文件全部计算出来
+type FileHash struct {
+	Md5       string    `json:"md5"`              // 文件md5
+	SliceMd5  string    `json:"slice_md5"`        // 前256KB的md5
+	BlockList []string  `json:"block_list"`       // 每个分片的md5
+	ChunkSize int64     `json:"chunk_size"`       // 计算分片md5时的分片大小
+	Size      int64     `json:"size"`             // 计算时的文件大小
+	ModTime   time.Time `json:"mod_time"`         // 计算时的文件修改时间
+	Offset    int64     `json:"offset,omitempty"` // 拆分上传时，计算的内容在文件中的偏移量
+	Length    int64     `json:"length,omitempty"` // 拆分上传时，计算的内容长度，0表示整个文件
+	Entropy   float64   `json:"entropy"`          // 前256KB的信息熵，单位bit/字节，加密后的内容接近8
+}
+
+// ContentSize 计算md5的内容长度
+func (h *FileHash) ContentSize() int64 {
+	if h.Length > 0 {
+		return h.Length
+	}
+	return h.Size
+}
+
+// Valid 缓存的结果是否还能使用，文件大小、修改时间和分片大小都不变时才能使用
+func (h *FileHash) Valid(filename string, chunkSize int64) bool {
+	if h == nil || h.Md5 == "" || len(h.BlockList) == 0 || h.ChunkSize != chunkSize {
+		return false
+	}
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+	return stat.Size() == h.Size && stat.ModTime().Equal(h.ModTime)
+}
+
+// HashFile 只读取一次文件，同时计算文件md5、分片md5列表和校验段md5
+func HashFile(ctx context.Context, filename string, chunkSize int64) (*FileHash, error) {
+	return HashSection(ctx, filename, 0, 0, chunkSize)
+}
+
+// HashSection 计算文件中一段内容的md5，length为0时计算整个文件，大文件拆分上传时每一段单独计算
+func HashSection(ctx context.Context, filename string, offset, length, chunkSize int64) (*FileHash, error) {
+	baseLogger := logger.Logger.WithContext(ctx)
+
+	file, err := os.OpenFile(filename, os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file fail")
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "get file stat fail")
+	}
+
+	var reader io.Reader = file
+	if length > 0 {
+		reader = io.NewSectionReader(file, offset, length)
+	}
+	writer := newHashWriter(chunkSize)
+	buffer := byte_pool.DefaultBytePool.Get()
+	defer byte_pool.DefaultBytePool.Put(buffer)
+	if _, err := io.CopyBuffer(writer, reader, buffer); err != nil {
+		baseLogger.WithError(err).WithField("filename", filename).Error("read file fail")
+		return nil, errors.Wrap(err, "read file fail")
+	}
+
+	result := writer.result()
+	result.Size = stat.Size()
+	result.ModTime = stat.ModTime()
+	if length > 0 {
+		result.Offset, result.Length = offset, length
+	}
+	baseLogger.WithField("filename", filename).WithField("md5", result.Md5).WithField("block_count", len(result.BlockList)).Info("hash file success")
+	return result, nil
+}
+
+// hashWriter 流式计算各种md5
+type hashWriter struct {
+	chunkSize int64
+
+	full        hash.Hash
+	slice       hash.Hash
+	sliceRemain int64      // 校验段还需要写入的长度
+	byteCounts  [256]int64 // 校验段中每个字节值出现的次数，用于计算信息熵
+	block       hash.Hash
+	blockRemain int64 // 当前分片还需要写入的长度
+	blockList   []string
+}
+
+func newHashWriter(chunkSize int64) *hashWriter {
+	return &hashWriter{
+		chunkSize:   chunkSize,
+		full:        md5.New(),
+		slice:       md5.New(),
+		sliceRemain: SliceSize,
+		block:       md5.New(),
+		blockRemain: chunkSize,
+	}
+}
+
+func (w *hashWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	w.full.Write(p)
+
+	if w.sliceRemain > 0 {
+		size := min64(w.sliceRemain, int64(len(p)))
+		w.slice.Write(p[:size])
+		for _, b := range p[:size] {
+			w.byteCounts[b]++
+		}
+		w.sliceRemain -= size
+	}
+
+	for len(p) > 0 {
+		size := min64(w.blockRemain, int64(len(p)))
+		w.block.Write(p[:size])
+		w.blockRemain -= size
+		p = p[size:]
+		if w.blockRemain == 0 { // 一个分片写满了
+			w.blockList = append(w.blockList, hex.EncodeToString(w.block.Sum(nil)))
+			w.block.Reset()
+			w.blockRemain = w.chunkSize
+		}
+	}
+	return n, nil
+}
+
+func (w *hashWriter) result() *FileHash {
+	// 最后一个不完整的分片，空文件也有一个空分片
+	if w.blockRemain != w.chunkSize || len(w.blockList) == 0 {
+		w.blockList = append(w.blockList, hex.EncodeToString(w.block.Sum(nil)))
+	}
+	return &FileHash{
+		Md5:       hex.EncodeToString(w.full.Sum(nil)),
+		SliceMd5:  hex.EncodeToString(w.slice.Sum(nil)),
+		BlockList: w.blockList,
+		ChunkSize: w.chunkSize,
+		Entropy:   entropy(&w.byteCounts, SliceSize-w.sliceRemain),
+	}
+}
+
+// entropy 按字节值的分布计算香农熵
+func entropy(counts *[256]int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	var res float64
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(total)
+		res -= p * math.Log2(p)
+	}
+	return res
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
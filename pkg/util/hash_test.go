@@ -0,0 +1,138 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestHashFile(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), SliceSize/16*2+3) // 超过校验段大小
+	tests := []struct {
+		name      string
+		content   []byte
+		chunkSize int64
+		wantBlock []string
+		wantSlice string
+	}{
+		{
+			name:      "empty",
+			content:   []byte{},
+			chunkSize: 4,
+			wantBlock: []string{md5Hex(nil)},
+			wantSlice: md5Hex(nil),
+		},
+		{
+			name:      "small",
+			content:   []byte("0123456789"),
+			chunkSize: 4,
+			wantBlock: []string{md5Hex([]byte("0123")), md5Hex([]byte("4567")), md5Hex([]byte("89"))},
+			wantSlice: md5Hex([]byte("0123456789")),
+		},
+		{
+			name:      "large",
+			content:   large,
+			chunkSize: SliceSize,
+			wantBlock: []string{md5Hex(large[:SliceSize]), md5Hex(large[SliceSize : 2*SliceSize]), md5Hex(large[2*SliceSize:])},
+			wantSlice: md5Hex(large[:SliceSize]),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "hash_file")
+			if err != nil {
+				t.Fatalf("create temp file error = %v", err)
+			}
+			defer os.Remove(file.Name())
+			file.Write(tt.content)
+			file.Close()
+
+			got, err := HashFile(context.Background(), file.Name(), tt.chunkSize)
+			if err != nil {
+				t.Fatalf("HashFile() error = %v", err)
+			}
+			if got.Md5 != md5Hex(tt.content) {
+				t.Errorf("HashFile() md5 = %s, want %s", got.Md5, md5Hex(tt.content))
+			}
+			if got.SliceMd5 != tt.wantSlice {
+				t.Errorf("HashFile() slice md5 = %s, want %s", got.SliceMd5, tt.wantSlice)
+			}
+			if !reflect.DeepEqual(got.BlockList, tt.wantBlock) {
+				t.Errorf("HashFile() block list = %v, want %v", got.BlockList, tt.wantBlock)
+			}
+			if got.Size != int64(len(tt.content)) || !got.Valid(file.Name(), tt.chunkSize) {
+				t.Errorf("HashFile() size = %d, valid = %v", got.Size, got.Valid(file.Name(), tt.chunkSize))
+			}
+			if got.Valid(file.Name(), tt.chunkSize*2) {
+				t.Errorf("Valid() with different chunk size = true, want false")
+			}
+		})
+	}
+}
+
+func TestHashSection(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	file, err := ioutil.TempFile("", "hash_section")
+	if err != nil {
+		t.Fatalf("create temp file error = %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Write(content)
+	file.Close()
+
+	tests := []struct {
+		name   string
+		offset int64
+		length int64
+		want   []byte
+	}{
+		{name: "whole file", offset: 0, length: 0, want: content},
+		{name: "head", offset: 0, length: 8, want: content[:8]},
+		{name: "tail", offset: 16, length: 4, want: content[16:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HashSection(context.Background(), file.Name(), tt.offset, tt.length, 4)
+			if err != nil {
+				t.Fatalf("HashSection() error = %v", err)
+			}
+			if got.Md5 != md5Hex(tt.want) || got.ContentSize() != int64(len(tt.want)) {
+				t.Errorf("HashSection() md5 = %s, size = %d, want %s, %d", got.Md5, got.ContentSize(), md5Hex(tt.want), len(tt.want))
+			}
+			// 文件没有变化时分段的结果也可以使用
+			if !got.Valid(file.Name(), 4) {
+				t.Errorf("Valid() = false, want true")
+			}
+		})
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	tests := []struct {
+		name    string
+		content []byte
+		want    float64
+	}{
+		{name: "empty", content: nil, want: 0},
+		{name: "same byte", content: bytes.Repeat([]byte("a"), 100), want: 0},
+		{name: "two values", content: []byte("abababab"), want: 1},
+		{name: "uniform", content: bytes.Repeat(all, 4), want: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newHashWriter(4)
+			w.Write(tt.content)
+			if got := w.result().Entropy; math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Entropy = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,61 +10,17 @@ import (
 
 	"github.com/pkg/errors"
 
-	"backup/consts"
 	"backup/pkg/byte_pool"
 	"backup/pkg/logger"
 )
 
-func GetBlockList(ctx context.Context, filename string) ([]string, error) {
-	baseLogger := logger.Logger.WithContext(ctx)
-	baseLogger.WithField("filename", filename).Info("generate block list start")
-
-	file, err := os.OpenFile(filename, os.O_RDONLY, 0644)
-	if err != nil {
-		return nil, errors.Wrap(err, "open file fail")
-	}
-	defer file.Close()
-
-	stat, err := file.Stat()
+// GetBlockList 按分片大小计算每个分片的md5，分片大小需要和上传时保持一致
+func GetBlockList(ctx context.Context, filename string, chunkSize int64) ([]string, error) {
+	hash, err := HashFile(ctx, filename, chunkSize)
 	if err != nil {
-		return nil, errors.Wrap(err, "get file stat fail")
-	}
-
-	number := (stat.Size() + consts.Size4MB - 1) / consts.Size4MB
-	if number == 0 {
-		block, err := Md5(ctx, nil)
-		if err != nil {
-			return nil, errors.Wrap(err, "md5 encode fail")
-		}
-		return []string{block}, nil
-	}
-
-	var result = make([]string, 0, number)
-
-	chunk := byte_pool.DefaultBytePool.Get()
-	for {
-		n, err := file.Read(chunk)
-		if err != nil && err != io.EOF {
-			baseLogger.WithError(err).WithField("filename", filename).Errorf("read file fail fail")
-			return nil, errors.Wrapf(err, "read file fail fail")
-		}
-		if n == 0 || err == io.EOF {
-			break
-		}
-
-		block, err := Md5(ctx, chunk[:n])
-		if err != nil {
-			baseLogger.WithError(err).Errorf("md5 encode fail")
-			return nil, err
-		}
-
-		result = append(result, block)
+		return nil, errors.Wrap(err, "hash file fail")
 	}
-
-	byte_pool.DefaultBytePool.Put(chunk)
-
-	baseLogger.WithField("filename", filename).WithField("result", result).Info("block list result")
-	return result, nil
+	return hash.BlockList, nil
 }
 
 func Md5(ctx context.Context, data []byte) (string, error) {
@@ -89,6 +45,7 @@ func GetFileMd5(ctx context.Context, filename string) (string, error) {
 	hash := md5.New()
 
 	chunk := byte_pool.DefaultBytePool.Get()
+	defer byte_pool.DefaultBytePool.Put(chunk)
 	for {
 		n, err := file.Read(chunk)
 		if err != nil && err != io.EOF {
@@ -102,7 +59,6 @@ func GetFileMd5(ctx context.Context, filename string) (string, error) {
 
 		hash.Write(chunk[:n])
 	}
-	byte_pool.DefaultBytePool.Put(chunk)
 
 	return strings.ToLower(hex.EncodeToString(hash.Sum(nil))), nil
 }
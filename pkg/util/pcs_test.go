@@ -1,8 +1,14 @@
 package util
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
 	"testing"
 )
 
@@ -10,3 +16,40 @@ func TestMd5(t *testing.T) {
 	md5, err := Md5(context.TODO(), []byte{})
 	fmt.Printf("%+v\n%+v", md5, err)
 }
+
+func TestGetBlockList(t *testing.T) {
+	file, err := ioutil.TempFile("", "block_list")
+	if err != nil {
+		t.Fatalf("create temp file error = %v", err)
+	}
+	defer os.Remove(file.Name())
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	file.Write(content)
+	file.Close()
+
+	tests := []struct {
+		name      string
+		chunkSize int64
+		want      []string
+	}{
+		{name: "oneChunk", chunkSize: int64(len(content)), want: []string{md5Hex(content)}},
+		{name: "exactChunks", chunkSize: 5000, want: []string{md5Hex(content[:5000]), md5Hex(content[5000:])}},
+		{name: "lastChunkSmaller", chunkSize: 4000, want: []string{md5Hex(content[:4000]), md5Hex(content[4000:8000]), md5Hex(content[8000:])}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetBlockList(context.Background(), file.Name(), tt.chunkSize)
+			if err != nil {
+				t.Fatalf("GetBlockList() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetBlockList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
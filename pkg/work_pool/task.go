@@ -17,6 +17,8 @@ type Task struct {
 	resultChan    chan interface{}
 
 	Run func(ctx context.Context, task *Task) error `json:"-"`
+	// Discard 任务不会再执行时调用（任务组已取消或者超过重试次数），用于释放任务占用的资源
+	Discard func(task *Task) `json:"-"`
 }
 
 func NewTask(g *TaskGroup, name string, maxRetryCount int) *Task {
@@ -56,11 +58,18 @@ func (t *Task) Output(result interface{}) {
 func (t *Task) Retry(p *WorkPool) error {
 	t.retryCount++
 	if t.retryCount > t.maxRetryCount {
+		t.discard()
 		return errors.Errorf("task %s exceed max retry times", t.Name)
 	}
 	return p.Submit(t)
 }
 
+func (t *Task) discard() {
+	if t.Discard != nil {
+		t.Discard(t)
+	}
+}
+
 // 任务组，每个任务都有一个任务组，控制该任务组下所有任务的执行，取消等等
 type TaskGroup struct {
 	ctx           context.Context
@@ -69,6 +78,7 @@ type TaskGroup struct {
 	doneTaskCount uint64
 	taskNumber    uint64
 	once          *sync.Once
+	closeOnce     *sync.Once // 保证errorChan只关闭一次
 
 	RunBefore  func(ctx context.Context, task *Task) bool
 	RunSuccess func(ctx context.Context, task *Task)
@@ -85,6 +95,7 @@ func NewTaskGroup(ctx context.Context, taskNumber int) *TaskGroup {
 		doneTaskCount: 0,
 		taskNumber:    uint64(taskNumber),
 		once:          &sync.Once{},
+		closeOnce:     &sync.Once{},
 	}
 	g.ctx, g.cancelFunc = context.WithCancel(ctx)
 
@@ -109,8 +120,17 @@ func (g *TaskGroup) Cancel() {
 
 func (g *TaskGroup) Fail(err error) {
 	g.once.Do(func() {
-		g.errorChan <- err
+		select {
+		case g.errorChan <- err:
+		case <-g.ctx.Done(): // 任务组已经取消，没有人等待结果了
+		}
 		g.Cancel()
+		g.closeErrorChan()
+	})
+}
+
+func (g *TaskGroup) closeErrorChan() {
+	g.closeOnce.Do(func() {
 		close(g.errorChan)
 	})
 }
@@ -121,7 +141,7 @@ func (g *TaskGroup) Chan() <-chan struct{} {
 
 func (g *TaskGroup) done() {
 	if newValue := atomic.AddUint64(&g.doneTaskCount, 1); newValue == g.taskNumber {
-		close(g.errorChan)
+		g.closeErrorChan()
 	}
 }
 
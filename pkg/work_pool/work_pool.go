@@ -122,6 +122,7 @@ func (p *WorkPool) executeTask(task *Task) {
 	}()
 
 	if !task.group.beforeRun(task) {
+		task.discard()
 		return
 	}
 
@@ -182,6 +183,16 @@ func (p *WorkPool) Cancel() {
 	}
 }
 
+// ActiveWorkers 正在执行任务的worker数量
+func (p *WorkPool) ActiveWorkers() int {
+	return int(atomic.LoadInt64(&p.currentSignalCount))
+}
+
+// QueueLength 暂存队列中等待执行的任务数量
+func (p *WorkPool) QueueLength() int {
+	return len(p.queue)
+}
+
 func (p *WorkPool) Context() context.Context {
 	return p.groupCtx
 }
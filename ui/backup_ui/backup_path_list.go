@@ -2,6 +2,7 @@ package backup_ui
 
 import (
 	"context"
+	"fmt"
 	"image/color"
 	"os"
 	"path/filepath"
@@ -9,27 +10,68 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"backup/consts"
 	"backup/internal/dao"
+	"backup/internal/guard"
 	"backup/internal/model"
 	"backup/internal/scanner"
 	"backup/pkg/database"
 	"backup/pkg/logger"
+	"backup/ui/upload_ui"
 	"backup/ui/util"
 )
 
 type BackupPathList struct {
 	widget.List
 
-	items []string
+	items []*model.BackupPath
 
 	window fyne.Window
 }
 
-func NewBackupPathList(item []string, window fyne.Window) *BackupPathList {
+// 优先级的展示名称
+var priorityOptions = []string{"低", "普通", "高", "最高"}
+
+var priorityValues = map[string]int{
+	"低":  consts.BackupPriorityLow,
+	"普通": consts.BackupPriorityNormal,
+	"高":  consts.BackupPriorityHigh,
+	"最高": consts.BackupPriorityVeryHigh,
+}
+
+// 压缩算法的展示名称
+var compressOptions = []string{"不压缩", "gzip压缩", "zstd压缩"}
+
+var compressValues = map[string]string{
+	"不压缩":    "",
+	"gzip压缩": consts.CompressGzip,
+	"zstd压缩": consts.CompressZstd,
+}
+
+func compressName(algorithm string) string {
+	for name, value := range compressValues {
+		if value == algorithm {
+			return name
+		}
+	}
+	return "不压缩"
+}
+
+func priorityName(priority int) string {
+	for name, value := range priorityValues {
+		if value == priority {
+			return name
+		}
+	}
+	return "普通"
+}
+
+func NewBackupPathList(item []*model.BackupPath, window fyne.Window) *BackupPathList {
 	list := &BackupPathList{
 		items:  item,
 		window: window,
@@ -66,12 +108,147 @@ func (l *BackupPathList) CreateItem() fyne.CanvasObject {
 		}
 	})
 
-	return container.New(layout.NewHBoxLayout(), text, layout.NewSpacer(), button)
+	prioritySelect := widget.NewSelect(priorityOptions, nil)
+	packCheck := widget.NewCheck("小文件打包", nil)
+	compressSelect := widget.NewSelect(compressOptions, nil)
+	mediaCheck := widget.NewCheck("媒体模式", nil)
+
+	suspendBtn := &widget.Button{Text: "已暂停", Icon: theme.WarningIcon(), Importance: widget.HighImportance}
+	suspendBtn.Hide()
+
+	return container.New(layout.NewHBoxLayout(), text, suspendBtn, layout.NewSpacer(), packCheck, compressSelect, mediaCheck, widget.NewLabel("优先级"), prioritySelect, button)
 }
 
 func (l *BackupPathList) UpdateItem(id widget.ListItemID, item fyne.CanvasObject) {
 	c := item.(*fyne.Container)
-	c.Objects[0].(*canvas.Text).Text = l.items[id]
+	path := l.items[id]
+	c.Objects[0].(*canvas.Text).Text = path.AbsPath
+
+	suspendBtn := c.Objects[1].(*widget.Button)
+	suspendBtn.Hide()
+	if path.Suspended {
+		suspendBtn.Show()
+		suspendBtn.OnTapped = func() {
+			l.ConfirmSuspend(path)
+		}
+	}
+
+	packCheck := c.Objects[3].(*widget.Check)
+	packCheck.OnChanged = nil // 防止设置初始值时触发更新
+	packCheck.SetChecked(path.Pack)
+	packCheck.OnChanged = func(checked bool) {
+		l.UpdatePack(path, checked, packCheck)
+	}
+
+	compressSelect := c.Objects[4].(*widget.Select)
+	compressSelect.OnChanged = nil // 防止设置初始值时触发更新
+	compressSelect.SetSelected(compressName(path.Compress))
+	compressSelect.OnChanged = func(s string) {
+		l.UpdateCompress(path, compressValues[s], compressSelect)
+	}
+
+	mediaCheck := c.Objects[5].(*widget.Check)
+	mediaCheck.OnChanged = nil // 防止设置初始值时触发更新
+	mediaCheck.SetChecked(path.Media)
+	mediaCheck.OnChanged = func(checked bool) {
+		l.UpdateMedia(path, checked, mediaCheck)
+	}
+
+	prioritySelect := c.Objects[7].(*widget.Select)
+	prioritySelect.OnChanged = nil // 防止设置初始值时触发更新
+	prioritySelect.SetSelected(priorityName(path.Priority))
+	prioritySelect.OnChanged = func(s string) {
+		l.UpdatePriority(path, priorityValues[s])
+	}
+}
+
+// UpdatePack 修改备份路径是否把小文件打包上传，下一次扫描时生效
+func (l *BackupPathList) UpdatePack(path *model.BackupPath, pack bool, check *widget.Check) {
+	if path.Pack == pack {
+		return
+	}
+	err := dao.NewBackupPathDao(context.Background(), database.DB).Update(map[string]interface{}{
+		"pack": pack,
+	}, path.AbsPath)
+	if err != nil {
+		util.ShowErrorDialog("修改打包设置失败", l.window)
+		check.OnChanged = nil // 恢复原来的选择
+		check.SetChecked(path.Pack)
+		check.OnChanged = func(checked bool) {
+			l.UpdatePack(path, checked, check)
+		}
+		return
+	}
+	path.Pack = pack
+}
+
+// UpdateCompress 修改备份路径上传前使用的压缩算法，为空时不压缩，下一次扫描时生效
+func (l *BackupPathList) UpdateCompress(path *model.BackupPath, algorithm string, sel *widget.Select) {
+	if path.Compress == algorithm {
+		return
+	}
+	err := dao.NewBackupPathDao(context.Background(), database.DB).Update(map[string]interface{}{
+		"compress": algorithm,
+	}, path.AbsPath)
+	if err != nil {
+		util.ShowErrorDialog("修改压缩设置失败", l.window)
+		sel.OnChanged = nil // 恢复原来的选择
+		sel.SetSelected(compressName(path.Compress))
+		sel.OnChanged = func(s string) {
+			l.UpdateCompress(path, compressValues[s], sel)
+		}
+		return
+	}
+	path.Compress = algorithm
+}
+
+// UpdateMedia 修改备份路径是否按媒体模式上传照片和视频，下一次扫描时生效
+func (l *BackupPathList) UpdateMedia(path *model.BackupPath, enable bool, check *widget.Check) {
+	if path.Media == enable {
+		return
+	}
+	err := dao.NewBackupPathDao(context.Background(), database.DB).Update(map[string]interface{}{
+		"media": enable,
+	}, path.AbsPath)
+	if err != nil {
+		util.ShowErrorDialog("修改媒体模式失败", l.window)
+		check.OnChanged = nil // 恢复原来的选择
+		check.SetChecked(path.Media)
+		check.OnChanged = func(checked bool) {
+			l.UpdateMedia(path, checked, check)
+		}
+		return
+	}
+	path.Media = enable
+}
+
+// UpdatePriority 修改备份路径的上传优先级，下一次扫描时生效
+func (l *BackupPathList) UpdatePriority(path *model.BackupPath, priority int) {
+	if path.Priority == priority {
+		return
+	}
+	err := dao.NewBackupPathDao(context.Background(), database.DB).Update(map[string]interface{}{
+		"priority": priority,
+	}, path.AbsPath)
+	if err != nil {
+		util.ShowErrorDialog("修改优先级失败", l.window)
+		return
+	}
+	path.Priority = priority
+}
+
+// ConfirmSuspend 疑似被勒索软件加密而暂停的备份路径，用户确认修改正常后继续上传
+func (l *BackupPathList) ConfirmSuspend(path *model.BackupPath) {
+	message := fmt.Sprintf("%s\n\n可能是勒索软件正在加密文件，这个备份路径的上传已经暂停，有%d个文件等待上传。\n确认这些修改是正常的吗？",
+		path.SuspendMsg, guard.HeldCount(path.AbsPath))
+	dialog.ShowConfirm("发现异常的文件修改", message, func(ok bool) {
+		if !ok {
+			return
+		}
+		upload_ui.ExportUploadList.ConfirmSuspend(context.Background(), path.AbsPath)
+		path.Suspended, path.SuspendMsg = false, ""
+		l.Refresh()
+	}, l.window)
 }
 
 func (l *BackupPathList) OnSelected(id widget.ListItemID) {
@@ -100,7 +277,9 @@ func (l *BackupPathList) AddItem(item string) (int64, error) {
 		return 0, err
 	}
 
-	l.items = append(l.items, item)
+	if affected > 0 {
+		l.items = append(l.items, path)
+	}
 
 	l.Refresh()
 	return affected, nil
@@ -112,6 +291,7 @@ func (l *BackupPathList) DeleteItem(nowItem string) error {
 	transaction := database.DB.Begin()
 	fileInfoDao := dao.NewFileInfoDao(context.Background(), transaction)
 	backupPathDao := dao.NewBackupPathDao(context.Background(), transaction)
+	uploadQueueDao := dao.NewUploadQueueDao(context.Background(), transaction)
 
 	err := backupPathDao.Delete(nowItem)
 	if err != nil {
@@ -124,11 +304,17 @@ func (l *BackupPathList) DeleteItem(nowItem string) error {
 		transaction.Rollback()
 		return err
 	}
+
+	err = uploadQueueDao.DeleteAllByPrefix(nowItem)
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
 	transaction.Commit()
 
-	newItems := make([]string, 0, len(l.items))
+	newItems := make([]*model.BackupPath, 0, len(l.items))
 	for _, item := range l.items {
-		if item == nowItem {
+		if item.AbsPath == nowItem {
 			continue
 		}
 		newItems = append(newItems, item)
@@ -145,11 +145,7 @@ func (c *BackupPathConfig) buildUI() *fyne.Container {
 	}
 
 	backupPathDao := dao.NewBackupPathDao(context.Background(), database.DB)
-	var items []string
-	for _, pathModel := range backupPathDao.GetAll() {
-		items = append(items, pathModel.AbsPath)
-	}
-	c.backupList = NewBackupPathList(items, c.window)
+	c.backupList = NewBackupPathList(backupPathDao.GetAll(), c.window)
 	content := container.NewBorder(c.addBackupPathButton, c.tipsButton, nil, nil, c.backupList)
 	return content
 }
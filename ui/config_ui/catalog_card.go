@@ -0,0 +1,111 @@
+package config_ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/internal/catalog"
+	"backup/internal/config"
+	"backup/pkg/crypt"
+	"backup/pkg/util"
+	ui_util "backup/ui/util"
+)
+
+// CatalogCard 备份和恢复本程序的数据库和配置
+type CatalogCard struct {
+	statusLabel *widget.Label
+	backupBtn   *widget.Button
+	restoreBtn  *widget.Button
+
+	window fyne.Window
+}
+
+func NewCatalogCard(window fyne.Window) *CatalogCard {
+	c := &CatalogCard{
+		window: window,
+	}
+	catalog.PromptPassword = c.promptPassword
+	return c
+}
+
+func (c *CatalogCard) buildCard() *widget.Card {
+	c.statusLabel = widget.NewLabel("")
+	c.backupBtn = widget.NewButton("立即备份", c.Backup)
+	c.restoreBtn = widget.NewButton("从网盘恢复", c.Restore)
+	c.refreshStatus()
+
+	return &widget.Card{
+		Title:    "目录备份",
+		Subtitle: fmt.Sprintf("数据库和配置文件备份到网盘的%s目录，换电脑后可以从网盘恢复", consts.CatalogDir),
+		Content:  container.NewHBox(c.statusLabel, layout.NewSpacer(), c.backupBtn, c.restoreBtn),
+	}
+}
+
+func (c *CatalogCard) refreshStatus() {
+	lastTime, err := catalog.Status()
+	switch {
+	case err != nil:
+		c.statusLabel.SetText("最近一次备份失败")
+	case lastTime.IsZero():
+		c.statusLabel.SetText("本次启动后还没有备份")
+	default:
+		c.statusLabel.SetText("最近一次备份：" + lastTime.Format(consts.TimeFormatSecond))
+	}
+}
+
+// Backup 立即备份
+func (c *CatalogCard) Backup() {
+	c.backupBtn.Disable()
+	c.statusLabel.SetText("正在备份...")
+	go func() {
+		defer c.backupBtn.Enable()
+		err := catalog.Backup(util.NewContext())
+		c.refreshStatus()
+		if err != nil {
+			ui_util.ShowErrorDialog("目录备份失败", c.window)
+		}
+	}()
+}
+
+// promptPassword 开启了加密的目录备份需要密码，等待用户输入，在后台备份时调用
+func (c *CatalogCard) promptPassword() (string, bool) {
+	passwordEntry := widget.NewPasswordEntry()
+	items := []*widget.FormItem{widget.NewFormItem("备份密码", passwordEntry)}
+	result := make(chan bool, 1)
+	dialog.ShowForm("目录备份需要加密密码，密码只保存在内存中", "备份", "跳过", items, func(confirm bool) {
+		result <- confirm
+	}, c.window)
+	confirm := <-result
+	return passwordEntry.Text, confirm
+}
+
+// Restore 从网盘恢复，会覆盖本地的数据库和配置，完成后退出程序
+func (c *CatalogCard) Restore() {
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetText(config.GetCatalogPassword())
+	items := []*widget.FormItem{widget.NewFormItem("备份密码", passwordEntry)}
+	dialog.ShowForm("从网盘恢复会覆盖本地的数据库和配置", "恢复", "取消", items, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		err := catalog.Restore(util.NewContext(), passwordEntry.Text)
+		switch {
+		case errors.Is(err, catalog.ErrPasswordRequired), errors.Is(err, crypt.ErrWrongPassword):
+			ui_util.ShowErrorDialog("备份密码错误", c.window)
+			return
+		case err != nil:
+			ui_util.ShowErrorDialog("从网盘恢复失败", c.window)
+			return
+		}
+		info := dialog.NewInformation("恢复成功", "数据库已经替换，请重新启动程序", c.window)
+		info.SetOnClosed(fyne.CurrentApp().Quit)
+		info.Show()
+	}, c.window)
+}
@@ -11,5 +11,9 @@ func NewConfigTabItem(window fyne.Window) *container.TabItem {
 		container.NewVScroll(container.NewVBox(
 			NewPcsConfigCard(window).buildCard(),
 			NewUploadConfigCard(window).buildCard(),
+			NewQuotaCard(window).buildCard(),
+			NewNotificationCard(window).buildCard(),
+			NewCatalogCard(window).buildCard(),
+			NewLogCard(window).buildCard(),
 		)))
 }
@@ -0,0 +1,84 @@
+package config_ui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	"backup/consts"
+	"backup/internal/config"
+	"backup/pkg/logger"
+	ui_util "backup/ui/util"
+)
+
+// 日志级别的展示名称
+var logLevelOptions = []string{"调试", "信息", "警告", "错误"}
+
+var logLevelValues = map[string]string{
+	"调试": consts.LevelDebug,
+	"信息": consts.LevelInfo,
+	"警告": consts.LevelWarn,
+	"错误": consts.LevelError,
+}
+
+// LogCard 修改日志级别，保存后立即生效
+type LogCard struct {
+	levelSelect *widget.Select
+	saveBtn     *widget.Button
+
+	window fyne.Window
+}
+
+func NewLogCard(window fyne.Window) *LogCard {
+	return &LogCard{
+		window: window,
+	}
+}
+
+func (c *LogCard) buildCard() *widget.Card {
+	c.levelSelect = widget.NewSelect(logLevelOptions, nil)
+	for name, value := range logLevelValues {
+		if value == logger.GetLevel() {
+			c.levelSelect.SetSelected(name)
+		}
+	}
+	c.saveBtn = &widget.Button{
+		Text:       "保存",
+		Importance: widget.HighImportance,
+		OnTapped:   c.SaveConfig,
+	}
+
+	return &widget.Card{
+		Title:    "日志",
+		Subtitle: fmt.Sprintf("日志保存在%s目录，格式可以通过环境变量%s_LOG_FORMAT=json修改", config.Config.LogConfig.Path, strings.ToUpper(consts.EnvPrefix)),
+		Content: container.NewVBox(container.NewGridWithColumns(2,
+			widget.NewLabel("日志级别"),
+			c.levelSelect,
+		), container.NewHBox(layout.NewSpacer(), c.saveBtn)),
+	}
+}
+
+func (c *LogCard) SaveConfig() {
+	level, ok := logLevelValues[c.levelSelect.Selected]
+	if !ok {
+		ui_util.ShowErrorDialog("请选择日志级别", c.window)
+		return
+	}
+
+	// 在原有配置的基础上修改，防止覆盖其他配置项
+	settings := config.UploadConfigViper.AllSettings()
+	settings[consts.LogLevelKey] = level
+	if err := writeUploadConfig(settings); err != nil {
+		ui_util.ShowErrorDialog("保存配置失败", c.window)
+		return
+	}
+	if err := logger.SetLevel(level); err != nil {
+		ui_util.ShowErrorDialog("修改日志级别失败", c.window)
+		return
+	}
+	ui_util.ShowInfoDialog("保存配置成功", c.window)
+}
@@ -0,0 +1,255 @@
+package config_ui
+
+import (
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	"backup/consts"
+	"backup/internal/config"
+	"backup/internal/notification"
+	"backup/pkg/util"
+	ui_util "backup/ui/util"
+)
+
+// 通知事件的展示名称，不选择时发送所有事件
+var eventOptions = []string{"备份完成", "备份失败", "多次上传失败", "授权失效", "空间已满", "空间不足", "疑似勒索软件", "长时间未备份"}
+
+var eventValues = map[string]string{
+	"备份完成":   consts.EventRunFinish,
+	"备份失败":   consts.EventRunFail,
+	"多次上传失败": consts.EventUploadFail,
+	"授权失效":   consts.EventTokenExpire,
+	"空间已满":   consts.EventQuotaFull,
+	"空间不足":   consts.EventQuotaLow,
+	"疑似勒索软件": consts.EventSuspend,
+	"长时间未备份": consts.EventNoBackup,
+}
+
+// 群机器人类型的展示名称
+var botTypeOptions = []string{"钉钉", "企业微信"}
+
+var botTypeValues = map[string]string{
+	"钉钉":   consts.BotTypeDingTalk,
+	"企业微信": consts.BotTypeWeCom,
+}
+
+// NotificationCard 配置webhook、群机器人和邮件通知
+type NotificationCard struct {
+	staleEntry *widget.Entry
+
+	webhookEntry  *widget.Entry
+	webhookEvents *widget.CheckGroup
+
+	botTypeSelect *widget.Select
+	botUrlEntry   *widget.Entry
+	botSecret     *widget.Entry
+	botEvents     *widget.CheckGroup
+
+	smtpHostEntry *widget.Entry
+	smtpPortEntry *widget.Entry
+	smtpUserEntry *widget.Entry
+	smtpPassword  *widget.Entry
+	smtpFromEntry *widget.Entry
+	smtpToEntry   *widget.Entry
+	emailEvents   *widget.CheckGroup
+	saveBtn       *widget.Button
+
+	window fyne.Window
+}
+
+func NewNotificationCard(window fyne.Window) *NotificationCard {
+	return &NotificationCard{
+		window: window,
+	}
+}
+
+func (c *NotificationCard) buildCard() *widget.Card {
+	cfg := config.GetNotificationConfig()
+	c.staleEntry = widget.NewEntry()
+	c.staleEntry.SetText(strconv.Itoa(cfg.StaleDays))
+
+	c.webhookEntry = widget.NewEntry()
+	c.webhookEntry.SetPlaceHolder("以JSON格式POST事件的地址")
+	c.webhookEntry.SetText(cfg.Webhook.Url)
+	c.webhookEvents = newEventGroup(cfg.Webhook.Events)
+
+	c.botTypeSelect = widget.NewSelect(botTypeOptions, nil)
+	c.botTypeSelect.SetSelected(botTypeOptions[0])
+	for name, value := range botTypeValues {
+		if value == cfg.Bot.Type {
+			c.botTypeSelect.SetSelected(name)
+		}
+	}
+	c.botUrlEntry = widget.NewEntry()
+	c.botUrlEntry.SetPlaceHolder("机器人的webhook地址")
+	c.botUrlEntry.SetText(cfg.Bot.Url)
+	c.botSecret = widget.NewPasswordEntry()
+	c.botSecret.SetPlaceHolder("钉钉机器人开启加签时填写")
+	c.botSecret.SetText(cfg.Bot.Secret)
+	c.botEvents = newEventGroup(cfg.Bot.Events)
+
+	c.smtpHostEntry = widget.NewEntry()
+	c.smtpHostEntry.SetText(cfg.Email.Host)
+	c.smtpPortEntry = widget.NewEntry()
+	if cfg.Email.Port > 0 {
+		c.smtpPortEntry.SetText(strconv.Itoa(cfg.Email.Port))
+	}
+	c.smtpUserEntry = widget.NewEntry()
+	c.smtpUserEntry.SetText(cfg.Email.Username)
+	c.smtpPassword = widget.NewPasswordEntry()
+	c.smtpPassword.SetText(cfg.Email.Password)
+	c.smtpFromEntry = widget.NewEntry()
+	c.smtpFromEntry.SetPlaceHolder("为空时使用用户名")
+	c.smtpFromEntry.SetText(cfg.Email.From)
+	c.smtpToEntry = widget.NewEntry()
+	c.smtpToEntry.SetPlaceHolder("多个地址用逗号分隔")
+	c.smtpToEntry.SetText(strings.Join(cfg.Email.To, ","))
+	c.emailEvents = newEventGroup(cfg.Email.Events)
+
+	c.saveBtn = &widget.Button{
+		Text:       "保存",
+		Importance: widget.HighImportance,
+		OnTapped:   c.SaveConfig,
+	}
+
+	return &widget.Card{
+		Title:    "通知",
+		Subtitle: "备份出现问题时通过webhook、群机器人或者邮件提醒，不选择事件时发送所有事件",
+		Content: container.NewVBox(
+			container.NewGridWithColumns(2,
+				widget.NewLabel("超过多少天没有成功备份时提醒(0表示不提醒)"), c.staleEntry,
+				newBoldLabel("Webhook"), layout.NewSpacer(),
+				widget.NewLabel("地址"), c.webhookEntry,
+			),
+			c.webhookEvents,
+			container.NewGridWithColumns(2,
+				newBoldLabel("群机器人"), c.botTypeSelect,
+				widget.NewLabel("地址"), c.botUrlEntry,
+				widget.NewLabel("加签密钥"), c.botSecret,
+			),
+			c.botEvents,
+			container.NewGridWithColumns(2,
+				newBoldLabel("邮件"), layout.NewSpacer(),
+				widget.NewLabel("SMTP服务器"), c.smtpHostEntry,
+				widget.NewLabel("端口"), c.smtpPortEntry,
+				widget.NewLabel("用户名"), c.smtpUserEntry,
+				widget.NewLabel("密码"), c.smtpPassword,
+				widget.NewLabel("发件人"), c.smtpFromEntry,
+				widget.NewLabel("收件人"), c.smtpToEntry,
+			),
+			c.emailEvents,
+			container.NewHBox(layout.NewSpacer(), c.saveBtn),
+		),
+	}
+}
+
+func (c *NotificationCard) SaveConfig() {
+	staleDays, err := strconv.Atoi(c.staleEntry.Text)
+	if err != nil || staleDays < 0 {
+		ui_util.ShowErrorDialog("提醒天数必须是非负整数", c.window)
+		return
+	}
+	var port int
+	if c.smtpPortEntry.Text != "" {
+		port, err = strconv.Atoi(c.smtpPortEntry.Text)
+		if err != nil || port <= 0 || port > 65535 {
+			ui_util.ShowErrorDialog("SMTP端口必须在1到65535之间", c.window)
+			return
+		}
+	}
+	if c.smtpHostEntry.Text != "" && port == 0 {
+		ui_util.ShowErrorDialog("请填写SMTP端口", c.window)
+		return
+	}
+	var to []string
+	for _, address := range strings.Split(c.smtpToEntry.Text, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			to = append(to, address)
+		}
+	}
+
+	cfg := config.NotificationConfig{
+		StaleDays: staleDays,
+		Webhook: config.WebhookConfig{
+			Url:    strings.TrimSpace(c.webhookEntry.Text),
+			Events: selectedEvents(c.webhookEvents),
+		},
+		Bot: config.BotConfig{
+			Type:   botTypeValues[c.botTypeSelect.Selected],
+			Url:    strings.TrimSpace(c.botUrlEntry.Text),
+			Secret: c.botSecret.Text,
+			Events: selectedEvents(c.botEvents),
+		},
+		Email: config.EmailConfig{
+			Host:     strings.TrimSpace(c.smtpHostEntry.Text),
+			Port:     port,
+			Username: c.smtpUserEntry.Text,
+			Password: c.smtpPassword.Text,
+			From:     strings.TrimSpace(c.smtpFromEntry.Text),
+			To:       to,
+			Events:   selectedEvents(c.emailEvents),
+		},
+	}
+
+	// 在原有配置的基础上修改，防止覆盖其他配置项
+	settings := config.UploadConfigViper.AllSettings()
+	settings[consts.NotificationKey] = map[string]interface{}{
+		"stale_days": cfg.StaleDays,
+		"webhook": map[string]interface{}{
+			"url":    cfg.Webhook.Url,
+			"events": cfg.Webhook.Events,
+		},
+		"bot": map[string]interface{}{
+			"type":   cfg.Bot.Type,
+			"url":    cfg.Bot.Url,
+			"secret": cfg.Bot.Secret,
+			"events": cfg.Bot.Events,
+		},
+		"email": map[string]interface{}{
+			"host":     cfg.Email.Host,
+			"port":     cfg.Email.Port,
+			"username": cfg.Email.Username,
+			"password": cfg.Email.Password,
+			"from":     cfg.Email.From,
+			"to":       cfg.Email.To,
+			"events":   cfg.Email.Events,
+		},
+	}
+	if err := writeUploadConfig(settings); err != nil {
+		ui_util.ShowErrorDialog("保存配置失败", c.window)
+		return
+	}
+	// 配置文件的变化是异步加载的，直接使用界面中的配置
+	notification.Apply(util.NewContext(), cfg)
+	ui_util.ShowInfoDialog("保存配置成功", c.window)
+}
+
+// newEventGroup 选择发送哪些事件
+func newEventGroup(events []string) *widget.CheckGroup {
+	group := widget.NewCheckGroup(eventOptions, nil)
+	group.Horizontal = true
+	var selected []string
+	for _, name := range eventOptions {
+		for _, event := range events {
+			if eventValues[name] == event {
+				selected = append(selected, name)
+			}
+		}
+	}
+	group.SetSelected(selected)
+	return group
+}
+
+// selectedEvents 选择的事件类型
+func selectedEvents(group *widget.CheckGroup) []string {
+	events := make([]string, 0, len(group.Selected))
+	for _, name := range group.Selected {
+		events = append(events, eventValues[name])
+	}
+	return events
+}
@@ -0,0 +1,63 @@
+package config_ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	"backup/pkg/logger"
+	"backup/pkg/pcs_client"
+	"backup/pkg/util"
+	ui_util "backup/ui/util"
+)
+
+// QuotaCard 展示百度网盘的空间使用情况
+type QuotaCard struct {
+	usageBar   *widget.ProgressBar
+	usageLabel *widget.Label
+	refreshBtn *widget.Button
+
+	window fyne.Window
+}
+
+func NewQuotaCard(window fyne.Window) *QuotaCard {
+	return &QuotaCard{
+		window: window,
+	}
+}
+
+func (c *QuotaCard) buildCard() *widget.Card {
+	c.usageBar = widget.NewProgressBar()
+	c.usageLabel = widget.NewLabel("点击刷新获取网盘容量")
+	c.refreshBtn = widget.NewButton("刷新", c.Refresh)
+
+	return &widget.Card{
+		Title: "网盘空间",
+		Content: container.NewVBox(
+			c.usageBar,
+			container.NewHBox(c.usageLabel, layout.NewSpacer(), c.refreshBtn),
+		),
+	}
+}
+
+// Refresh 重新获取网盘容量
+func (c *QuotaCard) Refresh() {
+	ctx := util.NewContext()
+	quota, err := pcs_client.RefreshQuota(ctx)
+	if err != nil {
+		logger.Logger.WithContext(ctx).WithError(err).Error("refresh quota fail")
+		ui_util.ShowErrorDialog("获取网盘容量失败，请检查access_token是否有效", c.window)
+		return
+	}
+	if quota.Total > 0 {
+		c.usageBar.SetValue(float64(quota.Used) / float64(quota.Total))
+	}
+	text := fmt.Sprintf("已使用 %s / 总共 %s，剩余 %s", ui_util.FormatSize(quota.Used), ui_util.FormatSize(quota.Total), ui_util.FormatSize(quota.Remain()))
+	if quota.Expire {
+		text += "，7天内有容量到期"
+	}
+	c.usageLabel.SetText(text)
+}
@@ -18,10 +18,42 @@ import (
 	ui_util "backup/ui/util"
 )
 
+// 排序策略的展示名称
+var uploadOrderOptions = []string{"先进先出", "小文件优先", "最新修改优先"}
+
+var uploadOrderValues = map[string]string{
+	"先进先出":   consts.UploadOrderFIFO,
+	"小文件优先":  consts.UploadOrderSmallest,
+	"最新修改优先": consts.UploadOrderNewest,
+}
+
+// 分片大小的展示名称
+var chunkSizeOptions = []string{"根据会员等级自动选择", "4MB", "16MB", "32MB"}
+
+var chunkSizeValues = map[string]string{
+	"根据会员等级自动选择": consts.ChunkSizeAuto,
+	"4MB":        "4",
+	"16MB":       "16",
+	"32MB":       "32",
+}
+
 type UploadConfigCard struct {
 	slider      *widget.Slider
 	sliderLabel *widget.Label
 
+	orderSelect     *widget.Select
+	interleaveCheck *widget.Check
+	thresholdEntry  *widget.Entry
+	hashBufferEntry *widget.Entry
+	quietEntry      *widget.Entry
+	lowWaterEntry   *widget.Entry
+	packEntry       *widget.Entry
+	catalogEntry    *widget.Entry
+	encryptCheck    *widget.Check
+	passwordEntry   *widget.Entry
+	guardEntry      *widget.Entry
+	chunkSizeSelect *widget.Select
+
 	saveBtn *widget.Button
 
 	window fyne.Window
@@ -47,6 +79,54 @@ func (c *UploadConfigCard) buildCard() *widget.Card {
 	}
 
 	c.sliderLabel = widget.NewLabel(strconv.Itoa(uploadCount))
+
+	c.orderSelect = widget.NewSelect(uploadOrderOptions, nil)
+	order := config.GetUploadOrder()
+	for name, value := range uploadOrderValues {
+		if value == order {
+			c.orderSelect.SetSelected(name)
+		}
+	}
+	c.interleaveCheck = widget.NewCheck("交替上传大文件和小文件", nil)
+	c.interleaveCheck.SetChecked(config.GetUploadInterleave())
+	c.thresholdEntry = widget.NewEntry()
+	c.thresholdEntry.SetText(strconv.FormatInt(config.GetLargeFileThreshold()/1024/1024, 10))
+	c.chunkSizeSelect = widget.NewSelect(chunkSizeOptions, nil)
+	c.chunkSizeSelect.SetSelected(chunkSizeOptions[0])
+	for name, value := range chunkSizeValues {
+		if value == config.UploadConfigViper.GetString(consts.ChunkSizeKey) {
+			c.chunkSizeSelect.SetSelected(name)
+		}
+	}
+	c.hashBufferEntry = widget.NewEntry()
+	c.hashBufferEntry.SetText(strconv.Itoa(config.GetHashBufferCount()))
+	c.quietEntry = widget.NewEntry()
+	c.quietEntry.SetText(strconv.Itoa(int(config.GetQuietPeriod().Seconds())))
+	c.lowWaterEntry = widget.NewEntry()
+	c.lowWaterEntry.SetText(strconv.FormatInt(config.GetQuotaLowWater()/1024/1024/1024, 10))
+	c.packEntry = widget.NewEntry()
+	c.packEntry.SetText(strconv.FormatInt(config.GetPackThreshold()/1024, 10))
+	c.catalogEntry = widget.NewEntry()
+	c.catalogEntry.SetText(strconv.Itoa(int(config.GetCatalogInterval().Hours())))
+	c.passwordEntry = widget.NewPasswordEntry()
+	c.passwordEntry.SetPlaceHolder("只保存在内存中，重启后第一次备份时输入")
+	c.passwordEntry.SetText(config.GetCatalogPassword())
+	c.encryptCheck = widget.NewCheck("加密目录备份", func(checked bool) {
+		if checked {
+			c.passwordEntry.Enable()
+		} else {
+			c.passwordEntry.Disable()
+		}
+	})
+	c.encryptCheck.SetChecked(config.GetCatalogEncrypt())
+	if !c.encryptCheck.Checked {
+		c.passwordEntry.Disable()
+	}
+	catalogTip := widget.NewLabel("不加密时token.json(包括refresh token)会明文上传到网盘")
+	catalogTip.Wrapping = fyne.TextWrapWord
+	c.guardEntry = widget.NewEntry()
+	c.guardEntry.SetText(strconv.Itoa(config.GetGuardChangeRatio()))
+
 	c.saveBtn = &widget.Button{
 		Text:       "保存",
 		Importance: widget.HighImportance,
@@ -58,49 +138,139 @@ func (c *UploadConfigCard) buildCard() *widget.Card {
 		Content: container.NewVBox(container.NewGridWithColumns(2,
 			widget.NewLabel("同时上传文件数"),
 			container.NewBorder(nil, nil, nil, c.sliderLabel, c.slider),
+			widget.NewLabel("上传顺序"),
+			c.orderSelect,
+			widget.NewLabel("大文件阈值(MB)"),
+			c.thresholdEntry,
+			widget.NewLabel("分片大小"),
+			c.chunkSizeSelect,
+			widget.NewLabel("计算md5的缓冲区数量(每个4MB，重启生效)"),
+			c.hashBufferEntry,
+			widget.NewLabel("文件停止修改多久后上传(秒)"),
+			c.quietEntry,
+			widget.NewLabel("网盘剩余空间提醒阈值(GB，0表示不提醒)"),
+			c.lowWaterEntry,
+			widget.NewLabel("小文件打包阈值(KB，在备份路径中开启)"),
+			c.packEntry,
+			widget.NewLabel("目录备份间隔(小时，0表示不备份)"),
+			c.catalogEntry,
+			c.encryptCheck,
+			c.passwordEntry,
+			layout.NewSpacer(),
+			catalogTip,
+			widget.NewLabel("一次修改超过多少比例的文件时暂停上传(%，0表示不检查)"),
+			c.guardEntry,
+			layout.NewSpacer(),
+			c.interleaveCheck,
 		), container.NewHBox(layout.NewSpacer(), c.saveBtn)),
 	}
 }
 
 func (c *UploadConfigCard) SaveConfig() {
-	value := int(c.slider.Value)
+	threshold, err := strconv.ParseInt(c.thresholdEntry.Text, 10, 64)
+	if err != nil || threshold <= 0 {
+		ui_util.ShowErrorDialog("大文件阈值必须是正整数", c.window)
+		return
+	}
+
+	hashBufferCount, err := strconv.Atoi(c.hashBufferEntry.Text)
+	if err != nil || hashBufferCount <= 0 || hashBufferCount > consts.MaxHashBufferCount {
+		ui_util.ShowErrorDialog(fmt.Sprintf("计算md5的缓冲区数量必须在1到%d之间", consts.MaxHashBufferCount), c.window)
+		return
+	}
+
+	quietPeriod, err := strconv.Atoi(c.quietEntry.Text)
+	if err != nil || quietPeriod < 0 {
+		ui_util.ShowErrorDialog("等待时间必须是非负整数", c.window)
+		return
+	}
+
+	lowWater, err := strconv.ParseInt(c.lowWaterEntry.Text, 10, 64)
+	if err != nil || lowWater < 0 {
+		ui_util.ShowErrorDialog("剩余空间提醒阈值必须是非负整数", c.window)
+		return
+	}
+
+	packThreshold, err := strconv.ParseInt(c.packEntry.Text, 10, 64)
+	if err != nil || packThreshold <= 0 {
+		ui_util.ShowErrorDialog("小文件打包阈值必须是正整数", c.window)
+		return
+	}
+
+	catalogInterval, err := strconv.Atoi(c.catalogEntry.Text)
+	if err != nil || catalogInterval < 0 {
+		ui_util.ShowErrorDialog("目录备份间隔必须是非负整数", c.window)
+		return
+	}
+
+	if c.encryptCheck.Checked && c.passwordEntry.Text == "" {
+		ui_util.ShowErrorDialog("请填写目录备份密码", c.window)
+		return
+	}
+
+	guardRatio, err := strconv.Atoi(c.guardEntry.Text)
+	if err != nil || guardRatio < 0 || guardRatio > 100 {
+		ui_util.ShowErrorDialog("暂停上传的比例必须在0到100之间", c.window)
+		return
+	}
+
+	// 在原有配置的基础上修改，防止覆盖其他配置项
+	settings := config.UploadConfigViper.AllSettings()
+	settings[consts.UploadCountKey] = int(c.slider.Value)
+	settings[consts.UploadOrderKey] = uploadOrderValues[c.orderSelect.Selected]
+	settings[consts.UploadInterleaveKey] = c.interleaveCheck.Checked
+	settings[consts.LargeFileThresholdKey] = threshold
+	settings[consts.HashBufferCountKey] = hashBufferCount
+	settings[consts.QuietPeriodKey] = quietPeriod
+	settings[consts.QuotaLowWaterKey] = lowWater
+	settings[consts.PackThresholdKey] = packThreshold
+	settings[consts.CatalogIntervalKey] = catalogInterval
+	settings[consts.CatalogEncryptKey] = c.encryptCheck.Checked
+	delete(settings, consts.CatalogPasswordKey) // 密码不写入配置文件，删除以前版本保存的密码
+	settings[consts.GuardChangeRatioKey] = guardRatio
+	settings[consts.ChunkSizeKey] = chunkSizeValues[c.chunkSizeSelect.Selected]
+
+	if err := writeUploadConfig(settings); err != nil {
+		ui_util.ShowErrorDialog("保存配置失败", c.window)
+		return
+	}
+	if c.encryptCheck.Checked {
+		config.SetCatalogPassword(c.passwordEntry.Text)
+	} else {
+		config.SetCatalogPassword("")
+	}
+	ui_util.ShowInfoDialog("保存配置成功", c.window)
+	upload_ui.ExportUploadList.AddSignal()
+}
+
+// writeUploadConfig 把配置写入上传配置文件，调用方在原有配置的基础上修改，防止覆盖其他配置项
+func writeUploadConfig(settings map[string]interface{}) error {
 	file, err := os.OpenFile(config.UploadConfigPath, os.O_WRONLY|os.O_CREATE, 0644)
 	if err != nil {
 		logger.Logger.WithField("path", config.UploadConfigPath).WithError(err).Error("open file fail")
-		ui_util.ShowErrorDialog("保存配置失败", c.window)
-		return
+		return err
 	}
 	defer file.Close()
 
 	err = file.Truncate(0)
 	if err != nil {
 		logger.Logger.WithField("path", config.UploadConfigPath).WithError(err).Error("truncate file fail")
-		ui_util.ShowErrorDialog("保存配置失败", c.window)
-		return
+		return err
 	}
 
-	data, err := yaml.Marshal(map[string]int{
-		consts.UploadCountKey: value,
-	})
+	data, err := yaml.Marshal(settings)
 	if err != nil {
-		logger.Logger.WithField("path", config.UploadConfigPath).WithField("config", map[string]int{
-			consts.UploadCountKey: value,
-		}).WithError(err).Error("marshal data fail")
-		ui_util.ShowErrorDialog("保存配置失败", c.window)
-		return
+		logger.Logger.WithField("path", config.UploadConfigPath).WithField("config", settings).WithError(err).Error("marshal data fail")
+		return err
 	}
 
 	_, err = file.Write(data)
 	if err != nil {
-		logger.Logger.WithField("path", config.UploadConfigPath).WithField("config", map[string]int{
-			consts.UploadCountKey: value,
-		}).WithError(err).Error("write file fail")
-		ui_util.ShowErrorDialog("保存配置失败", c.window)
-		return
+		logger.Logger.WithField("path", config.UploadConfigPath).WithField("config", settings).WithError(err).Error("write file fail")
+		return err
 	}
-	ui_util.ShowInfoDialog("保存配置成功", c.window)
-	upload_ui.ExportUploadList.AddSignal()
 
 	// 有可能文件不存在，这里补充配置
 	config.UploadConfigViper.SetConfigFile(config.UploadConfigPath)
+	return nil
 }
@@ -0,0 +1,151 @@
+package dashboard_ui
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/pkg/database"
+	"backup/pkg/util"
+	ui_util "backup/ui/util"
+)
+
+const recentRunLimit = 30 // 图表中展示的运行次数
+
+func NewDashboardTabItem(window fyne.Window) *container.TabItem {
+	return container.NewTabItemWithIcon("统计", theme.InfoIcon(), NewDashboard(window).buildUI())
+}
+
+// Dashboard 备份运行统计面板
+type Dashboard struct {
+	lastSuccessLabel *widget.Label
+	lastRunLabel     *widget.Label
+	savingsLabel     *widget.Label
+	chart            *RunChart
+	summaryList      *widget.List
+
+	summaries []*model.BackupRunSummary
+
+	window fyne.Window
+}
+
+func NewDashboard(window fyne.Window) *Dashboard {
+	return &Dashboard{
+		window: window,
+	}
+}
+
+func (d *Dashboard) buildUI() fyne.CanvasObject {
+	d.lastSuccessLabel = &widget.Label{TextStyle: fyne.TextStyle{Bold: true}}
+	d.lastRunLabel = widget.NewLabel("")
+	d.savingsLabel = widget.NewLabel("")
+	d.chart = NewRunChart()
+	d.summaryList = &widget.List{
+		Length: func() int {
+			return len(d.summaries)
+		},
+		CreateItem: func() fyne.CanvasObject {
+			return container.NewHBox(widget.NewLabel(""), layout.NewSpacer(), widget.NewLabel(""))
+		},
+		UpdateItem: func(id widget.ListItemID, object fyne.CanvasObject) {
+			c := object.(*fyne.Container)
+			summary := d.summaries[id]
+			c.Objects[0].(*widget.Label).SetText(summary.BackupPath)
+			c.Objects[2].(*widget.Label).SetText(fmt.Sprintf("运行%d次  上传%d个  失败%d个  秒传%d个  去重%d个  共%s  节省%s  最近成功：%s",
+				summary.RunCount, summary.UploadedCount, summary.FailedCount, summary.RapidUploadCount, summary.DedupCount,
+				ui_util.FormatSize(summary.UploadBytes), ui_util.FormatSize(summary.SavedBytes), formatTime(summary.LastSuccessTime)))
+		},
+	}
+	d.summaryList.ExtendBaseWidget(d.summaryList)
+
+	refreshBtn := &widget.Button{Text: "刷新", Icon: theme.ViewRefreshIcon(), OnTapped: d.Refresh}
+	top := container.NewVBox(
+		container.NewHBox(d.lastSuccessLabel, layout.NewSpacer(), refreshBtn),
+		d.lastRunLabel,
+		d.savingsLabel,
+		&widget.Card{Title: "最近运行", Subtitle: "上传文件数（绿色成功，橙色部分失败，红色失败，蓝色运行中）", Content: d.chart},
+		widget.NewLabelWithStyle("备份路径汇总", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+	)
+
+	d.Refresh()
+	go d.refresh()
+	return container.NewBorder(top, nil, nil, nil, d.summaryList)
+}
+
+// Refresh 从数据库重新加载统计数据
+func (d *Dashboard) Refresh() {
+	runDao := dao.NewBackupRunDao(util.NewContext(), database.DB)
+
+	lastSuccess, err := runDao.QueryLastSuccess()
+	if err != nil || lastSuccess == nil {
+		d.lastSuccessLabel.SetText("最近一次成功备份：暂无")
+	} else {
+		d.lastSuccessLabel.SetText(fmt.Sprintf("最近一次成功备份：%s（%s）", formatTime(lastSuccess.EndTime), lastSuccess.BackupPath))
+	}
+
+	recent := runDao.QueryRecent(recentRunLimit)
+	if len(recent) > 0 {
+		last := recent[0]
+		d.lastRunLabel.SetText(fmt.Sprintf("最近一次运行：%s  %s  扫描%d个  变更%d个  跳过%d个  上传%d个  失败%d个",
+			formatTime(last.StartTime), statusText(last.Status), last.ScannedCount, last.ChangedCount,
+			last.SkippedCount, last.UploadedCount, last.FailedCount))
+	} else {
+		d.lastRunLabel.SetText("最近一次运行：暂无")
+	}
+
+	d.summaries = runDao.SummaryByBackupPath()
+	savings := dao.NewContentDao(util.NewContext(), database.DB).Savings()
+	var savedBytes int64
+	for _, summary := range d.summaries {
+		savedBytes += summary.SavedBytes
+	}
+	d.savingsLabel.SetText(fmt.Sprintf("内容去重：重复文件%d个，节省空间%s，节省流量%s",
+		savings.DuplicateCount, ui_util.FormatSize(savings.SavedBytes), ui_util.FormatSize(savedBytes)))
+
+	// 图表按时间正序展示
+	runs := make([]*model.BackupRun, 0, len(recent))
+	for i := len(recent) - 1; i >= 0; i-- {
+		runs = append(runs, recent[i])
+	}
+	d.chart.SetRuns(runs)
+
+	d.summaryList.Refresh()
+}
+
+func (d *Dashboard) refresh() {
+	ticker := time.NewTicker(30 * time.Second)
+	for {
+		select {
+		// 定时刷新
+		case <-ticker.C:
+			d.Refresh()
+		}
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "暂无"
+	}
+	return t.Format(consts.TimeFormatSecond)
+}
+
+func statusText(status uint8) string {
+	switch status {
+	case consts.BackupRunStatusSuccess:
+		return "成功"
+	case consts.BackupRunStatusPartial:
+		return "部分失败"
+	case consts.BackupRunStatusFail:
+		return "失败"
+	}
+	return "运行中"
+}
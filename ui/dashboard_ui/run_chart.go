@@ -0,0 +1,124 @@
+package dashboard_ui
+
+import (
+	"image/color"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"backup/consts"
+	"backup/internal/model"
+)
+
+var (
+	successColor = color.NRGBA{R: 0x43, G: 0xa0, B: 0x47, A: 0xff}
+	partialColor = color.NRGBA{R: 0xfb, G: 0x8c, B: 0x00, A: 0xff}
+	failColor    = color.NRGBA{R: 0xe5, G: 0x39, B: 0x35, A: 0xff}
+	runningColor = color.NRGBA{R: 0x1e, G: 0x88, B: 0xe5, A: 0xff}
+)
+
+// RunChart 运行记录柱状图，每根柱子表示一次运行上传的文件数，颜色表示运行状态
+type RunChart struct {
+	widget.BaseWidget
+
+	runs []*model.BackupRun // 按时间正序排列
+}
+
+func NewRunChart() *RunChart {
+	chart := &RunChart{}
+	chart.ExtendBaseWidget(chart)
+	return chart
+}
+
+// SetRuns 设置运行记录，runs需要按时间正序排列
+func (c *RunChart) SetRuns(runs []*model.BackupRun) {
+	c.runs = runs
+	c.Refresh()
+}
+
+func (c *RunChart) CreateRenderer() fyne.WidgetRenderer {
+	r := &runChartRenderer{chart: c, axis: canvas.NewLine(theme.ForegroundColor())}
+	r.Refresh()
+	return r
+}
+
+func (c *RunChart) MinSize() fyne.Size {
+	return fyne.NewSize(200, 150)
+}
+
+type runChartRenderer struct {
+	chart *RunChart
+	axis  *canvas.Line
+	bars  []*canvas.Rectangle
+}
+
+func (r *runChartRenderer) Layout(size fyne.Size) {
+	padding := theme.Padding()
+	r.axis.Position1 = fyne.NewPos(0, size.Height)
+	r.axis.Position2 = fyne.NewPos(size.Width, size.Height)
+
+	if len(r.bars) == 0 {
+		return
+	}
+
+	var max int64 = 1
+	for _, run := range r.chart.runs {
+		if count := runValue(run); count > max {
+			max = count
+		}
+	}
+
+	width := size.Width / float32(len(r.bars))
+	for i, bar := range r.bars {
+		height := size.Height * float32(runValue(r.chart.runs[i])) / float32(max)
+		if height < 1 { // 保证没有上传的运行也能看到
+			height = 1
+		}
+		bar.Move(fyne.NewPos(float32(i)*width+padding/2, size.Height-height))
+		bar.Resize(fyne.NewSize(width-padding, height))
+	}
+}
+
+func (r *runChartRenderer) MinSize() fyne.Size {
+	return r.chart.MinSize()
+}
+
+func (r *runChartRenderer) Refresh() {
+	r.bars = make([]*canvas.Rectangle, 0, len(r.chart.runs))
+	for _, run := range r.chart.runs {
+		r.bars = append(r.bars, canvas.NewRectangle(statusColor(run.Status)))
+	}
+	r.axis.StrokeColor = theme.ForegroundColor()
+	r.Layout(r.chart.Size())
+	canvas.Refresh(r.chart)
+}
+
+func (r *runChartRenderer) Objects() []fyne.CanvasObject {
+	objects := make([]fyne.CanvasObject, 0, len(r.bars)+1)
+	for _, bar := range r.bars {
+		objects = append(objects, bar)
+	}
+	return append(objects, r.axis)
+}
+
+func (r *runChartRenderer) Destroy() {
+}
+
+// runValue 柱子高度：上传成功与失败的文件数之和
+func runValue(run *model.BackupRun) int64 {
+	return run.UploadedCount + run.FailedCount
+}
+
+func statusColor(status uint8) color.Color {
+	switch status {
+	case consts.BackupRunStatusSuccess:
+		return successColor
+	case consts.BackupRunStatusPartial:
+		return partialColor
+	case consts.BackupRunStatusFail:
+		return failColor
+	}
+	return runningColor
+}
@@ -0,0 +1,173 @@
+package log_ui
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"backup/consts"
+	"backup/pkg/logger"
+	ui_util "backup/ui/util"
+)
+
+const autoRefreshInterval = 3 * time.Second // 自动刷新日志的间隔
+
+// 过滤级别的展示名称
+var levelOptions = []string{"全部", "调试", "信息", "警告", "错误"}
+
+var levelValues = map[string]string{
+	"全部": "",
+	"调试": consts.LevelDebug,
+	"信息": consts.LevelInfo,
+	"警告": consts.LevelWarn,
+	"错误": consts.LevelError,
+}
+
+var ExportLogViewer *LogViewer
+
+func NewLogTabItem(window fyne.Window) *container.TabItem {
+	ExportLogViewer = NewLogViewer(window)
+	return container.NewTabItemWithIcon("日志", theme.DocumentIcon(), ExportLogViewer.buildUI())
+}
+
+// LogViewer 查看最近的日志，可以按级别、trace_id、文件路径过滤
+type LogViewer struct {
+	levelSelect *widget.Select
+	traceEntry  *widget.Entry
+	pathEntry   *widget.Entry
+	autoCheck   *widget.Check
+	countLabel  *widget.Label
+	list        *widget.List
+
+	lock  sync.RWMutex
+	lines []*logger.Line
+
+	window fyne.Window
+}
+
+func NewLogViewer(window fyne.Window) *LogViewer {
+	return &LogViewer{
+		window: window,
+	}
+}
+
+func (v *LogViewer) buildUI() fyne.CanvasObject {
+	v.levelSelect = widget.NewSelect(levelOptions, func(string) { v.Refresh() })
+	v.levelSelect.SetSelected(levelOptions[0])
+	v.traceEntry = widget.NewEntry()
+	v.traceEntry.SetPlaceHolder("trace_id")
+	v.traceEntry.OnSubmitted = func(string) { v.Refresh() }
+	v.pathEntry = widget.NewEntry()
+	v.pathEntry.SetPlaceHolder("文件路径")
+	v.pathEntry.OnSubmitted = func(string) { v.Refresh() }
+	v.autoCheck = widget.NewCheck("自动刷新", nil)
+	v.countLabel = widget.NewLabel("")
+
+	v.list = &widget.List{
+		Length: func() int {
+			v.lock.RLock()
+			defer v.lock.RUnlock()
+			return len(v.lines)
+		},
+		CreateItem: func() fyne.CanvasObject {
+			return &widget.Label{TextStyle: fyne.TextStyle{Monospace: true}, Wrapping: fyne.TextTruncate}
+		},
+		UpdateItem: func(id widget.ListItemID, object fyne.CanvasObject) {
+			v.lock.RLock()
+			line := v.lines[id]
+			v.lock.RUnlock()
+			object.(*widget.Label).SetText(fmt.Sprintf("[%s][%s] %s", line.Level, line.Time, line.Message))
+		},
+		OnSelected: func(id widget.ListItemID) {
+			v.lock.RLock()
+			line := v.lines[id]
+			v.lock.RUnlock()
+			v.list.Unselect(id)
+			v.showDetail(line)
+		},
+	}
+	v.list.ExtendBaseWidget(v.list)
+
+	searchBtn := &widget.Button{Text: "查询", Icon: theme.SearchIcon(), OnTapped: v.Refresh}
+	clearBtn := &widget.Button{Text: "清空条件", OnTapped: func() {
+		v.traceEntry.SetText("")
+		v.pathEntry.SetText("")
+		v.levelSelect.SetSelected(levelOptions[0])
+	}}
+	top := container.NewBorder(nil, nil,
+		container.NewHBox(widget.NewLabel("级别"), v.levelSelect),
+		container.NewHBox(searchBtn, clearBtn, v.autoCheck, v.countLabel),
+		container.NewGridWithColumns(2, v.traceEntry, v.pathEntry),
+	)
+
+	v.Refresh()
+	go v.autoRefresh()
+	return container.NewBorder(top, nil, nil, nil, v.list)
+}
+
+// ShowTrace 查看一个trace的所有日志
+func (v *LogViewer) ShowTrace(traceId string) {
+	v.pathEntry.SetText("")
+	v.traceEntry.SetText(traceId)
+	v.levelSelect.SetSelected(levelOptions[0]) // 会触发刷新
+}
+
+// Refresh 按当前的过滤条件重新读取日志，滚动到最新的日志
+func (v *LogViewer) Refresh() {
+	if v.list == nil { // 界面还没有创建完成
+		return
+	}
+	lines, err := logger.Tail(logger.Filter{
+		Level:   levelValues[v.levelSelect.Selected],
+		TraceId: v.traceEntry.Text,
+		Path:    v.pathEntry.Text,
+	})
+	if err != nil {
+		ui_util.ShowErrorDialog("读取日志失败", v.window)
+		return
+	}
+	v.lock.Lock()
+	v.lines = lines
+	v.lock.Unlock()
+	v.countLabel.SetText(fmt.Sprintf("%d条", len(lines)))
+	v.list.Refresh()
+	if len(lines) > 0 {
+		v.list.ScrollToBottom()
+	}
+}
+
+// autoRefresh 勾选自动刷新时定时读取新的日志
+func (v *LogViewer) autoRefresh() {
+	ticker := time.NewTicker(autoRefreshInterval)
+	for range ticker.C {
+		if v.autoCheck.Checked {
+			v.Refresh()
+		}
+	}
+}
+
+// showDetail 展示一条日志的完整内容，包括错误堆栈
+func (v *LogViewer) showDetail(line *logger.Line) {
+	text := widget.NewMultiLineEntry()
+	text.SetText(line.Text)
+	text.Wrapping = fyne.TextWrapWord
+	traceBtn := widget.NewButton("查看这个trace的日志", nil)
+	if line.TraceId == "" {
+		traceBtn.Disable()
+	}
+	content := container.NewBorder(nil, container.NewHBox(layout.NewSpacer(), traceBtn), nil, nil, text)
+	detail := dialog.NewCustom("日志详情", "关闭", content, v.window)
+	traceBtn.OnTapped = func() {
+		detail.Hide()
+		v.ShowTrace(line.TraceId)
+	}
+	detail.Resize(fyne.NewSize(800, 400))
+	detail.Show()
+}
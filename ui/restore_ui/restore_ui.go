@@ -0,0 +1,226 @@
+package restore_ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pkg/errors"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/restore"
+	"backup/pkg/database"
+	"backup/pkg/util"
+	ui_util "backup/ui/util"
+)
+
+const refreshInterval = time.Second // 恢复进度的刷新间隔
+
+func NewRestoreTabItem(window fyne.Window) *container.TabItem {
+	return container.NewTabItemWithIcon("恢复", theme.DownloadIcon(), NewRestoreUI(window).buildUI())
+}
+
+// RestoreUI 从网盘批量恢复备份路径下的文件
+type RestoreUI struct {
+	backupPathGroup  *widget.CheckGroup
+	pointInTimeEntry *widget.Entry
+	oldRootEntry     *widget.Entry
+	newRootEntry     *widget.Entry
+	startBtn         *widget.Button
+	pauseBtn         *widget.Button
+	progressBar      *widget.ProgressBar
+	progressLabel    *widget.Label
+
+	job *restore.Job
+
+	window fyne.Window
+}
+
+func NewRestoreUI(window fyne.Window) *RestoreUI {
+	return &RestoreUI{
+		window: window,
+	}
+}
+
+func (r *RestoreUI) buildUI() fyne.CanvasObject {
+	var backupPaths []string
+	for _, backupPath := range dao.NewBackupPathDao(util.NewContext(), database.DB).GetAll() {
+		backupPaths = append(backupPaths, backupPath.AbsPath)
+	}
+	r.backupPathGroup = widget.NewCheckGroup(backupPaths, nil)
+	r.backupPathGroup.SetSelected(backupPaths)
+	r.pointInTimeEntry = &widget.Entry{PlaceHolder: "恢复到这个时间之前最近的快照，格式" + consts.TimeFormatSecond + "，为空时恢复最新的文件"}
+	r.oldRootEntry = &widget.Entry{PlaceHolder: "原来的根目录，例如C:\\Users\\me"}
+	r.newRootEntry = &widget.Entry{PlaceHolder: "恢复到的根目录，为空时恢复到原位置"}
+	browseBtn := &widget.Button{Text: "浏览快照", Icon: theme.SearchIcon(), OnTapped: func() {
+		NewSnapshotBrowser(r.window, r.restoreDir).Show(backupPaths)
+	}}
+	newRootBtn := &widget.Button{Icon: theme.FolderOpenIcon(), OnTapped: func() {
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err == nil && dir != nil {
+				r.newRootEntry.SetText(dir.Path())
+			}
+		}, r.window)
+	}}
+
+	r.startBtn = &widget.Button{Text: "开始恢复", Icon: theme.DownloadIcon(), Importance: widget.HighImportance, OnTapped: r.Start}
+	r.pauseBtn = &widget.Button{Text: "暂停", Icon: theme.MediaPauseIcon(), OnTapped: r.Pause}
+	r.pauseBtn.Disable()
+	r.progressBar = widget.NewProgressBar()
+	r.progressLabel = widget.NewLabel("")
+
+	form := widget.NewForm(
+		widget.NewFormItem("时间点", container.NewBorder(nil, nil, nil, browseBtn, r.pointInTimeEntry)),
+		widget.NewFormItem("原根目录", r.oldRootEntry),
+		widget.NewFormItem("恢复到", container.NewBorder(nil, nil, nil, newRootBtn, r.newRootEntry)),
+	)
+	conditionCard := &widget.Card{
+		Title:    "恢复条件",
+		Subtitle: "按上传成功的文件记录或者快照从网盘下载，校验md5后写入本地，已经恢复的文件中断后不再下载",
+		Content:  container.NewVBox(widget.NewLabel("备份路径"), r.backupPathGroup, form),
+	}
+	progressCard := &widget.Card{
+		Title:   "恢复进度",
+		Content: container.NewVBox(r.progressBar, container.NewHBox(r.progressLabel, layout.NewSpacer(), r.startBtn, r.pauseBtn)),
+	}
+
+	r.loadUnfinished()
+	return container.NewVScroll(container.NewVBox(conditionCard, progressCard))
+}
+
+// loadUnfinished 上次没有完成的恢复任务可以继续
+func (r *RestoreUI) loadUnfinished() {
+	job, err := restore.Resume(util.NewContext())
+	if err != nil {
+		return
+	}
+	r.job = job
+	options := job.Options()
+	r.backupPathGroup.SetSelected(options.BackupPaths)
+	if options.PointInTime != nil {
+		r.pointInTimeEntry.SetText(options.PointInTime.Format(consts.TimeFormatSecond))
+	}
+	r.oldRootEntry.SetText(options.OldRoot)
+	r.newRootEntry.SetText(options.NewRoot)
+	r.startBtn.SetText("继续恢复")
+	r.progressLabel.SetText("上次的恢复没有完成")
+}
+
+// Start 开始新的恢复任务，条件和没有完成的任务相同时继续
+func (r *RestoreUI) Start() {
+	options, err := r.options()
+	if err != nil {
+		ui_util.ShowErrorDialog(err.Error(), r.window)
+		return
+	}
+	if r.job == nil || !sameOptions(r.job.Options(), options) {
+		job, err := restore.New(util.NewContext(), options)
+		if err != nil {
+			ui_util.ShowErrorDialog("创建恢复任务失败", r.window)
+			return
+		}
+		r.job = job
+	} else if job, err := restore.Resume(util.NewContext()); err == nil {
+		r.job = job // 暂停后重新加载，计数从头开始
+	}
+
+	r.startBtn.Disable()
+	r.pauseBtn.Enable()
+	r.job.Start()
+	go r.watch(r.job)
+}
+
+// restoreDir 在快照中选择的目录按快照的时间恢复
+func (r *RestoreUI) restoreDir(dir string, pointInTime time.Time) {
+	found := false
+	for _, option := range r.backupPathGroup.Options {
+		found = found || option == dir
+	}
+	if !found {
+		r.backupPathGroup.Options = append(r.backupPathGroup.Options, dir)
+	}
+	r.backupPathGroup.SetSelected([]string{dir})
+	// 快照时间精确到纳秒，输入框只到秒，向后取整才能查到这个快照
+	r.pointInTimeEntry.SetText(pointInTime.Truncate(time.Second).Add(time.Second).Format(consts.TimeFormatSecond))
+}
+
+// Pause 暂停恢复，之后可以继续
+func (r *RestoreUI) Pause() {
+	if r.job != nil {
+		r.job.Pause()
+	}
+}
+
+func (r *RestoreUI) options() (*restore.Options, error) {
+	options := &restore.Options{
+		BackupPaths: r.backupPathGroup.Selected,
+		OldRoot:     strings.TrimSpace(r.oldRootEntry.Text),
+		NewRoot:     strings.TrimSpace(r.newRootEntry.Text),
+	}
+	if len(options.BackupPaths) == 0 {
+		return nil, errors.New("请选择需要恢复的备份路径")
+	}
+	if text := strings.TrimSpace(r.pointInTimeEntry.Text); text != "" {
+		pointInTime, err := time.ParseInLocation(consts.TimeFormatSecond, text, time.Local)
+		if err != nil {
+			return nil, errors.Errorf("时间点的格式应该是%s", consts.TimeFormatSecond)
+		}
+		options.PointInTime = &pointInTime
+	}
+	return options, nil
+}
+
+// watch 定时刷新进度，结束后提示报告的位置
+func (r *RestoreUI) watch(job *restore.Job) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.refreshProgress(job)
+		case <-job.Done():
+			r.refreshProgress(job)
+			r.pauseBtn.Disable()
+			r.startBtn.Enable()
+			if !job.Finished() {
+				r.startBtn.SetText("继续恢复")
+				return
+			}
+			r.job = nil
+			r.startBtn.SetText("开始恢复")
+			progress := job.Progress()
+			ui_util.ShowInfoDialog(fmt.Sprintf("恢复完成，成功%d个，失败%d个\n报告：%s", progress.RestoredCount, progress.FailedCount, job.ReportPath()), r.window)
+			return
+		}
+	}
+}
+
+func (r *RestoreUI) refreshProgress(job *restore.Job) {
+	progress := job.Progress()
+	if progress.TotalBytes > 0 {
+		r.progressBar.SetValue(float64(progress.RestoredBytes) / float64(progress.TotalBytes))
+	}
+	text := fmt.Sprintf("已恢复%d/%d个  失败%d个  %s/%s", progress.RestoredCount, progress.TotalCount, progress.FailedCount,
+		ui_util.FormatSize(progress.RestoredBytes), ui_util.FormatSize(progress.TotalBytes))
+	if progress.ETA > 0 {
+		text += "  剩余约" + progress.ETA.String()
+	}
+	r.progressLabel.SetText(text)
+}
+
+func sameOptions(a, b *restore.Options) bool {
+	if strings.Join(a.BackupPaths, "\n") != strings.Join(b.BackupPaths, "\n") || a.OldRoot != b.OldRoot || a.NewRoot != b.NewRoot {
+		return false
+	}
+	if a.PointInTime == nil || b.PointInTime == nil {
+		return a.PointInTime == b.PointInTime
+	}
+	return a.PointInTime.Equal(*b.PointInTime)
+}
@@ -0,0 +1,162 @@
+package restore_ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/internal/snapshot"
+	"backup/pkg/database"
+	"backup/pkg/util"
+	ui_util "backup/ui/util"
+)
+
+const snapshotLimit = 100 // 可以选择的快照数量
+
+// SnapshotBrowser 浏览备份路径在某个快照中的文件，选择目录后按这个快照恢复
+type SnapshotBrowser struct {
+	backupSelect   *widget.Select
+	snapshotSelect *widget.Select
+	dirLabel       *widget.Label
+	upBtn          *widget.Button
+	restoreBtn     *widget.Button
+	nodeList       *widget.List
+	dialog         dialog.Dialog
+
+	backupPath string
+	dir        string
+	snapshots  []*model.Snapshot
+	snapshot   *model.Snapshot
+	nodes      []*snapshot.Node
+
+	onRestore func(dir string, pointInTime time.Time)
+	window    fyne.Window
+}
+
+func NewSnapshotBrowser(window fyne.Window, onRestore func(dir string, pointInTime time.Time)) *SnapshotBrowser {
+	return &SnapshotBrowser{
+		onRestore: onRestore,
+		window:    window,
+	}
+}
+
+// Show 打开浏览窗口，默认显示第一个备份路径的最新快照
+func (b *SnapshotBrowser) Show(backupPaths []string) {
+	b.backupSelect = widget.NewSelect(backupPaths, b.selectBackupPath)
+	b.snapshotSelect = widget.NewSelect(nil, b.selectSnapshot)
+	b.dirLabel = &widget.Label{Wrapping: fyne.TextTruncate}
+	b.upBtn = &widget.Button{Icon: theme.MoveUpIcon(), OnTapped: func() {
+		if b.dir != b.backupPath {
+			b.open(filepath.Dir(b.dir))
+		}
+	}}
+	b.restoreBtn = &widget.Button{Text: "恢复这个目录", Icon: theme.DownloadIcon(), OnTapped: func() {
+		if b.snapshot != nil {
+			b.dialog.Hide()
+			b.onRestore(b.dir, *b.snapshot.CreateTime)
+		}
+	}}
+	b.nodeList = &widget.List{
+		Length: func() int {
+			return len(b.nodes)
+		},
+		CreateItem: func() fyne.CanvasObject {
+			return container.NewHBox(widget.NewIcon(theme.FileIcon()), widget.NewLabel(""), layout.NewSpacer(), widget.NewLabel(""))
+		},
+		UpdateItem: func(id widget.ListItemID, object fyne.CanvasObject) {
+			c := object.(*fyne.Container)
+			node := b.nodes[id]
+			if node.IsDir {
+				c.Objects[0].(*widget.Icon).SetResource(theme.FolderIcon())
+				c.Objects[3].(*widget.Label).SetText(fmt.Sprintf("%d个文件  %s", node.FileCount, ui_util.FormatSize(node.Size)))
+			} else {
+				c.Objects[0].(*widget.Icon).SetResource(theme.FileIcon())
+				c.Objects[3].(*widget.Label).SetText(fmt.Sprintf("%s  %s", ui_util.FormatSize(node.Size), formatTime(node.ModTime)))
+			}
+			c.Objects[1].(*widget.Label).SetText(node.Name)
+		},
+		OnSelected: func(id widget.ListItemID) {
+			b.nodeList.Unselect(id)
+			if node := b.nodes[id]; node.IsDir {
+				b.open(node.Path)
+			}
+		},
+	}
+	b.nodeList.ExtendBaseWidget(b.nodeList)
+
+	top := container.NewVBox(
+		widget.NewForm(widget.NewFormItem("备份路径", b.backupSelect), widget.NewFormItem("快照", b.snapshotSelect)),
+		container.NewBorder(nil, nil, b.upBtn, b.restoreBtn, b.dirLabel),
+	)
+	b.dialog = dialog.NewCustom("浏览快照", "关闭", container.NewBorder(top, nil, nil, nil, b.nodeList), b.window)
+	b.dialog.Resize(ui_util.WindowSizeToDialog(b.window.Canvas().Size()))
+	b.dialog.Show()
+	if len(backupPaths) > 0 {
+		b.backupSelect.SetSelectedIndex(0)
+	}
+}
+
+func (b *SnapshotBrowser) selectBackupPath(backupPath string) {
+	b.backupPath = backupPath
+	b.snapshots = dao.NewSnapshotDao(util.NewContext(), database.DB).QueryByBackupPath(backupPath, snapshotLimit)
+	options := make([]string, 0, len(b.snapshots))
+	for _, s := range b.snapshots {
+		options = append(options, fmt.Sprintf("%s  %d个文件  变化%d个", formatTime(s.CreateTime), s.FileCount, s.ChangeCount))
+	}
+	b.snapshotSelect.Options = options
+	if len(options) == 0 {
+		b.snapshot, b.nodes = nil, nil
+		b.snapshotSelect.ClearSelected()
+		b.dirLabel.SetText("这个备份路径还没有快照，成功备份一次后生成")
+		b.nodeList.Refresh()
+		return
+	}
+	b.snapshotSelect.SetSelectedIndex(0)
+}
+
+func (b *SnapshotBrowser) selectSnapshot(string) {
+	index := b.snapshotSelect.SelectedIndex()
+	if index < 0 || index >= len(b.snapshots) {
+		return
+	}
+	b.snapshot = b.snapshots[index]
+	dir := b.dir
+	if dir == "" || (dir != b.backupPath && !strings.HasPrefix(dir, b.backupPath+string(filepath.Separator))) {
+		dir = b.backupPath
+	}
+	b.open(dir)
+}
+
+// open 显示快照中dir目录下的文件和子目录
+func (b *SnapshotBrowser) open(dir string) {
+	if b.snapshot == nil {
+		return
+	}
+	_, nodes, err := snapshot.Browse(util.NewContext(), b.backupPath, b.snapshot.CreateTime, dir)
+	if err != nil {
+		ui_util.ShowErrorDialog("读取快照失败", b.window)
+		return
+	}
+	b.dir, b.nodes = dir, nodes
+	b.dirLabel.SetText(dir)
+	b.nodeList.Refresh()
+	b.nodeList.ScrollToTop()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(consts.TimeFormatSecond)
+}
@@ -6,13 +6,26 @@ import (
 
 	"backup/ui/backup_ui"
 	"backup/ui/config_ui"
+	"backup/ui/dashboard_ui"
+	"backup/ui/log_ui"
+	"backup/ui/restore_ui"
 	"backup/ui/upload_ui"
 )
 
 func Create(window fyne.Window) *container.AppTabs {
-	return &container.AppTabs{Items: []*container.TabItem{
+	logTab := log_ui.NewLogTabItem(window)
+	tabs := &container.AppTabs{Items: []*container.TabItem{
 		backup_ui.NewBackupTabItem(window),
 		upload_ui.NewUploadTabItem(window),
+		dashboard_ui.NewDashboardTabItem(window),
+		restore_ui.NewRestoreTabItem(window),
 		config_ui.NewConfigTabItem(window),
+		logTab,
 	}}
+	// 上传失败的文件跳转到日志页查看这次上传的日志
+	upload_ui.ShowLog = func(traceId string) {
+		log_ui.ExportLogViewer.ShowTrace(traceId)
+		tabs.Select(logTab)
+	}
+	return tabs
 }
@@ -0,0 +1,99 @@
+package ui
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+
+	"backup/internal/scanner"
+	"backup/ui/upload_ui"
+)
+
+const trayRefreshInterval = 5 * time.Second // 托盘菜单中状态的刷新间隔
+
+// SetupTray 启用托盘模式，关闭窗口时隐藏到托盘，备份在后台继续，返回是否启用
+// 驱动不支持托盘时(例如移动端)不启用，关闭窗口仍然退出程序
+func SetupTray(app fyne.App, window fyne.Window) bool {
+	tray, ok := app.(desktop.App)
+	if !ok {
+		return false
+	}
+	tray.SetSystemTrayIcon(app.Icon())
+
+	var mux sync.Mutex // 菜单的回调和定时刷新在不同的协程中
+	visible := true
+	statusItem := &fyne.MenuItem{Label: trayStatus(), Disabled: true}
+	showItem := fyne.NewMenuItem("隐藏窗口", nil)
+	pauseItem := fyne.NewMenuItem("全部暂停", nil)
+	menu := fyne.NewMenu("网盘备份", statusItem, fyne.NewMenuItemSeparator(), showItem, pauseItem,
+		fyne.NewMenuItem("立即扫描", scanner.Manager.ScanNow))
+	// 修改菜单后重新设置，托盘中的菜单才会更新
+	refresh := func() {
+		mux.Lock()
+		defer mux.Unlock()
+		statusItem.Label = trayStatus()
+		showItem.Label = "显示窗口"
+		if visible {
+			showItem.Label = "隐藏窗口"
+		}
+		pauseItem.Label = "全部暂停"
+		if upload_ui.ExportUploadList.Paused() {
+			pauseItem.Label = "全部继续"
+		}
+		tray.SetSystemTrayMenu(menu)
+	}
+	setVisible := func(show bool) {
+		mux.Lock()
+		visible = show
+		mux.Unlock()
+		refresh()
+	}
+	showItem.Action = func() {
+		mux.Lock()
+		show := !visible
+		mux.Unlock()
+		if show {
+			window.Show()
+			window.RequestFocus()
+		} else {
+			window.Hide()
+		}
+		setVisible(show)
+	}
+	pauseItem.Action = func() {
+		if upload_ui.ExportUploadList.Paused() {
+			upload_ui.ExportUploadList.ResumeAll()
+		} else {
+			upload_ui.ExportUploadList.PauseAll(time.Time{})
+		}
+		refresh()
+	}
+	window.SetCloseIntercept(func() {
+		window.Hide()
+		setVisible(false)
+	})
+
+	refresh()
+	go func() {
+		ticker := time.NewTicker(trayRefreshInterval)
+		for range ticker.C {
+			refresh()
+		}
+	}()
+	return true
+}
+
+// trayStatus 托盘菜单中显示的当前状态
+func trayStatus() string {
+	if upload_ui.ExportUploadList.Paused() {
+		return "已全部暂停"
+	}
+	uploading, waiting := upload_ui.ExportUploadList.Counts()
+	if uploading == 0 && waiting == 0 {
+		return "空闲"
+	}
+	return fmt.Sprintf("正在上传%d个，等待%d个", uploading, waiting)
+}
@@ -0,0 +1,78 @@
+package upload_ui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2/dialog"
+
+	"backup/consts"
+	"backup/internal/guard"
+	"backup/internal/notification"
+	"backup/pkg/logger"
+	"backup/pkg/util"
+	ui_util "backup/ui/util"
+)
+
+// Suspend 备份路径疑似被勒索软件加密，暂停其中已经入队的文件，提醒用户确认后再继续上传
+func (l *UploadList) Suspend(backupPath, reason string) {
+	var paused []*UploadItem
+	for _, item := range l.itemsUnder(backupPath) {
+		if item.Pause(false) {
+			paused = append(paused, item)
+		}
+	}
+	l.pauseLock.Lock()
+	if l.suspendedItems == nil {
+		l.suspendedItems = map[string][]*UploadItem{}
+	}
+	l.suspendedItems[backupPath] = append(l.suspendedItems[backupPath], paused...)
+	l.pauseLock.Unlock()
+	logger.Logger.WithField("backup_path", backupPath).WithField("paused_count", len(paused)).Warn("suspend backup path upload")
+	l.Refresh()
+
+	notification.Send(util.NewContext(), consts.EventSuspend, "备份已暂停", fmt.Sprintf("%s：%s", backupPath, reason))
+	if l.window == nil {
+		return
+	}
+	message := fmt.Sprintf("%s\n%s\n\n可能是勒索软件正在加密文件，已暂停这个备份路径的上传，防止覆盖网盘中的备份。\n确认这些修改是正常的吗？", backupPath, reason)
+	dialog.ShowConfirm("发现异常的文件修改", message, func(ok bool) {
+		if ok {
+			l.ConfirmSuspend(util.NewContext(), backupPath)
+		}
+	}, l.window)
+}
+
+// ConfirmSuspend 用户确认修改是正常的，继续上传暂停期间保留的文件和暂停的文件
+// 保留的文件入队时可能要等待队列有空位，在协程中执行
+func (l *UploadList) ConfirmSuspend(ctx context.Context, backupPath string) {
+	go func() {
+		if err := guard.Confirm(ctx, backupPath); err != nil {
+			ui_util.ShowErrorDialog("继续上传失败", l.window)
+			return
+		}
+		l.pauseLock.Lock()
+		paused := l.suspendedItems[backupPath]
+		delete(l.suspendedItems, backupPath)
+		l.pauseLock.Unlock()
+		for _, item := range paused {
+			l.Resume(ctx, item)
+		}
+	}()
+}
+
+// itemsUnder 列表中备份路径下的item
+func (l *UploadList) itemsUnder(backupPath string) []*UploadItem {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	prefix := filepath.Clean(backupPath) + string(filepath.Separator)
+	var res []*UploadItem
+	for _, item := range l.items {
+		if item.path == filepath.Clean(backupPath) || strings.HasPrefix(item.path, prefix) {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,16 @@
+package upload_ui
+
+import (
+	"os"
+	"testing"
+
+	"backup/pkg/database"
+)
+
+// TestMain 测试使用临时目录中的数据库，不影响用户的数据库
+func TestMain(m *testing.M) {
+	cleanup := database.InitForTest("upload_ui")
+	code := m.Run()
+	cleanup()
+	os.Exit(code)
+}
@@ -0,0 +1,49 @@
+package upload_ui
+
+import (
+	"fmt"
+	"time"
+
+	"backup/consts"
+	"backup/internal/config"
+	"backup/internal/notification"
+	"backup/pkg/logger"
+	"backup/pkg/pcs_client"
+	"backup/pkg/util"
+	ui_util "backup/ui/util"
+)
+
+const quotaCheckInterval = 10 * time.Minute // 检查网盘剩余空间的间隔
+
+// quotaLoop 定时检查网盘剩余空间，低于提醒阈值时发送通知，恢复之前只提醒一次
+func (l *UploadList) quotaLoop() {
+	ticker := time.NewTicker(quotaCheckInterval)
+	var alerted bool
+	for {
+		select {
+		case <-ticker.C:
+			alerted = l.checkQuota(alerted)
+		}
+	}
+}
+
+func (l *UploadList) checkQuota(alerted bool) bool {
+	ctx := util.NewContext()
+	quota, err := pcs_client.RefreshQuota(ctx)
+	if err != nil {
+		logger.Logger.WithContext(ctx).WithError(err).Warn("check quota fail")
+		return alerted
+	}
+
+	lowWater := config.GetQuotaLowWater()
+	if lowWater <= 0 || quota.Remain() >= lowWater {
+		return false
+	}
+	if alerted {
+		return true
+	}
+	logger.Logger.WithContext(ctx).WithField("remain", quota.Remain()).WithField("low_water", lowWater).Warn("netdisk space is low")
+	notification.Send(ctx, consts.EventQuotaLow, "百度网盘空间不足",
+		fmt.Sprintf("剩余空间 %s，低于提醒阈值 %s", ui_util.FormatSize(quota.Remain()), ui_util.FormatSize(lowWater)))
+	return true
+}
@@ -5,9 +5,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"backup/consts"
+	"backup/internal/config"
 	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/internal/statistics"
 	"backup/pkg/database"
 	"backup/pkg/logger"
 	"backup/pkg/pcs_client"
@@ -18,17 +26,33 @@ type UploadItem struct {
 	path       string
 	ctx        context.Context
 	cancelFunc context.CancelFunc
+	stateLock  sync.Mutex // 状态切换需要先检查原来的状态，防止出队和暂停同时修改
 	state      int
 	progress   string
 	serverPath string
 
-	list *UploadList
+	size     int64     // 文件大小
+	modTime  time.Time // 文件修改时间
+	priority int       // 所属备份路径的优先级
+	seq      uint64    // 入队序号
+	nextSeq  uint64    // "下一个上传"的序号
+	pinned   bool      // 是否置顶
+
+	hash        *util.FileHash          // 扫描时计算的md5，文件没有变化时上传前不需要再计算
+	uploadState *pcs_client.UploadState // 分片上传的进度，暂停后继续上传时使用
+	pausedByAll bool                    // 是否是全部暂停导致的暂停，全部继续时只恢复这些item
+	compress    string                  // 上传前使用的压缩算法，为空时不压缩
+	mode        uint8                   // 上传模式，为0时是手动上传
+
+	list       *UploadList
+	recordLock sync.Mutex
+	recorder   *statistics.RunRecorder // 所属运行的统计记录，上传结束后置空
 }
 
 func NewUploadItem(path, serverPath string, list *UploadList) *UploadItem {
 	baseCtx := util.NewContext() // 基础ctx，用于生成trace_id
 	ctx, cancelFunc := context.WithCancel(baseCtx)
-	return &UploadItem{
+	item := &UploadItem{
 		path:       filepath.Clean(path),
 		ctx:        ctx,
 		cancelFunc: cancelFunc,
@@ -36,42 +60,241 @@ func NewUploadItem(path, serverPath string, list *UploadList) *UploadItem {
 		progress:   "等待上传",
 		serverPath: serverPath,
 		list:       list,
+
+		uploadState: pcs_client.NewUploadState("", nil, nil),
+	}
+	if stat, err := os.Stat(item.path); err == nil { // 用于等待队列排序
+		item.size = stat.Size()
+		item.modTime = stat.ModTime()
 	}
+	return item
+}
+
+// WithPriority 设置item所属备份路径的优先级
+func (i *UploadItem) WithPriority(priority int) *UploadItem {
+	i.priority = priority
+	return i
+}
+
+// WithHash 设置扫描时计算的md5
+func (i *UploadItem) WithHash(hash *util.FileHash) *UploadItem {
+	i.hash = hash
+	return i
+}
+
+// WithCompress 设置上传前使用的压缩算法
+func (i *UploadItem) WithCompress(algorithm string) *UploadItem {
+	i.compress = algorithm
+	return i
+}
+
+// WithMode 设置上传模式
+func (i *UploadItem) WithMode(mode uint8) *UploadItem {
+	i.mode = mode
+	return i
+}
+
+// WithUploadState 设置上一次的上传进度
+func (i *UploadItem) WithUploadState(state *pcs_client.UploadState) *UploadItem {
+	i.uploadState = state
+	return i
+}
+
+// WithRecorder 设置item所属运行的统计记录
+func (i *UploadItem) WithRecorder(recorder *statistics.RunRecorder) *UploadItem {
+	i.recorder = recorder
+	return i
 }
 
 func (i *UploadItem) Cancel() {
 	i.UploadStatus(consts.UploadStatusCancel)
 	i.cancelFunc()
+	i.finishRecord(func(recorder *statistics.RunRecorder) {
+		recorder.UploadCancel()
+	})
+}
+
+// Pause 暂停上传，正在上传的分片会继续完成，继续上传时跳过已经完成的分片
+// byAll 表示是否是全部暂停导致的暂停
+func (i *UploadItem) Pause(byAll bool) bool {
+	old, ok := i.compareAndSwapState(consts.UploadStatusPaused, consts.UploadStatusWaitUploaded, consts.UploadStatusUploading)
+	if !ok {
+		return false
+	}
+	i.pausedByAll = byAll
+	i.cancelFunc()
+	if old == consts.UploadStatusWaitUploaded { // 等待中的item移出队列，继续时重新入队，上传中的item在上传协程中处理
+		i.list.waitQueue.Remove(i)
+		i.list.persistPause(i)
+	}
+	return true
+}
+
+// finishRecord 上传结束后更新统计记录，每个item只会记录一次
+func (i *UploadItem) finishRecord(record func(recorder *statistics.RunRecorder)) {
+	i.recordLock.Lock()
+	recorder := i.recorder
+	i.recorder = nil
+	i.recordLock.Unlock()
+
+	if recorder != nil {
+		record(recorder)
+	}
 }
 
 func (i *UploadItem) UploadStatus(status int) {
+	i.stateLock.Lock()
+	defer i.stateLock.Unlock()
 	i.state = status
 	i.progress = consts.UploadTextMap[status]
 }
 
+// compareAndSwapState 当前状态是from中的一个时切换为to，返回切换前的状态
+func (i *UploadItem) compareAndSwapState(to int, from ...int) (int, bool) {
+	i.stateLock.Lock()
+	defer i.stateLock.Unlock()
+	old := i.state
+	for _, status := range from {
+		if old == status {
+			i.state = to
+			i.progress = consts.UploadTextMap[to]
+			return old, true
+		}
+	}
+	return old, false
+}
+
 func (i *UploadItem) Upload() {
 	baseLogger := logger.Logger.WithContext(i.ctx)
+	// 同一个item可能被重复出队，只有切换到上传中的协程继续上传
+	if _, ok := i.compareAndSwapState(consts.UploadStatusUploading, consts.UploadStatusWaitUploaded); !ok {
+		baseLogger.WithField("path", i.path).WithField("state", i.state).Warn("item is not waiting, skip upload")
+		i.list.release(i)
+		return
+	}
 
 	stat, err := os.Stat(i.path)
 	if err != nil {
 		baseLogger.WithField("path", i.path).WithError(err).Error("get file stat fail")
+		i.UploadStatus(consts.UploadStatusFail)
 		i.progress = consts.UploadFailText
+		i.finishRecord(func(recorder *statistics.RunRecorder) {
+			recorder.UploadFail()
+		})
 		i.list.Refresh()
 		return
 	}
+	// 文件最近还在修改（日志、虚拟机磁盘等），等一段时间没有修改后再上传
+	if wait := config.GetQuietPeriod() - time.Since(stat.ModTime()); wait > 0 {
+		baseLogger.WithField("path", i.path).WithField("mod_time", stat.ModTime()).WithField("wait", wait.String()).Info("file modified recently, wait for quiet period")
+		i.list.deferItem(i, wait)
+		return
+	}
 	fileInfoDao := dao.NewFileInfoDao(i.ctx, database.DB)
 	// 这里是兼容空文件的情况，如果是一个空文件，至少会上传一个空的分块，最后create也会有一个signal，总共两个signal
-	total := (stat.Size()+consts.Size4MB-1)/consts.Size4MB + 1
+	chunkSize := pcs_client.ChunkSize(i.ctx)
+	total := (stat.Size()+chunkSize-1)/chunkSize + 1
 	if total < 2 {
 		total = 2
 	}
 	var current int64 = 0
+	var completed int32 = 0 // 是否已经合并完成
 	signal := make(chan struct{})
+	sendSignal := func() {
+		select {
+		case signal <- struct{}{}:
+		case <-i.ctx.Done():
+		}
+	}
+	if i.hash == nil { // 恢复的item没有md5，使用数据库中缓存的结果
+		if fileInfo, err := fileInfoDao.QueryByAbsPath(i.path); err == nil {
+			i.hash = fileInfo.Hash()
+		}
+	}
+	// 本地有相同内容的文件已经上传过，直接复制网盘中的文件，媒体模式有自己的去重
+	contentDao := dao.NewContentDao(i.ctx, database.DB)
+	var copySource string
+	if i.mode == 0 && i.hash.Valid(i.path, chunkSize) {
+		if content, err := contentDao.QueryByMd5(i.hash.Md5); err == nil {
+			copySource = content.ServerPath
+		}
+	}
+	uploadState := i.uploadState
+	filePartDao := dao.NewFilePartDao(i.ctx, database.DB)
+	var uploadedParts []*pcs_client.FilePart // 拆分上传时上一次已经上传完成的部分
+	if records, err := filePartDao.QueryByAbsPath(i.path); err == nil {
+		for _, record := range records {
+			uploadedParts = append(uploadedParts, &pcs_client.FilePart{Seq: record.Seq, Path: record.ServerPath, Offset: record.Offset, Size: record.Size, Md5: record.Md5})
+		}
+	}
+	params := pcs_client.NewUploadParams(i.path, i.serverPath, sendSignal, func() {
+		atomic.StoreInt32(&completed, 1)
+		sendSignal()
+	}).WithChunkSize(chunkSize).WithCompress(i.compress).WithMode(i.mode).WithCopySource(copySource).WithHash(i.hash).WithState(uploadState).WithStateFunc(func(state *pcs_client.UploadState) {
+		i.list.persistUploadState(i, state)
+	}).WithParts(uploadedParts).WithPartFunc(func(part *pcs_client.FilePart) {
+		filePartDao.Save(&model.FilePart{
+			AbsPath:      i.path,
+			Seq:          part.Seq,
+			ServerPath:   part.Path,
+			ManifestPath: part.ManifestPath(),
+			Offset:       part.Offset,
+			Size:         part.Size,
+			Md5:          part.Md5,
+		})
+	})
+
+	i.list.persistState(i, consts.UploadStatusUploading)
+	err = fileInfoDao.Update(map[string]interface{}{
+		"upload_status": consts.UploadStatusUploading,
+	}, i.path)
+	if err != nil {
+		baseLogger.WithField("status", consts.UploadStatusUploading).Warn("upload file info status fail")
+	}
+
 	go func() {
 		defer close(signal)
-		err := pcs_client.UploadFileWithSignal(i.ctx, i.path, i.serverPath, signal)
+		err := pcs_client.Upload(i.ctx, params)
+		if err != nil && i.state == consts.UploadStatusPaused { // 暂停上传，保留上传进度
+			baseLogger.WithField("upload_item", i).WithField("completed_count", uploadState.CompletedCount()).Info("upload item paused")
+			i.list.persistPause(i)
+			i.list.release(i)
+			return
+		}
+		if errors.Is(err, pcs_client.ErrSpaceFull) { // 网盘空间不足，全部暂停，不再消耗重试次数
+			baseLogger.WithField("upload_item", i).WithError(err).Warn("netdisk space is full, pause all")
+			i.list.PauseForSpaceFull()
+			i.pausedByAll = true
+			i.UploadStatus(consts.UploadStatusPaused)
+			i.progress = consts.SpaceFullText
+			i.list.persistPause(i)
+			i.list.release(i)
+			return
+		}
+		if errors.Is(err, pcs_client.ErrFileChanged) { // 上传过程中文件被修改，重新计算md5后从头上传
+			baseLogger.WithField("upload_item", i).WithError(err).Warn("file changed during upload")
+			i.hash = nil
+			i.uploadState = pcs_client.NewUploadState("", nil, nil)
+			i.list.persistUploadState(i, i.uploadState)
+			err = fileInfoDao.Update(map[string]interface{}{
+				"upload_status": consts.UploadStatusWaitUploaded,
+			}, i.path)
+			if err != nil {
+				baseLogger.WithField("status", consts.UploadStatusWaitUploaded).Warn("upload file info status fail")
+			}
+			wait := config.GetQuietPeriod()
+			if wait <= 0 { // 不等待的话文件还在修改时会反复上传失败
+				wait = consts.DefaultQuietPeriod * time.Second
+			}
+			i.list.deferItem(i, wait)
+			return
+		}
 		if err != nil {
 			baseLogger.WithField("upload_item", i).WithError(err).Error("upload file fail")
+			if params.IsResumed() { // 上传ID可能已经失效，下一次重新上传
+				i.uploadState = pcs_client.NewUploadState("", nil, nil)
+				i.list.persistUploadState(i, i.uploadState)
+			}
 			err = fileInfoDao.Update(map[string]interface{}{
 				"upload_status": consts.UploadStatusFail,
 			}, i.path)
@@ -79,28 +302,48 @@ func (i *UploadItem) Upload() {
 				baseLogger.WithField("status", consts.UploadStatusFail).Warn("upload file info status fail")
 			}
 			i.UploadStatus(consts.UploadStatusFail)
+			i.list.persistFail(i, err)
+			i.finishRecord(func(recorder *statistics.RunRecorder) {
+				recorder.UploadFail()
+			})
 			i.list.release(i) // list从上传列表中移除item
 			return
 		}
 		// 上传完成，更新上传状态
 		baseLogger.WithField("item", i).Info("upload item upload success")
-		err = fileInfoDao.Update(map[string]interface{}{
+		updates := map[string]interface{}{
 			"upload_status": consts.UploadStatusUploaded,
-		}, i.path)
+		}
+		if hash := params.Hash(); hash != nil && hash != i.hash { // 上传前重新计算了md5，更新缓存
+			for key, value := range model.HashUpdates(hash) {
+				updates[key] = value
+			}
+			i.hash = hash
+		}
+		if i.hash != nil { // 记录上传的内容，内容相同的文件关联到同一条记录
+			if content, err := contentDao.Link(i.hash.Md5, i.hash.Size, params.RemotePath()); err == nil {
+				updates["content_id"] = content.ID
+			}
+		}
+		err = fileInfoDao.Update(updates, i.path)
 		if err != nil {
 			baseLogger.WithField("status", consts.UploadStatusUploaded).Warn("upload file info status fail")
 		}
+		if manifest := params.Manifest(); manifest != nil { // 文件变小后拆分的部分变少，删除多余的记录
+			filePartDao.DeleteAfter(i.path, len(manifest.Parts))
+		}
 		i.UploadStatus(consts.UploadStatusUploaded)
+		i.list.removePersisted(i)
+		i.finishRecord(func(recorder *statistics.RunRecorder) {
+			if params.IsCopied() {
+				recorder.UploadCopied(stat.Size())
+			} else {
+				recorder.UploadSuccess(stat.Size(), params.IsRapidUpload())
+			}
+		})
 		i.list.release(i) // list从上传列表中移除item
 	}()
 
-	i.UploadStatus(consts.UploadStatusUploading)
-	err = fileInfoDao.Update(map[string]interface{}{
-		"upload_status": consts.UploadStatusUploading,
-	}, i.path)
-	if err != nil {
-		baseLogger.WithField("status", consts.UploadStatusUploading).Warn("upload file info status fail")
-	}
 	for {
 		select {
 		case _, ok := <-signal:
@@ -122,9 +365,17 @@ func (i *UploadItem) Upload() {
 				i.list.release(i)                       // list从上传列表中移除item
 				return
 			}
-			i.progress = fmt.Sprintf("%.2f%%", float64(current*100)/float64(total))
-			if current == total { // 补充更新，否则可能出现覆盖
+			if atomic.LoadInt32(&completed) == 1 { // 补充更新，否则可能出现覆盖
 				i.UploadStatus(consts.UploadStatusUploaded)
+				continue
+			}
+			if i.state == consts.UploadStatusUploading {
+				// 继续上传时分片不是从0开始的，按已完成的分片数量计算进度，拆分上传时没有分片进度，按上传的分片数量计算
+				done := int64(uploadState.CompletedCount())
+				if done < current {
+					done = current
+				}
+				i.progress = fmt.Sprintf("%.2f%%", float64(done*100)/float64(total))
 			}
 		}
 	}
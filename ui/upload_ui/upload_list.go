@@ -17,7 +17,10 @@ import (
 
 	"backup/consts"
 	"backup/internal/config"
+	"backup/internal/notification"
+	"backup/internal/statistics"
 	"backup/pkg/logger"
+	"backup/pkg/metrics"
 	"backup/pkg/util"
 	ui_util "backup/ui/util"
 )
@@ -31,7 +34,15 @@ type UploadList struct {
 	window          fyne.Window
 	uploadingItems  []*UploadItem
 	uploadingSignal chan struct{}
-	waitQueue       chan *UploadItem
+	waitQueue       *waitQueue
+
+	pauseLock   sync.Mutex
+	paused      bool           // 是否全部暂停
+	running     chan struct{}  // 没有全部暂停时是关闭的
+	resumeTimer *time.Timer    // 到时间后自动全部继续
+	pauseText   binding.String // 全部暂停的提示
+
+	suspendedItems map[string][]*UploadItem // 备份路径疑似被加密时暂停的item，确认后继续
 
 	signal chan *UploadItem
 }
@@ -40,10 +51,13 @@ func NewUploadList(window fyne.Window) *UploadList {
 	list := &UploadList{
 		items:           []*UploadItem{},
 		window:          window,
-		waitQueue:       make(chan *UploadItem, 100), // 等待队列
+		waitQueue:       newWaitQueue(waitQueueSize), // 等待队列
 		uploadingItems:  make([]*UploadItem, 0, 10),  // 同时上传文件个数
 		uploadingSignal: make(chan struct{}, 10),     // 上传文件的信号量，用于控制最大上传数量
+		running:         make(chan struct{}),
+		pauseText:       binding.NewString(),
 	}
+	close(list.running)
 
 	list.List.CreateItem = list.CreateItem
 	list.List.Length = list.Length
@@ -54,9 +68,16 @@ func NewUploadList(window fyne.Window) *UploadList {
 		list.uploadingSignal <- struct{}{}
 	}
 
+	metrics.NewGaugeFunc("upload_wait_queue_length", "Number of files waiting in the upload list queue.", func() float64 {
+		return float64(list.waitQueue.Len())
+	})
+
 	list.ExtendBaseWidget(list)
-	go list.upload()  // 启动协程开始上传任务
-	go list.refresh() // 启动协程定时刷新
+	go list.recoverQueue() // 恢复上次退出时的上传队列
+	go list.upload()       // 启动协程开始上传任务
+	go list.refresh()      // 启动协程定时刷新
+	go list.retryLoop()    // 启动协程定时重试失败的文件
+	go list.quotaLoop()    // 启动协程定时检查网盘剩余空间
 	return list
 }
 
@@ -71,10 +92,22 @@ func (l *UploadList) CreateItem() fyne.CanvasObject {
 	retryBtn := &widget.Button{
 		Icon: theme.ViewRefreshIcon(),
 	}
+	pauseBtn := &widget.Button{
+		Icon: theme.MediaPauseIcon(),
+	}
+	nextBtn := &widget.Button{
+		Icon: theme.MediaSkipNextIcon(),
+	}
+	pinBtn := &widget.Button{
+		Icon: theme.MoveUpIcon(),
+	}
+	logBtn := &widget.Button{
+		Icon: theme.DocumentIcon(),
+	}
 	progress := &widget.Label{
 		Text: "",
 	}
-	return container.NewHBox(widget.NewLabel(""), layout.NewSpacer(), progress, retryBtn, cancelBtn)
+	return container.NewHBox(widget.NewLabel(""), layout.NewSpacer(), progress, nextBtn, pinBtn, pauseBtn, retryBtn, logBtn, cancelBtn)
 }
 
 func (l *UploadList) UpdateItem(id widget.ListItemID, canvas fyne.CanvasObject) {
@@ -83,24 +116,72 @@ func (l *UploadList) UpdateItem(id widget.ListItemID, canvas fyne.CanvasObject)
 	c.Objects[0].(*widget.Label).SetText(item.path)
 
 	c.Objects[2].(*widget.Label).Bind(binding.BindString(&item.progress))
-	retryBtn := c.Objects[3].(*widget.Button)
+
+	nextBtn := c.Objects[3].(*widget.Button)
+	pinBtn := c.Objects[4].(*widget.Button)
+	nextBtn.Hide()
+	pinBtn.Hide()
+	if item.state == consts.UploadStatusWaitUploaded {
+		nextBtn.Show()
+		nextBtn.OnTapped = func() { // 下一个上传
+			l.UploadNext(item)
+		}
+		pinBtn.Show()
+		pinBtn.Importance = widget.MediumImportance
+		if item.pinned {
+			pinBtn.Importance = widget.HighImportance
+		}
+		pinBtn.OnTapped = func() { // 置顶或取消置顶
+			l.Pin(item, !item.pinned)
+		}
+		pinBtn.Refresh()
+	}
+
+	pauseBtn := c.Objects[5].(*widget.Button)
+	pauseBtn.Hide()
+	switch item.state {
+	case consts.UploadStatusWaitUploaded, consts.UploadStatusUploading:
+		pauseBtn.Show()
+		pauseBtn.SetIcon(theme.MediaPauseIcon())
+		pauseBtn.OnTapped = func() { // 暂停
+			l.Pause(item)
+		}
+	case consts.UploadStatusPaused:
+		pauseBtn.Show()
+		pauseBtn.SetIcon(theme.MediaPlayIcon())
+		pauseBtn.OnTapped = func() { // 继续上传
+			ctx, cancelFunc := context.WithTimeout(util.NewContext(), 5*time.Second)
+			defer cancelFunc()
+			if !l.Resume(ctx, item) {
+				ui_util.ShowErrorDialog("继续上传失败", l.window)
+			}
+		}
+	}
+
+	retryBtn := c.Objects[6].(*widget.Button)
 	retryBtn.Hide()
 	if item.state == consts.UploadStatusFail {
 		retryBtn.Show()
 		retryBtn.OnTapped = func() { // 点击重试按钮
-			ctx := util.NewContext()
-			item.WithContext(ctx)                              // 更新上下文
-			item.UploadStatus(consts.UploadStatusWaitUploaded) //更新进度和状态
-			select {
-			case l.waitQueue <- item:
-			case <-time.NewTimer(5 * time.Second).C:
+			ctx, cancelFunc := context.WithTimeout(util.NewContext(), 5*time.Second)
+			defer cancelFunc()
+			if !l.requeue(ctx, item) {
 				ui_util.ShowErrorDialog("重试失败", l.window)
 			}
 		}
 	}
-	c.Objects[4].(*widget.Button).OnTapped = func() {
+	logBtn := c.Objects[7].(*widget.Button)
+	logBtn.Hide()
+	if item.state == consts.UploadStatusFail && ShowLog != nil {
+		logBtn.Show()
+		logBtn.OnTapped = func() { // 查看这次上传的日志
+			ShowLog(util.TraceId(item.ctx))
+		}
+	}
+	c.Objects[8].(*widget.Button).OnTapped = func() {
 		item.Cancel()
 		l.removeItem(item)
+		l.removePersisted(item)
 	}
 }
 
@@ -117,11 +198,161 @@ func (l *UploadList) removeItem(item *UploadItem) {
 		}
 	}
 	// 移除指定的item
-	if index > 0 {
+	if index >= 0 {
 		l.items = append(l.items[:index], l.items[index+1:]...)
 	}
 }
 
+// UploadNext 将等待中的item设置为下一个上传，并在列表中移到最前面
+func (l *UploadList) UploadNext(item *UploadItem) {
+	l.waitQueue.UploadNext(item)
+	l.moveToTop(item)
+}
+
+// Pin 置顶或取消置顶等待中的item，置顶的item总是优先上传
+func (l *UploadList) Pin(item *UploadItem, pinned bool) {
+	l.waitQueue.Pin(item, pinned)
+	if pinned {
+		l.moveToTop(item)
+	}
+	l.Refresh()
+}
+
+// moveToTop 在列表中把item移到最前面
+func (l *UploadList) moveToTop(item *UploadItem) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	newItems := make([]*UploadItem, 0, len(l.items))
+	newItems = append(newItems, item)
+	for _, i := range l.items {
+		if i == item {
+			continue
+		}
+		newItems = append(newItems, i)
+	}
+	l.items = newItems
+}
+
+// Pause 暂停item
+func (l *UploadList) Pause(item *UploadItem) {
+	if item.Pause(false) {
+		l.Refresh()
+	}
+}
+
+// Resume 继续上传暂停的item
+func (l *UploadList) Resume(ctx context.Context, item *UploadItem) bool {
+	if item.state != consts.UploadStatusPaused {
+		return true
+	}
+	item.pausedByAll = false
+	return l.requeue(ctx, item)
+}
+
+// PauseAll 全部暂停，正在上传的文件暂停，等待上传的文件不再开始上传
+// until为零值时需要手动全部继续，否则到时间后自动全部继续
+func (l *UploadList) PauseAll(until time.Time) {
+	text := "已全部暂停"
+	if !until.IsZero() {
+		text = fmt.Sprintf("已全部暂停至 %s", until.Format("01-02 15:04"))
+	}
+	l.pauseAll(until, text)
+}
+
+// PauseForSpaceFull 网盘空间不足时全部暂停，清理空间后手动全部继续
+func (l *UploadList) PauseForSpaceFull() {
+	if !l.Paused() { // 同时上传的多个文件都会遇到空间不足，只通知一次
+		notification.Send(util.NewContext(), consts.EventQuotaFull, "百度网盘空间已满", "已全部暂停上传，清理空间后点击全部继续")
+	}
+	l.pauseAll(time.Time{}, "网盘空间已满，已全部暂停，清理空间后点击全部继续")
+}
+
+// Paused 是否全部暂停
+func (l *UploadList) Paused() bool {
+	l.pauseLock.Lock()
+	defer l.pauseLock.Unlock()
+	return l.paused
+}
+
+// Counts 正在上传和等待上传的文件数
+func (l *UploadList) Counts() (uploading, waiting int) {
+	l.lock.RLock()
+	uploading = len(l.uploadingItems)
+	l.lock.RUnlock()
+	return uploading, l.waitQueue.Len()
+}
+
+func (l *UploadList) pauseAll(until time.Time, text string) {
+	l.pauseLock.Lock()
+	if l.resumeTimer != nil {
+		l.resumeTimer.Stop()
+		l.resumeTimer = nil
+	}
+	if !l.paused {
+		l.paused = true
+		l.running = make(chan struct{})
+	}
+	if !until.IsZero() {
+		l.resumeTimer = time.AfterFunc(time.Until(until), l.ResumeAll)
+	}
+	l.pauseText.Set(text)
+	l.pauseLock.Unlock()
+
+	l.lock.RLock()
+	uploadingItems := make([]*UploadItem, len(l.uploadingItems))
+	copy(uploadingItems, l.uploadingItems)
+	l.lock.RUnlock()
+
+	for _, item := range uploadingItems {
+		item.Pause(true)
+	}
+	logger.Logger.WithField("until", until).WithField("paused_count", len(uploadingItems)).Info("pause all upload")
+	l.Refresh()
+}
+
+// ResumeAll 全部继续，只恢复因为全部暂停而暂停的文件
+func (l *UploadList) ResumeAll() {
+	l.pauseLock.Lock()
+	if !l.paused {
+		l.pauseLock.Unlock()
+		return
+	}
+	if l.resumeTimer != nil {
+		l.resumeTimer.Stop()
+		l.resumeTimer = nil
+	}
+	l.paused = false
+	close(l.running)
+	l.pauseText.Set("")
+	l.pauseLock.Unlock()
+
+	l.lock.RLock()
+	var pausedItems []*UploadItem
+	for _, item := range l.items {
+		if item.state == consts.UploadStatusPaused && item.pausedByAll {
+			pausedItems = append(pausedItems, item)
+		}
+	}
+	l.lock.RUnlock()
+
+	ctx := util.NewContext()
+	logger.Logger.WithContext(ctx).WithField("resume_count", len(pausedItems)).Info("resume all upload")
+	go func() {
+		for _, item := range pausedItems {
+			l.Resume(ctx, item)
+		}
+	}()
+}
+
+// waitRunning 全部暂停时阻塞，直到全部继续
+func (l *UploadList) waitRunning() {
+	l.pauseLock.Lock()
+	running := l.running
+	l.pauseLock.Unlock()
+	<-running
+}
+
 // 清理指定状态的item
 func (l *UploadList) CleanItem(state int) {
 	l.lock.Lock()
@@ -164,11 +395,7 @@ func (l *UploadList) RetryAll() *context.CancelFunc {
 			if item.state != consts.UploadStatusFail {
 				continue
 			}
-			item.WithContext(util.NewContext())                // 更新上下文
-			item.UploadStatus(consts.UploadStatusWaitUploaded) //更新进度和状态
-			select {
-			case l.waitQueue <- item:
-			case <-ctx.Done():
+			if !l.requeue(ctx, item) {
 				return
 			}
 		}
@@ -211,7 +438,7 @@ func (l *UploadList) AddItem(ctx context.Context, item *UploadItem) {
 	var exists = false
 	for _, i := range l.items {
 		if i.path == item.path {
-			if i.state == consts.UploadStatusWaitUploaded || i.state == consts.UploadStatusUploading { // 判断状态是否为等待上传
+			if i.state == consts.UploadStatusWaitUploaded || i.state == consts.UploadStatusUploading || i.state == consts.UploadStatusPaused { // 判断状态是否为等待上传
 				exists = true
 			}
 			break
@@ -220,15 +447,19 @@ func (l *UploadList) AddItem(ctx context.Context, item *UploadItem) {
 	l.lock.Unlock() // 不使用defer，尽可能减少锁住的时间
 
 	if !exists {
-		select {
-		case l.waitQueue <- item: // 添加item到等待队列中
-			l.lock.Lock()
-			l.items = append(l.items, item) // 添加item
-			l.lock.Unlock()
-		case <-ctx.Done(): // 取消上传
+		item.recorder.UploadStart() // 先计数，防止item上传结束得比入队计数更早
+		l.persistItem(item)
+		if !l.waitQueue.Push(ctx, item) { // 取消上传
 			logger.Logger.WithContext(ctx).WithField("item", item).Info("cancel add item")
+			l.removePersisted(item)
+			item.finishRecord(func(recorder *statistics.RunRecorder) {
+				recorder.UploadCancel()
+			})
 			return
 		}
+		l.lock.Lock()
+		l.items = append(l.items, item) // 添加item
+		l.lock.Unlock()
 	}
 }
 
@@ -253,17 +484,19 @@ func (l *UploadList) addSignal(count int) {
 func (l *UploadList) upload() {
 	// 从waitQueue中获取item，添加到uploadingQueue队列中
 	for {
-		select {
-		// 从等待队列中获取上传队列的任务
-		case item := <-l.waitQueue:
-			// 如果item的状态已经不是待上传了，掠过
-			if item.state == consts.UploadStatusWaitUploaded {
-				<-l.uploadingSignal                               // 控制上传个数
-				l.uploadingItems = append(l.uploadingItems, item) // 存储上传的item
-				fmt.Println(item)
-				go item.Upload() // 开始上传
-			}
+		// 先拿到上传名额再出队，保证出队时按最新的优先级选择
+		<-l.uploadingSignal // 控制上传个数
+		l.waitRunning()     // 全部暂停时不再开始新的上传
+		item := l.waitQueue.Pop()
+		// 如果item的状态已经不是待上传了，掠过
+		if item.state != consts.UploadStatusWaitUploaded {
+			l.uploadingSignal <- struct{}{}
+			continue
 		}
+		l.lock.Lock()
+		l.uploadingItems = append(l.uploadingItems, item) // 存储上传的item
+		l.lock.Unlock()
+		go item.Upload() // 开始上传
 	}
 }
 
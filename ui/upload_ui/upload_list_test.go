@@ -0,0 +1,53 @@
+package upload_ui
+
+import (
+	"testing"
+)
+
+func TestUploadList_removeItem(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove int
+		want   []string
+	}{
+		{name: "head", remove: 0, want: []string{"b", "c"}},
+		{name: "middle", remove: 1, want: []string{"a", "c"}},
+		{name: "tail", remove: 2, want: []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &UploadList{}
+			for _, path := range []string{"a", "b", "c"} {
+				l.items = append(l.items, &UploadItem{path: path})
+			}
+			l.removeItem(l.items[tt.remove])
+			var got []string
+			for _, item := range l.items {
+				got = append(got, item.path)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("removeItem() items = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("removeItem() items = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadList_removePinnedItem(t *testing.T) {
+	l := &UploadList{waitQueue: newWaitQueue(3)}
+	for _, path := range []string{"a", "b", "c"} {
+		l.items = append(l.items, &UploadItem{path: path})
+	}
+	pinned := l.items[2]
+	l.moveToTop(pinned)
+	l.removeItem(pinned)
+	for _, item := range l.items {
+		if item == pinned {
+			t.Fatalf("removeItem() pinned item is still in the list")
+		}
+	}
+}
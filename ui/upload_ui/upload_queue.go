@@ -0,0 +1,260 @@
+package upload_ui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"backup/consts"
+	"backup/internal/dao"
+	"backup/internal/model"
+	"backup/internal/notification"
+	"backup/internal/statistics"
+	"backup/pkg/database"
+	"backup/pkg/logger"
+	"backup/pkg/pcs_client"
+	"backup/pkg/util"
+)
+
+const (
+	retryCheckInterval = 30 * time.Second // 检查失败文件是否需要自动重试的间隔
+	retryBaseInterval  = time.Minute      // 自动重试的基础间隔，按失败次数的平方递增
+)
+
+// 上传队列的持久化，队列中的记录在上传成功或者取消后删除
+
+// persistItem 记录入队
+func (l *UploadList) persistItem(item *UploadItem) {
+	err := dao.NewUploadQueueDao(item.ctx, database.DB).Add(&model.UploadQueue{
+		AbsPath:    item.path,
+		ServerPath: item.serverPath,
+		State:      consts.UploadStatusWaitUploaded,
+		Compress:   item.compress,
+		Mode:       item.mode,
+		Priority:   item.priority,
+	})
+	if err != nil {
+		logger.Logger.WithContext(item.ctx).WithField("path", item.path).WithError(err).Warn("persist upload item fail")
+	}
+}
+
+// persistState 更新记录的状态
+func (l *UploadList) persistState(item *UploadItem, state int) {
+	err := dao.NewUploadQueueDao(item.ctx, database.DB).Update(map[string]interface{}{
+		"state": state,
+	}, item.path)
+	if err != nil {
+		logger.Logger.WithContext(item.ctx).WithField("path", item.path).WithField("state", state).WithError(err).Warn("update upload queue state fail")
+	}
+}
+
+// persistFail 记录失败原因，并计算下一次自动重试的时间
+func (l *UploadList) persistFail(item *UploadItem, uploadErr error) {
+	queueDao := dao.NewUploadQueueDao(item.ctx, database.DB)
+	var attempts int
+	if record, err := queueDao.QueryByAbsPath(item.path); err == nil {
+		attempts = record.Attempts
+	}
+	attempts++
+
+	nextRetryTime := time.Now().Add(time.Duration(attempts*attempts) * retryBaseInterval)
+	var lastError string
+	if uploadErr != nil {
+		lastError = uploadErr.Error()
+	}
+	err := queueDao.Fail(item.path, lastError, &nextRetryTime)
+	if err != nil {
+		logger.Logger.WithContext(item.ctx).WithField("path", item.path).WithError(err).Warn("persist upload fail state fail")
+	}
+	if attempts == consts.MaxQueueRetryCount { // 达到最大重试次数后不再自动重试，需要提醒用户
+		notification.Send(item.ctx, consts.EventUploadFail, "文件多次上传失败", fmt.Sprintf("%s：已经失败%d次，不再自动重试。%s", item.path, attempts, lastError))
+	}
+}
+
+// persistUploadState 记录分片上传的进度，用于暂停或者程序退出后继续上传
+func (l *UploadList) persistUploadState(item *UploadItem, state *pcs_client.UploadState) {
+	if state != item.uploadState { // 已经重新开始上传，旧的进度不再保存
+		return
+	}
+	blockList, _ := jsoniter.MarshalToString(state.BlockList())
+	completedParts, _ := jsoniter.MarshalToString(state.CompletedParts())
+	err := dao.NewUploadQueueDao(item.ctx, database.DB).SaveUploadState(item.path, state.UploadId(), blockList, completedParts)
+	if err != nil {
+		logger.Logger.WithContext(item.ctx).WithField("path", item.path).WithError(err).Warn("persist upload state fail")
+	}
+}
+
+// persistPause 记录暂停状态，全部暂停的item记录为等待上传，程序重启后会自动继续上传
+func (l *UploadList) persistPause(item *UploadItem) {
+	state := consts.UploadStatusPaused
+	if item.pausedByAll {
+		state = consts.UploadStatusWaitUploaded
+	}
+	l.persistState(item, state)
+
+	// 暂停的文件依然在队列中，扫描时不需要重新入队
+	err := dao.NewFileInfoDao(item.ctx, database.DB).Update(map[string]interface{}{
+		"upload_status": consts.UploadStatusWaitUploaded,
+	}, item.path)
+	if err != nil {
+		logger.Logger.WithContext(item.ctx).WithField("path", item.path).WithError(err).Warn("update file info status fail")
+	}
+	// 暂停的item不再计入本次运行，继续上传后也不会计入
+	item.finishRecord(func(recorder *statistics.RunRecorder) {
+		recorder.UploadCancel()
+	})
+}
+
+// loadUploadState 从持久化的记录中恢复分片上传的进度
+func loadUploadState(record *model.UploadQueue) *pcs_client.UploadState {
+	var blockList []string
+	var completedParts []int
+	if record.UploadId == "" ||
+		jsoniter.UnmarshalFromString(record.BlockList, &blockList) != nil ||
+		jsoniter.UnmarshalFromString(record.CompletedParts, &completedParts) != nil {
+		return pcs_client.NewUploadState("", nil, nil)
+	}
+	return pcs_client.NewUploadState(record.UploadId, blockList, completedParts)
+}
+
+// removePersisted 上传成功或取消后从持久化队列中删除
+func (l *UploadList) removePersisted(item *UploadItem) {
+	err := dao.NewUploadQueueDao(item.ctx, database.DB).Delete(item.path)
+	if err != nil {
+		logger.Logger.WithContext(item.ctx).WithField("path", item.path).WithError(err).Warn("delete upload queue fail")
+	}
+}
+
+// recoverQueue 程序启动时恢复上次中断的上传队列
+// 1. 等待上传和上传中的记录按原来的顺序重新入队
+// 2. 失败的记录展示在列表中，由自动重试或手动重试处理，暂停的记录展示在列表中，由手动继续上传处理
+// 3. 不在队列中却处于等待上传、上传中状态的文件重置为未上传，下次扫描时会重新入队
+func (l *UploadList) recoverQueue() {
+	ctx := util.NewContext()
+	baseLogger := logger.Logger.WithContext(ctx)
+
+	records, err := dao.NewUploadQueueDao(ctx, database.DB).QueryAll()
+	if err != nil {
+		baseLogger.WithError(err).Error("recover upload queue fail")
+		return
+	}
+
+	var waitItems, pausedItems []*UploadItem
+	l.lock.Lock()
+	for _, record := range records {
+		item := NewUploadItem(record.AbsPath, record.ServerPath, l).WithUploadState(loadUploadState(record)).WithCompress(record.Compress).WithMode(record.Mode).WithPriority(record.Priority)
+		switch record.State {
+		case consts.UploadStatusFail:
+			item.UploadStatus(consts.UploadStatusFail)
+		case consts.UploadStatusPaused:
+			item.UploadStatus(consts.UploadStatusPaused)
+			pausedItems = append(pausedItems, item)
+		default:
+			waitItems = append(waitItems, item)
+		}
+		l.items = append(l.items, item)
+	}
+	l.lock.Unlock()
+
+	// 先把所有中间状态重置，再把队列中的文件标记为等待上传
+	fileInfoDao := dao.NewFileInfoDao(ctx, database.DB)
+	lost, err := fileInfoDao.ResetStatus(consts.UploadStatusUploading, consts.UploadStatusWaitUploaded)
+	if err == nil && lost > 0 {
+		baseLogger.WithField("count", lost).Info("reset interrupted file status")
+	}
+	for _, item := range append(waitItems, pausedItems...) {
+		err := fileInfoDao.Update(map[string]interface{}{
+			"upload_status": consts.UploadStatusWaitUploaded,
+		}, item.path)
+		if err != nil {
+			baseLogger.WithField("path", item.path).WithError(err).Warn("update file info status fail")
+		}
+	}
+
+	for _, item := range waitItems {
+		l.persistState(item, consts.UploadStatusWaitUploaded)
+		l.waitQueue.Push(context.Background(), item) // 按原来的顺序入队
+	}
+	baseLogger.WithField("wait_count", len(waitItems)).WithField("total", len(records)).Info("recover upload queue success")
+}
+
+// retryLoop 定时将到了重试时间的失败文件重新入队
+func (l *UploadList) retryLoop() {
+	ticker := time.NewTicker(retryCheckInterval)
+	for {
+		select {
+		case <-ticker.C:
+			l.retryDue()
+		}
+	}
+}
+
+func (l *UploadList) retryDue() {
+	ctx := util.NewContext()
+	records, err := dao.NewUploadQueueDao(ctx, database.DB).QueryDueRetry(time.Now(), consts.MaxQueueRetryCount)
+	if err != nil {
+		return
+	}
+
+	for _, record := range records {
+		l.lock.RLock()
+		var item *UploadItem
+		for _, i := range l.items {
+			if i.path == record.AbsPath {
+				item = i
+				break
+			}
+		}
+		l.lock.RUnlock()
+
+		if item == nil || item.state != consts.UploadStatusFail {
+			continue
+		}
+		logger.Logger.WithContext(ctx).WithField("path", record.AbsPath).WithField("attempts", record.Attempts).Info("auto retry upload")
+		l.requeue(ctx, item)
+	}
+}
+
+// deferItem 文件还在修改，释放上传名额，等待一段时间后重新入队
+// 本次运行不再等待这个item，重新入队后的上传不计入统计
+func (l *UploadList) deferItem(item *UploadItem, wait time.Duration) {
+	item.finishRecord(func(recorder *statistics.RunRecorder) {
+		recorder.UploadCancel()
+	})
+	l.release(item)
+	if _, ok := item.compareAndSwapState(consts.UploadStatusWaitUploaded, consts.UploadStatusUploading); !ok {
+		if item.state == consts.UploadStatusPaused { // 开始上传后被暂停，按上传中处理，需要在这里记录暂停
+			l.persistPause(item)
+		}
+		return
+	}
+	l.persistState(item, consts.UploadStatusWaitUploaded)
+	item.progress = consts.WaitQuietText
+	time.AfterFunc(wait, func() {
+		if item.state != consts.UploadStatusWaitUploaded { // 等待期间被取消或暂停
+			return
+		}
+		l.waitQueue.Push(item.ctx, item)
+	})
+}
+
+// requeue 失败或者暂停的item重新入队，入队失败时恢复原来的状态，防止item停留在等待状态
+// 入队后可能立即开始上传，状态需要在入队前修改
+func (l *UploadList) requeue(ctx context.Context, item *UploadItem) bool {
+	oldCtx, oldCancel, oldState, oldProgress := item.ctx, item.cancelFunc, item.state, item.progress
+	item.WithContext(util.NewContext())                // 更新上下文
+	item.UploadStatus(consts.UploadStatusWaitUploaded) //更新进度和状态
+	l.persistState(item, consts.UploadStatusWaitUploaded)
+	if l.waitQueue.Push(ctx, item) {
+		return true
+	}
+	item.cancelFunc()
+	item.ctx, item.cancelFunc = oldCtx, oldCancel // 保留原来的trace_id，可以继续查看失败的日志
+	item.UploadStatus(oldState)
+	item.progress = oldProgress
+	l.persistState(item, oldState)
+	l.Refresh()
+	return false
+}
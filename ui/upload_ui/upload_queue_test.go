@@ -0,0 +1,93 @@
+package upload_ui
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"backup/consts"
+	"backup/pkg/util"
+)
+
+func TestUploadList_RequeueFull(t *testing.T) {
+	l := &UploadList{waitQueue: newWaitQueue(1)}
+	l.waitQueue.Push(context.Background(), &UploadItem{path: "a"})
+
+	item := &UploadItem{path: "b"}
+	item.WithContext(util.NewContext())
+	item.UploadStatus(consts.UploadStatusFail)
+	item.progress = "upload fail"
+	traceId := util.TraceId(item.ctx)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if l.requeue(ctx, item) {
+		t.Fatalf("requeue() to full queue = true, want false")
+	}
+	if item.state != consts.UploadStatusFail || item.progress != "upload fail" {
+		t.Errorf("requeue() state = %d, %s, want %d, upload fail", item.state, item.progress, consts.UploadStatusFail)
+	}
+	if got := util.TraceId(item.ctx); got != traceId {
+		t.Errorf("requeue() trace_id = %s, want %s", got, traceId)
+	}
+}
+
+func TestUploadList_PauseResume(t *testing.T) {
+	l := &UploadList{waitQueue: newWaitQueue(2)}
+	item := &UploadItem{path: "a", list: l}
+	item.WithContext(util.NewContext())
+	item.UploadStatus(consts.UploadStatusWaitUploaded)
+	l.waitQueue.Push(context.Background(), item)
+
+	if !item.Pause(false) {
+		t.Fatalf("Pause() = false, want true")
+	}
+	if got := l.waitQueue.Len(); got != 0 {
+		t.Fatalf("Pause() queue len = %d, want 0", got)
+	}
+	if !l.Resume(context.Background(), item) {
+		t.Fatalf("Resume() = false, want true")
+	}
+	// 重复入队不会生效
+	l.waitQueue.Push(context.Background(), item)
+
+	if got := l.waitQueue.Pop(); got != item {
+		t.Fatalf("Pop() = %v, want %v", got, item)
+	}
+	popped := make(chan *UploadItem, 1)
+	go func() {
+		popped <- l.waitQueue.Pop()
+	}()
+	select {
+	case got := <-popped:
+		t.Fatalf("second Pop() = %v, want blocked", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 只有一个上传协程可以切换到上传中
+	if _, ok := item.compareAndSwapState(consts.UploadStatusUploading, consts.UploadStatusWaitUploaded); !ok {
+		t.Fatalf("first claim fail, state = %d", item.state)
+	}
+	if _, ok := item.compareAndSwapState(consts.UploadStatusUploading, consts.UploadStatusWaitUploaded); ok {
+		t.Errorf("second claim succeed, want fail")
+	}
+}
+
+func TestUploadList_recoverPriority(t *testing.T) {
+	l := &UploadList{waitQueue: newWaitQueue(100)}
+	item := NewUploadItem("/recover_test/a.txt", "/apps/backup/recover_test/a.txt", l).WithPriority(consts.BackupPriorityHigh)
+	l.persistItem(item)
+	defer l.removePersisted(item)
+
+	recovered := &UploadList{waitQueue: newWaitQueue(100)}
+	recovered.recoverQueue()
+	for _, v := range recovered.items {
+		if v.path == item.path {
+			if v.priority != consts.BackupPriorityHigh {
+				t.Errorf("recoverQueue() priority = %d, want %d", v.priority, consts.BackupPriorityHigh)
+			}
+			return
+		}
+	}
+	t.Errorf("recoverQueue() missing %s", item.path)
+}
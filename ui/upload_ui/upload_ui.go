@@ -2,9 +2,11 @@ package upload_ui
 
 import (
 	"context"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
@@ -15,10 +17,23 @@ import (
 var ExportUploadList *UploadList
 var retryCancelFunc *context.CancelFunc
 
+// ShowLog 跳转到日志页查看trace的日志，由ui包在创建日志页后设置
+var ShowLog func(traceId string)
+
 func NewUploadTabItem(window fyne.Window) *container.TabItem {
 	ExportUploadList = NewUploadList(window)
 	return container.NewTabItemWithIcon("上传", theme.SettingsIcon(),
-		container.NewBorder(container.New(layout.NewHBoxLayout(), layout.NewSpacer(), &widget.Button{
+		container.NewBorder(container.New(layout.NewHBoxLayout(), widget.NewLabelWithData(ExportUploadList.pauseText), layout.NewSpacer(), &widget.Button{
+			Text: "全部暂停",
+			OnTapped: func() {
+				showPauseAllDialog(window)
+			},
+		}, &widget.Button{
+			Text: "全部继续",
+			OnTapped: func() {
+				ExportUploadList.ResumeAll()
+			},
+		}, &widget.Button{
 			Text: "清除上传成功",
 			OnTapped: func() {
 				ExportUploadList.CleanItem(consts.UploadStatusUploaded)
@@ -38,3 +53,32 @@ func NewUploadTabItem(window fyne.Window) *container.TabItem {
 			},
 		}), nil, nil, nil, container.NewVScroll(ExportUploadList)))
 }
+
+// 全部暂停的时长选项，0表示直到手动继续
+var pauseDurations = map[string]time.Duration{
+	"30分钟":   30 * time.Minute,
+	"1小时":    time.Hour,
+	"2小时":    2 * time.Hour,
+	"4小时":    4 * time.Hour,
+	"直到手动继续": 0,
+}
+
+var pauseOptions = []string{"30分钟", "1小时", "2小时", "4小时", "直到手动继续"}
+
+func showPauseAllDialog(window fyne.Window) {
+	durationSelect := widget.NewSelect(pauseOptions, nil)
+	durationSelect.SetSelected(pauseOptions[1])
+	dialog.ShowCustomConfirm("全部暂停", "确认", "取消", container.NewVBox(
+		widget.NewLabel("正在上传的文件会在当前分片完成后暂停，到时间后自动继续上传"),
+		durationSelect,
+	), func(ok bool) {
+		if !ok {
+			return
+		}
+		var until time.Time
+		if duration := pauseDurations[durationSelect.Selected]; duration > 0 {
+			until = time.Now().Add(duration)
+		}
+		ExportUploadList.PauseAll(until)
+	}, window)
+}
@@ -0,0 +1,198 @@
+package upload_ui
+
+import (
+	"context"
+	"sync"
+
+	"backup/consts"
+	"backup/internal/config"
+)
+
+const waitQueueSize = 1000 // 等待队列的容量，满了之后入队会阻塞
+
+// waitQueue 等待上传的队列，出队时按排序策略选出下一个上传的item
+// 排序规则依次为：置顶 > 下一个上传 > 备份路径优先级 > 排序策略 > 入队顺序
+type waitQueue struct {
+	lock  sync.Mutex
+	items []*UploadItem
+	size  int
+
+	seq       uint64 // 入队序号
+	nextSeq   uint64 // "下一个上传"的序号，越大越优先
+	lastLarge bool   // 上一次出队的是否是大文件，用于交替上传大小文件
+
+	notEmpty chan struct{} // 有新的item入队
+	notFull  chan struct{} // 有item出队
+
+	order      func() string // 排序策略
+	interleave func() bool   // 是否交替上传大小文件
+	threshold  func() int64  // 大文件阈值
+}
+
+func newWaitQueue(size int) *waitQueue {
+	return &waitQueue{
+		size:       size,
+		notEmpty:   make(chan struct{}, 1),
+		notFull:    make(chan struct{}, 1),
+		order:      config.GetUploadOrder,
+		interleave: config.GetUploadInterleave,
+		threshold:  config.GetLargeFileThreshold,
+	}
+}
+
+// Push 入队，队列满时阻塞，ctx取消时返回false，已经在队列中的item不会重复入队
+func (q *waitQueue) Push(ctx context.Context, item *UploadItem) bool {
+	for {
+		q.lock.Lock()
+		if q.index(item) >= 0 {
+			q.lock.Unlock()
+			return true
+		}
+		if len(q.items) < q.size {
+			q.seq++
+			item.seq = q.seq
+			q.items = append(q.items, item)
+			q.lock.Unlock()
+			notify(q.notEmpty)
+			return true
+		}
+		q.lock.Unlock()
+
+		select {
+		case <-q.notFull:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Pop 出队，队列为空时阻塞
+func (q *waitQueue) Pop() *UploadItem {
+	for {
+		q.lock.Lock()
+		if len(q.items) > 0 {
+			index := q.pick()
+			item := q.items[index]
+			item.nextSeq = 0 // "下一个上传"只生效一次
+			q.items = append(q.items[:index], q.items[index+1:]...)
+			q.lastLarge = item.size >= q.threshold()
+			if len(q.items) > 0 { // 还有剩余，继续唤醒
+				notify(q.notEmpty)
+			}
+			q.lock.Unlock()
+			notify(q.notFull)
+			return item
+		}
+		q.lock.Unlock()
+
+		<-q.notEmpty
+	}
+}
+
+// Remove 移除还没有出队的item，暂停时调用，返回item是否在队列中
+func (q *waitQueue) Remove(item *UploadItem) bool {
+	q.lock.Lock()
+	index := q.index(item)
+	if index < 0 {
+		q.lock.Unlock()
+		return false
+	}
+	q.items = append(q.items[:index], q.items[index+1:]...)
+	q.lock.Unlock()
+	notify(q.notFull)
+	return true
+}
+
+// index item在队列中的下标，不在队列中时返回-1，调用方需要持有锁
+func (q *waitQueue) index(item *UploadItem) int {
+	for i, queued := range q.items {
+		if queued == item {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *waitQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.items)
+}
+
+// UploadNext 将item设置为下一个上传
+func (q *waitQueue) UploadNext(item *UploadItem) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.nextSeq++
+	item.nextSeq = q.nextSeq
+}
+
+// Pin 置顶或取消置顶item
+func (q *waitQueue) Pin(item *UploadItem, pinned bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	item.pinned = pinned
+}
+
+// pick 选出下一个出队的下标，调用方需要持有锁
+func (q *waitQueue) pick() int {
+	order := q.order()
+	best := 0
+	for i := 1; i < len(q.items); i++ {
+		if q.less(q.items[i], q.items[best], order) {
+			best = i
+		}
+	}
+
+	bestItem := q.items[best]
+	if !q.interleave() || bestItem.pinned || bestItem.nextSeq > 0 {
+		return best
+	}
+
+	// 交替上传：上一次是大文件，这次优先取同优先级中的小文件，反之亦然
+	threshold := q.threshold()
+	alternative := -1
+	for i, item := range q.items {
+		if (item.size >= threshold) == q.lastLarge || item.priority != bestItem.priority {
+			continue
+		}
+		if alternative == -1 || q.less(item, q.items[alternative], order) {
+			alternative = i
+		}
+	}
+	if alternative != -1 {
+		return alternative
+	}
+	return best
+}
+
+// less a是否比b更优先上传
+func (q *waitQueue) less(a, b *UploadItem, order string) bool {
+	if a.pinned != b.pinned {
+		return a.pinned
+	}
+	if a.nextSeq != b.nextSeq {
+		return a.nextSeq > b.nextSeq
+	}
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	switch order {
+	case consts.UploadOrderSmallest:
+		if a.size != b.size {
+			return a.size < b.size
+		}
+	case consts.UploadOrderNewest:
+		if !a.modTime.Equal(b.modTime) {
+			return a.modTime.After(b.modTime)
+		}
+	}
+	return a.seq < b.seq
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
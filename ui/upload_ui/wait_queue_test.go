@@ -0,0 +1,99 @@
+package upload_ui
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"backup/consts"
+)
+
+func Test_waitQueue_Pop(t *testing.T) {
+	now := time.Now()
+	newItems := func() []*UploadItem {
+		return []*UploadItem{
+			{path: "a", size: 300, modTime: now.Add(-3 * time.Hour)},
+			{path: "b", size: 100, modTime: now.Add(-1 * time.Hour)},
+			{path: "c", size: 200, modTime: now.Add(-2 * time.Hour), priority: consts.BackupPriorityHigh},
+			{path: "d", size: 50, modTime: now},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		order      string
+		interleave bool
+		prepare    func(q *waitQueue, items []*UploadItem)
+		want       []string
+	}{
+		{
+			name:  "fifo",
+			order: consts.UploadOrderFIFO,
+			want:  []string{"c", "a", "b", "d"},
+		},
+		{
+			name:  "smallest",
+			order: consts.UploadOrderSmallest,
+			want:  []string{"c", "d", "b", "a"},
+		},
+		{
+			name:  "newest",
+			order: consts.UploadOrderNewest,
+			want:  []string{"c", "d", "b", "a"},
+		},
+		{
+			name:  "pinAndUploadNext",
+			order: consts.UploadOrderFIFO,
+			prepare: func(q *waitQueue, items []*UploadItem) {
+				q.UploadNext(items[1])
+				q.Pin(items[3], true)
+			},
+			want: []string{"d", "b", "c", "a"},
+		},
+		{
+			name:       "interleave",
+			order:      consts.UploadOrderSmallest,
+			interleave: true,
+			prepare: func(q *waitQueue, items []*UploadItem) {
+				items[2].priority = consts.BackupPriorityNormal
+			},
+			want: []string{"c", "d", "a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newWaitQueue(10)
+			q.order = func() string { return tt.order }
+			q.interleave = func() bool { return tt.interleave }
+			q.threshold = func() int64 { return 150 }
+
+			items := newItems()
+			if tt.prepare != nil {
+				tt.prepare(q, items)
+			}
+			for _, item := range items {
+				q.Push(context.Background(), item)
+			}
+
+			var got []string
+			for q.Len() > 0 {
+				got = append(got, q.Pop().path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pop() order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_waitQueue_PushFull(t *testing.T) {
+	q := newWaitQueue(1)
+	q.Push(context.Background(), &UploadItem{path: "a"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if q.Push(ctx, &UploadItem{path: "b"}) {
+		t.Errorf("Push() to full queue = true, want false")
+	}
+}
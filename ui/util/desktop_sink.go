@@ -0,0 +1,23 @@
+package util
+
+import (
+	"context"
+
+	"fyne.io/fyne/v2"
+
+	"backup/internal/notification"
+)
+
+// DesktopSink 通过系统的桌面通知提醒用户
+type DesktopSink struct{}
+
+func (DesktopSink) Name() string {
+	return "desktop"
+}
+
+func (DesktopSink) Send(_ context.Context, event *notification.Event) error {
+	if app := fyne.CurrentApp(); app != nil {
+		app.SendNotification(fyne.NewNotification(event.Title, event.Content))
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"errors"
+	"fmt"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/dialog"
@@ -19,3 +20,17 @@ func ShowErrorDialog(errmsg string, window fyne.Window) {
 func ShowInfoDialog(info string, window fyne.Window) {
 	dialog.NewInformation("Info", info, window).Show()
 }
+
+// FormatSize 将字节数格式化为便于阅读的大小
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}